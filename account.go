@@ -3,12 +3,14 @@ package oanda
 import (
 	"github.com/kamaiu/oanda-go/model"
 	"sync"
+	"time"
 )
 
 type Account struct {
 	props   *model.AccountProperties
 	details *model.Account
 	err     error
+	updated time.Time
 	mu      sync.RWMutex
 }
 
@@ -18,3 +20,57 @@ func newAccount(props *model.AccountProperties, details *model.Account) *Account
 		details: details,
 	}
 }
+
+func (a *Account) ID() model.AccountID {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.props.ID
+}
+
+func (a *Account) Properties() *model.AccountProperties {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.props
+}
+
+// The most recently loaded Account details. May be nil if the Account never loaded.
+func (a *Account) Details() *model.Account {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.details
+}
+
+// The error of the most recent load attempt or nil if it succeeded.
+func (a *Account) Err() error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.err
+}
+
+// State returns the most recently loaded details together with the error of the
+// most recent load attempt. A failed refresh keeps the previous details.
+func (a *Account) State() (*model.Account, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.details, a.err
+}
+
+// The time of the last successful load.
+func (a *Account) Updated() time.Time {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.updated
+}
+
+func (a *Account) update(props *model.AccountProperties, details *model.Account, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if props != nil {
+		a.props = props
+	}
+	a.err = err
+	if err == nil && details != nil {
+		a.details = details
+		a.updated = time.Now()
+	}
+}
@@ -0,0 +1,195 @@
+// Package backtest replays stored candles or recorded prices through the simulated
+// broker of package oandatest. A strategy trades through the same endpoint.API and
+// receives the same pricing and transaction stream messages as it does live, so it
+// runs unchanged in both.
+//
+//	bt, _ := backtest.New(backtest.Config{Balance: 100000})
+//	defer bt.Close()
+//	feed, _ := backtest.Candles("EUR_USD", model.CandlestickGranularity_M1, candles, 0.0002)
+//	strategy := NewStrategy(bt.API(), bt.AccountID())
+//	err := bt.Run(feed, strategy, nil)
+//	result, _ := bt.Result()
+package backtest
+
+import (
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"time"
+)
+
+const (
+	// DefaultAccountID is the ID of the simulated Account if the Config has none.
+	DefaultAccountID model.AccountID = "101-001-1-001"
+	// DefaultCurrency is the home currency of the simulated Account if the Config has
+	// none.
+	DefaultCurrency model.Currency = "USD"
+)
+
+// Config describes the simulated Account.
+type Config struct {
+	AccountID model.AccountID
+	Currency  model.Currency
+	// Balance deposited when the Account opens.
+	Balance float64
+	// Instruments with their margin rates and financing. Instruments that are not
+	// listed trade as currency pairs with a margin rate of 0.02 and no financing.
+	Instruments []*model.Instrument
+}
+
+// Result summarizes the Account after a backtest.
+type Result struct {
+	// Number of prices replayed
+	Ticks int
+	// Time of the first and the last price
+	Start time.Time
+	End   time.Time
+	// Account at the last price
+	Account *model.AccountSummary
+	// Every Transaction of the Account
+	Transactions []*model.TransactionParser
+}
+
+// Backtest is a simulated Account with the broker behind it. The broker fills,
+// finances and closes out as described on oandatest.Server.
+type Backtest struct {
+	config Config
+	srv    *oandatest.Server
+	conn   *endpoint.Connection
+	lastTx model.TransactionID
+	ticks  int
+	start  time.Time
+	end    time.Time
+}
+
+// New opens the simulated Account.
+func New(config Config) (*Backtest, error) {
+	if len(config.AccountID) == 0 {
+		config.AccountID = DefaultAccountID
+	}
+	if len(config.Currency) == 0 {
+		config.Currency = DefaultCurrency
+	}
+	srv := oandatest.NewServer()
+	for _, instrument := range config.Instruments {
+		srv.AddInstrument(instrument)
+	}
+	srv.AddAccount(config.AccountID, config.Currency, config.Balance)
+	conn, err := endpoint.NewConnectionURL("backtest", srv.URL(), srv.URL())
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	return &Backtest{
+		config: config,
+		srv:    srv,
+		conn:   conn,
+		lastTx: "0",
+	}, nil
+}
+
+// API is the API of the simulated broker.
+func (b *Backtest) API() endpoint.API {
+	return b.conn
+}
+
+// AccountID is the ID of the simulated Account.
+func (b *Backtest) AccountID() model.AccountID {
+	return b.config.AccountID
+}
+
+// Close shuts the simulated broker down.
+func (b *Backtest) Close() {
+	b.srv.Close()
+}
+
+// Run replays the feed. Every price first fills the Orders it triggers and applies
+// the financing and margin closeouts due, then the new Transactions are passed to
+// transactions and the price to prices. Transactions created by the price handler are
+// passed on before the next price. Either handler may be nil.
+//
+// Run returns at the end of the feed or with the first error of a handler and closes
+// both handlers. It may be called again with another feed to continue the backtest.
+func (b *Backtest) Run(
+	feed Feed,
+	prices endpoint.PricingStreamHandler,
+	transactions endpoint.TxStreamHandler,
+) error {
+	defer func() {
+		if prices != nil {
+			prices.OnClose()
+		}
+		if transactions != nil {
+			transactions.OnClose()
+		}
+	}()
+	for {
+		tick, ok := feed.Next()
+		if !ok {
+			return nil
+		}
+		b.srv.Quote(tick)
+		if b.ticks == 0 {
+			b.start = tick.Time
+		}
+		b.ticks++
+		b.end = tick.Time
+
+		if err := b.deliver(transactions); err != nil {
+			return err
+		}
+		if prices != nil {
+			price, err := b.streamPrice(tick.Instrument)
+			if err != nil {
+				return err
+			}
+			if err = prices.OnMessage(price); err != nil {
+				return err
+			}
+		}
+		if err := b.deliver(transactions); err != nil {
+			return err
+		}
+	}
+}
+
+// deliver passes the Transactions created since the last call to the handler.
+func (b *Backtest) deliver(transactions endpoint.TxStreamHandler) error {
+	for _, tx := range b.srv.Transactions(b.config.AccountID, b.lastTx) {
+		b.lastTx = model.TransactionID(tx.Id)
+		if transactions == nil {
+			continue
+		}
+		if err := transactions.OnMessage(tx.Parse()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamPrice converts the current price of the instrument to the message of the
+// pricing stream.
+func (b *Backtest) streamPrice(instrument model.InstrumentName) (*model.StreamClientPrice, error) {
+	msg, err := b.srv.Price(instrument).MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	price := &model.StreamClientPrice{}
+	price.UnmarshalJSON(msg)
+	return price, nil
+}
+
+// Result returns the state of the Account after the prices replayed so far.
+func (b *Backtest) Result() (*Result, error) {
+	summary, err := b.conn.AccountSummary(b.config.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Ticks:        b.ticks,
+		Start:        b.start,
+		End:          b.end,
+		Account:      summary.Account,
+		Transactions: b.srv.Transactions(b.config.AccountID, "0"),
+	}, nil
+}
@@ -0,0 +1,186 @@
+package backtest
+
+import (
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"math"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func expectNear(t *testing.T, name string, got float64, expected float64) {
+	t.Helper()
+	if math.Abs(got-expected) > 1e-6 {
+		t.Fatalf("%s: expected %v got %v", name, expected, got)
+	}
+}
+
+func midCandle(t time.Time, o, h, l, c string) model.Candlestick {
+	return model.Candlestick{
+		Time:     model.DateTime(t.Format(time.RFC3339Nano)),
+		Mid:      &model.CandlestickData{Open: model.PriceValue(o), High: model.PriceValue(h), Low: model.PriceValue(l), Close: model.PriceValue(c)},
+		Complete: true,
+	}
+}
+
+func drain(feed Feed) []oandatest.Tick {
+	var ticks []oandatest.Tick
+	for {
+		tick, ok := feed.Next()
+		if !ok {
+			return ticks
+		}
+		ticks = append(ticks, tick)
+	}
+}
+
+func TestCandles(t *testing.T) {
+	feed, err := Candles("EUR_USD", model.CandlestickGranularity_M1, []model.Candlestick{
+		midCandle(testStart, "1.1000", "1.1010", "1.0990", "1.1005"),
+		midCandle(testStart.Add(time.Minute), "1.1005", "1.1010", "1.0990", "1.1000"),
+	}, 0.0002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticks := drain(feed)
+	if len(ticks) != 8 {
+		t.Fatalf("expected 8 ticks got %d", len(ticks))
+	}
+	// Rising candles visit the low first, falling candles the high
+	for i, mid := range []float64{1.1000, 1.0990, 1.1010, 1.1005, 1.1005, 1.1010, 1.0990, 1.1000} {
+		expectNear(t, "bid", ticks[i].Bid, mid-0.0001)
+		expectNear(t, "ask", ticks[i].Ask, mid+0.0001)
+	}
+	if !ticks[1].Time.Equal(testStart.Add(15*time.Second)) || !ticks[4].Time.Equal(testStart.Add(time.Minute)) {
+		t.Fatalf("unexpected tick times %v %v", ticks[1].Time, ticks[4].Time)
+	}
+
+	if _, err = Candles("EUR_USD", model.CandlestickGranularity_M1, []model.Candlestick{{Time: "2021-03-01T12:00:00Z"}}, 0); err == nil {
+		t.Fatal("expected an error for a candle without prices")
+	}
+}
+
+func TestTicksMerge(t *testing.T) {
+	price := func(instrument string, at time.Time, bid, ask float64) *model.StreamClientPrice {
+		return &model.StreamClientPrice{
+			Instrument: []byte(instrument),
+			Time:       at,
+			Bids:       []model.StreamPriceBucket{{Price: bid, Liquidity: 500000}},
+			Asks:       []model.StreamPriceBucket{{Price: ask, Liquidity: 250000}},
+		}
+	}
+	eur := Ticks([]*model.StreamClientPrice{
+		price("EUR_USD", testStart, 1.1, 1.1002),
+		{IsHeartbeat: true, Time: testStart.Add(time.Second)},
+		price("EUR_USD", testStart.Add(2*time.Second), 1.1001, 1.1003),
+	})
+	gbp := Ticks([]*model.StreamClientPrice{
+		price("GBP_USD", testStart.Add(time.Second), 1.3, 1.3002),
+	})
+	ticks := drain(Merge(eur, gbp))
+	if len(ticks) != 3 {
+		t.Fatalf("expected 3 ticks got %d", len(ticks))
+	}
+	for i, instrument := range []model.InstrumentName{"EUR_USD", "GBP_USD", "EUR_USD"} {
+		if ticks[i].Instrument != instrument {
+			t.Fatalf("expected %s at %d got %s", instrument, i, ticks[i].Instrument)
+		}
+	}
+	if ticks[0].Liquidity != 250000 {
+		t.Fatalf("expected the smaller liquidity got %d", ticks[0].Liquidity)
+	}
+}
+
+// trailingStrategy buys on the first price with a trailing stop.
+type trailingStrategy struct {
+	api       endpoint.API
+	accountID model.AccountID
+	prices    int
+	closed    bool
+}
+
+func (s *trailingStrategy) OnMessage(price *model.StreamClientPrice) error {
+	s.prices++
+	if s.prices > 1 {
+		return nil
+	}
+	_, _, err := s.api.OrderCreate(s.accountID, &model.MarketOrderRequest{
+		Type:                   model.OrderType_MARKET,
+		Instrument:             model.InstrumentName(price.Instrument),
+		Units:                  "10000",
+		TrailingStopLossOnFill: &model.TrailingStopLossDetails{Distance: "0.0010"},
+	})
+	return err
+}
+
+func (s *trailingStrategy) OnHeartbeat(time.Time) {}
+
+func (s *trailingStrategy) OnClose() {
+	s.closed = true
+}
+
+type fillRecorder struct {
+	fills []*model.OrderFillTransaction
+}
+
+func (r *fillRecorder) OnMessage(msg model.TransactionMessage) error {
+	if fill, ok := msg.(*model.OrderFillTransaction); ok {
+		r.fills = append(r.fills, fill)
+	}
+	return nil
+}
+
+func (r *fillRecorder) OnHeartbeat(model.DateTime, model.TransactionID) error {
+	return nil
+}
+
+func (r *fillRecorder) OnClose() {}
+
+func TestRun(t *testing.T) {
+	bt, err := New(Config{Balance: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bt.Close()
+	feed, err := Candles("EUR_USD", model.CandlestickGranularity_M1, []model.Candlestick{
+		midCandle(testStart, "1.1000", "1.1010", "1.0995", "1.1008"),
+		midCandle(testStart.Add(time.Minute), "1.1008", "1.1030", "1.1005", "1.1028"),
+		midCandle(testStart.Add(2*time.Minute), "1.1028", "1.1029", "1.1015", "1.1020"),
+	}, 0.0002)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strategy := &trailingStrategy{api: bt.API(), accountID: bt.AccountID()}
+	fills := &fillRecorder{}
+	if err = bt.Run(feed, strategy, fills); err != nil {
+		t.Fatal(err)
+	}
+	if !strategy.closed || strategy.prices != 12 {
+		t.Fatalf("expected 12 prices and the handler closed got %d %v", strategy.prices, strategy.closed)
+	}
+
+	// Bought at 1.1001, the stop trails the high of 1.1029 to 1.1019 and fills at
+	// the low of the last candle
+	if len(fills.fills) != 2 {
+		t.Fatalf("expected 2 fills got %d", len(fills.fills))
+	}
+	closing := fills.fills[1]
+	if closing.Reason != model.OrderFillReason_TRAILING_STOP_LOSS_ORDER {
+		t.Fatalf("expected the trailing stop to fill got %s", closing.Reason)
+	}
+	expectNear(t, "price", closing.Price.AsFloat64(0), 1.1014)
+	expectNear(t, "pl", model.DecimalNumber(closing.Pl).AsFloat64(0), 13)
+
+	result, err := bt.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ticks != 12 || !result.Start.Equal(testStart) || result.Account.OpenTradeCount != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	expectNear(t, "balance", model.DecimalNumber(result.Account.Balance).AsFloat64(0), 10013)
+}
@@ -0,0 +1,159 @@
+package backtest
+
+import (
+	"github.com/kamaiu/oanda-go"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"time"
+)
+
+// Feed supplies the prices of a backtest in chronological order.
+type Feed interface {
+	// Next returns the next price or false once the feed is exhausted.
+	Next() (oandatest.Tick, bool)
+}
+
+type tickFeed struct {
+	ticks []oandatest.Tick
+}
+
+func (f *tickFeed) Next() (oandatest.Tick, bool) {
+	if len(f.ticks) == 0 {
+		return oandatest.Tick{}, false
+	}
+	tick := f.ticks[0]
+	f.ticks = f.ticks[1:]
+	return tick, true
+}
+
+// Ticks replays prices recorded from the pricing stream. Heartbeats and prices
+// without a bid or an ask are skipped.
+func Ticks(prices []*model.StreamClientPrice) Feed {
+	ticks := make([]oandatest.Tick, 0, len(prices))
+	for _, p := range prices {
+		if tick, ok := oandatest.StreamTick(p); ok {
+			ticks = append(ticks, tick)
+		}
+	}
+	return &tickFeed{ticks: ticks}
+}
+
+// Indexes of the prices of a candle.
+const (
+	open = iota
+	high
+	low
+	closing
+)
+
+// Candles replays candles as four prices each, spread evenly over the candle: the
+// open, the low and the high, and the close. Rising candles visit the low first and
+// falling candles the high first. Candles with bid and ask prices are replayed as they
+// are, mid candles are widened by the spread. The candles are those of a
+// CandleStore Range or a Candles Download.
+func Candles(
+	instrument model.InstrumentName,
+	granularity model.CandlestickGranularity,
+	candles []model.Candlestick,
+	spread float64,
+) (Feed, error) {
+	d, ok := oanda.GranularityDuration(granularity)
+	if !ok {
+		return nil, oanda.ErrInvalidGranularity
+	}
+	ticks := make([]oandatest.Tick, 0, len(candles)*4)
+	for n := range candles {
+		c := &candles[n]
+		t, err := c.Time.Parse()
+		if err != nil {
+			return nil, err
+		}
+		bid, ask, err := candlePrices(c, spread)
+		if err != nil {
+			return nil, err
+		}
+		path := [4]int{open, low, high, closing}
+		if bid[closing] < bid[open] {
+			path = [4]int{open, high, low, closing}
+		}
+		for i, k := range path {
+			ticks = append(ticks, oandatest.Tick{
+				Instrument: instrument,
+				Time:       t.Add(d * time.Duration(i) / 4),
+				Bid:        bid[k],
+				Ask:        ask[k],
+			})
+		}
+	}
+	return &tickFeed{ticks: ticks}, nil
+}
+
+// candlePrices returns the open, high, low and close of the bid and of the ask.
+func candlePrices(c *model.Candlestick, spread float64) (bid [4]float64, ask [4]float64, err error) {
+	switch {
+	case c.Bid != nil && c.Ask != nil:
+		if bid, err = ohlc(c.Bid); err != nil {
+			return
+		}
+		ask, err = ohlc(c.Ask)
+	case c.Mid != nil:
+		var mid [4]float64
+		if mid, err = ohlc(c.Mid); err != nil {
+			return
+		}
+		for i := range mid {
+			bid[i] = mid[i] - spread/2
+			ask[i] = mid[i] + spread/2
+		}
+	default:
+		err = oanda.ErrCandleComponent
+	}
+	return
+}
+
+func ohlc(data *model.CandlestickData) (p [4]float64, err error) {
+	for i, v := range [4]model.PriceValue{data.Open, data.High, data.Low, data.Close} {
+		if p[i] = v.AsFloat64(0); p[i] <= 0 {
+			return p, oanda.ErrCandlePrice
+		}
+	}
+	return p, nil
+}
+
+type mergedFeed struct {
+	feeds []Feed
+	next  []oandatest.Tick
+	ok    []bool
+	init  bool
+}
+
+// Merge interleaves the feeds by time. Ticks at the same time are taken from the
+// feeds in the order they are passed in.
+func Merge(feeds ...Feed) Feed {
+	return &mergedFeed{
+		feeds: feeds,
+		next:  make([]oandatest.Tick, len(feeds)),
+		ok:    make([]bool, len(feeds)),
+	}
+}
+
+func (m *mergedFeed) Next() (oandatest.Tick, bool) {
+	if !m.init {
+		m.init = true
+		for i, f := range m.feeds {
+			m.next[i], m.ok[i] = f.Next()
+		}
+	}
+	first := -1
+	for i := range m.feeds {
+		if m.ok[i] && (first < 0 || m.next[i].Time.Before(m.next[first].Time)) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return oandatest.Tick{}, false
+	}
+	tick := m.next[first]
+	m.next[first], m.ok[first] = m.feeds[first].Next()
+	return tick, true
+}
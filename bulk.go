@@ -0,0 +1,293 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+)
+
+// BulkFilter selects the orders and trades a bulk operation applies to. Empty
+// fields match everything.
+type BulkFilter struct {
+	Instrument model.InstrumentName
+	// The tag of the client extensions.
+	Tag model.ClientTag
+}
+
+func (f *BulkFilter) match(instrument model.InstrumentName, ext *model.ClientExtensions) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Instrument) > 0 && f.Instrument != instrument {
+		return false
+	}
+	if len(f.Tag) > 0 && (ext == nil || ext.Tag != f.Tag) {
+		return false
+	}
+	return true
+}
+
+// OrderCancelResult is the outcome of cancelling a single order.
+type OrderCancelResult struct {
+	OrderID model.OrderID
+	Cancel  *model.OrderCancelTransaction
+	// The details of a rejected cancellation.
+	Rejected *model.CancelOrderError
+	Err      error
+}
+
+// TradeCloseResult is the outcome of closing a single trade.
+type TradeCloseResult struct {
+	TradeID model.TradeID
+	Fill    *model.OrderFillTransaction
+	// The details of a rejected close.
+	Rejected *model.TradeCloseError
+	Err      error
+}
+
+// PositionCloseResult is the outcome of closing both sides of a position.
+type PositionCloseResult struct {
+	Instrument model.InstrumentName
+	LongFill   *model.OrderFillTransaction
+	ShortFill  *model.OrderFillTransaction
+	// The details of a rejected close.
+	Rejected *model.PositionCloseError
+	Err      error
+}
+
+// FlattenResult is the outcome of flattening an Account.
+type FlattenResult struct {
+	Orders    []OrderCancelResult
+	Positions []PositionCloseResult
+}
+
+// Err returns the first error of any order or position or nil.
+func (r *FlattenResult) Err() error {
+	for _, o := range r.Orders {
+		if o.Err != nil {
+			return o.Err
+		}
+	}
+	for _, p := range r.Positions {
+		if p.Err != nil {
+			return p.Err
+		}
+	}
+	return nil
+}
+
+// Bulk cancels orders and closes trades and positions of an Account in bulk. The
+// individual requests run concurrently under the rate limit and each one reports
+// its own result.
+type Bulk struct {
+	accountID     model.AccountID
+	limiter       *RateLimiter
+	concurrency   int
+	ordersPending func() (*model.OrdersResponse, error)
+	orderCancel   func(specifier model.OrderSpecifier) (*model.CancelOrderResponse, *model.CancelOrderError, error)
+	tradesOpen    func() (*model.TradesResponse, error)
+	tradeClose    func(specifier model.TradeSpecifier) (*model.TradeCloseResponse, *model.TradeCloseError, error)
+	positionsOpen func() (*model.PositionsResponse, error)
+	positionClose func(instrument model.InstrumentName, request *model.PositionCloseRequest) (*model.PositionCloseResponse, *model.PositionCloseError, error)
+}
+
+func NewBulk(conn endpoint.API, limiter *RateLimiter, accountID model.AccountID) *Bulk {
+	return &Bulk{
+		accountID:   accountID,
+		limiter:     limiter,
+		concurrency: DefaultConcurrency,
+		ordersPending: func() (*model.OrdersResponse, error) {
+			return conn.OrdersPending(accountID)
+		},
+		orderCancel: func(specifier model.OrderSpecifier) (*model.CancelOrderResponse, *model.CancelOrderError, error) {
+			return conn.OrderCancel(accountID, specifier)
+		},
+		tradesOpen: func() (*model.TradesResponse, error) {
+			return conn.TradesOpen(accountID)
+		},
+		tradeClose: func(specifier model.TradeSpecifier) (*model.TradeCloseResponse, *model.TradeCloseError, error) {
+			return conn.TradeClose(accountID, specifier, "ALL")
+		},
+		positionsOpen: func() (*model.PositionsResponse, error) {
+			return conn.PositionsOpen(accountID)
+		},
+		positionClose: func(instrument model.InstrumentName, request *model.PositionCloseRequest) (*model.PositionCloseResponse, *model.PositionCloseError, error) {
+			return conn.PositionClose(accountID, instrument, request)
+		},
+	}
+}
+
+// WithConcurrency sets the maximum number of requests in flight at the same time.
+func (b *Bulk) WithConcurrency(concurrency int) *Bulk {
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	b.concurrency = concurrency
+	return b
+}
+
+func (b *Bulk) AccountID() model.AccountID {
+	return b.accountID
+}
+
+// CancelOrders cancels every pending order matching the filter. Orders attached to
+// a trade, such as Stop Loss Orders, match the instrument of their trade. The error
+// is only set if the pending orders could not be listed.
+func (b *Bulk) CancelOrders(filter *BulkFilter) ([]OrderCancelResult, error) {
+	b.limiter.Wait()
+	pending, err := b.ordersPending()
+	if err != nil {
+		return nil, err
+	}
+	var trades map[model.TradeID]model.InstrumentName
+	if filter != nil && len(filter.Instrument) > 0 {
+		for _, order := range pending.Orders {
+			if order != nil && len(order.Instrument) == 0 && len(order.TradeID) > 0 {
+				if trades, err = b.tradeInstruments(); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	var orders []model.OrderID
+	for _, order := range pending.Orders {
+		if order == nil {
+			continue
+		}
+		instrument := order.Instrument
+		if len(instrument) == 0 {
+			instrument = trades[model.TradeID(order.TradeID)]
+		}
+		if filter.match(instrument, order.ClientExtensions) {
+			orders = append(orders, model.OrderID(order.Id))
+		}
+	}
+
+	results := make([]OrderCancelResult, len(orders))
+	parallel(len(orders), b.concurrency, b.limiter, func(i int) {
+		r := &results[i]
+		r.OrderID = orders[i]
+		var resp *model.CancelOrderResponse
+		resp, r.Rejected, r.Err = b.orderCancel(model.OrderSpecifier(orders[i]))
+		if resp != nil {
+			r.Cancel = resp.OrderCancelTransaction
+		}
+	})
+	return results, nil
+}
+
+func (b *Bulk) tradeInstruments() (map[model.TradeID]model.InstrumentName, error) {
+	b.limiter.Wait()
+	open, err := b.tradesOpen()
+	if err != nil {
+		return nil, err
+	}
+	trades := make(map[model.TradeID]model.InstrumentName, len(open.Trades))
+	for _, trade := range open.Trades {
+		if trade != nil {
+			trades[trade.Id] = trade.Instrument
+		}
+	}
+	return trades, nil
+}
+
+// CloseTrades closes every open trade matching the filter. The error is only set
+// if the open trades could not be listed.
+func (b *Bulk) CloseTrades(filter *BulkFilter) ([]TradeCloseResult, error) {
+	b.limiter.Wait()
+	open, err := b.tradesOpen()
+	if err != nil {
+		return nil, err
+	}
+	var trades []model.TradeID
+	for _, trade := range open.Trades {
+		if trade != nil && filter.match(trade.Instrument, trade.ClientExtensions) {
+			trades = append(trades, trade.Id)
+		}
+	}
+
+	results := make([]TradeCloseResult, len(trades))
+	parallel(len(trades), b.concurrency, b.limiter, func(i int) {
+		r := &results[i]
+		r.TradeID = trades[i]
+		var resp *model.TradeCloseResponse
+		resp, r.Rejected, r.Err = b.tradeClose(model.TradeSpecifier(trades[i]))
+		if resp != nil {
+			r.Fill = resp.OrderFillTransaction
+		}
+	})
+	return results, nil
+}
+
+// ClosePositions closes both sides of the open positions of the instruments, or of
+// every open position if none are supplied. The error is only set if the open
+// positions could not be listed.
+func (b *Bulk) ClosePositions(instruments ...model.InstrumentName) ([]PositionCloseResult, error) {
+	b.limiter.Wait()
+	open, err := b.positionsOpen()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		positions []model.InstrumentName
+		requests  []*model.PositionCloseRequest
+	)
+	for _, position := range open.Positions {
+		if position == nil || !containsInstrument(instruments, position.Instrument) {
+			continue
+		}
+		request := &model.PositionCloseRequest{LongUnits: "NONE", ShortUnits: "NONE"}
+		if position.Long != nil && position.Long.Units.AsFloat64(0) != 0 {
+			request.LongUnits = "ALL"
+		}
+		if position.Short != nil && position.Short.Units.AsFloat64(0) != 0 {
+			request.ShortUnits = "ALL"
+		}
+		if request.LongUnits == "NONE" && request.ShortUnits == "NONE" {
+			continue
+		}
+		positions = append(positions, position.Instrument)
+		requests = append(requests, request)
+	}
+
+	results := make([]PositionCloseResult, len(positions))
+	parallel(len(positions), b.concurrency, b.limiter, func(i int) {
+		r := &results[i]
+		r.Instrument = positions[i]
+		var resp *model.PositionCloseResponse
+		resp, r.Rejected, r.Err = b.positionClose(positions[i], requests[i])
+		if resp != nil {
+			r.LongFill = resp.LongOrderFillTransaction
+			r.ShortFill = resp.ShortOrderFillTransaction
+		}
+	})
+	return results, nil
+}
+
+// Flatten cancels every pending order and then closes every open position, so no
+// pending order can open a new position while the Account is being closed out.
+// The results are returned together with the first listing error, if any.
+func (b *Bulk) Flatten() (*FlattenResult, error) {
+	result := &FlattenResult{}
+	orders, ordersErr := b.CancelOrders(nil)
+	result.Orders = orders
+	positions, err := b.ClosePositions()
+	result.Positions = positions
+	if ordersErr != nil {
+		return result, ordersErr
+	}
+	return result, err
+}
+
+func containsInstrument(instruments []model.InstrumentName, instrument model.InstrumentName) bool {
+	if len(instruments) == 0 {
+		return true
+	}
+	for _, i := range instruments {
+		if i == instrument {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func newTestBulk() (*Bulk, *sync.Map) {
+	calls := &sync.Map{}
+	b := &Bulk{
+		concurrency: 2,
+		ordersPending: func() (*model.OrdersResponse, error) {
+			return &model.OrdersResponse{Orders: []*model.OrderParser{
+				{Id: "1", Type: "LIMIT", Instrument: "EUR_USD", ClientExtensions: &model.ClientExtensions{Tag: "grid"}},
+				{Id: "2", Type: "LIMIT", Instrument: "GBP_USD"},
+				{Id: "3", Type: "STOP_LOSS", TradeID: "10"},
+			}}, nil
+		},
+		orderCancel: func(specifier model.OrderSpecifier) (*model.CancelOrderResponse, *model.CancelOrderError, error) {
+			calls.Store("cancel "+string(specifier), true)
+			if specifier == "3" {
+				return nil, &model.CancelOrderError{ErrorCode: "ORDER_DOESNT_EXIST"}, endpoint.StatusCodeError{Code: 404}
+			}
+			return &model.CancelOrderResponse{
+				OrderCancelTransaction: &model.OrderCancelTransaction{OrderID: model.OrderID(specifier)},
+			}, nil, nil
+		},
+		tradesOpen: func() (*model.TradesResponse, error) {
+			return &model.TradesResponse{Trades: []*model.Trade{
+				{Id: "10", Instrument: "EUR_USD", ClientExtensions: &model.ClientExtensions{Tag: "grid"}},
+				{Id: "11", Instrument: "GBP_USD"},
+			}}, nil
+		},
+		tradeClose: func(specifier model.TradeSpecifier) (*model.TradeCloseResponse, *model.TradeCloseError, error) {
+			calls.Store("close "+string(specifier), true)
+			return &model.TradeCloseResponse{OrderFillTransaction: &model.OrderFillTransaction{}}, nil, nil
+		},
+		positionsOpen: func() (*model.PositionsResponse, error) {
+			return &model.PositionsResponse{Positions: []*model.Position{
+				{Instrument: "EUR_USD", Long: &model.PositionSide{Units: "100"}, Short: &model.PositionSide{Units: "0"}},
+				{Instrument: "GBP_USD", Long: &model.PositionSide{Units: "0"}, Short: &model.PositionSide{Units: "-50"}},
+				{Instrument: "USD_JPY", Long: &model.PositionSide{Units: "0"}, Short: &model.PositionSide{Units: "0"}},
+			}}, nil
+		},
+		positionClose: func(instrument model.InstrumentName, request *model.PositionCloseRequest) (*model.PositionCloseResponse, *model.PositionCloseError, error) {
+			calls.Store("position "+string(instrument)+" "+request.LongUnits+" "+request.ShortUnits, true)
+			return &model.PositionCloseResponse{}, nil, nil
+		},
+	}
+	return b, calls
+}
+
+func bulkCalls(calls *sync.Map) []string {
+	var result []string
+	calls.Range(func(key, value interface{}) bool {
+		result = append(result, key.(string))
+		return true
+	})
+	sort.Strings(result)
+	return result
+}
+
+func TestBulk(t *testing.T) {
+	b, calls := newTestBulk()
+	orders, err := b.CancelOrders(&BulkFilter{Instrument: "EUR_USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Stop Loss Order matches the instrument of its trade
+	if len(orders) != 2 || orders[0].OrderID != "1" || orders[0].Err != nil || orders[0].Cancel == nil ||
+		orders[1].OrderID != "3" || orders[1].Err == nil || orders[1].Rejected == nil {
+		t.Fatalf("unexpected cancel results %+v", orders)
+	}
+
+	trades, err := b.CloseTrades(&BulkFilter{Tag: "grid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 1 || trades[0].TradeID != "10" || trades[0].Fill == nil {
+		t.Fatalf("unexpected close results %+v", trades)
+	}
+
+	b, calls = newTestBulk()
+	result, err := b.Flatten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Orders) != 3 || len(result.Positions) != 2 || result.Err() == nil {
+		t.Fatalf("unexpected flatten result %+v", result)
+	}
+	expected := []string{
+		"cancel 1", "cancel 2", "cancel 3",
+		"position EUR_USD ALL NONE", "position GBP_USD NONE ALL",
+	}
+	got := bulkCalls(calls)
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected calls %v", got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("unexpected calls %v", got)
+		}
+	}
+}
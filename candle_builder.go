@@ -0,0 +1,328 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CandleHandler receives the candles maintained by a CandleBuilder. Callbacks are
+// invoked from the goroutine delivering prices and must not block.
+type CandleHandler interface {
+	// OnUpdate is called each time a price updates a candle.
+	OnUpdate(instrument model.InstrumentName, granularity model.CandlestickGranularity, candle *model.Candlestick)
+
+	// OnComplete is called once a candle's end time has passed.
+	OnComplete(instrument model.InstrumentName, granularity model.CandlestickGranularity, candle *model.Candlestick)
+}
+
+type liveOHLC struct {
+	open, high, low, close float64
+}
+
+func (o *liveOHLC) reset(price float64) {
+	o.open, o.high, o.low, o.close = price, price, price, price
+}
+
+func (o *liveOHLC) update(price float64) {
+	if price > o.high {
+		o.high = price
+	}
+	if price < o.low {
+		o.low = price
+	}
+	o.close = price
+}
+
+// merge folds the prices of a candle seeded for the same period into o. The seeded
+// open is kept, as are the extremes of both, and the close of o as it is the later.
+func (o *liveOHLC) merge(seeded liveOHLC) {
+	o.open = seeded.open
+	if seeded.high > o.high {
+		o.high = seeded.high
+	}
+	if seeded.low < o.low {
+		o.low = seeded.low
+	}
+}
+
+func (o *liveOHLC) data() *model.CandlestickData {
+	return &model.CandlestickData{
+		Open:  formatPrice(o.open),
+		High:  formatPrice(o.high),
+		Low:   formatPrice(o.low),
+		Close: formatPrice(o.close),
+	}
+}
+
+type liveCandle struct {
+	granularity model.CandlestickGranularity
+	start       time.Time
+	end         time.Time
+	bid         liveOHLC
+	ask         liveOHLC
+	mid         liveOHLC
+	volume      int64
+	active      bool
+}
+
+func (c *liveCandle) candle(complete bool) *model.Candlestick {
+	return &model.Candlestick{
+		Time:     model.DateTime(c.start.Format(candleTimeLayout)),
+		Bid:      c.bid.data(),
+		Ask:      c.ask.data(),
+		Mid:      c.mid.data(),
+		Volume:   c.volume,
+		Complete: complete,
+	}
+}
+
+type candleEvent struct {
+	instrument  model.InstrumentName
+	granularity model.CandlestickGranularity
+	candle      *model.Candlestick
+}
+
+// CandleBuilder maintains live bid, ask and mid candles of a set of granularities
+// from pricing stream updates. It implements endpoint.PricingStreamHandler so it can
+// be passed directly to StartPricingStream. Heartbeats complete candles of
+// instruments that stopped receiving prices.
+type CandleBuilder struct {
+	alignment     *Alignment
+	granularities []model.CandlestickGranularity
+	handler       CandleHandler
+	instruments   map[model.InstrumentName][]*liveCandle
+	mu            sync.Mutex
+}
+
+func NewCandleBuilder(
+	alignment *Alignment,
+	handler CandleHandler,
+	granularities ...model.CandlestickGranularity,
+) (*CandleBuilder, error) {
+	if len(granularities) == 0 {
+		return nil, errors.New("at least one granularity required")
+	}
+	for _, g := range granularities {
+		if _, ok := GranularityDuration(g); !ok {
+			return nil, ErrInvalidGranularity
+		}
+	}
+	if alignment == nil {
+		alignment = DefaultAlignment()
+	}
+	return &CandleBuilder{
+		alignment:     alignment,
+		granularities: granularities,
+		handler:       handler,
+		instruments:   make(map[model.InstrumentName][]*liveCandle),
+	}, nil
+}
+
+func (b *CandleBuilder) series(instrument model.InstrumentName) []*liveCandle {
+	series := b.instruments[instrument]
+	if series == nil {
+		series = make([]*liveCandle, len(b.granularities))
+		for i, g := range b.granularities {
+			series[i] = &liveCandle{granularity: g}
+		}
+		b.instruments[instrument] = series
+	}
+	return series
+}
+
+// Current returns the candle of the instrument and granularity that is currently
+// being built.
+func (b *CandleBuilder) Current(
+	instrument model.InstrumentName,
+	granularity model.CandlestickGranularity,
+) (*model.Candlestick, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.instruments[instrument] {
+		if c.granularity == granularity && c.active {
+			return c.candle(false), true
+		}
+	}
+	return nil, false
+}
+
+// Seed fetches the current candles of the instruments with a single CandlesLatest
+// request and continues building on top of them. Call it right after starting the
+// pricing stream so the candles that were already in progress are not partial. A
+// candle the stream already started is merged with the seeded one.
+func (b *CandleBuilder) Seed(
+	conn endpoint.PricingAPI,
+	accountID model.AccountID,
+	instruments ...model.InstrumentName,
+) error {
+	if len(instruments) == 0 {
+		return endpoint.ErrInstrumentsRequired
+	}
+	request := model.NewCandlesLatestRequest().
+		WithDailyAlignment(b.alignment.DailyAlignment).
+		WithAlignmentTimezone(b.alignment.AlignmentTimezone).
+		WithWeeklyAlignment(b.alignment.WeeklyAlignment)
+	for _, instrument := range instruments {
+		for _, g := range b.granularities {
+			request.AddCandleSpecification(model.NewCandleSpecification(instrument, g, "BAM"))
+		}
+	}
+	resp, err := conn.CandlesLatest(accountID, request)
+	if err != nil {
+		return err
+	}
+	return b.seed(resp)
+}
+
+func (b *CandleBuilder) seed(resp *model.CandlesLatestResponse) error {
+	if resp == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, latest := range resp.LatestCandles {
+		if latest == nil || len(latest.Candles) == 0 {
+			continue
+		}
+		last := latest.Candles[len(latest.Candles)-1]
+		if last == nil || last.Complete || last.Bid == nil || last.Ask == nil {
+			continue
+		}
+		start, err := last.Time.Parse()
+		if err != nil {
+			return err
+		}
+		for _, c := range b.series(latest.Instrument) {
+			if c.granularity != latest.Granularity {
+				continue
+			}
+			if c.active && c.start.After(start) {
+				// The stream has already moved on
+				continue
+			}
+			end, err := b.alignment.Next(c.granularity, start)
+			if err != nil {
+				return err
+			}
+			bid, ask := seedOHLC(last.Bid), seedOHLC(last.Ask)
+			mid := liveOHLC{
+				open:  (bid.open + ask.open) / 2,
+				high:  (bid.high + ask.high) / 2,
+				low:   (bid.low + ask.low) / 2,
+				close: (bid.close + ask.close) / 2,
+			}
+			if last.Mid != nil {
+				mid = seedOHLC(last.Mid)
+			}
+			if c.active && c.start.Equal(start) {
+				// Prices of this candle already arrived on the stream
+				c.bid.merge(bid)
+				c.ask.merge(ask)
+				c.mid.merge(mid)
+				if last.Volume > c.volume {
+					c.volume = last.Volume
+				}
+				continue
+			}
+			c.start, c.end = start, end
+			c.bid, c.ask, c.mid = bid, ask, mid
+			c.volume = last.Volume
+			c.active = true
+		}
+	}
+	return nil
+}
+
+func seedOHLC(d *model.CandlestickData) liveOHLC {
+	return liveOHLC{
+		open:  d.Open.AsFloat64(0),
+		high:  d.High.AsFloat64(0),
+		low:   d.Low.AsFloat64(0),
+		close: d.Close.AsFloat64(0),
+	}
+}
+
+func (b *CandleBuilder) OnMessage(price *model.StreamClientPrice) error {
+	if price == nil || price.IsHeartbeat || len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return nil
+	}
+	var (
+		instrument = model.InstrumentName(price.Instrument)
+		bid        = price.Bids[0].Price
+		ask        = price.Asks[0].Price
+		mid        = (bid + ask) / 2
+		events     []candleEvent
+		completed  []candleEvent
+	)
+	b.mu.Lock()
+	for _, c := range b.series(instrument) {
+		if c.active && !price.Time.Before(c.end) {
+			completed = append(completed, candleEvent{instrument, c.granularity, c.candle(true)})
+			c.active = false
+		}
+		if !c.active {
+			// Granularities were validated by NewCandleBuilder
+			c.start, _ = b.alignment.Start(c.granularity, price.Time)
+			c.end, _ = b.alignment.Next(c.granularity, c.start)
+			c.bid.reset(bid)
+			c.ask.reset(ask)
+			c.mid.reset(mid)
+			c.volume = 1
+			c.active = true
+		} else {
+			c.bid.update(bid)
+			c.ask.update(ask)
+			c.mid.update(mid)
+			c.volume++
+		}
+		events = append(events, candleEvent{instrument, c.granularity, c.candle(false)})
+	}
+	b.mu.Unlock()
+
+	b.dispatch(completed, events)
+	return nil
+}
+
+// OnHeartbeat completes every candle whose end time has passed.
+func (b *CandleBuilder) OnHeartbeat(t time.Time) {
+	var completed []candleEvent
+	b.mu.Lock()
+	for instrument, series := range b.instruments {
+		for _, c := range series {
+			if c.active && !t.Before(c.end) {
+				completed = append(completed, candleEvent{instrument, c.granularity, c.candle(true)})
+				c.active = false
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.dispatch(completed, nil)
+}
+
+func (b *CandleBuilder) OnClose() {}
+
+func (b *CandleBuilder) dispatch(completed, updated []candleEvent) {
+	if b.handler == nil {
+		return
+	}
+	for _, e := range completed {
+		b.handler.OnComplete(e.instrument, e.granularity, e.candle)
+	}
+	for _, e := range updated {
+		b.handler.OnUpdate(e.instrument, e.granularity, e.candle)
+	}
+}
+
+// formatPrice formats a price without the floating point noise introduced by
+// averaging bid and ask.
+func formatPrice(v float64) model.PriceValue {
+	s := strconv.FormatFloat(v, 'f', 8, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	return model.PriceValue(s)
+}
@@ -0,0 +1,124 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"testing"
+	"time"
+)
+
+type testCandleHandler struct {
+	updates   int
+	completed []model.Candlestick
+}
+
+func (h *testCandleHandler) OnUpdate(_ model.InstrumentName, _ model.CandlestickGranularity, _ *model.Candlestick) {
+	h.updates++
+}
+
+func (h *testCandleHandler) OnComplete(_ model.InstrumentName, g model.CandlestickGranularity, candle *model.Candlestick) {
+	if g == model.CandlestickGranularity_M1 {
+		h.completed = append(h.completed, *candle)
+	}
+}
+
+func newTestPrice(instrument string, t time.Time, bid, ask float64) *model.StreamClientPrice {
+	return &model.StreamClientPrice{
+		Instrument: []byte(instrument),
+		Time:       t,
+		Bids:       []model.StreamPriceBucket{{Price: bid, Liquidity: 1000000}},
+		Asks:       []model.StreamPriceBucket{{Price: ask, Liquidity: 1000000}},
+		Tradeable:  true,
+	}
+}
+
+func TestCandleBuilder(t *testing.T) {
+	handler := &testCandleHandler{}
+	b, err := NewCandleBuilder(nil, handler, "M1", "H1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 1, 5, 10, 0, 0, 0, time.UTC)
+
+	// Seed the M1 candle that was in progress before the stream started
+	err = b.seed(&model.CandlesLatestResponse{LatestCandles: []*model.CandlestickResponse{{
+		Instrument:  "EUR_USD",
+		Granularity: "M1",
+		Candles: []*model.Candlestick{{
+			Time:   model.DateTime(start.Format(time.RFC3339)),
+			Bid:    &model.CandlestickData{Open: "1.1", High: "1.105", Low: "1.099", Close: "1.1"},
+			Ask:    &model.CandlestickData{Open: "1.1002", High: "1.1052", Low: "1.0992", Close: "1.1002"},
+			Mid:    &model.CandlestickData{Open: "1.1001", High: "1.1051", Low: "1.0991", Close: "1.1001"},
+			Volume: 10,
+		}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = b.OnMessage(newTestPrice("EUR_USD", start.Add(20*time.Second), 1.098, 1.0982))
+	_ = b.OnMessage(newTestPrice("EUR_USD", start.Add(40*time.Second), 1.101, 1.1012))
+	current, ok := b.Current("EUR_USD", "M1")
+	if !ok || current.Volume != 12 || current.Bid.Open != "1.1" || current.Bid.Low != "1.098" ||
+		current.Bid.High != "1.105" || current.Bid.Close != "1.101" {
+		t.Fatalf("unexpected current candle %+v %+v", current, current.Bid)
+	}
+	if h1, _ := b.Current("EUR_USD", "H1"); h1.Volume != 2 {
+		t.Fatal("unexpected H1 candle")
+	}
+
+	_ = b.OnMessage(newTestPrice("EUR_USD", start.Add(70*time.Second), 1.102, 1.1022))
+	if len(handler.completed) != 1 || handler.completed[0].Volume != 12 || !handler.completed[0].Complete {
+		t.Fatalf("expected completed candle got %v", handler.completed)
+	}
+	if current, _ = b.Current("EUR_USD", "M1"); current.Volume != 1 || current.Mid.Open != "1.1021" {
+		t.Fatalf("unexpected new candle %+v", current.Mid)
+	}
+
+	b.OnHeartbeat(start.Add(2 * time.Minute))
+	if len(handler.completed) != 2 {
+		t.Fatal("heartbeat did not complete candle")
+	}
+	if _, ok = b.Current("EUR_USD", "M1"); ok {
+		t.Fatal("expected no current candle")
+	}
+	if handler.updates != 6 {
+		t.Fatalf("expected 6 updates got %d", handler.updates)
+	}
+}
+
+func TestCandleBuilderSeedAfterTicks(t *testing.T) {
+	b, err := NewCandleBuilder(nil, nil, "M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 1, 5, 10, 0, 0, 0, time.UTC)
+
+	// The stream delivers prices before the seed arrives
+	_ = b.OnMessage(newTestPrice("EUR_USD", start.Add(20*time.Second), 1.106, 1.1062))
+	_ = b.OnMessage(newTestPrice("EUR_USD", start.Add(30*time.Second), 1.103, 1.1032))
+	err = b.seed(&model.CandlesLatestResponse{LatestCandles: []*model.CandlestickResponse{{
+		Instrument:  "EUR_USD",
+		Granularity: "M1",
+		Candles: []*model.Candlestick{{
+			Time:   model.DateTime(start.Format(time.RFC3339)),
+			Bid:    &model.CandlestickData{Open: "1.1", High: "1.105", Low: "1.099", Close: "1.104"},
+			Ask:    &model.CandlestickData{Open: "1.1002", High: "1.1052", Low: "1.0992", Close: "1.1042"},
+			Volume: 10,
+		}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, ok := b.Current("EUR_USD", "M1")
+	if !ok || current.Volume != 10 {
+		t.Fatalf("unexpected seeded candle %+v", current)
+	}
+	if current.Bid.Open != "1.1" || current.Bid.High != "1.106" || current.Bid.Low != "1.099" ||
+		current.Bid.Close != "1.103" {
+		t.Fatalf("unexpected merged bid %+v", current.Bid)
+	}
+	if current.Mid.Open != "1.1001" || current.Mid.High != "1.1061" || current.Mid.Low != "1.0991" ||
+		current.Mid.Close != "1.1031" {
+		t.Fatalf("unexpected merged mid %+v", current.Mid)
+	}
+}
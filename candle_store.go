@@ -0,0 +1,691 @@
+package oanda
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	candleStoreExt   = ".candles"
+	candleStoreMagic = "OCS1"
+	// Record: time (8) + volume (8) + flags (1) + digits (1) + 4 prices (8) per component
+	candleRecordBaseSize = 18
+	candleRecordDataSize = 32
+	candleFlagComplete   = 1
+	// The maximum number of decimal places a stored price may have.
+	candleMaxDigits = 12
+
+	candleComponentBid = 1
+	candleComponentAsk = 2
+	candleComponentMid = 4
+
+	// The layout OANDA uses for RFC3339 candle times.
+	candleTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+var (
+	ErrCandleStoreClosed   = errors.New("candle store closed")
+	ErrCandleStoreMismatch = errors.New("candle store was created with different alignment")
+	ErrCandleStoreCorrupt  = errors.New("candle store corrupt")
+	ErrCandleComponent     = errors.New("candle is missing a price component")
+	ErrCandlePrice         = errors.New("invalid candle price")
+	ErrCandleStoreFrom     = errors.New("candle store is empty and its request has no From")
+)
+
+// CandleGap is a range of missing candles that is not explained by the market being
+// closed. From is the start of the first missing candle and To the start of the
+// next candle that is present or the time the market closes. Missing only counts
+// the candles of the time the market is open.
+type CandleGap struct {
+	From    time.Time
+	To      time.Time
+	Missing int
+}
+
+// CandleStore is an on-disk cache of the candles of a single instrument, granularity
+// and price component.
+//
+// Candles are stored as fixed size binary records in time order, so the file is only
+// ever appended to, apart from the trailing incomplete candle which is replaced by
+// the next Sync. Prices are stored as scaled integers and round trip exactly.
+type CandleStore struct {
+	request      model.InstrumentCandlesRequest
+	candles      *Candles
+	marketClosed func(t time.Time) bool
+	path         string
+	f            *os.File
+	mask         byte
+	header       int64
+	recordSize   int64
+	times        []int64
+	complete     int
+	closed       bool
+	syncMu       sync.Mutex
+	mu           sync.RWMutex
+}
+
+// OpenCandleStore opens or creates the store within dir for the instrument,
+// granularity, price components and alignment of the request. The request's From
+// is where the first Sync of an empty store begins. Candles are downloaded through
+// candles which may be nil if the store is only read.
+func OpenCandleStore(
+	dir string,
+	candles *Candles,
+	request *model.InstrumentCandlesRequest,
+) (*CandleStore, error) {
+	if request == nil {
+		return nil, errors.New("request required")
+	}
+	if len(request.Instrument) == 0 {
+		return nil, errors.New("instrument required")
+	}
+	r := *request
+	if len(r.Granularity) == 0 {
+		r.Granularity = model.CandlestickGranularity_S5
+	}
+	if _, ok := GranularityDuration(r.Granularity); !ok {
+		return nil, ErrInvalidGranularity
+	}
+	if len(r.Price) == 0 {
+		r.Price = model.PricingComponent_MID
+	}
+	r.AlignmentTimezone, r.WeeklyAlignment = candleStoreAlignment(&r)
+	mask := candleComponents(r.Price)
+	if mask == 0 {
+		return nil, errors.New("invalid price component: " + string(r.Price))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &CandleStore{
+		request:      r,
+		candles:      candles,
+		marketClosed: MarketClosed,
+		path:         filepath.Join(dir, candleStoreName(r.Instrument, r.Granularity, mask)),
+		mask:         mask,
+		recordSize:   candleRecordSize(mask),
+	}
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	if err = s.load(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// candleStoreAlignment returns the timezone and weekly alignment of the request
+// with OANDA's defaults applied.
+func candleStoreAlignment(r *model.InstrumentCandlesRequest) (string, model.WeeklyAlignment) {
+	timezone, weekly := r.AlignmentTimezone, r.WeeklyAlignment
+	if len(timezone) == 0 {
+		timezone = "America/New_York"
+	}
+	if len(weekly) == 0 {
+		weekly = model.WeeklyAlignment_Friday
+	}
+	return timezone, weekly
+}
+
+// aligned reports whether the request has the alignment of the store.
+func (s *CandleStore) aligned(r *model.InstrumentCandlesRequest) bool {
+	timezone, weekly := candleStoreAlignment(r)
+	return r.DailyAlignment == s.request.DailyAlignment &&
+		timezone == s.request.AlignmentTimezone &&
+		weekly == s.request.WeeklyAlignment
+}
+
+func candleStoreName(instrument model.InstrumentName, granularity model.CandlestickGranularity, mask byte) string {
+	return string(instrument) + "." + string(granularity) + "." + candleComponentString(mask) + candleStoreExt
+}
+
+func candleComponents(price model.PricingComponent) byte {
+	var mask byte
+	for _, c := range strings.ToUpper(string(price)) {
+		switch c {
+		case 'B':
+			mask |= candleComponentBid
+		case 'A':
+			mask |= candleComponentAsk
+		case 'M':
+			mask |= candleComponentMid
+		default:
+			return 0
+		}
+	}
+	return mask
+}
+
+func candleComponentString(mask byte) string {
+	s := ""
+	if mask&candleComponentBid != 0 {
+		s += "B"
+	}
+	if mask&candleComponentAsk != 0 {
+		s += "A"
+	}
+	if mask&candleComponentMid != 0 {
+		s += "M"
+	}
+	return s
+}
+
+func candleRecordSize(mask byte) int64 {
+	n := int64(candleRecordBaseSize)
+	for bit := byte(1); bit <= candleComponentMid; bit <<= 1 {
+		if mask&bit != 0 {
+			n += candleRecordDataSize
+		}
+	}
+	return n
+}
+
+func (s *CandleStore) encodeHeader() []byte {
+	b := []byte(candleStoreMagic)
+	b = append(b, s.mask, byte(s.request.DailyAlignment))
+	b = append(b, byte(len(s.request.AlignmentTimezone)))
+	b = append(b, s.request.AlignmentTimezone...)
+	b = append(b, byte(len(s.request.WeeklyAlignment)))
+	b = append(b, s.request.WeeklyAlignment...)
+	return b
+}
+
+// load writes the header of a new file or validates the header of an existing one
+// and indexes the records. A partial record at the tail is truncated.
+func (s *CandleStore) load() error {
+	header := s.encodeHeader()
+	s.header = int64(len(header))
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err = s.f.WriteAt(header, 0); err != nil {
+			return err
+		}
+		return s.f.Sync()
+	}
+	existing := make([]byte, len(header))
+	if _, err = s.f.ReadAt(existing, 0); err != nil {
+		if err == io.EOF {
+			return ErrCandleStoreCorrupt
+		}
+		return err
+	}
+	if string(existing[:4]) != candleStoreMagic {
+		return ErrCandleStoreCorrupt
+	}
+	if string(existing) != string(header) {
+		return ErrCandleStoreMismatch
+	}
+
+	count := (info.Size() - s.header) / s.recordSize
+	if end := s.header + count*s.recordSize; end != info.Size() {
+		// Torn write
+		if err = s.f.Truncate(end); err != nil {
+			return err
+		}
+		if err = s.f.Sync(); err != nil {
+			return err
+		}
+	}
+	s.times = make([]int64, 0, count)
+	r := bufio.NewReaderSize(io.NewSectionReader(s.f, s.header, count*s.recordSize), 1024*64)
+	record := make([]byte, s.recordSize)
+	for i := int64(0); i < count; i++ {
+		if _, err = io.ReadFull(r, record); err != nil {
+			return err
+		}
+		s.times = append(s.times, int64(binary.LittleEndian.Uint64(record)))
+		if record[16]&candleFlagComplete != 0 {
+			s.complete = len(s.times)
+		}
+	}
+	return nil
+}
+
+// WithMarketHours replaces the function used to decide whether a gap is explained
+// by the market being closed. Defaults to MarketClosed.
+func (s *CandleStore) WithMarketHours(closed func(t time.Time) bool) *CandleStore {
+	if closed == nil {
+		closed = MarketClosed
+	}
+	s.mu.Lock()
+	s.marketClosed = closed
+	s.mu.Unlock()
+	return s
+}
+
+func (s *CandleStore) Instrument() model.InstrumentName {
+	return s.request.Instrument
+}
+
+func (s *CandleStore) Granularity() model.CandlestickGranularity {
+	return s.request.Granularity
+}
+
+func (s *CandleStore) Price() model.PricingComponent {
+	return model.PricingComponent(candleComponentString(s.mask))
+}
+
+// The number of stored candles including a trailing incomplete one.
+func (s *CandleStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.times)
+}
+
+// The start time of the first stored candle or zero if the store is empty.
+func (s *CandleStore) First() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.times) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(s.times[0], 0).UTC()
+}
+
+// The start time of the last stored candle or zero if the store is empty.
+func (s *CandleStore) Last() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.times) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(s.times[len(s.times)-1], 0).UTC()
+}
+
+// The start time of the last complete candle or zero if there is none.
+func (s *CandleStore) LastComplete() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.complete == 0 {
+		return time.Time{}
+	}
+	return time.Unix(s.times[s.complete-1], 0).UTC()
+}
+
+// Sync downloads every candle after the last complete one up to to, replacing a
+// trailing incomplete candle. An empty store starts at the From of the request it
+// was opened with and fails with ErrCandleStoreFrom if it has none. The returned
+// gaps cover the newly stored candles and the boundary with the existing ones.
+func (s *CandleStore) Sync(to time.Time) ([]CandleGap, error) {
+	if s.candles == nil {
+		return nil, errors.New("candle store is read only")
+	}
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrCandleStoreClosed
+	}
+	var (
+		from     time.Time
+		previous time.Time
+	)
+	if s.complete > 0 {
+		previous = time.Unix(s.times[s.complete-1], 0).UTC()
+		from = previous.Add(time.Second)
+	} else {
+		from, _ = s.request.From.Parse()
+	}
+	synced := s.complete > 0
+	s.mu.RUnlock()
+	if !synced && from.IsZero() {
+		return nil, ErrCandleStoreFrom
+	}
+
+	result, err := s.candles.Download(&s.request, from, to)
+	if err == ErrInvalidRange && synced {
+		// Already up to date
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, int64(len(result.Candles))*s.recordSize)
+	times := make([]int64, 0, len(result.Candles))
+	complete := -1
+	for i := range result.Candles {
+		candle := &result.Candles[i]
+		t, err := candle.Time.Parse()
+		if err != nil {
+			return nil, err
+		}
+		if buf, err = s.encode(buf, t, candle); err != nil {
+			return nil, err
+		}
+		times = append(times, t.Unix())
+		if candle.Complete {
+			complete = len(times) - 1
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrCandleStoreClosed
+	}
+	// Replace the trailing incomplete candle
+	offset := s.header + int64(s.complete)*s.recordSize
+	if err = s.f.Truncate(offset); err != nil {
+		return nil, err
+	}
+	s.times = s.times[:s.complete]
+	if len(buf) > 0 {
+		if _, err = s.f.WriteAt(buf, offset); err != nil {
+			_ = s.f.Truncate(offset)
+			return nil, err
+		}
+	}
+	if err = s.f.Sync(); err != nil {
+		return nil, err
+	}
+	s.complete += complete + 1
+	s.times = append(s.times, times...)
+	return s.gaps(previous, times), nil
+}
+
+// gaps reports the missing candles between previous and times that are not
+// explained by the market being closed. A gap that runs into or out of a market
+// close is reported as the ranges the market is open within it. Gaps are not
+// reported for weekly and monthly candles.
+func (s *CandleStore) gaps(previous time.Time, times []int64) []CandleGap {
+	granularity := s.request.Granularity
+	if granularity == model.CandlestickGranularity_W || granularity == model.CandlestickGranularity_M {
+		return nil
+	}
+	d, _ := GranularityDuration(granularity)
+	step := d
+	if step > time.Hour {
+		step = time.Hour
+	}
+	// Daily alignment follows daylight saving time in the alignment timezone
+	tolerance := time.Duration(0)
+	if d >= time.Hour*2 {
+		tolerance = time.Hour
+	}
+
+	var gaps []CandleGap
+	prev := previous
+	for _, unix := range times {
+		t := time.Unix(unix, 0).UTC()
+		if !prev.IsZero() && t.Sub(prev) > d+tolerance {
+			var open time.Time
+			for x := prev.Add(d); ; x = x.Add(step) {
+				end := !x.Before(t)
+				if !end && !s.marketClosed(x) {
+					if open.IsZero() {
+						open = x
+					}
+					continue
+				}
+				if !open.IsZero() {
+					if x.After(t) {
+						x = t
+					}
+					if missing := int((x.Sub(open) + d/2) / d); missing > 0 {
+						gaps = append(gaps, CandleGap{From: open, To: x, Missing: missing})
+					}
+					open = time.Time{}
+				}
+				if end {
+					break
+				}
+			}
+		}
+		prev = t
+	}
+	return gaps
+}
+
+// Range returns the stored candles starting within [from, to). A zero to returns
+// every candle after from.
+func (s *CandleStore) Range(from, to time.Time) ([]model.Candlestick, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrCandleStoreClosed
+	}
+	start := sort.Search(len(s.times), func(i int) bool {
+		return s.times[i] >= from.Unix()
+	})
+	end := len(s.times)
+	if !to.IsZero() {
+		end = sort.Search(len(s.times), func(i int) bool {
+			return s.times[i] >= to.Unix()
+		})
+	}
+	if start >= end {
+		return nil, nil
+	}
+
+	buf := make([]byte, int64(end-start)*s.recordSize)
+	if _, err := s.f.ReadAt(buf, s.header+int64(start)*s.recordSize); err != nil {
+		return nil, err
+	}
+	candles := make([]model.Candlestick, end-start)
+	for i := range candles {
+		s.decode(buf[int64(i)*s.recordSize:int64(i+1)*s.recordSize], &candles[i])
+	}
+	return candles, nil
+}
+
+func (s *CandleStore) encode(b []byte, t time.Time, candle *model.Candlestick) ([]byte, error) {
+	data := s.components(candle)
+	digits := 0
+	for _, d := range data {
+		if d == nil {
+			return nil, ErrCandleComponent
+		}
+		for _, v := range []model.PriceValue{d.Open, d.High, d.Low, d.Close} {
+			if n := priceDigits(string(v)); n > digits {
+				digits = n
+			}
+		}
+	}
+	if digits > candleMaxDigits {
+		return nil, ErrCandlePrice
+	}
+
+	var flags byte
+	if candle.Complete {
+		flags |= candleFlagComplete
+	}
+	b = appendUint64(b, uint64(t.Unix()))
+	b = appendUint64(b, uint64(candle.Volume))
+	b = append(b, flags, byte(digits))
+	for _, d := range data {
+		for _, v := range []model.PriceValue{d.Open, d.High, d.Low, d.Close} {
+			n, ok := parseScaled(string(v), digits)
+			if !ok {
+				return nil, ErrCandlePrice
+			}
+			b = appendUint64(b, uint64(n))
+		}
+	}
+	return b, nil
+}
+
+func (s *CandleStore) decode(b []byte, candle *model.Candlestick) {
+	candle.Time = model.DateTime(time.Unix(int64(binary.LittleEndian.Uint64(b)), 0).UTC().Format(candleTimeLayout))
+	candle.Volume = int64(binary.LittleEndian.Uint64(b[8:]))
+	candle.Complete = b[16]&candleFlagComplete != 0
+	digits := int(b[17])
+	b = b[candleRecordBaseSize:]
+	next := func() *model.CandlestickData {
+		d := &model.CandlestickData{
+			Open:  model.PriceValue(formatScaled(int64(binary.LittleEndian.Uint64(b)), digits)),
+			High:  model.PriceValue(formatScaled(int64(binary.LittleEndian.Uint64(b[8:])), digits)),
+			Low:   model.PriceValue(formatScaled(int64(binary.LittleEndian.Uint64(b[16:])), digits)),
+			Close: model.PriceValue(formatScaled(int64(binary.LittleEndian.Uint64(b[24:])), digits)),
+		}
+		b = b[candleRecordDataSize:]
+		return d
+	}
+	if s.mask&candleComponentBid != 0 {
+		candle.Bid = next()
+	}
+	if s.mask&candleComponentAsk != 0 {
+		candle.Ask = next()
+	}
+	if s.mask&candleComponentMid != 0 {
+		candle.Mid = next()
+	}
+}
+
+// components returns the stored price components of the candle in record order.
+func (s *CandleStore) components(candle *model.Candlestick) []*model.CandlestickData {
+	data := make([]*model.CandlestickData, 0, 3)
+	if s.mask&candleComponentBid != 0 {
+		data = append(data, candle.Bid)
+	}
+	if s.mask&candleComponentAsk != 0 {
+		data = append(data, candle.Ask)
+	}
+	if s.mask&candleComponentMid != 0 {
+		data = append(data, candle.Mid)
+	}
+	return data
+}
+
+func (s *CandleStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.f.Close()
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// priceDigits returns the number of decimal places of a decimal string.
+func priceDigits(s string) int {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// parseScaled parses a decimal string into an integer scaled by 10^digits.
+func parseScaled(s string, digits int) (int64, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+	frac := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], s[i+1:]
+	}
+	if len(frac) > digits {
+		return 0, false
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+	n, err := strconv.ParseInt(s+frac, 10, 64)
+	return n, err == nil
+}
+
+// formatScaled formats an integer scaled by 10^digits as a decimal string.
+func formatScaled(n int64, digits int) string {
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	s := strconv.FormatInt(n, 10)
+	if digits > 0 {
+		if len(s) <= digits {
+			s = strings.Repeat("0", digits-len(s)+1) + s
+		}
+		s = s[:len(s)-digits] + "." + s[len(s)-digits:]
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s
+}
+
+// CandleCache opens CandleStores within a single directory, keyed by instrument,
+// granularity and price component.
+type CandleCache struct {
+	dir     string
+	candles *Candles
+	stores  map[string]*CandleStore
+	mu      sync.Mutex
+}
+
+func NewCandleCache(dir string, candles *Candles) *CandleCache {
+	return &CandleCache{
+		dir:     dir,
+		candles: candles,
+		stores:  make(map[string]*CandleStore),
+	}
+}
+
+// Store returns the open CandleStore for the request, opening it if needed. A
+// request with a different alignment than the open store fails with
+// ErrCandleStoreMismatch.
+func (c *CandleCache) Store(request *model.InstrumentCandlesRequest) (*CandleStore, error) {
+	if request == nil {
+		return nil, errors.New("request required")
+	}
+	granularity := request.Granularity
+	if len(granularity) == 0 {
+		granularity = model.CandlestickGranularity_S5
+	}
+	price := request.Price
+	if len(price) == 0 {
+		price = model.PricingComponent_MID
+	}
+	key := candleStoreName(request.Instrument, granularity, candleComponents(price))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.stores[key]; s != nil {
+		if !s.aligned(request) {
+			return nil, ErrCandleStoreMismatch
+		}
+		return s, nil
+	}
+	s, err := OpenCandleStore(c.dir, c.candles, request)
+	if err != nil {
+		return nil, err
+	}
+	c.stores[key] = s
+	return s, nil
+}
+
+// Close closes every store opened through the cache.
+func (c *CandleCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for key, s := range c.stores {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(c.stores, key)
+	}
+	return err
+}
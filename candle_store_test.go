@@ -0,0 +1,206 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestCandles returns a downloader serving minute candles from series. Candles
+// starting at or after now are reported incomplete.
+func newTestCandles(series func() []time.Time, now func() time.Time) *Candles {
+	return &Candles{
+		concurrency: 2,
+		fetch: func(r *model.InstrumentCandlesRequest) (*model.CandlestickResponse, error) {
+			from, _ := r.From.Parse()
+			to, _ := r.To.Parse()
+			resp := &model.CandlestickResponse{Instrument: r.Instrument, Granularity: r.Granularity}
+			for _, ts := range series() {
+				if ts.Before(from.Truncate(time.Minute)) || ts.After(to) {
+					continue
+				}
+				resp.Candles = append(resp.Candles, &model.Candlestick{
+					Time: model.DateTime(ts.Format(time.RFC3339)),
+					Bid: &model.CandlestickData{
+						Open: "1.10250", High: "1.1030", Low: "1.1", Close: "1.10255",
+					},
+					Ask: &model.CandlestickData{
+						Open: "1.10260", High: "1.1031", Low: "1.10011", Close: "1.10265",
+					},
+					Volume:   ts.Unix() % 100,
+					Complete: ts.Add(time.Minute).Before(now()),
+				})
+			}
+			return resp, nil
+		},
+	}
+}
+
+func TestCandleStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "candles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Thursday 2021-01-07 12:00 UTC
+	start := time.Date(2021, 1, 7, 12, 0, 0, 0, time.UTC)
+	var series []time.Time
+	for i := 0; i < 120; i++ {
+		// Minutes 50 to 54 are missing
+		if i >= 50 && i < 55 {
+			continue
+		}
+		series = append(series, start.Add(time.Duration(i)*time.Minute))
+	}
+	// Friday close to Sunday open
+	friday := time.Date(2021, 1, 8, 21, 59, 0, 0, time.UTC)
+	sunday := time.Date(2021, 1, 10, 22, 0, 0, 0, time.UTC)
+	now := start.Add(100*time.Minute + 30*time.Second)
+	candles := newTestCandles(
+		func() []time.Time { return series },
+		func() time.Time { return now },
+	)
+
+	request := model.NewInstrumentCandlesRequest("EUR_USD", start).
+		WithGranularity(model.CandlestickGranularity_M1).
+		WithPrice("BA")
+	cache := NewCandleCache(dir, candles)
+	store, err := cache.Store(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps, err := store.Sync(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 || gaps[0].Missing != 5 || !gaps[0].From.Equal(start.Add(50*time.Minute)) {
+		t.Fatalf("unexpected gaps %v", gaps)
+	}
+	utc := *request
+	if _, err = cache.Store(utc.WithAlignmentTimezone("UTC")); err != ErrCandleStoreMismatch {
+		t.Fatalf("expected ErrCandleStoreMismatch from the cache got %v", err)
+	}
+	// 95 complete candles and the incomplete one at minute 100
+	if store.Len() != 96 || !store.LastComplete().Equal(start.Add(99*time.Minute)) {
+		t.Fatalf("unexpected store after first sync %d %v", store.Len(), store.LastComplete())
+	}
+
+	// An empty store has nowhere to start without a From
+	empty, err := cache.Store(&model.InstrumentCandlesRequest{
+		Instrument:  "GBP_USD",
+		Granularity: model.CandlestickGranularity_M1,
+		Price:       "BA",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = empty.Sync(now); err != ErrCandleStoreFrom {
+		t.Fatalf("expected ErrCandleStoreFrom got %v", err)
+	}
+
+	series = append(series, friday, sunday)
+	now = sunday.Add(time.Hour)
+	if gaps, err = store.Sync(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 || !gaps[0].From.Equal(start.Add(120*time.Minute)) {
+		t.Fatalf("unexpected gaps after second sync %v", gaps)
+	}
+	if store.Len() != 117 || !store.Last().Equal(sunday) {
+		t.Fatalf("unexpected store after second sync %d %v", store.Len(), store.Last())
+	}
+	if err = cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen read only and query
+	store, err = OpenCandleStore(dir, nil, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if store.Len() != 117 || store.Price() != "BA" {
+		t.Fatal("store not reloaded")
+	}
+	r, err := store.Range(start.Add(48*time.Minute), start.Add(56*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 3 {
+		t.Fatalf("expected 3 candles got %d", len(r))
+	}
+	c := r[2]
+	ts, _ := c.Time.Parse()
+	if !ts.Equal(start.Add(55*time.Minute)) || !c.Complete || c.Mid != nil {
+		t.Fatal("unexpected candle")
+	}
+	if c.Bid.Open != "1.10250" || c.Bid.High != "1.10300" || c.Bid.Low != "1.10000" ||
+		c.Ask.Low != "1.10011" || c.Volume != ts.Unix()%100 {
+		t.Fatalf("prices did not round trip %+v %+v", c.Bid, c.Ask)
+	}
+
+	_ = store.Close()
+	if _, err = OpenCandleStore(dir, nil, request.WithAlignmentTimezone("UTC")); err != ErrCandleStoreMismatch {
+		t.Fatal("expected ErrCandleStoreMismatch")
+	}
+}
+
+func TestMarketClosed(t *testing.T) {
+	for _, c := range []struct {
+		t      time.Time
+		closed bool
+	}{
+		{time.Date(2021, 1, 8, 21, 59, 0, 0, time.UTC), false},
+		{time.Date(2021, 1, 8, 22, 0, 0, 0, time.UTC), true},
+		{time.Date(2021, 1, 9, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2021, 1, 10, 21, 59, 0, 0, time.UTC), true},
+		{time.Date(2021, 1, 10, 22, 0, 0, 0, time.UTC), false},
+		{time.Date(2020, 12, 24, 23, 0, 0, 0, time.UTC), true},
+		{time.Date(2021, 7, 9, 20, 59, 0, 0, time.UTC), false},
+		{time.Date(2021, 7, 9, 21, 0, 0, 0, time.UTC), true},
+	} {
+		if MarketClosed(c.t) != c.closed {
+			t.Errorf("%v: expected closed=%v", c.t, c.closed)
+		}
+	}
+}
+
+func TestCandleStoreGapsAroundClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "candles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	request := model.NewInstrumentCandlesRequest("EUR_USD", time.Time{}).
+		WithGranularity(model.CandlestickGranularity_M1).
+		WithPrice("M")
+	store, err := OpenCandleStore(dir, nil, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// The feed stops ten minutes before the Friday close and resumes five minutes
+	// after the Sunday open
+	friday := time.Date(2021, 1, 8, 21, 49, 0, 0, time.UTC)
+	sunday := time.Date(2021, 1, 10, 22, 5, 0, 0, time.UTC)
+	gaps := store.gaps(friday, []int64{sunday.Unix()})
+	if len(gaps) != 2 {
+		t.Fatalf("expected a gap on either side of the close got %v", gaps)
+	}
+	if !gaps[0].From.Equal(friday.Add(time.Minute)) || !gaps[0].To.Equal(friday.Add(11*time.Minute)) || gaps[0].Missing != 10 {
+		t.Fatalf("unexpected gap before the close %+v", gaps[0])
+	}
+	if !gaps[1].From.Equal(sunday.Add(-5*time.Minute)) || !gaps[1].To.Equal(sunday) || gaps[1].Missing != 5 {
+		t.Fatalf("unexpected gap after the open %+v", gaps[1])
+	}
+
+	// A gap within the close is explained
+	if gaps = store.gaps(friday.Add(11*time.Minute), []int64{sunday.Add(-5 * time.Minute).Unix()}); len(gaps) != 0 {
+		t.Fatalf("unexpected gaps within the close %v", gaps)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"strconv"
+)
+
+func (a *app) accounts(args []string) error {
+	if _, err := a.parse(a.flags("accounts", ""), args, 0, 0); err != nil {
+		return err
+	}
+	resp, err := a.conn.Accounts()
+	if err != nil {
+		return err
+	}
+	summaries := make([]*model.AccountSummary, 0, len(resp.Accounts))
+	rows := make([][]string, 0, len(resp.Accounts))
+	for _, props := range resp.Accounts {
+		summary, err := a.conn.AccountSummary(props.ID)
+		if err != nil {
+			return err
+		}
+		s := summary.Account
+		summaries = append(summaries, s)
+		rows = append(rows, []string{
+			string(s.Id),
+			s.Alias,
+			string(s.Currency),
+			string(s.Balance),
+			string(s.NAV),
+			string(s.UnrealizedPL),
+			string(s.MarginUsed),
+			string(s.MarginAvailable),
+			strconv.FormatInt(s.OpenTradeCount, 10),
+			strconv.FormatInt(s.PendingOrderCount, 10),
+		})
+	}
+	return a.out.print(summaries, []string{
+		"ID", "ALIAS", "CURRENCY", "BALANCE", "NAV", "UNREALIZED", "MARGIN USED", "MARGIN AVAILABLE", "TRADES", "ORDERS",
+	}, rows)
+}
+
+func (a *app) summary(args []string) error {
+	if _, err := a.parse(a.flags("summary", ""), args, 0, 0); err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, err := a.conn.AccountSummary(id)
+	if err != nil {
+		return err
+	}
+	s := resp.Account
+	return a.out.fields(resp,
+		"ID", string(s.Id),
+		"Alias", s.Alias,
+		"Currency", string(s.Currency),
+		"Balance", string(s.Balance),
+		"NAV", string(s.NAV),
+		"Unrealized P/L", string(s.UnrealizedPL),
+		"Realized P/L", string(s.PL),
+		"Margin used", string(s.MarginUsed),
+		"Margin available", string(s.MarginAvailable),
+		"Margin closeout percent", string(s.MarginCloseoutPercent),
+		"Open Trades", strconv.FormatInt(s.OpenTradeCount, 10),
+		"Open Positions", strconv.FormatInt(s.OpenPositionCount, 10),
+		"Pending Orders", strconv.FormatInt(s.PendingOrderCount, 10),
+		"Hedging", strconv.FormatBool(s.HedgingEnabled),
+		"Last Transaction", string(resp.LastTransactionID),
+	)
+}
+
+func (a *app) orders(args []string) error {
+	if _, err := a.parse(a.flags("orders", ""), args, 0, 0); err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, err := a.conn.OrdersPending(id)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Orders))
+	for _, o := range resp.Orders {
+		rows = append(rows, []string{
+			o.Id, o.Type, string(o.Instrument), string(o.Units), string(o.Price), o.TradeID, string(o.TimeInForce), string(o.CreateTime),
+		})
+	}
+	return a.out.print(resp, []string{"ID", "TYPE", "INSTRUMENT", "UNITS", "PRICE", "TRADE", "TIF", "CREATED"}, rows)
+}
+
+func (a *app) trades(args []string) error {
+	if _, err := a.parse(a.flags("trades", ""), args, 0, 0); err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, err := a.conn.TradesOpen(id)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Trades))
+	for _, t := range resp.Trades {
+		rows = append(rows, []string{
+			string(t.Id), string(t.Instrument), string(t.CurrentUnits), string(t.Price), string(t.UnrealizedPL), string(t.OpenTime),
+		})
+	}
+	return a.out.print(resp, []string{"ID", "INSTRUMENT", "UNITS", "PRICE", "UNREALIZED", "OPENED"}, rows)
+}
+
+func (a *app) positions(args []string) error {
+	if _, err := a.parse(a.flags("positions", ""), args, 0, 0); err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, err := a.conn.PositionsOpen(id)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Positions))
+	for _, p := range resp.Positions {
+		var long, short model.PositionSide
+		if p.Long != nil {
+			long = *p.Long
+		}
+		if p.Short != nil {
+			short = *p.Short
+		}
+		rows = append(rows, []string{
+			string(p.Instrument), string(long.Units), string(long.AveragePrice), string(short.Units), string(short.AveragePrice), string(p.UnrealizedPL),
+		})
+	}
+	return a.out.print(resp, []string{"INSTRUMENT", "LONG", "LONG PRICE", "SHORT", "SHORT PRICE", "UNREALIZED"}, rows)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The keys of the configuration file and the environment. The tokens use the same
+// keys as the .env file of the endpoint tests.
+const (
+	envConfig        = "OANDA_CONFIG"
+	envToken         = "OANDA_API_KEY"
+	envPracticeToken = "OANDA_PRACTICE_API_KEY"
+	envAccount       = "OANDA_ACCOUNT_ID"
+	envLive          = "OANDA_LIVE"
+	envRESTURL       = "OANDA_REST_URL"
+	envStreamURL     = "OANDA_STREAM_URL"
+)
+
+type config struct {
+	Token     string
+	Account   model.AccountID
+	Live      bool
+	RESTURL   string
+	StreamURL string
+	liveSet   bool
+}
+
+// loadConfig reads the configuration file at path, which may be empty, and overrides
+// it with the environment and the flags. The practice environment uses
+// OANDA_PRACTICE_API_KEY if it is set and OANDA_API_KEY otherwise.
+func loadConfig(path string, getenv func(key string) string, flags *config) (*config, error) {
+	values := make(map[string]string)
+	if len(path) > 0 {
+		if err := readConfigFile(path, values); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range [...]string{envToken, envPracticeToken, envAccount, envLive, envRESTURL, envStreamURL} {
+		if v := getenv(key); len(v) > 0 {
+			values[key] = v
+		}
+	}
+
+	c := &config{
+		Account:   model.AccountID(values[envAccount]),
+		RESTURL:   values[envRESTURL],
+		StreamURL: values[envStreamURL],
+	}
+	if v := values[envLive]; len(v) > 0 {
+		live, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("invalid " + envLive + ": " + v)
+		}
+		c.Live = live
+	}
+	if flags.liveSet {
+		c.Live = flags.Live
+	}
+	c.Token = values[envToken]
+	if v := values[envPracticeToken]; !c.Live && len(v) > 0 {
+		c.Token = v
+	}
+	if len(flags.Token) > 0 {
+		c.Token = flags.Token
+	}
+	if len(flags.Account) > 0 {
+		c.Account = flags.Account
+	}
+	if len(flags.RESTURL) > 0 {
+		c.RESTURL = flags.RESTURL
+	}
+	if len(flags.StreamURL) > 0 {
+		c.StreamURL = flags.StreamURL
+	}
+	if len(c.Token) == 0 {
+		return nil, errors.New("token required, set " + envToken + " or use -token")
+	}
+	return c, nil
+}
+
+// readConfigFile reads KEY=VALUE lines. Empty lines and lines starting with # are
+// ignored.
+func readConfigFile(path string, values map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		index := strings.IndexByte(line, '=')
+		if index < 0 {
+			return errors.New(path + ":" + strconv.Itoa(n) + ": expected KEY=VALUE")
+		}
+		values[strings.TrimSpace(line[:index])] = strings.Trim(strings.TrimSpace(line[index+1:]), `"'`)
+	}
+	return scanner.Err()
+}
+
+// connect creates the Connection for the environment or the URLs.
+func (c *config) connect() (*endpoint.Connection, error) {
+	if len(c.RESTURL) == 0 {
+		return endpoint.NewConnection(c.Token, c.Live), nil
+	}
+	streamURL := c.StreamURL
+	if len(streamURL) == 0 {
+		streamURL = c.RESTURL
+	}
+	return endpoint.NewConnectionURL(c.Token, c.RESTURL, streamURL)
+}
@@ -0,0 +1,229 @@
+// Command oanda inspects and acts on OANDA v20 Accounts from the command line.
+//
+// Usage:
+//
+//	oanda [flags] <command> [arguments]
+//
+// The token, Account and environment are read from a configuration file, the
+// environment and the flags, in increasing order of precedence. See config.go for
+// the supported keys.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+)
+
+const usage = `Usage: oanda [flags] <command> [arguments]
+
+Commands:
+  accounts                          list the Accounts of the token with their summaries
+  summary                           show the summary of the Account
+  instruments [names...]            list the tradeable instruments of the Account
+  prices <names...>                 show the current prices
+  candles -instrument <name> ...    download candles as CSV or JSONL
+  stream prices <names...>          tail the pricing stream
+  stream transactions               tail the transaction stream
+  orders                            list the pending Orders
+  trades                            list the open Trades
+  positions                         list the open Positions
+  order create -instrument <name> -units <units> ...
+  order replace <id> -instrument <name> -units <units> ...
+  order cancel <id>
+  trade close <id> [-units <units>]
+  position close <instrument> [-long <units>] [-short <units>]
+
+Run 'oanda <command> -h' for the flags of a command.
+
+Flags:
+`
+
+// errUsage reports invalid arguments. The usage has already been printed.
+var errUsage = errors.New("usage")
+
+type command func(a *app, args []string) error
+
+var commands = map[string]command{
+	"accounts":    (*app).accounts,
+	"summary":     (*app).summary,
+	"instruments": (*app).instruments,
+	"prices":      (*app).prices,
+	"candles":     (*app).candles,
+	"stream":      (*app).stream,
+	"orders":      (*app).orders,
+	"trades":      (*app).trades,
+	"positions":   (*app).positions,
+	"order":       (*app).order,
+	"trade":       (*app).trade,
+	"position":    (*app).position,
+}
+
+// app is the state shared by the commands.
+type app struct {
+	config *config
+	conn   *endpoint.Connection
+	out    *printer
+	stdout io.Writer
+	stderr io.Writer
+	// Closed to stop a stream, for example on an interrupt.
+	interrupt <-chan struct{}
+}
+
+func main() {
+	interrupt := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		close(interrupt)
+	}()
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr, interrupt))
+}
+
+// run executes the command line and returns the exit code.
+func run(
+	args []string,
+	getenv func(key string) string,
+	stdout, stderr io.Writer,
+	interrupt <-chan struct{},
+) int {
+	fs := flag.NewFlagSet("oanda", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	var flags config
+	configPath := fs.String("config", getenv(envConfig), "configuration `file` with KEY=VALUE lines")
+	fs.StringVar(&flags.Token, "token", "", "API `token`")
+	fs.StringVar((*string)(&flags.Account), "account", "", "Account `ID`, defaults to the only Account of the token")
+	live := fs.Bool("live", false, "use the live environment instead of practice")
+	fs.StringVar(&flags.RESTURL, "rest-url", "", "REST `url` replacing the OANDA host")
+	fs.StringVar(&flags.StreamURL, "stream-url", "", "streaming `url` replacing the OANDA host")
+	output := fs.String("output", "table", "output `format`: table or json")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd := commands[fs.Arg(0)]
+	if cmd == nil {
+		_, _ = fmt.Fprintf(stderr, "oanda: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		_, _ = fmt.Fprintf(stderr, "oanda: unknown output format %q\n", *output)
+		return 2
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "live" {
+			flags.Live, flags.liveSet = *live, true
+		}
+	})
+
+	cfg, err := loadConfig(*configPath, getenv, &flags)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "oanda:", err)
+		return 1
+	}
+	conn, err := cfg.connect()
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "oanda:", err)
+		return 1
+	}
+	a := &app{
+		config:    cfg,
+		conn:      conn,
+		out:       &printer{w: stdout, json: *output == "json"},
+		stdout:    stdout,
+		stderr:    stderr,
+		interrupt: interrupt,
+	}
+	if err = cmd(a, fs.Args()[1:]); err != nil {
+		if err == errUsage {
+			return 2
+		}
+		_, _ = fmt.Fprintln(stderr, "oanda:", err)
+		return 1
+	}
+	return 0
+}
+
+// flags creates the flag set of a command.
+func (a *app) flags(name string, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(a.stderr, "Usage: oanda %s %s\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the arguments of a command, which may mix flags and positional
+// arguments, and checks the number of positional arguments.
+func (a *app) parse(fs *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// subcommand dispatches the first argument to one of the subcommands.
+func (a *app) subcommand(name string, args []string, subcommands map[string]command) error {
+	if len(args) > 0 {
+		if cmd := subcommands[args[0]]; cmd != nil {
+			return cmd(a, args[1:])
+		}
+	}
+	names := make([]string, 0, len(subcommands))
+	for n := range subcommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	_, _ = fmt.Fprintf(a.stderr, "Usage: oanda %s <%s> [arguments]\n", name, strings.Join(names, "|"))
+	return errUsage
+}
+
+// account returns the configured Account or the only Account of the token.
+func (a *app) account() (model.AccountID, error) {
+	if len(a.config.Account) > 0 {
+		return a.config.Account, nil
+	}
+	resp, err := a.conn.Accounts()
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Accounts) != 1 {
+		return "", fmt.Errorf("the token has %d Accounts, select one with -account or %s", len(resp.Accounts), envAccount)
+	}
+	a.config.Account = resp.Accounts[0].ID
+	return a.config.Account, nil
+}
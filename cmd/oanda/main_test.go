@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestCLI(t *testing.T) (*oandatest.Server, func(args ...string) (string, string, int)) {
+	t.Helper()
+	s := oandatest.NewTestServer(10000, oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1, Ask: 1.1002})
+	t.Cleanup(s.Close)
+	env := map[string]string{envToken: "token", envRESTURL: s.URL()}
+	return s, func(args ...string) (string, string, int) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := run(args, func(key string) string { return env[key] }, stdout, stderr, make(chan struct{}))
+		return stdout.String(), stderr.String(), code
+	}
+}
+
+func TestAccountCommands(t *testing.T) {
+	_, oanda := newTestCLI(t)
+	out, stderr, code := oanda("accounts")
+	if code != 0 || !strings.Contains(out, string(oandatest.TestAccount)) || !strings.HasPrefix(out, "ID ") {
+		t.Fatalf("unexpected accounts %d %s %s", code, out, stderr)
+	}
+
+	// The only Account is used without -account
+	out, _, code = oanda("-output", "json", "summary")
+	summary := &model.AccountSummaryResponse{}
+	if err := json.Unmarshal([]byte(out), summary); err != nil || code != 0 {
+		t.Fatalf("unexpected summary %d %v %s", code, err, out)
+	}
+	if summary.Account.Id != oandatest.TestAccount || summary.Account.Balance != "10000.0000" {
+		t.Fatalf("unexpected summary %+v", summary.Account)
+	}
+
+	if _, _, code = oanda("unknown"); code != 2 {
+		t.Fatalf("expected a usage error got %d", code)
+	}
+	if _, stderr, code = oanda("-account", "101-001-1-999", "summary"); code != 1 || !strings.Contains(stderr, "oanda:") {
+		t.Fatalf("expected an error got %d %s", code, stderr)
+	}
+}
+
+func TestMarketCommands(t *testing.T) {
+	s, oanda := newTestCLI(t)
+	out, _, code := oanda("-output", "json", "prices", "EUR_USD")
+	var prices []*model.ClientPrice
+	if err := json.Unmarshal([]byte(out), &prices); err != nil || code != 0 {
+		t.Fatalf("unexpected prices %d %v %s", code, err, out)
+	}
+	if len(prices) != 1 || prices[0].Bids[0].Price != "1.10000" {
+		t.Fatalf("unexpected prices %s", out)
+	}
+
+	s.SetCandles("EUR_USD", "M1",
+		&model.Candlestick{Time: "2021-03-01T12:00:00.000000000Z", Mid: &model.CandlestickData{Open: "1.1", High: "1.2", Low: "1.0", Close: "1.15"}, Volume: 10, Complete: true},
+		&model.Candlestick{Time: "2021-03-01T12:01:00.000000000Z", Mid: &model.CandlestickData{Open: "1.15", High: "1.2", Low: "1.1", Close: "1.12"}, Volume: 5},
+	)
+	path := filepath.Join(t.TempDir(), "candles.csv")
+	if _, stderr, code := oanda("candles", "-instrument", "EUR_USD", "-count", "10", "-out", path); code != 0 {
+		t.Fatalf("unexpected candles %d %s", code, stderr)
+	}
+	b, _ := ioutil.ReadFile(path)
+	expected := "time,volume,complete,mid_o,mid_h,mid_l,mid_c\n" +
+		"2021-03-01T12:00:00.000000000Z,10,true,1.1,1.2,1.0,1.15\n" +
+		"2021-03-01T12:01:00.000000000Z,5,false,1.15,1.2,1.1,1.12\n"
+	if string(b) != expected {
+		t.Fatalf("unexpected csv %s", b)
+	}
+	out, _, _ = oanda("candles", "-instrument", "EUR_USD", "-format", "jsonl")
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"c":"1.12"`) {
+		t.Fatalf("unexpected jsonl %s", out)
+	}
+
+	out, _, code = oanda("-output", "json", "stream", "prices", "-n", "1", "EUR_USD")
+	if code != 0 || strings.Count(out, "\n") != 1 || !strings.Contains(out, `"instrument":"EUR_USD"`) {
+		t.Fatalf("unexpected stream %d %s", code, out)
+	}
+}
+
+func TestOrderCommands(t *testing.T) {
+	_, oanda := newTestCLI(t)
+	out, stderr, code := oanda("order", "create", "-instrument", "EUR_USD", "-units", "1000")
+	if code != 0 || !strings.Contains(out, "ORDER_FILL") {
+		t.Fatalf("unexpected order create %d %s %s", code, out, stderr)
+	}
+	out, _, _ = oanda("-output", "json", "trades")
+	trades := &model.TradesResponse{}
+	if err := json.Unmarshal([]byte(out), trades); err != nil || len(trades.Trades) != 1 {
+		t.Fatalf("unexpected trades %v %s", err, out)
+	}
+
+	// A reject is printed along with the error
+	out, _, code = oanda("order", "create", "-instrument", "EUR_USD", "-units", "0")
+	if code != 1 || !strings.Contains(out, "MARKET_ORDER_REJECT") {
+		t.Fatalf("expected a reject got %d %s", code, out)
+	}
+
+	out, _, code = oanda("order", "create", "-type", "limit", "-instrument", "EUR_USD", "-units", "100", "-price", "1.05")
+	if code != 0 || !strings.Contains(out, "LIMIT_ORDER") {
+		t.Fatalf("unexpected limit order %d %s", code, out)
+	}
+	out, _, _ = oanda("-output", "json", "orders")
+	orders := &model.OrdersResponse{}
+	if err := json.Unmarshal([]byte(out), orders); err != nil || len(orders.Orders) != 1 {
+		t.Fatalf("unexpected orders %v %s", err, out)
+	}
+	orderID := orders.Orders[0].Id
+	if out, _, code = oanda("order", "replace", orderID, "-type", "LIMIT", "-instrument", "EUR_USD", "-units", "200", "-price", "1.06"); code != 0 || !strings.Contains(out, "ORDER_CANCEL") {
+		t.Fatalf("unexpected replace %d %s", code, out)
+	}
+	out, _, _ = oanda("-output", "json", "orders")
+	orders = &model.OrdersResponse{}
+	_ = json.Unmarshal([]byte(out), orders)
+	if out, _, code = oanda("order", "cancel", orders.Orders[0].Id); code != 0 || !strings.Contains(out, "ORDER_CANCEL") {
+		t.Fatalf("unexpected cancel %d %s", code, out)
+	}
+
+	if out, _, code = oanda("trade", "close", string(trades.Trades[0].Id), "-units", "400"); code != 0 || !strings.Contains(out, "-400") {
+		t.Fatalf("unexpected trade close %d %s", code, out)
+	}
+	if out, _, code = oanda("position", "close", "EUR_USD"); code != 0 || !strings.Contains(out, "-600") {
+		t.Fatalf("unexpected position close %d %s", code, out)
+	}
+	if _, stderr, code = oanda("position", "close", "EUR_USD"); code != 1 || !strings.Contains(stderr, "no open position") {
+		t.Fatalf("expected no position got %d %s", code, stderr)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oanda.env")
+	content := "# OANDA\nOANDA_API_KEY=live\nOANDA_PRACTICE_API_KEY = \"practice\"\nOANDA_ACCOUNT_ID=101-001-1-001\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	c, err := loadConfig(path, getenv, &config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "practice" || c.Account != "101-001-1-001" || c.Live {
+		t.Fatalf("unexpected config %+v", c)
+	}
+	env[envLive] = "true"
+	if c, _ = loadConfig(path, getenv, &config{}); c.Token != "live" || !c.Live {
+		t.Fatalf("unexpected live config %+v", c)
+	}
+	// Flags win over the environment
+	if c, _ = loadConfig(path, getenv, &config{Token: "flag", liveSet: true}); c.Token != "flag" || c.Live {
+		t.Fatalf("unexpected flag config %+v", c)
+	}
+	if _, err = loadConfig("", func(string) string { return "" }, &config{}); err == nil {
+		t.Fatal("expected a missing token error")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/kamaiu/oanda-go"
+	"github.com/kamaiu/oanda-go/model"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (a *app) instruments(args []string) error {
+	fs := a.flags("instruments", "[-type CURRENCY|CFD|METAL] [names...]")
+	typ := fs.String("type", "", "only list instruments of the `type`")
+	names, err := a.parse(fs, args, 0, -1)
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, err := a.conn.AccountInstruments(id, names...)
+	if err != nil {
+		return err
+	}
+	if len(*typ) > 0 {
+		filtered := resp.Instruments[:0]
+		for _, i := range resp.Instruments {
+			if strings.EqualFold(string(i.Type), *typ) {
+				filtered = append(filtered, i)
+			}
+		}
+		resp.Instruments = filtered
+	}
+	rows := make([][]string, 0, len(resp.Instruments))
+	for _, i := range resp.Instruments {
+		rows = append(rows, []string{
+			string(i.Name),
+			string(i.Type),
+			i.DisplayName,
+			strconv.FormatInt(i.PipLocation, 10),
+			strconv.FormatInt(i.DisplayPrecision, 10),
+			string(i.MinimumTradeSize),
+			string(i.MarginRate),
+		})
+	}
+	return a.out.print(resp.Instruments, []string{"NAME", "TYPE", "DISPLAY NAME", "PIP", "PRECISION", "MIN SIZE", "MARGIN"}, rows)
+}
+
+func (a *app) prices(args []string) error {
+	names, err := a.parse(a.flags("prices", "<names...>"), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	request := &model.PricingRequest{}
+	for _, name := range names {
+		request.Instruments = append(request.Instruments, model.InstrumentName(name))
+	}
+	resp, err := a.conn.Pricing(id, request)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Prices))
+	for _, p := range resp.Prices {
+		var bid, ask model.PriceValue
+		if len(p.Bids) > 0 {
+			bid = p.Bids[0].Price
+		}
+		if len(p.Asks) > 0 {
+			ask = p.Asks[0].Price
+		}
+		rows = append(rows, []string{string(p.Instrument), string(p.Time), string(bid), string(ask), strconv.FormatBool(p.Tradeable)})
+	}
+	return a.out.print(resp.Prices, []string{"INSTRUMENT", "TIME", "BID", "ASK", "TRADEABLE"}, rows)
+}
+
+func (a *app) candles(args []string) error {
+	fs := a.flags("candles", "-instrument <name> [-granularity M1] [-price BAM] [-from <time> [-to <time>] | -count <n>] [-format csv|jsonl] [-out <file>]")
+	instrument := fs.String("instrument", "", "the `instrument`")
+	granularity := fs.String("granularity", "M1", "the candle `granularity`")
+	price := fs.String("price", "M", "the price `components`, any of B, A and M")
+	from := fs.String("from", "", "download every candle from the RFC3339 `time`")
+	to := fs.String("to", "", "download the candles before the RFC3339 `time`, defaults to now")
+	count := fs.Int("count", 500, "the number of latest candles without -from")
+	format := fs.String("format", "csv", "the output `format`: csv or jsonl")
+	out := fs.String("out", "", "write to the `file` instead of the standard output")
+	if _, err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if len(*instrument) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if *format != "csv" && *format != "jsonl" {
+		return errors.New("unknown format " + *format)
+	}
+	if _, ok := oanda.GranularityDuration(model.CandlestickGranularity(*granularity)); !ok {
+		return oanda.ErrInvalidGranularity
+	}
+	request := &model.InstrumentCandlesRequest{
+		Instrument:  model.InstrumentName(*instrument),
+		Granularity: model.CandlestickGranularity(*granularity),
+		Price:       model.PricingComponent(strings.ToUpper(*price)),
+	}
+
+	var candles []*model.Candlestick
+	if len(*from) > 0 {
+		start, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			return err
+		}
+		var end time.Time
+		if len(*to) > 0 {
+			if end, err = time.Parse(time.RFC3339, *to); err != nil {
+				return err
+			}
+		}
+		result, err := oanda.NewCandles(a.conn, oanda.NewRateLimiter(oanda.DefaultRateLimit, oanda.DefaultRateBurst)).
+			Download(request, start, end)
+		if err != nil {
+			return err
+		}
+		candles = make([]*model.Candlestick, len(result.Candles))
+		for i := range result.Candles {
+			candles[i] = &result.Candles[i]
+		}
+	} else {
+		resp, err := a.conn.InstrumentCandles(request.WithCount(*count))
+		if err != nil {
+			return err
+		}
+		candles = resp.Candles
+	}
+
+	w := a.stdout
+	if len(*out) > 0 {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	var err error
+	if *format == "csv" {
+		err = writeCandlesCSV(bw, request.Price, candles)
+	} else {
+		enc := json.NewEncoder(bw)
+		for _, c := range candles {
+			if err = enc.Encode(c); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeCandlesCSV writes a header and a line per candle with the open, high, low and
+// close of every requested price component.
+func writeCandlesCSV(w *bufio.Writer, price model.PricingComponent, candles []*model.Candlestick) error {
+	type component struct {
+		name string
+		get  func(c *model.Candlestick) *model.CandlestickData
+	}
+	var components []component
+	for _, c := range string(price) {
+		switch c {
+		case 'B':
+			components = append(components, component{"bid", func(c *model.Candlestick) *model.CandlestickData { return c.Bid }})
+		case 'A':
+			components = append(components, component{"ask", func(c *model.Candlestick) *model.CandlestickData { return c.Ask }})
+		case 'M':
+			components = append(components, component{"mid", func(c *model.Candlestick) *model.CandlestickData { return c.Mid }})
+		}
+	}
+	cw := csv.NewWriter(w)
+	header := []string{"time", "volume", "complete"}
+	for _, c := range components {
+		header = append(header, c.name+"_o", c.name+"_h", c.name+"_l", c.name+"_c")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, candle := range candles {
+		record := []string{string(candle.Time), strconv.FormatInt(candle.Volume, 10), strconv.FormatBool(candle.Complete)}
+		for _, c := range components {
+			d := c.get(candle)
+			if d == nil {
+				d = &model.CandlestickData{}
+			}
+			record = append(record, string(d.Open), string(d.High), string(d.Low), string(d.Close))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/kamaiu/oanda-go/model"
+	"strings"
+)
+
+func (a *app) order(args []string) error {
+	return a.subcommand("order", args, map[string]command{
+		"create":  (*app).orderCreate,
+		"replace": (*app).orderReplace,
+		"cancel":  (*app).orderCancel,
+	})
+}
+
+// orderFlags are the flags that describe an Order to create or replace with.
+type orderFlags struct {
+	typ          *string
+	instrument   *string
+	units        *string
+	price        *string
+	timeInForce  *string
+	gtd          *string
+	positionFill *string
+	stopLoss     *string
+	takeProfit   *string
+	trailing     *string
+}
+
+func newOrderFlags(fs *flag.FlagSet) *orderFlags {
+	return &orderFlags{
+		typ:          fs.String("type", "MARKET", "the Order `type`: MARKET, LIMIT, STOP or MARKET_IF_TOUCHED"),
+		instrument:   fs.String("instrument", "", "the `instrument`"),
+		units:        fs.String("units", "", "the `units`, negative to sell"),
+		price:        fs.String("price", "", "the `price` of a LIMIT, STOP or MARKET_IF_TOUCHED Order or the price bound of a MARKET Order"),
+		timeInForce:  fs.String("tif", "", "the time in `force`, defaults to FOK for MARKET and GTC otherwise"),
+		gtd:          fs.String("gtd", "", "the RFC3339 `time` a GTD Order expires"),
+		positionFill: fs.String("position-fill", "", "the position `fill`: DEFAULT, REDUCE_FIRST, REDUCE_ONLY or OPEN_ONLY"),
+		stopLoss:     fs.String("sl", "", "the stop loss `price` on fill"),
+		takeProfit:   fs.String("tp", "", "the take profit `price` on fill"),
+		trailing:     fs.String("trailing", "", "the trailing stop loss `distance` on fill"),
+	}
+}
+
+func (f *orderFlags) request() (model.OrderRequest, error) {
+	if len(*f.instrument) == 0 || len(*f.units) == 0 {
+		return nil, errors.New("-instrument and -units required")
+	}
+	var (
+		instrument   = model.InstrumentName(*f.instrument)
+		units        = model.DecimalNumber(*f.units)
+		price        = model.PriceValue(*f.price)
+		timeInForce  = model.TimeInForce(strings.ToUpper(*f.timeInForce))
+		gtd          = model.DateTime(*f.gtd)
+		positionFill = model.OrderPositionFill(strings.ToUpper(*f.positionFill))
+		stopLoss     *model.StopLossDetails
+		takeProfit   *model.TakeProfitDetails
+		trailing     *model.TrailingStopLossDetails
+	)
+	if len(*f.stopLoss) > 0 {
+		stopLoss = &model.StopLossDetails{Price: model.PriceValue(*f.stopLoss)}
+	}
+	if len(*f.takeProfit) > 0 {
+		takeProfit = &model.TakeProfitDetails{Price: model.PriceValue(*f.takeProfit)}
+	}
+	if len(*f.trailing) > 0 {
+		trailing = &model.TrailingStopLossDetails{Distance: model.DecimalNumber(*f.trailing)}
+	}
+	typ := model.OrderType(strings.ToUpper(*f.typ))
+	if typ != model.OrderType_MARKET && len(price) == 0 {
+		return nil, errors.New("-price required for " + string(typ) + " Orders")
+	}
+	if len(timeInForce) == 0 {
+		timeInForce = model.TimeInForce_GTC
+		if typ == model.OrderType_MARKET {
+			timeInForce = model.TimeInForce_FOK
+		}
+	}
+
+	switch typ {
+	case model.OrderType_MARKET:
+		return &model.MarketOrderRequest{
+			Type:                   typ,
+			Instrument:             instrument,
+			Units:                  units,
+			TimeInForce:            timeInForce,
+			PriceBound:             price,
+			PositionFill:           positionFill,
+			StopLossOnFill:         stopLoss,
+			TakeProfitOnFill:       takeProfit,
+			TrailingStopLossOnFill: trailing,
+		}, nil
+	case model.OrderType_LIMIT:
+		return &model.LimitOrderRequest{
+			Type:                   typ,
+			Instrument:             instrument,
+			Units:                  units,
+			Price:                  price,
+			TimeInForce:            timeInForce,
+			GtdTime:                gtd,
+			PositionFill:           positionFill,
+			StopLossOnFill:         stopLoss,
+			TakeProfitOnFill:       takeProfit,
+			TrailingStopLossOnFill: trailing,
+		}, nil
+	case model.OrderType_STOP:
+		return &model.StopOrderRequest{
+			Type:                   typ,
+			Instrument:             instrument,
+			Units:                  units,
+			Price:                  price,
+			TimeInForce:            timeInForce,
+			GtdTime:                gtd,
+			PositionFill:           positionFill,
+			StopLossOnFill:         stopLoss,
+			TakeProfitOnFill:       takeProfit,
+			TrailingStopLossOnFill: trailing,
+		}, nil
+	case model.OrderType_MARKET_IF_TOUCHED:
+		return &model.MarketIfTouchedOrderRequest{
+			Type:                   typ,
+			Instrument:             instrument,
+			Units:                  units,
+			Price:                  price,
+			TimeInForce:            timeInForce,
+			GtdTime:                gtd,
+			PositionFill:           positionFill,
+			StopLossOnFill:         stopLoss,
+			TakeProfitOnFill:       takeProfit,
+			TrailingStopLossOnFill: trailing,
+		}, nil
+	}
+	return nil, errors.New("unsupported Order type " + string(typ))
+}
+
+func (a *app) orderCreate(args []string) error {
+	fs := a.flags("order create", "-instrument <name> -units <units> [flags]")
+	f := newOrderFlags(fs)
+	if _, err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	request, err := f.request()
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, reject, err := a.conn.OrderCreate(id, request)
+	return a.result(resp, reject, err)
+}
+
+func (a *app) orderReplace(args []string) error {
+	fs := a.flags("order replace", "<id> -instrument <name> -units <units> [flags]")
+	f := newOrderFlags(fs)
+	positional, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	request, err := f.request()
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, reject, err := a.conn.OrderReplace(id, model.OrderSpecifier(positional[0]), request)
+	return a.result(resp, reject, err)
+}
+
+func (a *app) orderCancel(args []string) error {
+	positional, err := a.parse(a.flags("order cancel", "<id>"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, reject, err := a.conn.OrderCancel(id, model.OrderSpecifier(positional[0]))
+	return a.result(resp, reject, err)
+}
+
+func (a *app) trade(args []string) error {
+	return a.subcommand("trade", args, map[string]command{
+		"close": (*app).tradeClose,
+	})
+}
+
+func (a *app) tradeClose(args []string) error {
+	fs := a.flags("trade close", "<id> [-units <units>]")
+	units := fs.String("units", "ALL", "the `units` to close")
+	positional, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	resp, reject, err := a.conn.TradeClose(id, model.TradeSpecifier(positional[0]), model.DecimalNumber(*units))
+	return a.result(resp, reject, err)
+}
+
+func (a *app) position(args []string) error {
+	return a.subcommand("position", args, map[string]command{
+		"close": (*app).positionClose,
+	})
+}
+
+func (a *app) positionClose(args []string) error {
+	fs := a.flags("position close", "<instrument> [-long <units>] [-short <units>]")
+	long := fs.String("long", "", "the long `units` to close, defaults to ALL of an open long side")
+	short := fs.String("short", "", "the short `units` to close, defaults to ALL of an open short side")
+	positional, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	instrument := model.InstrumentName(positional[0])
+	request := &model.PositionCloseRequest{LongUnits: *long, ShortUnits: *short}
+	if len(*long) == 0 && len(*short) == 0 {
+		// OANDA rejects closing a side without units
+		resp, err := a.conn.Position(id, instrument)
+		if err != nil {
+			return err
+		}
+		if p := resp.Position; p != nil {
+			if p.Long != nil && p.Long.Units.AsFloat64(0) != 0 {
+				request.LongUnits = "ALL"
+			}
+			if p.Short != nil && p.Short.Units.AsFloat64(0) != 0 {
+				request.ShortUnits = "ALL"
+			}
+		}
+		if len(request.LongUnits) == 0 && len(request.ShortUnits) == 0 {
+			return errors.New("no open position in " + string(instrument))
+		}
+	}
+	resp, reject, err := a.conn.PositionClose(id, instrument, request)
+	return a.result(resp, reject, err)
+}
+
+// result prints the response of a state changing request, or the reject if the
+// request failed with one, and returns the error.
+func (a *app) result(resp interface{}, reject interface{}, err error) error {
+	if err != nil {
+		if !isNil(reject) {
+			if printErr := a.out.transactions(reject); printErr != nil {
+				return printErr
+			}
+		}
+		return err
+	}
+	return a.out.transactions(resp)
+}
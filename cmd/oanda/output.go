@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes the result of a command as indented JSON or as a table.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as JSON or the header and rows as a table.
+func (p *printer) print(v interface{}, header []string, rows [][]string) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// fields writes v as JSON or the pairs of name and value as a two column table.
+func (p *printer) fields(v interface{}, pairs ...string) error {
+	rows := make([][]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rows = append(rows, []string{pairs[i], pairs[i+1]})
+	}
+	return p.print(v, []string{"FIELD", "VALUE"}, rows)
+}
+
+// transactions writes the response of a state changing request as JSON or as a
+// table of the Transactions it contains.
+func (p *printer) transactions(v interface{}) error {
+	if p.json {
+		return p.print(v, nil, nil)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if strings.HasSuffix(name, "Transaction") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	rows := make([][]string, 0, len(names)+1)
+	for _, name := range names {
+		if row := transactionRow(fields[name]); row != nil {
+			rows = append(rows, row)
+		}
+	}
+	if err = p.print(nil, transactionHeader, rows); err != nil {
+		return err
+	}
+	var status struct {
+		ErrorCode    string `json:"errorCode"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	_ = json.Unmarshal(b, &status)
+	if len(status.ErrorCode) > 0 || len(status.ErrorMessage) > 0 {
+		_, err = fmt.Fprintf(p.w, "%s %s\n", status.ErrorCode, status.ErrorMessage)
+	}
+	return err
+}
+
+var transactionHeader = []string{"ID", "TIME", "TYPE", "INSTRUMENT", "UNITS", "PRICE", "PL", "REASON"}
+
+// transactionRow returns the table row of a Transaction or nil if b is not one.
+func transactionRow(b []byte) []string {
+	var tx struct {
+		ID           string `json:"id"`
+		Time         string `json:"time"`
+		Type         string `json:"type"`
+		Instrument   string `json:"instrument"`
+		Units        string `json:"units"`
+		Price        string `json:"price"`
+		PL           string `json:"pl"`
+		Reason       string `json:"reason"`
+		RejectReason string `json:"rejectReason"`
+	}
+	if err := json.Unmarshal(b, &tx); err != nil || len(tx.Type) == 0 {
+		return nil
+	}
+	if len(tx.RejectReason) > 0 {
+		tx.Reason = tx.RejectReason
+	}
+	return []string{tx.ID, tx.Time, tx.Type, tx.Instrument, tx.Units, tx.Price, tx.PL, tx.Reason}
+}
+
+// isNil reports whether v is nil or a nil pointer.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
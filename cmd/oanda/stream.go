@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"strconv"
+	"time"
+)
+
+func (a *app) stream(args []string) error {
+	return a.subcommand("stream", args, map[string]command{
+		"prices":       (*app).streamPrices,
+		"transactions": (*app).streamTransactions,
+	})
+}
+
+func (a *app) streamPrices(args []string) error {
+	fs := a.flags("stream prices", "[-n <count>] [-heartbeats] <names...>")
+	n := fs.Int("n", 0, "stop after `count` prices")
+	heartbeats := fs.Bool("heartbeats", false, "also print heartbeats")
+	names, err := a.parse(fs, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	request := &model.PricingStreamRequest{Snapshot: true}
+	for _, name := range names {
+		request.Instruments = append(request.Instruments, model.InstrumentName(name))
+	}
+	h := &streamPrinter{app: a, limit: *n, heartbeats: *heartbeats, done: make(chan struct{})}
+	if !a.out.json {
+		_, _ = fmt.Fprintf(a.stdout, "%-30s  %-12s  %12s  %12s  %s\n", "TIME", "INSTRUMENT", "BID", "ASK", "TRADEABLE")
+	}
+	stream, err := a.conn.StartPricingStream(id, request, &pricePrinter{h})
+	if err != nil {
+		return err
+	}
+	return h.wait(stream)
+}
+
+func (a *app) streamTransactions(args []string) error {
+	fs := a.flags("stream transactions", "[-n <count>] [-heartbeats]")
+	n := fs.Int("n", 0, "stop after `count` transactions")
+	heartbeats := fs.Bool("heartbeats", false, "also print heartbeats")
+	if _, err := a.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	id, err := a.account()
+	if err != nil {
+		return err
+	}
+	h := &streamPrinter{app: a, limit: *n, heartbeats: *heartbeats, done: make(chan struct{})}
+	if !a.out.json {
+		_, _ = fmt.Fprintf(a.stdout, "%-8s  %-30s  %-28s  %-10s  %10s  %10s  %10s  %s\n",
+			"ID", "TIME", "TYPE", "INSTRUMENT", "UNITS", "PRICE", "PL", "REASON")
+	}
+	stream, err := a.conn.StartTransactionStream(id, &txPrinter{h})
+	if err != nil {
+		return err
+	}
+	return h.wait(stream)
+}
+
+// streamPrinter prints the messages of a stream until the limit is reached, the
+// stream ends or the app is interrupted. In JSON output every line is printed as it
+// was received.
+type streamPrinter struct {
+	app        *app
+	limit      int
+	count      int
+	heartbeats bool
+	done       chan struct{}
+	err        error
+}
+
+func (h *streamPrinter) wait(stream *endpoint.Stream) error {
+	select {
+	case <-h.done:
+	case <-stream.Done():
+	case <-h.app.interrupt:
+	}
+	_ = stream.Close()
+	stream.Wait()
+	return h.err
+}
+
+// counted records a printed message and stops the stream once the limit is reached.
+func (h *streamPrinter) counted() {
+	h.count++
+	if h.limit > 0 && h.count == h.limit {
+		close(h.done)
+	}
+}
+
+func (h *streamPrinter) raw(line []byte, heartbeat bool) {
+	if !h.app.out.json || (heartbeat && !h.heartbeats) || h.finished() {
+		return
+	}
+	if _, err := fmt.Fprintf(h.app.stdout, "%s\n", line); err != nil && h.err == nil {
+		h.err = err
+	}
+}
+
+func (h *streamPrinter) finished() bool {
+	return h.limit > 0 && h.count >= h.limit
+}
+
+func (h *streamPrinter) printf(format string, args ...interface{}) {
+	if _, err := fmt.Fprintf(h.app.stdout, format, args...); err != nil && h.err == nil {
+		h.err = err
+	}
+}
+
+type pricePrinter struct {
+	*streamPrinter
+}
+
+func (p *pricePrinter) OnRaw(line []byte) {
+	p.raw(line, isHeartbeat(line))
+}
+
+func (p *pricePrinter) OnMessage(price *model.StreamClientPrice) error {
+	if p.finished() {
+		return nil
+	}
+	if !p.app.out.json {
+		var bid, ask float64
+		if len(price.Bids) > 0 {
+			bid = price.Bids[0].Price
+		}
+		if len(price.Asks) > 0 {
+			ask = price.Asks[0].Price
+		}
+		p.printf("%-30s  %-12s  %12s  %12s  %t\n",
+			price.Time.Format(time.RFC3339Nano), price.Instrument,
+			strconv.FormatFloat(bid, 'f', -1, 64), strconv.FormatFloat(ask, 'f', -1, 64), price.Tradeable)
+	}
+	p.counted()
+	return nil
+}
+
+func (p *pricePrinter) OnHeartbeat(t time.Time) {
+	if p.heartbeats && !p.app.out.json && !p.finished() {
+		p.printf("%-30s  HEARTBEAT\n", t.Format(time.RFC3339Nano))
+	}
+}
+
+func (p *pricePrinter) OnClose() {}
+
+type txPrinter struct {
+	*streamPrinter
+}
+
+func (p *txPrinter) OnRaw(line []byte) {
+	heartbeat := isHeartbeat(line)
+	p.raw(line, heartbeat)
+	if p.app.out.json || heartbeat || p.finished() {
+		return
+	}
+	if row := transactionRow(line); row != nil {
+		p.printf("%-8s  %-30s  %-28s  %-10s  %10s  %10s  %10s  %s\n",
+			row[0], row[1], row[2], row[3], row[4], row[5], row[6], row[7])
+	}
+}
+
+func (p *txPrinter) OnMessage(model.TransactionMessage) error {
+	if !p.finished() {
+		p.counted()
+	}
+	return nil
+}
+
+func (p *txPrinter) OnHeartbeat(t model.DateTime, last model.TransactionID) error {
+	if p.heartbeats && !p.app.out.json && !p.finished() {
+		p.printf("%-8s  %-30s  HEARTBEAT\n", last, t)
+	}
+	return nil
+}
+
+func (p *txPrinter) OnClose() {}
+
+// isHeartbeat reports whether a stream line is a heartbeat without parsing it.
+func isHeartbeat(line []byte) bool {
+	return bytes.Contains(line, []byte(`"type":"HEARTBEAT"`))
+}
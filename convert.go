@@ -0,0 +1,147 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+)
+
+// PriceSide selects which price of a pair is used for conversion.
+type PriceSide int
+
+const (
+	PriceSide_MID PriceSide = iota
+	PriceSide_BID
+	PriceSide_ASK
+)
+
+var (
+	ErrNoConversion = errors.New("no conversion path between currencies")
+)
+
+// CurrencyConverter converts amounts between currencies using the latest quotes of
+// a Pricing. Currencies without a direct pair are triangulated through USD or EUR.
+// Conversions into the home currency prefer the HomeConversions factors published
+// by OANDA so the results match the Account's own numbers.
+type CurrencyConverter struct {
+	pricing *Pricing
+	home    model.Currency
+}
+
+func NewCurrencyConverter(pricing *Pricing, home model.Currency) *CurrencyConverter {
+	return &CurrencyConverter{
+		pricing: pricing,
+		home:    home,
+	}
+}
+
+func (c *CurrencyConverter) Home() model.Currency {
+	return c.home
+}
+
+// Rate returns the number of units of to that one unit of from converts into.
+// The side selects the bid, ask or mid of every pair used. A pair quoted the other
+// way round uses the opposite side, so the bid rate of selling from is the inverse
+// of the ask of buying it back.
+func (c *CurrencyConverter) Rate(from, to model.Currency, side PriceSide) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	if rate, ok := c.direct(from, to, side); ok {
+		return rate, nil
+	}
+	// Triangulate through the most liquid currencies
+	for _, via := range [...]model.Currency{"USD", "EUR", c.home} {
+		if via == from || via == to {
+			continue
+		}
+		first, ok := c.direct(from, via, side)
+		if !ok {
+			continue
+		}
+		second, ok := c.direct(via, to, side)
+		if !ok {
+			continue
+		}
+		return first * second, nil
+	}
+	return 0, ErrNoConversion
+}
+
+func (c *CurrencyConverter) direct(from, to model.Currency, side PriceSide) (float64, bool) {
+	if q, ok := c.pricing.Quote(model.InstrumentName(from + "_" + to)); ok {
+		if price := quoteSide(q, side); price > 0 {
+			return price, true
+		}
+	}
+	if q, ok := c.pricing.Quote(model.InstrumentName(to + "_" + from)); ok {
+		if price := quoteSide(q, oppositeSide(side)); price > 0 {
+			return 1 / price, true
+		}
+	}
+	return 0, false
+}
+
+func quoteSide(q Quote, side PriceSide) float64 {
+	switch side {
+	case PriceSide_BID:
+		return q.Bid
+	case PriceSide_ASK:
+		return q.Ask
+	default:
+		return q.Mid()
+	}
+}
+
+func oppositeSide(side PriceSide) PriceSide {
+	switch side {
+	case PriceSide_BID:
+		return PriceSide_ASK
+	case PriceSide_ASK:
+		return PriceSide_BID
+	default:
+		return side
+	}
+}
+
+// Convert converts an amount between currencies.
+func (c *CurrencyConverter) Convert(amount float64, from, to model.Currency, side PriceSide) (float64, error) {
+	rate, err := c.Rate(from, to, side)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate, nil
+}
+
+// ToHome converts a profit or loss in the currency into the home currency. Gains
+// and losses use the AccountGain and AccountLoss factors of the HomeConversions if
+// they are known, and the mid rate otherwise.
+func (c *CurrencyConverter) ToHome(amount float64, from model.Currency) (float64, error) {
+	if from == c.home {
+		return amount, nil
+	}
+	if conversion, ok := c.pricing.HomeConversion(from); ok {
+		factor := conversion.AccountGain
+		if amount < 0 {
+			factor = conversion.AccountLoss
+		}
+		if f := factor.AsFloat64(0); f > 0 {
+			return amount * f, nil
+		}
+	}
+	return c.Convert(amount, from, c.home, PriceSide_MID)
+}
+
+// HomeValue converts a position or trade value in the currency into the home
+// currency using the PositionValue factor of the HomeConversions if it is known,
+// and the mid rate otherwise.
+func (c *CurrencyConverter) HomeValue(amount float64, from model.Currency) (float64, error) {
+	if from == c.home {
+		return amount, nil
+	}
+	if conversion, ok := c.pricing.HomeConversion(from); ok {
+		if f := conversion.PositionValue.AsFloat64(0); f > 0 {
+			return amount * f, nil
+		}
+	}
+	return c.Convert(amount, from, c.home, PriceSide_MID)
+}
@@ -0,0 +1,97 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCurrencyConverter(t *testing.T) {
+	pricing := NewPricing()
+	now := time.Now()
+	pricing.Update(Quote{Instrument: "EUR_USD", Time: now, Bid: 1.2, Ask: 1.2002})
+	pricing.Update(Quote{Instrument: "USD_JPY", Time: now, Bid: 110, Ask: 110.02})
+	pricing.Update(Quote{Instrument: "EUR_GBP", Time: now, Bid: 0.9, Ask: 0.9002})
+	// Older quotes are ignored
+	pricing.Update(Quote{Instrument: "EUR_USD", Time: now.Add(-time.Second), Bid: 1, Ask: 1})
+
+	c := NewCurrencyConverter(pricing, "GBP")
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) < 1e-9
+	}
+
+	rate, err := c.Rate("EUR", "USD", PriceSide_BID)
+	if err != nil || !near(rate, 1.2) {
+		t.Fatalf("unexpected direct rate %v %v", rate, err)
+	}
+	rate, err = c.Rate("USD", "EUR", PriceSide_MID)
+	if err != nil || !near(rate, 1/1.2001) {
+		t.Fatalf("unexpected inverse rate %v %v", rate, err)
+	}
+	// Selling USD for EUR pays the ask of EUR_USD
+	rate, err = c.Rate("USD", "EUR", PriceSide_BID)
+	if err != nil || !near(rate, 1/1.2002) {
+		t.Fatalf("unexpected inverse bid rate %v %v", rate, err)
+	}
+	// EUR to JPY through USD
+	rate, err = c.Rate("EUR", "JPY", PriceSide_BID)
+	if err != nil || !near(rate, 1.2*110) {
+		t.Fatalf("unexpected triangulated rate %v %v", rate, err)
+	}
+	// USD to GBP is triangulated through EUR
+	amount, err := c.Convert(1.2001, "USD", "GBP", PriceSide_MID)
+	if err != nil || !near(amount, 0.9001) {
+		t.Fatalf("unexpected conversion %v %v", amount, err)
+	}
+	if _, err = c.Rate("JPY", "CHF", PriceSide_MID); err != ErrNoConversion {
+		t.Fatal("expected ErrNoConversion")
+	}
+
+	// Home conversions take precedence
+	pricing.UpdateHomeConversions(&model.HomeConversions{
+		Currency:      "EUR",
+		AccountGain:   "0.89",
+		AccountLoss:   "0.91",
+		PositionValue: "0.9",
+	})
+	if amount, _ = c.ToHome(100, "EUR"); !near(amount, 89) {
+		t.Fatalf("unexpected gain %v", amount)
+	}
+	if amount, _ = c.ToHome(-100, "EUR"); !near(amount, -91) {
+		t.Fatalf("unexpected loss %v", amount)
+	}
+	if amount, _ = c.HomeValue(100, "EUR"); !near(amount, 90) {
+		t.Fatalf("unexpected value %v", amount)
+	}
+	if amount, _ = c.ToHome(100, "GBP"); amount != 100 {
+		t.Fatal("home currency converted")
+	}
+}
+
+func TestCurrencyConverterInversePair(t *testing.T) {
+	pricing := NewPricing()
+	pricing.Update(Quote{Instrument: "USD_JPY", Time: time.Now(), Bid: 110, Ask: 110.02})
+	c := NewCurrencyConverter(pricing, "USD")
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) < 1e-12
+	}
+
+	// JPY into the USD home currency is quoted by USD_JPY, so the sides swap
+	rate, err := c.Rate("JPY", "USD", PriceSide_BID)
+	if err != nil || !near(rate, 1/110.02) {
+		t.Fatalf("unexpected bid rate %v %v", rate, err)
+	}
+	rate, err = c.Rate("JPY", "USD", PriceSide_ASK)
+	if err != nil || !near(rate, 1/110.0) {
+		t.Fatalf("unexpected ask rate %v %v", rate, err)
+	}
+	rate, err = c.Rate("JPY", "USD", PriceSide_MID)
+	if err != nil || !near(rate, 1/110.01) {
+		t.Fatalf("unexpected mid rate %v %v", rate, err)
+	}
+	amount, err := c.Convert(11002, "JPY", "USD", PriceSide_BID)
+	if err != nil || !near(amount, 100) {
+		t.Fatalf("unexpected conversion %v %v", amount, err)
+	}
+}
@@ -0,0 +1,323 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"sort"
+)
+
+// CostBreakdown is the cost of trading attributed to an instrument, Trade or day.
+// The amounts are in the home currency of the Account. Financing is negative when
+// paid as in the transactions, the other costs are positive when charged.
+type CostBreakdown struct {
+	// The instrument, Trade ID or trading date. Empty for the total.
+	Key string `json:"key"`
+	// The instrument of a Trade.
+	Instrument model.InstrumentName `json:"instrument,omitempty"`
+	// Financing of daily rollovers and of closing fills.
+	Financing              float64 `json:"financing"`
+	Commission             float64 `json:"commission"`
+	GuaranteedExecutionFee float64 `json:"guaranteedExecutionFee"`
+	// The half spread cost reported by OANDA.
+	HalfSpreadCost float64 `json:"halfSpreadCost"`
+	// The cost of filling away from the mid of the price in effect at the fill.
+	SpreadCost float64 `json:"spreadCost"`
+	// The commission, fees and spread cost minus the financing.
+	Total float64 `json:"total"`
+}
+
+func (b *CostBreakdown) add(financing, commission, fee, halfSpread, spread float64) {
+	b.Financing += financing
+	b.Commission += commission
+	b.GuaranteedExecutionFee += fee
+	b.HalfSpreadCost += halfSpread
+	b.SpreadCost += spread
+	b.Total = b.Commission + b.GuaranteedExecutionFee + b.SpreadCost - b.Financing
+}
+
+// CostReport attributes the costs of trading in total and by instrument, Trade and
+// trading day.
+type CostReport struct {
+	Total        CostBreakdown   `json:"total"`
+	ByInstrument []CostBreakdown `json:"byInstrument"`
+	// The Trades in the order they were first charged.
+	ByTrade []CostBreakdown `json:"byTrade"`
+	ByDay   []CostBreakdown `json:"byDay"`
+}
+
+// CostConfig configures Costs.
+type CostConfig struct {
+	// The alignment of the trading days. Defaults to DefaultAlignment.
+	Alignment *Alignment
+}
+
+// Costs aggregates the financing, commissions, guaranteed execution fees and
+// spread costs of the transactions of an Account. Daily financing is attributed
+// to Trades by its OpenTradeFinancing details and commissions are shared by the
+// Trades of a fill in proportion to their units.
+type Costs struct {
+	config      CostConfig
+	total       CostBreakdown
+	instruments map[string]*CostBreakdown
+	trades      map[string]*CostBreakdown
+	tradeOrder  []*CostBreakdown
+	days        map[string]*CostBreakdown
+	replay      txReplay
+}
+
+func NewCosts(config CostConfig) *Costs {
+	if config.Alignment == nil {
+		config.Alignment = DefaultAlignment()
+	}
+	return &Costs{
+		config:      config,
+		instruments: make(map[string]*CostBreakdown),
+		trades:      make(map[string]*CostBreakdown),
+		days:        make(map[string]*CostBreakdown),
+	}
+}
+
+// AddParsed adds the transactions of a TransactionsResponse.
+func (c *Costs) AddParsed(transactions []*model.TransactionParser) error {
+	return c.Add(parsed(transactions)...)
+}
+
+// Add adds transactions in ID order. Transactions that were already added are
+// skipped, so overlapping ranges may be added.
+func (c *Costs) Add(messages ...model.TransactionMessage) error {
+	return c.replay.add(messages, func(msg model.TransactionMessage, _ *model.Transaction) error {
+		switch tx := msg.(type) {
+		case *model.OrderFillTransaction:
+			day, err := c.day(tx.Time)
+			if err != nil {
+				return err
+			}
+			c.fill(tx, day)
+		case *model.DailyFinancingTransaction:
+			day, err := c.day(tx.Time)
+			if err != nil {
+				return err
+			}
+			c.financing(tx, day)
+		}
+		return nil
+	})
+}
+
+// day returns the breakdown of the trading day containing t.
+func (c *Costs) day(t model.DateTime) (*CostBreakdown, error) {
+	parsed, err := t.Parse()
+	if err != nil {
+		return nil, err
+	}
+	a := c.config.Alignment
+	start, err := a.Start(model.CandlestickGranularity_D, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return costBreakdown(c.days, a.tradingDate(start).Format("2006-01-02")), nil
+}
+
+func (c *Costs) trade(id model.TradeID, instrument model.InstrumentName) *CostBreakdown {
+	b := c.trades[string(id)]
+	if b == nil {
+		b = &CostBreakdown{Key: string(id), Instrument: instrument}
+		c.trades[string(id)] = b
+		c.tradeOrder = append(c.tradeOrder, b)
+	}
+	return b
+}
+
+func costBreakdown(m map[string]*CostBreakdown, key string) *CostBreakdown {
+	b := m[key]
+	if b == nil {
+		b = &CostBreakdown{Key: key}
+		m[key] = b
+	}
+	return b
+}
+
+func (c *Costs) fill(fill *model.OrderFillTransaction, day *CostBreakdown) {
+	var (
+		reduces = fillReduces(fill)
+		share   = commissionShare(fill, reduces)
+		mid     = fillMid(fill)
+		spread  float64
+	)
+	for _, r := range reduces {
+		if r == nil {
+			continue
+		}
+		cost := spreadCost(fill, mid, r.Units, r.Price)
+		spread += cost
+		c.trade(r.TradeID, fill.Instrument).add(
+			accountUnits(r.Financing),
+			share(r.Units),
+			accountUnits(r.GuaranteedExecutionFee),
+			accountUnits(r.HalfSpreadCost),
+			cost,
+		)
+	}
+	if open := fill.TradeOpened; open != nil {
+		cost := spreadCost(fill, mid, open.Units, open.Price)
+		spread += cost
+		c.trade(open.TradeID, fill.Instrument).add(
+			0,
+			share(open.Units),
+			accountUnits(open.GuaranteedExecutionFee),
+			accountUnits(open.HalfSpreadCost),
+			cost,
+		)
+	}
+	for _, b := range []*CostBreakdown{&c.total, costBreakdown(c.instruments, string(fill.Instrument)), day} {
+		b.add(
+			accountUnits(fill.Financing),
+			accountUnits(fill.Commission),
+			accountUnits(fill.GuaranteedExecutionFee),
+			accountUnits(fill.HalfSpreadCost),
+			spread,
+		)
+	}
+}
+
+func (c *Costs) financing(tx *model.DailyFinancingTransaction, day *CostBreakdown) {
+	if len(tx.PositionFinancings) == 0 {
+		// Without details the financing can only be attributed to the day
+		for _, b := range []*CostBreakdown{&c.total, day} {
+			b.add(accountUnits(tx.Financing), 0, 0, 0, 0)
+		}
+		return
+	}
+	for _, position := range tx.PositionFinancings {
+		if position == nil {
+			continue
+		}
+		financing := accountUnits(position.Financing)
+		for _, b := range []*CostBreakdown{&c.total, costBreakdown(c.instruments, string(position.Instrument)), day} {
+			b.add(financing, 0, 0, 0, 0)
+		}
+		for _, trade := range position.OpenTradeFinancings {
+			if trade != nil {
+				c.trade(trade.TradeID, position.Instrument).add(accountUnits(trade.Financing), 0, 0, 0, 0)
+			}
+		}
+	}
+}
+
+// fillMid returns the mid of the price in effect at the fill or zero if the fill
+// has no price.
+func fillMid(fill *model.OrderFillTransaction) float64 {
+	price := &fill.FullPrice
+	var bid, ask float64
+	if len(price.Bids) > 0 && len(price.Asks) > 0 {
+		bid, ask = price.Bids[0].Price.AsFloat64(0), price.Asks[0].Price.AsFloat64(0)
+	} else {
+		bid, ask = price.CloseoutBid.AsFloat64(0), price.CloseoutAsk.AsFloat64(0)
+	}
+	if bid <= 0 || ask <= 0 {
+		return 0
+	}
+	return (bid + ask) / 2
+}
+
+// spreadCost returns the cost in the home currency of filling the signed units at
+// the price instead of the mid. A cost is converted with the loss factor and a gain
+// with the gain factor of the fill.
+func spreadCost(fill *model.OrderFillTransaction, mid float64, units model.DecimalNumber, price model.PriceValue) float64 {
+	if mid == 0 {
+		return 0
+	}
+	cost := (price.AsFloat64(mid) - mid) * units.AsFloat64(0)
+	var factor float64
+	if f := fill.HomeConversionFactors; f != nil {
+		if cost > 0 {
+			factor = f.LossQuoteHome.Factor.AsFloat64(0)
+		} else {
+			factor = f.GainQuoteHome.Factor.AsFloat64(0)
+		}
+	}
+	if factor == 0 {
+		if cost > 0 {
+			factor = fill.LossQuoteHomeConversionFactor.AsFloat64(0)
+		} else {
+			factor = fill.GainQuoteHomeConversionFactor.AsFloat64(0)
+		}
+	}
+	return cost * factor
+}
+
+// Report returns the costs added so far.
+func (c *Costs) Report() *CostReport {
+	trades := make([]CostBreakdown, len(c.tradeOrder))
+	for i, b := range c.tradeOrder {
+		trades[i] = *b
+	}
+	return &CostReport{
+		Total:        c.total,
+		ByInstrument: sortedCostBreakdowns(c.instruments),
+		ByTrade:      trades,
+		ByDay:        sortedCostBreakdowns(c.days),
+	}
+}
+
+func sortedCostBreakdowns(m map[string]*CostBreakdown) []CostBreakdown {
+	result := make([]CostBreakdown, 0, len(m))
+	for _, b := range m {
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *CostReport) WriteJSON(w io.Writer) error {
+	return writeJSON(w, r)
+}
+
+var costHeader = []string{
+	"instrument", "financing", "commission", "guaranteed_execution_fee", "half_spread_cost", "spread_cost", "total",
+}
+
+func (b *CostBreakdown) row() []string {
+	return []string{
+		string(b.Instrument),
+		formatAmount(b.Financing),
+		formatAmount(b.Commission),
+		formatAmount(b.GuaranteedExecutionFee),
+		formatAmount(b.HalfSpreadCost),
+		formatAmount(b.SpreadCost),
+		formatAmount(b.Total),
+	}
+}
+
+func costGroup(name string, breakdowns []CostBreakdown) reportGroup {
+	g := reportGroup{name: name}
+	for i := range breakdowns {
+		g.keys = append(g.keys, breakdowns[i].Key)
+		g.rows = append(g.rows, breakdowns[i].row())
+	}
+	return g
+}
+
+// groups returns the groups of the report in table order.
+func (r *CostReport) groups() []reportGroup {
+	return []reportGroup{
+		costGroup("total", []CostBreakdown{r.Total}),
+		costGroup("instrument", r.ByInstrument),
+		costGroup("trade", r.ByTrade),
+		costGroup("day", r.ByDay),
+	}
+}
+
+// WriteCSV writes the report as CSV with a row per group. The first columns are
+// the kind of group (total, instrument, trade or day) and its key.
+func (r *CostReport) WriteCSV(w io.Writer) error {
+	return writeGroupsCSV(w, costHeader, r.groups())
+}
+
+// WriteMarkdown writes the report as Markdown tables, one per kind of group.
+func (r *CostReport) WriteMarkdown(w io.Writer) error {
+	return writeGroupsMarkdown(w, "Costs", costHeader, r.groups())
+}
@@ -0,0 +1,90 @@
+package oanda
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCosts(t *testing.T) {
+	_, transactions := financedTrade(t)
+	costs := NewCosts(CostConfig{})
+	if err := costs.AddParsed(transactions); err != nil {
+		t.Fatal(err)
+	}
+	report := costs.Report()
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+	// Filled a pip from the mid on open and close
+	total := report.Total
+	if !near(total.Financing, -2.2) || !near(total.SpreadCost, 2) || !near(total.HalfSpreadCost, 2) ||
+		total.Commission != 0 || !near(total.Total, 4.2) {
+		t.Fatalf("unexpected total %+v", total)
+	}
+	if len(report.ByInstrument) != 1 || report.ByInstrument[0].Key != "EUR_USD" || !near(report.ByInstrument[0].Total, 4.2) {
+		t.Fatalf("unexpected instruments %+v", report.ByInstrument)
+	}
+	if len(report.ByTrade) != 1 || report.ByTrade[0].Instrument != "EUR_USD" ||
+		!near(report.ByTrade[0].Financing, -2.2) || !near(report.ByTrade[0].SpreadCost, 2) {
+		t.Fatalf("unexpected trades %+v", report.ByTrade)
+	}
+	days := report.ByDay
+	// The rollovers at 17:00 New York open the next trading day
+	if len(days) != 3 || days[0].Key != "2021-03-01" || !near(days[0].Total, 1) ||
+		!near(days[1].Total, 1.1) || days[2].Key != "2021-03-03" || !near(days[2].Total, 2.1) {
+		t.Fatalf("unexpected days %+v", days)
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &CostReport{}
+	if err := json.Unmarshal(b.Bytes(), decoded); err != nil || len(decoded.ByDay) != 3 {
+		t.Fatalf("unexpected json %v %s", err, b.String())
+	}
+	b.Reset()
+	if err := report.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 7 || lines[1] != "total,,,-2.2000,0.0000,0.0000,2.0000,2.0000,4.2000" {
+		t.Fatalf("unexpected csv %s", b.String())
+	}
+	b.Reset()
+	if err := report.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "## Day") || !strings.Contains(b.String(), "| 2021-03-02 |  | -1.1000 |") {
+		t.Fatalf("unexpected markdown %s", b.String())
+	}
+}
+
+func TestCostsCommissionShare(t *testing.T) {
+	// A fill closing 1000 units of one Trade and opening 2000 of another
+	costs := NewCosts(CostConfig{})
+	err := costs.Add(&model.OrderFillTransaction{
+		Transaction:            model.Transaction{Id: "10", Time: "2021-03-01T12:00:00.000000000Z"},
+		Instrument:             "EUR_USD",
+		Units:                  "3000",
+		Commission:             "3.0000",
+		GuaranteedExecutionFee: "0.5000",
+		TradesClosed:           []*model.TradeReduce{{TradeID: "5", Units: "1000", Financing: "0.2000"}},
+		TradeOpened:            &model.TradeOpen{TradeID: "10", Units: "2000", GuaranteedExecutionFee: "0.5000"},
+		Financing:              "0.2000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := costs.Report()
+	if len(report.ByTrade) != 2 || report.ByTrade[0].Commission != 1 || report.ByTrade[1].Commission != 2 ||
+		report.ByTrade[0].Total != 0.8 || report.ByTrade[1].GuaranteedExecutionFee != 0.5 {
+		t.Fatalf("unexpected trades %+v", report.ByTrade)
+	}
+	if report.Total.Total != 3.3 || report.Total.SpreadCost != 0 {
+		t.Fatalf("unexpected total %+v", report.Total)
+	}
+}
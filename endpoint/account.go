@@ -96,7 +96,7 @@ func (c *Connection) AccountConfigure(
 	_, _ = url.WriteString(c.host)
 	_, _ = url.WriteString("/v3/accounts/")
 	_, _ = url.WriteString((string)(id))
-	_, _ = url.WriteString("/v3/configuration")
+	_, _ = url.WriteString("/configuration")
 
 	ctx := newCall(c, fasthttp.MethodPatch, url, AcceptDatetimeFormat_RFC3339)
 	defer ctx.release()
@@ -105,7 +105,7 @@ func (c *Connection) AccountConfigure(
 	config.MarshalEasyJSON(w)
 	ctx.req.SetBody(w.Buffer.BuildBytes())
 
-	err := fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+	simulated, err := c.send(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -120,6 +120,7 @@ func (c *Connection) AccountConfigure(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return resp, nil, nil
 
 	// HTTP 400 – The configuration specification was invalid.
@@ -134,6 +135,7 @@ func (c *Connection) AccountConfigure(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return nil, resp, StatusCodeError{Code: statusCode}
 
 	default:
@@ -0,0 +1,120 @@
+package endpoint
+
+import (
+	. "github.com/kamaiu/oanda-go/model"
+	"time"
+)
+
+// The interfaces below split the v20 API into its areas. Connection implements all
+// of them; wrappers and fakes can implement the ones their callers depend on.
+
+// AccountsAPI covers the Account endpoints.
+type AccountsAPI interface {
+	Accounts() (*AccountsResponse, error)
+	Account(id AccountID) (*Account, error)
+	AccountSummary(id AccountID) (*AccountSummaryResponse, error)
+	AccountInstruments(id AccountID, filter ...string) (*AccountInstrumentsResponse, error)
+	AccountConfigure(
+		id AccountID,
+		config *AccountConfigurationRequest,
+	) (*AccountConfigurationResponse, *AccountConfigurationError, error)
+	AccountChanges(id AccountID, sinceTransactionID TransactionID) (*AccountChangesResponse, error)
+}
+
+// OrdersAPI covers the Order endpoints.
+type OrdersAPI interface {
+	OrderCreate(accountID AccountID, request OrderRequest) (*CreateOrderResponse, *CreateOrderError, error)
+	Orders(accountID AccountID, request *OrdersRequest) (*OrdersResponse, error)
+	OrdersPending(accountID AccountID) (*OrdersResponse, error)
+	OrdersBySpecifier(accountID AccountID, specifier OrderSpecifier) (*OrderResponse, error)
+	OrderReplace(
+		accountID AccountID,
+		specifier OrderSpecifier,
+		order OrderRequest,
+	) (*CreateOrderResponse, *CreateOrderError, error)
+	OrderCancel(accountID AccountID, specifier OrderSpecifier) (*CancelOrderResponse, *CancelOrderError, error)
+	OrderClientExtensions(
+		accountID AccountID,
+		specifier OrderSpecifier,
+		request *OrderClientExtensionsRequest,
+	) (*OrderClientExtensionsResponse, *OrderClientExtensionsError, error)
+}
+
+// TradesAPI covers the Trade endpoints.
+type TradesAPI interface {
+	Trades(accountID AccountID, request *TradesRequest) (*TradesResponse, error)
+	TradesOpen(accountID AccountID) (*TradesResponse, error)
+	Trade(accountID AccountID, specifier TradeSpecifier) (*TradeResponse, error)
+	TradeClose(
+		accountID AccountID,
+		specifier TradeSpecifier,
+		units DecimalNumber,
+	) (*TradeCloseResponse, *TradeCloseError, error)
+	TradeClientExtensions(
+		accountID AccountID,
+		specifier TradeSpecifier,
+		request *OrderClientExtensionsRequest,
+	) (*OrderClientExtensionsResponse, *OrderClientExtensionsError, error)
+	TradeModify(
+		accountID AccountID,
+		specifier TradeSpecifier,
+		request *TradeModifyRequest,
+	) (*TradeModifyResponse, *TradeModifyError, error)
+}
+
+// PositionsAPI covers the Position endpoints.
+type PositionsAPI interface {
+	Positions(accountID AccountID) (*PositionsResponse, error)
+	PositionsOpen(accountID AccountID) (*PositionsResponse, error)
+	Position(accountID AccountID, instrument InstrumentName) (*PositionResponse, error)
+	PositionClose(
+		accountID AccountID,
+		instrument InstrumentName,
+		request *PositionCloseRequest,
+	) (*PositionCloseResponse, *PositionCloseError, error)
+}
+
+// PricingAPI covers the Pricing endpoints including the pricing stream.
+type PricingAPI interface {
+	CandlesLatest(accountID AccountID, request *CandlesLatestRequest) (*CandlesLatestResponse, error)
+	Pricing(accountID AccountID, request *PricingRequest) (*PricingResponse, error)
+	PricingCandles(
+		accountID AccountID,
+		instrument InstrumentName,
+		request *PricingCandlesRequest,
+	) (*PricingCandlesResponse, error)
+	StartPricingStream(
+		accountID AccountID,
+		request *PricingStreamRequest,
+		handler PricingStreamHandler,
+	) (*Stream, error)
+}
+
+// TransactionsAPI covers the Transaction endpoints including the transaction stream.
+type TransactionsAPI interface {
+	Transactions(accountID AccountID, request *TransactionsRequest) (*TransactionsPagesResponse, error)
+	Transaction(accountID AccountID, id TransactionID) (*TransactionResponse, error)
+	TransactionsIDRange(accountID AccountID, request *TransactionsIDRangeRequest) (*TransactionsResponse, error)
+	TransactionsSinceID(accountID AccountID, request *TransactionsSinceIDRequest) (*TransactionsResponse, error)
+	StartTransactionStream(accountID AccountID, handler TxStreamHandler) (*Stream, error)
+}
+
+// InstrumentsAPI covers the Instrument endpoints.
+type InstrumentsAPI interface {
+	InstrumentCandles(request *InstrumentCandlesRequest) (*CandlestickResponse, error)
+	InstrumentOrderBook(instrument InstrumentName, t time.Time) (*OrderBook, error)
+	InstrumentPositionBook(instrument InstrumentName, t time.Time) (*PositionBook, error)
+}
+
+// API is the complete v20 API as implemented by Connection.
+type API interface {
+	AccountsAPI
+	OrdersAPI
+	TradesAPI
+	PositionsAPI
+	PricingAPI
+	TransactionsAPI
+	InstrumentsAPI
+}
+
+var _ API = (*Connection)(nil)
@@ -8,7 +8,10 @@ import (
 	"github.com/valyala/fasthttp"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unsafe"
 )
@@ -20,6 +23,7 @@ const (
 
 var (
 	ErrNilRequest = errors.New("nil request")
+	ErrInvalidURL = errors.New("invalid url")
 )
 
 type StatusCodeError struct {
@@ -41,30 +45,64 @@ type Connection struct {
 	agent          string
 	restClient     *fasthttp.HostClient
 	streamClient   *http.Client
+	guard          guardHolder
+	dryRun         *DryRun
+	dryRunMu       sync.RWMutex
 }
 
 const DefaultUserAgent string = "oanda-go/0.9.0"
 
 func NewConnection(token string, live bool) *Connection {
-	host := ""
-	fastHttpHost := ""
-	hostStreaming := ""
 	if live {
-		fastHttpHost = "api-fxtrade.oanda.com:443"
-		host = "https://api-fxtrade.oanda.com"
-		hostStreaming = "https://stream-fxtrade.oanda.com"
-	} else {
-		fastHttpHost = "api-fxpractice.oanda.com:443"
-		host = "https://api-fxpractice.oanda.com"
-		hostStreaming = "https://stream-fxpractice.oanda.com"
+		return newConnection(token, "https://api-fxtrade.oanda.com", "https://stream-fxtrade.oanda.com", "api-fxtrade.oanda.com:443", true)
+	}
+	return newConnection(token, "https://api-fxpractice.oanda.com", "https://stream-fxpractice.oanda.com", "api-fxpractice.oanda.com:443", true)
+}
+
+// NewConnectionURL creates a Connection that sends REST requests to restURL and
+// streaming requests to streamURL instead of the OANDA hosts, for example to a
+// local test server.
+func NewConnectionURL(token string, restURL string, streamURL string) (*Connection, error) {
+	u, err := url.Parse(restURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = url.Parse(streamURL); err != nil {
+		return nil, err
+	}
+	var ssl bool
+	switch u.Scheme {
+	case "https":
+		ssl = true
+	case "http":
+	default:
+		return nil, ErrInvalidURL
+	}
+	addr := u.Host
+	if len(u.Port()) == 0 {
+		if ssl {
+			addr += ":443"
+		} else {
+			addr += ":80"
+		}
+	}
+	return newConnection(token, strings.TrimRight(restURL, "/"), strings.TrimRight(streamURL, "/"), addr, ssl), nil
+}
+
+func newConnection(token string, host string, hostStreaming string, fastHttpHost string, ssl bool) *Connection {
+	port := 443
+	if i := strings.LastIndexByte(fastHttpHost, ':'); i > -1 {
+		if p, err := strconv.Atoi(fastHttpHost[i+1:]); err == nil {
+			port = p
+		}
 	}
 
 	// Create the Connection object
 	connection := &Connection{
 		host:          host,
 		hostStreaming: hostStreaming,
-		port:          443,
-		ssl:           true,
+		port:          port,
+		ssl:           ssl,
 		token:         token,
 		auth:          "Bearer " + token,
 		agent:         DefaultUserAgent,
@@ -75,7 +113,7 @@ func NewConnection(token string, live bool) *Connection {
 			NoDefaultUserAgentHeader:      true,
 			Dial:                          fasthttp.Dial,
 			DialDualStack:                 false,
-			IsTLS:                         true,
+			IsTLS:                         ssl,
 			MaxConns:                      120,
 			MaxConnDuration:               0,
 			MaxIdleConnDuration:           time.Minute * 5,
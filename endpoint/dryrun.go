@@ -0,0 +1,260 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/kamaiu/oanda-go/model"
+	"github.com/valyala/fasthttp"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DryRunIDPrefix starts the IDs of the Transactions, Orders and Trades made up by a
+// DryRun so that they cannot be confused with those of the Account.
+const DryRunIDPrefix = "DRY-"
+
+const dryRunTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+var (
+	ErrDryRunSet         = errors.New("dry run already enabled")
+	ErrDryRunUnsupported = errors.New("request not supported in dry run")
+)
+
+// DryRunRecord is a request that was simulated instead of sent.
+type DryRunRecord struct {
+	Time       time.Time       `json:"time"`
+	Method     string          `json:"method"`
+	URL        string          `json:"url"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	StatusCode int             `json:"statusCode"`
+	Response   json.RawMessage `json:"response"`
+}
+
+// DryRun simulates the state-changing requests of a Connection. Requests are
+// validated locally and answered with the Transactions OANDA would plausibly have
+// created, with IDs starting with DryRunIDPrefix. Prices, Orders, Trades and
+// Positions are read from the live Account when a request depends on them.
+//
+// Market Orders fill at the current price and open new Trades. Orders and Trades
+// made up by the DryRun can be replaced, modified, cancelled and closed by later
+// requests, the live Account never changes.
+type DryRun struct {
+	audit   io.Writer
+	records []DryRunRecord
+	lastID  int64
+	orders  []*dryRunOrder
+	trades  []*dryRunTrade
+	// Pending Orders of the live Accounts cancelled by the DryRun
+	cancelled map[string]bool
+	mu        sync.Mutex
+}
+
+type dryRunOrder struct {
+	accountID AccountID
+	id        string
+	clientID  string
+	typ       string
+	tradeID   string
+}
+
+type dryRunTrade struct {
+	accountID  AccountID
+	id         string
+	clientID   string
+	instrument InstrumentName
+	units      float64
+	// Units of the Trade on the live Account, zero for Trades made up by the DryRun
+	live float64
+	// Pending dependent Orders by type
+	orders map[string]string
+}
+
+// NewDryRun creates a DryRun that writes every simulated request to audit as a line
+// of JSON. The audit writer may be nil.
+func NewDryRun(audit io.Writer) *DryRun {
+	return &DryRun{
+		audit:     audit,
+		cancelled: make(map[string]bool),
+	}
+}
+
+// Records returns the simulated requests in the order they were made.
+func (d *DryRun) Records() []DryRunRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	records := make([]DryRunRecord, len(d.records))
+	copy(records, d.records)
+	return records
+}
+
+// SetDryRun stops OrderCreate, OrderReplace, OrderCancel, TradeClose, TradeModify,
+// PositionClose and AccountConfigure from reaching OANDA. They are simulated by the
+// DryRun instead and their responses have Simulated set. All other requests and the
+// streams stay live. Dry-run mode can only be enabled once and cannot be disabled.
+func (c *Connection) SetDryRun(dryRun *DryRun) error {
+	if dryRun == nil {
+		return ErrNilRequest
+	}
+	c.dryRunMu.Lock()
+	defer c.dryRunMu.Unlock()
+	if c.dryRun != nil {
+		return ErrDryRunSet
+	}
+	c.dryRun = dryRun
+	return nil
+}
+
+// DryRun returns the DryRun of the Connection or nil.
+func (c *Connection) DryRun() *DryRun {
+	c.dryRunMu.RLock()
+	defer c.dryRunMu.RUnlock()
+	return c.dryRun
+}
+
+// send performs a state-changing request, or simulates it in dry-run mode.
+func (c *Connection) send(ctx *call) (simulated bool, err error) {
+	if d := c.DryRun(); d != nil {
+		return true, d.simulate(c, ctx.req, ctx.resp)
+	}
+	return false, fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+}
+
+// simulate answers the request as OANDA would and records it. The live state the
+// request depends on is read before the DryRun is locked so that simulated requests
+// never wait on the live requests of another.
+func (d *DryRun) simulate(c *Connection, req *fasthttp.Request, resp *fasthttp.Response) error {
+	method := string(req.Header.Method())
+	path := string(req.URI().Path())
+	i := strings.Index(path, "/v3/accounts/")
+	if i < 0 {
+		return ErrDryRunUnsupported
+	}
+	parts := strings.Split(path[i+len("/v3/accounts/"):], "/")
+	body := append([]byte(nil), req.Body()...)
+
+	live := &dryRunLive{conn: c, accountID: AccountID(parts[0])}
+	var run func(s *simulation) (int, interface{}, error)
+	switch {
+	case method == fasthttp.MethodPost && len(parts) == 2 && parts[1] == "orders",
+		method == fasthttp.MethodPut && len(parts) == 3 && parts[1] == "orders":
+		request := &CreateOrderRequest{}
+		if err := request.UnmarshalJSON(body); err != nil {
+			return err
+		}
+		if request.Order == nil {
+			return ErrNilRequest
+		}
+		var replaces string
+		if len(parts) == 3 {
+			replaces = parts[2]
+			live.readOrder(replaces)
+		}
+		if specifier := tradeSpecifier(request.Order); dependentOrder(request.Order.Type) && len(specifier) > 0 {
+			live.readTrade(specifier)
+		}
+		if request.Order.Type == string(OrderType_MARKET) && len(request.Order.Instrument) > 0 {
+			live.readQuote(request.Order.Instrument)
+		}
+		run = func(s *simulation) (int, interface{}, error) {
+			return s.orderCreate(request.Order, replaces)
+		}
+	case method == fasthttp.MethodPut && len(parts) == 4 && parts[1] == "orders" && parts[3] == "cancel":
+		live.readOrder(parts[2])
+		run = func(s *simulation) (int, interface{}, error) {
+			return s.orderCancel(parts[2])
+		}
+	case method == fasthttp.MethodPut && len(parts) == 4 && parts[1] == "trades" && parts[3] == "close":
+		live.readTrade(parts[2])
+		instrument := d.tradeInstrument(live.accountID, parts[2])
+		if len(instrument) == 0 && live.trade != nil {
+			instrument = live.trade.Instrument
+		}
+		if len(instrument) > 0 {
+			live.readQuote(instrument)
+		}
+		run = func(s *simulation) (int, interface{}, error) {
+			return s.tradeClose(parts[2], body)
+		}
+	case method == fasthttp.MethodPut && len(parts) == 4 && parts[1] == "trades" && parts[3] == "orders":
+		live.readTrade(parts[2])
+		run = func(s *simulation) (int, interface{}, error) {
+			return s.tradeModify(parts[2], body)
+		}
+	case method == fasthttp.MethodPut && len(parts) == 4 && parts[1] == "positions" && parts[3] == "close":
+		instrument := InstrumentName(parts[2])
+		live.readPosition(instrument)
+		live.readQuote(instrument)
+		run = func(s *simulation) (int, interface{}, error) {
+			return s.positionClose(instrument, body)
+		}
+	case method == fasthttp.MethodPatch && len(parts) == 2 && parts[1] == "configuration":
+		run = func(s *simulation) (int, interface{}, error) {
+			return s.configure(body)
+		}
+	default:
+		return ErrDryRunUnsupported
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status, result, err := run(&simulation{DryRun: d, live: live, accountID: live.accountID})
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	resp.SetStatusCode(status)
+	resp.SetBody(b)
+
+	record := DryRunRecord{
+		Time:       time.Now().UTC(),
+		Method:     method,
+		URL:        req.URI().String(),
+		Body:       body,
+		StatusCode: status,
+		Response:   b,
+	}
+	d.records = append(d.records, record)
+	if d.audit == nil {
+		return nil
+	}
+	line, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	_, err = d.audit.Write(append(line, '\n'))
+	return err
+}
+
+// tradeSpecifier returns the Trade of a dependent Order request.
+func tradeSpecifier(req *OrderRequestParser) string {
+	if len(req.TradeID) == 0 && len(req.ClientTradeID) > 0 {
+		return "@" + req.ClientTradeID
+	}
+	return req.TradeID
+}
+
+// tradeInstrument returns the instrument of a Trade the DryRun already knows or an
+// empty name.
+func (d *DryRun) tradeInstrument(accountID AccountID, specifier string) InstrumentName {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t := d.findTrade(accountID, specifier); t != nil {
+		return t.instrument
+	}
+	return ""
+}
+
+// findTrade must be called with the lock held.
+func (d *DryRun) findTrade(accountID AccountID, specifier string) *dryRunTrade {
+	for _, t := range d.trades {
+		if t.accountID == accountID && (t.id == specifier || len(t.clientID) > 0 && "@"+t.clientID == specifier) {
+			return t
+		}
+	}
+	return nil
+}
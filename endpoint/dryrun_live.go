@@ -0,0 +1,84 @@
+package endpoint
+
+import (
+	"errors"
+	. "github.com/kamaiu/oanda-go/model"
+	"github.com/valyala/fasthttp"
+	"strings"
+)
+
+// dryRunLive is the state of the live Account a simulated request depends on. Errors
+// are kept until the simulation needs the state.
+type dryRunLive struct {
+	conn        *Connection
+	accountID   AccountID
+	order       *OrderParser
+	orderErr    error
+	trade       *Trade
+	tradeErr    error
+	position    *Position
+	positionErr error
+	price       *ClientPrice
+	priceReject TransactionRejectReason
+	priceErr    error
+}
+
+func (l *dryRunLive) readOrder(specifier string) {
+	if strings.HasPrefix(specifier, DryRunIDPrefix) {
+		return
+	}
+	resp, err := l.conn.OrdersBySpecifier(l.accountID, OrderSpecifier(specifier))
+	switch {
+	case notFound(err):
+	case err != nil:
+		l.orderErr = err
+	default:
+		l.order = resp.Order
+	}
+}
+
+func (l *dryRunLive) readTrade(specifier string) {
+	if strings.HasPrefix(specifier, DryRunIDPrefix) {
+		return
+	}
+	resp, err := l.conn.Trade(l.accountID, TradeSpecifier(specifier))
+	switch {
+	case notFound(err):
+	case err != nil:
+		l.tradeErr = err
+	default:
+		l.trade = resp.Trade
+	}
+}
+
+func (l *dryRunLive) readPosition(instrument InstrumentName) {
+	resp, err := l.conn.Position(l.accountID, instrument)
+	switch {
+	case notFound(err):
+	case err != nil:
+		l.positionErr = err
+	default:
+		l.position = resp.Position
+	}
+}
+
+// readQuote reads the current price of the instrument or the reason it is unknown.
+func (l *dryRunLive) readQuote(instrument InstrumentName) {
+	resp, err := l.conn.Pricing(l.accountID, &PricingRequest{Instruments: []InstrumentName{instrument}})
+	var code StatusCodeError
+	if errors.As(err, &code) && code.Code == fasthttp.StatusBadRequest {
+		l.priceReject = TransactionRejectReason_INSTRUMENT_UNKNOWN
+		return
+	}
+	if err != nil {
+		l.priceErr = err
+		return
+	}
+	for _, price := range resp.Prices {
+		if price.Instrument == instrument && len(price.Bids) > 0 && len(price.Asks) > 0 {
+			l.price = price
+			return
+		}
+	}
+	l.priceReject = TransactionRejectReason_INSTRUMENT_PRICE_UNKNOWN
+}
@@ -0,0 +1,252 @@
+package endpoint
+
+import (
+	. "github.com/kamaiu/oanda-go/model"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"time"
+)
+
+func dependentOrder(typ string) bool {
+	switch OrderType(typ) {
+	case OrderType_TAKE_PROFIT, OrderType_STOP_LOSS, OrderType_GUARANTEED_STOP_LOSS, OrderType_TRAILING_STOP_LOSS:
+		return true
+	}
+	return false
+}
+
+// validateOrder returns the reason to reject the Order or an empty string.
+func validateOrder(req *OrderRequestParser, t *dryRunTrade, replaces *dryRunOrder) TransactionRejectReason {
+	if dependentOrder(req.Type) {
+		if len(req.TradeID) == 0 && len(req.ClientTradeID) == 0 {
+			return TransactionRejectReason_TRADE_ID_UNSPECIFIED
+		}
+		if t == nil {
+			return TransactionRejectReason_TRADE_DOESNT_EXIST
+		}
+		if existing, ok := t.orders[req.Type]; ok && (replaces == nil || existing != replaces.id) {
+			switch OrderType(req.Type) {
+			case OrderType_TAKE_PROFIT:
+				return TransactionRejectReason_TAKE_PROFIT_ORDER_ALREADY_EXISTS
+			case OrderType_TRAILING_STOP_LOSS:
+				return TransactionRejectReason_TRAILING_STOP_LOSS_ORDER_ALREADY_EXISTS
+			}
+			return TransactionRejectReason_STOP_LOSS_ORDER_ALREADY_EXISTS
+		}
+	} else {
+		if len(req.Instrument) == 0 {
+			return TransactionRejectReason_INSTRUMENT_MISSING
+		}
+		if len(req.Units) == 0 {
+			return TransactionRejectReason_UNITS_MISSING
+		}
+		if units, err := strconv.ParseFloat(string(req.Units), 64); err != nil || units == 0 {
+			return TransactionRejectReason_UNITS_INVALID
+		}
+	}
+	switch OrderType(req.Type) {
+	case OrderType_MARKET:
+		if req.TimeInForce != TimeInForce_FOK && req.TimeInForce != TimeInForce_IOC {
+			return TransactionRejectReason_TIME_IN_FORCE_INVALID
+		}
+	case OrderType_TRAILING_STOP_LOSS:
+		if len(req.Distance) == 0 {
+			return TransactionRejectReason_PRICE_DISTANCE_MISSING
+		}
+		if req.Distance.AsFloat64(0) <= 0 {
+			return TransactionRejectReason_PRICE_DISTANCE_INVALID
+		}
+	case OrderType_STOP_LOSS, OrderType_GUARANTEED_STOP_LOSS:
+		if len(req.Price) == 0 && len(req.Distance) == 0 {
+			return TransactionRejectReason_PRICE_MISSING
+		}
+		if len(req.Price) > 0 && req.Price.AsFloat64(0) <= 0 {
+			return TransactionRejectReason_PRICE_INVALID
+		}
+		if len(req.Distance) > 0 && req.Distance.AsFloat64(0) <= 0 {
+			return TransactionRejectReason_PRICE_DISTANCE_INVALID
+		}
+	default:
+		if len(req.Price) == 0 {
+			return TransactionRejectReason_PRICE_MISSING
+		}
+		if req.Price.AsFloat64(0) <= 0 {
+			return TransactionRejectReason_PRICE_INVALID
+		}
+	}
+	if req.TimeInForce == TimeInForce_GTD {
+		if len(req.GtdTime) == 0 {
+			return TransactionRejectReason_TIME_IN_FORCE_GTD_TIMESTAMP_MISSING
+		}
+		if gtd, err := req.GtdTime.Parse(); err != nil || !gtd.After(time.Now()) {
+			return TransactionRejectReason_TIME_IN_FORCE_GTD_TIMESTAMP_IN_PAST
+		}
+	}
+	if tp := req.TakeProfitOnFill; tp != nil {
+		if len(tp.Price) == 0 {
+			return TransactionRejectReason_TAKE_PROFIT_ON_FILL_PRICE_MISSING
+		}
+		if tp.Price.AsFloat64(0) <= 0 {
+			return TransactionRejectReason_TAKE_PROFIT_ON_FILL_PRICE_INVALID
+		}
+	}
+	if sl := req.StopLossOnFill; sl != nil {
+		if len(sl.Price) == 0 && len(sl.Distance) == 0 {
+			return TransactionRejectReason_STOP_LOSS_ON_FILL_PRICE_AND_DISTANCE_BOTH_MISSING
+		}
+		if len(sl.Price) > 0 && sl.Price.AsFloat64(0) <= 0 {
+			return TransactionRejectReason_STOP_LOSS_ON_FILL_PRICE_INVALID
+		}
+	}
+	if tsl := req.TrailingStopLossOnFill; tsl != nil {
+		if len(tsl.Distance) == 0 {
+			return TransactionRejectReason_TRAILING_STOP_LOSS_ON_FILL_PRICE_DISTANCE_MISSING
+		}
+		if tsl.Distance.AsFloat64(0) <= 0 {
+			return TransactionRejectReason_TRAILING_STOP_LOSS_ON_FILL_PRICE_DISTANCE_INVALID
+		}
+	}
+	return ""
+}
+
+// orderTx fills the fields of the Transaction that creates or rejects the Order.
+func orderTx(tx *TransactionParser, req *OrderRequestParser) {
+	tx.Instrument = req.Instrument
+	tx.Units = req.Units
+	tx.Price = req.Price
+	tx.PriceBound = req.PriceBound
+	tx.Distance = req.Distance
+	tx.TimeInForce = req.TimeInForce
+	tx.GtdTime = req.GtdTime
+	tx.PositionFill = req.PositionFill
+	tx.TriggerCondition = req.TriggerCondition
+	tx.TradeID = req.TradeID
+	tx.ClientTradeID = req.ClientTradeID
+	tx.ClientExtensions = req.ClientExtensions
+	tx.TradeClientExtensions = req.TradeClientExtensions
+	tx.TakeProfitOnFill = req.TakeProfitOnFill
+	tx.StopLossOnFill = req.StopLossOnFill
+	tx.TrailingStopLossOnFill = req.TrailingStopLossOnFill
+	tx.GuaranteedStopLossOnFill = req.GuaranteedStopLossOnFill
+}
+
+func (s *simulation) orderCreate(req *OrderRequestParser, replaces string) (int, interface{}, error) {
+	if len(req.TimeInForce) == 0 {
+		if req.Type == string(OrderType_MARKET) {
+			req.TimeInForce = TimeInForce_FOK
+		} else {
+			req.TimeInForce = TimeInForce_GTC
+		}
+	}
+	if len(req.PositionFill) == 0 && !dependentOrder(req.Type) {
+		req.PositionFill = OrderPositionFill_DEFAULT
+	}
+	if len(req.TriggerCondition) == 0 && req.Type != string(OrderType_MARKET) {
+		req.TriggerCondition = string(OrderTriggerCondition_DEFAULT)
+	}
+	rejected := func(status int, reason TransactionRejectReason) (int, interface{}, error) {
+		reject := s.newTx(req.Type + "_ORDER_REJECT")
+		orderTx(reject, req)
+		reject.RejectReason = string(reason)
+		resp := &CreateOrderError{OrderRejectTransaction: reject}
+		resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+		resp.ErrorCode, resp.ErrorMessage = rejectError(reason)
+		return status, resp, nil
+	}
+
+	var (
+		replaced *dryRunOrder
+		err      error
+	)
+	if len(replaces) > 0 {
+		if replaced, err = s.order(replaces); err != nil {
+			return 0, nil, err
+		}
+		if replaced == nil {
+			return rejected(fasthttp.StatusNotFound, TransactionRejectReason_ORDER_DOESNT_EXIST)
+		}
+	}
+	var t *dryRunTrade
+	if specifier := tradeSpecifier(req); dependentOrder(req.Type) && len(specifier) > 0 {
+		if t, err = s.trade(specifier); err != nil {
+			return 0, nil, err
+		}
+	}
+	var price *ClientPrice
+	reason := validateOrder(req, t, replaced)
+	if len(reason) == 0 && req.Type == string(OrderType_MARKET) {
+		if price, reason, err = s.quote(req.Instrument); err != nil {
+			return 0, nil, err
+		}
+	}
+	if len(reason) > 0 {
+		return rejected(fasthttp.StatusBadRequest, reason)
+	}
+
+	resp := &CreateOrderResponse{}
+	var cancelReplaced *TransactionParser
+	if replaced != nil {
+		cancelReplaced = s.newTx(string(TransactionType_ORDER_CANCEL))
+		cancelReplaced.OrderID = replaced.id
+		cancelReplaced.ClientOrderID = replaced.clientID
+		cancelReplaced.Reason = string(OrderCancelReason_CLIENT_REQUEST_REPLACED)
+		s.removeOrder(replaced.id)
+	}
+	create := s.newTx(req.Type + "_ORDER")
+	orderTx(create, req)
+	create.Reason = "CLIENT_ORDER"
+	if replaced != nil {
+		create.Reason = "REPLACEMENT"
+		create.ReplacesOrderID = replaced.id
+		cancelReplaced.ReplacedByOrderID = create.Id
+		resp.OrderCancelTransaction, _ = typed(cancelReplaced).(*OrderCancelTransaction)
+	}
+	resp.OrderCreateTransaction = create
+
+	if price != nil {
+		fill, cancel := s.fill(create, price, req.Units.AsFloat64(0), OrderFillReason_MARKET_ORDER, nil, true)
+		if fill != nil {
+			resp.OrderFillTransaction, _ = typed(fill).(*OrderFillTransaction)
+		} else {
+			resp.OrderCancelTransaction, _ = typed(cancel).(*OrderCancelTransaction)
+		}
+	} else {
+		o := &dryRunOrder{accountID: s.accountID, id: create.Id, typ: req.Type}
+		if req.ClientExtensions != nil {
+			o.clientID = string(req.ClientExtensions.ID)
+		}
+		if t != nil {
+			o.tradeID = t.id
+			t.orders[req.Type] = o.id
+		}
+		s.orders = append(s.orders, o)
+	}
+	resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+	return fasthttp.StatusCreated, resp, nil
+}
+
+func (s *simulation) orderCancel(specifier string) (int, interface{}, error) {
+	o, err := s.order(specifier)
+	if err != nil {
+		return 0, nil, err
+	}
+	if o == nil {
+		reject := s.newTx(string(TransactionType_ORDER_CANCEL_REJECT))
+		reject.OrderID = specifier
+		reject.RejectReason = string(TransactionRejectReason_ORDER_DOESNT_EXIST)
+		resp := &CancelOrderError{}
+		resp.OrderCancelRejectTransaction, _ = typed(reject).(*OrderCancelRejectTransaction)
+		resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+		resp.ErrorCode, resp.ErrorMessage = rejectError(TransactionRejectReason_ORDER_DOESNT_EXIST)
+		return fasthttp.StatusNotFound, resp, nil
+	}
+	cancel := s.newTx(string(TransactionType_ORDER_CANCEL))
+	cancel.OrderID = o.id
+	cancel.ClientOrderID = o.clientID
+	cancel.Reason = string(OrderCancelReason_CLIENT_REQUEST)
+	s.removeOrder(o.id)
+	resp := &CancelOrderResponse{}
+	resp.OrderCancelTransaction, _ = typed(cancel).(*OrderCancelTransaction)
+	resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+	return fasthttp.StatusOK, resp, nil
+}
@@ -0,0 +1,311 @@
+package endpoint
+
+import (
+	"errors"
+	. "github.com/kamaiu/oanda-go/model"
+	"github.com/valyala/fasthttp"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// simulation is a single simulated request.
+type simulation struct {
+	*DryRun
+	live      *dryRunLive
+	accountID AccountID
+	batch     string
+	related   []TransactionID
+}
+
+func (s *simulation) newTx(typ string) *TransactionParser {
+	s.lastID++
+	id := DryRunIDPrefix + strconv.FormatInt(s.lastID, 10)
+	if len(s.batch) == 0 {
+		s.batch = id
+	}
+	s.related = append(s.related, TransactionID(id))
+	return &TransactionParser{
+		Id:        id,
+		Type:      typ,
+		AccountID: string(s.accountID),
+		BatchID:   s.batch,
+		Time:      DateTime(time.Now().UTC().Format(dryRunTimeFormat)),
+	}
+}
+
+// transactionIDs returns the IDs of the Transactions of the request and the last one.
+func (s *simulation) transactionIDs() ([]TransactionID, TransactionID) {
+	var last TransactionID
+	if len(s.related) > 0 {
+		last = s.related[len(s.related)-1]
+	}
+	return s.related, last
+}
+
+// rejectError returns the error code and message of the reject reason.
+func rejectError(reason TransactionRejectReason) (string, string) {
+	return string(reason), strings.ToLower(strings.Replace(string(reason), "_", " ", -1))
+}
+
+// typed returns the concrete Transaction of tx or nil.
+func typed(tx *TransactionParser) TransactionMessage {
+	if tx == nil {
+		return nil
+	}
+	return tx.Parse()
+}
+
+// order returns the pending Order of the specifier or nil.
+func (s *simulation) order(specifier string) (*dryRunOrder, error) {
+	for _, o := range s.orders {
+		if o.accountID == s.accountID && (o.id == specifier || len(o.clientID) > 0 && "@"+o.clientID == specifier) {
+			return o, nil
+		}
+	}
+	if strings.HasPrefix(specifier, DryRunIDPrefix) {
+		return nil, nil
+	}
+	if s.live.orderErr != nil {
+		return nil, s.live.orderErr
+	}
+	o := s.live.order
+	if o == nil || o.State != OrderState_PENDING || s.cancelled[s.key(o.Id)] {
+		return nil, nil
+	}
+	order := &dryRunOrder{accountID: s.accountID, id: o.Id, typ: o.Type, tradeID: o.TradeID}
+	if o.ClientExtensions != nil {
+		order.clientID = string(o.ClientExtensions.ID)
+	}
+	return order, nil
+}
+
+// key identifies an Order of the live Account.
+func (s *simulation) key(id string) string {
+	return string(s.accountID) + "/" + id
+}
+
+// removeOrder takes the pending Order off the Account and its Trade.
+func (s *simulation) removeOrder(id string) {
+	if !strings.HasPrefix(id, DryRunIDPrefix) {
+		s.cancelled[s.key(id)] = true
+	}
+	for i, o := range s.orders {
+		if o.accountID == s.accountID && o.id == id {
+			s.orders = append(s.orders[:i], s.orders[i+1:]...)
+			break
+		}
+	}
+	for _, t := range s.trades {
+		if t.accountID != s.accountID {
+			continue
+		}
+		for typ, dependent := range t.orders {
+			if dependent == id {
+				delete(t.orders, typ)
+			}
+		}
+	}
+}
+
+// trade returns the open Trade of the specifier or nil. Trades of the live Account
+// are kept once they are read so that later requests see the simulated changes.
+func (s *simulation) trade(specifier string) (*dryRunTrade, error) {
+	if t := s.findTrade(s.accountID, specifier); t != nil {
+		if t.units == 0 {
+			return nil, nil
+		}
+		return t, nil
+	}
+	if strings.HasPrefix(specifier, DryRunIDPrefix) {
+		return nil, nil
+	}
+	if s.live.tradeErr != nil {
+		return nil, s.live.tradeErr
+	}
+	lt := s.live.trade
+	if lt == nil || lt.State != TradeState_OPEN {
+		return nil, nil
+	}
+	t := &dryRunTrade{
+		accountID:  s.accountID,
+		id:         string(lt.Id),
+		instrument: lt.Instrument,
+		units:      lt.CurrentUnits.AsFloat64(0),
+		live:       lt.CurrentUnits.AsFloat64(0),
+		orders:     make(map[string]string),
+	}
+	if lt.ClientExtensions != nil {
+		t.clientID = string(lt.ClientExtensions.ID)
+	}
+	live := map[string]OrderID{}
+	if lt.TakeProfitOrder != nil {
+		live[string(OrderType_TAKE_PROFIT)] = lt.TakeProfitOrder.Id
+	}
+	if lt.StopLossOrder != nil {
+		live[string(OrderType_STOP_LOSS)] = lt.StopLossOrder.Id
+	}
+	if lt.TrailingStopLossOrder != nil {
+		live[string(OrderType_TRAILING_STOP_LOSS)] = lt.TrailingStopLossOrder.Id
+	}
+	for typ, id := range live {
+		if !s.cancelled[s.key(string(id))] {
+			t.orders[typ] = string(id)
+		}
+	}
+	for _, o := range s.orders {
+		if o.accountID == s.accountID && o.tradeID == t.id {
+			t.orders[o.typ] = o.id
+		}
+	}
+	s.trades = append(s.trades, t)
+	return t, nil
+}
+
+func notFound(err error) bool {
+	var code StatusCodeError
+	return errors.As(err, &code) && code.Code == fasthttp.StatusNotFound
+}
+
+// quote returns the current price of the instrument or the reason it is unknown.
+func (s *simulation) quote(instrument InstrumentName) (*ClientPrice, TransactionRejectReason, error) {
+	l := s.live
+	if l.priceErr != nil || len(l.priceReject) > 0 {
+		return nil, l.priceReject, l.priceErr
+	}
+	if l.price == nil || l.price.Instrument != instrument {
+		return nil, TransactionRejectReason_INSTRUMENT_PRICE_UNKNOWN, nil
+	}
+	return l.price, "", nil
+}
+
+// fill executes the Market Order at the current price. The units reduce the Trades
+// first and open a new Trade with the rest if open is set. It returns the fill
+// Transaction, or the cancel Transaction when the market is halted or the price bound
+// is violated.
+func (s *simulation) fill(
+	create *TransactionParser,
+	price *ClientPrice,
+	units float64,
+	reason OrderFillReason,
+	trades []*dryRunTrade,
+	open bool,
+) (fill *TransactionParser, cancel *TransactionParser) {
+	at := price.Bids[0].Price
+	if units > 0 {
+		at = price.Asks[0].Price
+	}
+	bound := create.PriceBound.AsFloat64(0)
+	var cancelReason OrderCancelReason
+	switch {
+	case !price.Tradeable:
+		cancelReason = OrderCancelReason_MARKET_HALTED
+	case bound > 0 && (units > 0 && at.AsFloat64(0) > bound || units < 0 && at.AsFloat64(0) < bound):
+		cancelReason = OrderCancelReason_BOUNDS_VIOLATION
+	}
+	if len(cancelReason) > 0 {
+		cancel = s.newTx(string(TransactionType_ORDER_CANCEL))
+		cancel.OrderID = create.Id
+		cancel.Reason = string(cancelReason)
+		return nil, cancel
+	}
+
+	fill = s.newTx(string(TransactionType_ORDER_FILL))
+	fill.OrderID = create.Id
+	fill.Instrument = price.Instrument
+	fill.Units = formatUnits(units)
+	fill.Price = at
+	fill.FullVWAP = at
+	fill.FullPrice = *price
+	fill.Reason = string(reason)
+	remaining := units
+	for _, t := range trades {
+		if remaining == 0 || math.Signbit(remaining) == math.Signbit(t.units) {
+			break
+		}
+		reduce := &TradeReduce{TradeID: TradeID(t.id), Price: at}
+		if math.Abs(remaining) >= math.Abs(t.units) {
+			reduce.Units = formatUnits(-t.units)
+			remaining += t.units
+			t.units = 0
+			fill.TradesClosed = append(fill.TradesClosed, reduce)
+		} else {
+			reduce.Units = formatUnits(remaining)
+			t.units += remaining
+			remaining = 0
+			fill.TradeReduced = reduce
+		}
+	}
+	if open && remaining != 0 {
+		fill.TradeOpened = &TradeOpen{
+			TradeID:          TradeID(fill.Id),
+			Units:            formatUnits(remaining),
+			Price:            at,
+			ClientExtensions: create.TradeClientExtensions,
+		}
+		t := &dryRunTrade{
+			accountID:  s.accountID,
+			id:         fill.Id,
+			instrument: price.Instrument,
+			units:      remaining,
+			orders:     make(map[string]string),
+		}
+		if create.TradeClientExtensions != nil {
+			t.clientID = string(create.TradeClientExtensions.ID)
+		}
+		s.trades = append(s.trades, t)
+	}
+	s.closeTrades(trades)
+	return fill, nil
+}
+
+// closeTrades cancels the dependent Orders of the closed Trades.
+func (s *simulation) closeTrades(trades []*dryRunTrade) {
+	for _, t := range trades {
+		if t.units != 0 {
+			continue
+		}
+		for _, id := range t.orders {
+			s.removeOrder(id)
+		}
+	}
+}
+
+func formatUnits(units float64) DecimalNumber {
+	return DecimalNumber(strconv.FormatFloat(units, 'f', -1, 64))
+}
+
+func (s *simulation) configure(body []byte) (int, interface{}, error) {
+	request := &AccountConfigurationRequest{}
+	if err := request.UnmarshalJSON(body); err != nil {
+		return 0, nil, err
+	}
+	var reason TransactionRejectReason
+	if len(request.MarginRate) > 0 {
+		if rate, err := strconv.ParseFloat(string(request.MarginRate), 64); err != nil || rate <= 0 || rate > 1 {
+			reason = TransactionRejectReason_MARGIN_RATE_INVALID
+		}
+	}
+	if len(request.Alias) > 100 {
+		reason = TransactionRejectReason_ALIAS_INVALID
+	}
+	if len(reason) > 0 {
+		tx := s.newTx(string(TransactionType_CLIENT_CONFIGURE_REJECT))
+		tx.Alias = request.Alias
+		tx.MarginRate = request.MarginRate
+		tx.RejectReason = string(reason)
+		resp := &AccountConfigurationError{}
+		resp.ClientConfigureRejectTransaction, _ = typed(tx).(*ClientConfigureRejectTransaction)
+		_, resp.LastTransactionID = s.transactionIDs()
+		resp.ErrorCode, resp.ErrorMessage = rejectError(reason)
+		return fasthttp.StatusBadRequest, resp, nil
+	}
+	tx := s.newTx(string(TransactionType_CLIENT_CONFIGURE))
+	tx.Alias = request.Alias
+	tx.MarginRate = request.MarginRate
+	resp := &AccountConfigurationResponse{}
+	resp.ClientConfigureTransaction, _ = typed(tx).(*ClientConfigureTransaction)
+	_, resp.LastTransactionID = s.transactionIDs()
+	return fasthttp.StatusOK, resp, nil
+}
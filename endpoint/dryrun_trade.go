@@ -0,0 +1,362 @@
+package endpoint
+
+import (
+	"encoding/json"
+	. "github.com/kamaiu/oanda-go/model"
+	"github.com/valyala/fasthttp"
+	"math"
+	"strconv"
+)
+
+// closeout creates the Market Order that closes units of the Trade or Position and
+// fills it. The reject reason is returned if the Order cannot be created.
+func (s *simulation) closeout(
+	create *TransactionParser,
+	instrument InstrumentName,
+	units float64,
+	reason OrderFillReason,
+	trades []*dryRunTrade,
+) (fill *TransactionParser, cancel *TransactionParser, reject TransactionRejectReason, err error) {
+	price, reject, err := s.quote(instrument)
+	if err != nil || len(reject) > 0 {
+		return nil, nil, reject, err
+	}
+	fill, cancel = s.fill(create, price, units, reason, trades, false)
+	return fill, cancel, "", nil
+}
+
+func (s *simulation) tradeClose(specifier string, body []byte) (int, interface{}, error) {
+	request := &struct {
+		Units string `json:"units"`
+	}{}
+	if err := json.Unmarshal(body, request); err != nil {
+		return 0, nil, err
+	}
+	t, err := s.trade(specifier)
+	if err != nil {
+		return 0, nil, err
+	}
+	rejected := func(status int, reason TransactionRejectReason) (int, interface{}, error) {
+		tx := s.newTx(string(TransactionType_MARKET_ORDER_REJECT))
+		tx.TradeClose = &MarketOrderTradeClose{TradeID: TradeID(specifier), Units: request.Units}
+		tx.RejectReason = string(reason)
+		resp := &TradeCloseError{}
+		resp.OrderRejectTransaction, _ = typed(tx).(*MarketOrderRejectTransaction)
+		resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+		resp.ErrorCode, resp.ErrorMessage = rejectError(reason)
+		return status, resp, nil
+	}
+	if t == nil {
+		return rejected(fasthttp.StatusNotFound, TransactionRejectReason_TRADE_DOESNT_EXIST)
+	}
+	units := math.Abs(t.units)
+	if request.Units != "ALL" {
+		v, err := strconv.ParseFloat(request.Units, 64)
+		switch {
+		case err != nil || v <= 0:
+			return rejected(fasthttp.StatusBadRequest, TransactionRejectReason_UNITS_INVALID)
+		case v > units:
+			return rejected(fasthttp.StatusBadRequest, TransactionRejectReason_CLOSE_TRADE_UNITS_EXCEED_TRADE_SIZE)
+		}
+		units = v
+	}
+	units = math.Copysign(units, -t.units)
+
+	create := s.newTx(string(TransactionType_MARKET_ORDER))
+	create.Instrument = t.instrument
+	create.Units = formatUnits(units)
+	create.TimeInForce = TimeInForce_FOK
+	create.PositionFill = OrderPositionFill_REDUCE_ONLY
+	create.TradeClose = &MarketOrderTradeClose{TradeID: TradeID(t.id), Units: request.Units}
+	create.Reason = "TRADE_CLOSE"
+	fill, cancel, reason, err := s.closeout(create, t.instrument, units, OrderFillReason_MARKET_ORDER_TRADE_CLOSE, []*dryRunTrade{t})
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(reason) > 0 {
+		return rejected(fasthttp.StatusBadRequest, reason)
+	}
+	resp := &TradeCloseResponse{}
+	resp.OrderCreateTransaction, _ = typed(create).(*MarketOrderTransaction)
+	resp.OrderFillTransaction, _ = typed(fill).(*OrderFillTransaction)
+	resp.OrderCancelTransaction, _ = typed(cancel).(*OrderCancelTransaction)
+	resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+	return fasthttp.StatusOK, resp, nil
+}
+
+// tradeOrderChange is a dependent Order created or replaced by a TradeModify request.
+type tradeOrderChange struct {
+	typ    OrderType
+	req    *OrderRequestParser
+	reject TransactionRejectReason
+	// The Transactions of the change
+	cancel   *TransactionParser
+	create   *TransactionParser
+	rejected *TransactionParser
+}
+
+func (s *simulation) tradeModify(specifier string, body []byte) (int, interface{}, error) {
+	request := &TradeModifyRequest{}
+	if err := request.UnmarshalJSON(body); err != nil {
+		return 0, nil, err
+	}
+	t, err := s.trade(specifier)
+	if err != nil {
+		return 0, nil, err
+	}
+	var changes []*tradeOrderChange
+	if tp := request.TakeProfit; tp != nil {
+		changes = append(changes, &tradeOrderChange{typ: OrderType_TAKE_PROFIT, req: &OrderRequestParser{
+			Price: tp.Price, TimeInForce: tp.TimeInForce, GtdTime: tp.GtdTime, ClientExtensions: tp.ClientExtensions,
+		}})
+	}
+	if sl := request.StopLoss; sl != nil {
+		changes = append(changes, &tradeOrderChange{typ: OrderType_STOP_LOSS, req: &OrderRequestParser{
+			Price: sl.Price, Distance: sl.Distance, TimeInForce: sl.TimeInForce, GtdTime: sl.GtdTime, ClientExtensions: sl.ClientExtensions,
+		}})
+	}
+	if tsl := request.TrailingStopLoss; tsl != nil {
+		changes = append(changes, &tradeOrderChange{typ: OrderType_TRAILING_STOP_LOSS, req: &OrderRequestParser{
+			Distance: tsl.Distance, TimeInForce: tsl.TimeInForce, GtdTime: tsl.GtdTime, ClientExtensions: tsl.ClientExtensions,
+		}})
+	}
+	if gsl := request.GuaranteedStopLoss; gsl != nil {
+		changes = append(changes, &tradeOrderChange{typ: OrderType_GUARANTEED_STOP_LOSS, req: &OrderRequestParser{
+			Price: gsl.Price, Distance: gsl.Distance, TimeInForce: gsl.TimeInForce, GtdTime: gsl.GtdTime, ClientExtensions: gsl.ClientExtensions,
+		}})
+	}
+
+	var reason TransactionRejectReason
+	for _, c := range changes {
+		c.req.Type = string(c.typ)
+		c.req.TradeID = specifier
+		if len(c.req.TimeInForce) == 0 {
+			c.req.TimeInForce = TimeInForce_GTC
+		}
+		c.req.TriggerCondition = string(OrderTriggerCondition_DEFAULT)
+		var replaces *dryRunOrder
+		if t != nil {
+			c.req.TradeID = t.id
+			if id, ok := t.orders[string(c.typ)]; ok {
+				replaces = &dryRunOrder{id: id}
+			}
+		}
+		if c.reject = validateOrder(c.req, t, replaces); len(c.reject) > 0 && len(reason) == 0 {
+			reason = c.reject
+		}
+	}
+	if len(reason) > 0 {
+		resp := &TradeModifyError{}
+		for _, c := range changes {
+			if len(c.reject) == 0 {
+				continue
+			}
+			c.rejected = s.newTx(string(c.typ) + "_ORDER_REJECT")
+			orderTx(c.rejected, c.req)
+			c.rejected.RejectReason = string(c.reject)
+			switch c.typ {
+			case OrderType_TAKE_PROFIT:
+				resp.TakeProfitOrderRejectTransaction, _ = typed(c.rejected).(*TakeProfitOrderRejectTransaction)
+			case OrderType_STOP_LOSS:
+				resp.StopLossOrderRejectTransaction, _ = typed(c.rejected).(*StopLossOrderRejectTransaction)
+			case OrderType_TRAILING_STOP_LOSS:
+				resp.TrailingStopLossOrderRejectTransaction, _ = typed(c.rejected).(*TrailingStopLossOrderRejectTransaction)
+			case OrderType_GUARANTEED_STOP_LOSS:
+				resp.GuaranteedStopLossOrderRejectTransaction, _ = typed(c.rejected).(*GuaranteedStopLossOrderRejectTransaction)
+			}
+		}
+		resp.ErrorCode, resp.ErrorMessage = rejectError(reason)
+		status := fasthttp.StatusBadRequest
+		if t == nil {
+			status = fasthttp.StatusNotFound
+		}
+		return status, resp, nil
+	}
+
+	resp := &TradeModifyResponse{}
+	for _, c := range changes {
+		if id, ok := t.orders[string(c.typ)]; ok {
+			c.cancel = s.newTx(string(TransactionType_ORDER_CANCEL))
+			c.cancel.OrderID = id
+			c.cancel.Reason = string(OrderCancelReason_CLIENT_REQUEST_REPLACED)
+			s.removeOrder(id)
+		}
+		c.create = s.newTx(string(c.typ) + "_ORDER")
+		orderTx(c.create, c.req)
+		c.create.Reason = "CLIENT_ORDER"
+		if c.cancel != nil {
+			c.create.Reason = "REPLACEMENT"
+			c.create.ReplacesOrderID = c.cancel.OrderID
+			c.cancel.ReplacedByOrderID = c.create.Id
+		}
+		cancel, _ := typed(c.cancel).(*OrderCancelTransaction)
+		switch c.typ {
+		case OrderType_TAKE_PROFIT:
+			resp.TakeProfitOrderCancelTransaction = cancel
+			resp.TakeProfitOrderTransaction, _ = typed(c.create).(*TakeProfitOrderTransaction)
+		case OrderType_STOP_LOSS:
+			resp.StopLossOrderCancelTransaction = cancel
+			resp.StopLossOrderTransaction, _ = typed(c.create).(*StopLossOrderTransaction)
+		case OrderType_TRAILING_STOP_LOSS:
+			resp.TrailingStopLossOrderCancelTransaction = cancel
+			resp.TrailingStopLossOrderTransaction, _ = typed(c.create).(*TrailingStopLossOrderTransaction)
+		case OrderType_GUARANTEED_STOP_LOSS:
+			resp.GuaranteedStopLossOrderCancelTransaction = cancel
+			resp.GuaranteedStopLossOrderTransaction, _ = typed(c.create).(*GuaranteedStopLossOrderTransaction)
+		}
+		o := &dryRunOrder{accountID: s.accountID, id: c.create.Id, typ: string(c.typ), tradeID: t.id}
+		if c.req.ClientExtensions != nil {
+			o.clientID = string(c.req.ClientExtensions.ID)
+		}
+		t.orders[o.typ] = o.id
+		s.orders = append(s.orders, o)
+	}
+	resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+	return fasthttp.StatusOK, resp, nil
+}
+
+func (s *simulation) positionClose(instrument InstrumentName, body []byte) (int, interface{}, error) {
+	request := &PositionCloseRequest{}
+	if err := request.UnmarshalJSON(body); err != nil {
+		return 0, nil, err
+	}
+	if s.live.positionErr != nil {
+		return 0, nil, s.live.positionErr
+	}
+	var long, short float64
+	if position := s.live.position; position != nil {
+		if side := position.Long; side != nil {
+			long = side.Units.AsFloat64(0)
+		}
+		if side := position.Short; side != nil {
+			short = side.Units.AsFloat64(0)
+		}
+	}
+	// Apply the simulated changes to the live Position
+	var longTrades, shortTrades []*dryRunTrade
+	for _, t := range s.trades {
+		if t.accountID != s.accountID || t.instrument != instrument {
+			continue
+		}
+		if t.live > 0 || t.units > 0 {
+			long += t.units - t.live
+			if t.units != 0 {
+				longTrades = append(longTrades, t)
+			}
+		} else {
+			short += t.units - t.live
+			if t.units != 0 {
+				shortTrades = append(shortTrades, t)
+			}
+		}
+	}
+
+	type side struct {
+		long     bool
+		units    string
+		size     float64
+		trades   []*dryRunTrade
+		closeout float64
+		reject   TransactionRejectReason
+	}
+	sides := []*side{
+		{long: true, units: request.LongUnits, size: long, trades: longTrades},
+		{units: request.ShortUnits, size: short, trades: shortTrades},
+	}
+	requested := false
+	for _, p := range sides {
+		switch p.units {
+		case "", "NONE":
+			continue
+		case "ALL":
+			p.closeout = -p.size
+			if p.size == 0 {
+				p.reject = TransactionRejectReason_CLOSEOUT_POSITION_DOESNT_EXIST
+			}
+		default:
+			v, err := strconv.ParseFloat(p.units, 64)
+			switch {
+			case err != nil || v <= 0:
+				p.reject = TransactionRejectReason_UNITS_INVALID
+			case p.size == 0:
+				p.reject = TransactionRejectReason_CLOSEOUT_POSITION_DOESNT_EXIST
+			case v > math.Abs(p.size):
+				p.reject = TransactionRejectReason_CLOSEOUT_POSITION_UNITS_EXCEED_POSITION_SIZE
+			}
+			p.closeout = math.Copysign(v, -p.size)
+		}
+		requested = true
+	}
+	rejected := func(status int, reason TransactionRejectReason, long, short *TransactionParser) (int, interface{}, error) {
+		resp := &PositionCloseError{}
+		resp.LongOrderRejectTransaction, _ = typed(long).(*MarketOrderRejectTransaction)
+		resp.ShortOrderRejectTransaction, _ = typed(short).(*MarketOrderRejectTransaction)
+		resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+		resp.ErrorCode, resp.ErrorMessage = rejectError(reason)
+		return status, resp, nil
+	}
+	if !requested {
+		return rejected(fasthttp.StatusBadRequest, TransactionRejectReason_CLOSEOUT_POSITION_INCOMPLETE_SPECIFICATION, nil, nil)
+	}
+
+	newCreate := func(typ TransactionType, p *side) *TransactionParser {
+		tx := s.newTx(string(typ))
+		tx.Instrument = instrument
+		tx.Units = formatUnits(p.closeout)
+		tx.TimeInForce = TimeInForce_FOK
+		tx.PositionFill = OrderPositionFill_REDUCE_ONLY
+		tx.Reason = "POSITION_CLOSEOUT"
+		closeout := &MarketOrderPositionCloseout{Instrument: instrument, Units: p.units}
+		if p.long {
+			tx.LongPositionCloseout = closeout
+		} else {
+			tx.ShortPositionCloseout = closeout
+		}
+		return tx
+	}
+	var reason TransactionRejectReason
+	for _, p := range sides {
+		if len(p.reject) > 0 && len(reason) == 0 {
+			reason = p.reject
+		}
+	}
+	if len(reason) > 0 {
+		var rejects [2]*TransactionParser
+		for i, p := range sides {
+			if len(p.reject) > 0 {
+				rejects[i] = newCreate(TransactionType_MARKET_ORDER_REJECT, p)
+				rejects[i].RejectReason = string(p.reject)
+			}
+		}
+		status := fasthttp.StatusBadRequest
+		if reason == TransactionRejectReason_CLOSEOUT_POSITION_DOESNT_EXIST {
+			status = fasthttp.StatusNotFound
+		}
+		return rejected(status, reason, rejects[0], rejects[1])
+	}
+
+	resp := &PositionCloseResponse{}
+	for _, p := range sides {
+		if p.closeout == 0 {
+			continue
+		}
+		create := newCreate(TransactionType_MARKET_ORDER, p)
+		fill, cancel, reason, err := s.closeout(create, instrument, p.closeout, OrderFillReason_MARKET_ORDER_POSITION_CLOSEOUT, p.trades)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(reason) > 0 {
+			return rejected(fasthttp.StatusBadRequest, reason, nil, nil)
+		}
+		created, _ := typed(create).(*MarketOrderTransaction)
+		filled, _ := typed(fill).(*OrderFillTransaction)
+		cancelled, _ := typed(cancel).(*OrderCancelTransaction)
+		if p.long {
+			resp.LongOrderCreateTransaction, resp.LongOrderFillTransaction, resp.LongOrderCancelTransaction = created, filled, cancelled
+		} else {
+			resp.ShortOrderCreateTransaction, resp.ShortOrderFillTransaction, resp.ShortOrderCancelTransaction = created, filled, cancelled
+		}
+	}
+	resp.RelatedTransactionIDs, resp.LastTransactionID = s.transactionIDs()
+	return fasthttp.StatusOK, resp, nil
+}
@@ -0,0 +1,133 @@
+package endpoint
+
+import (
+	"errors"
+	. "github.com/kamaiu/oanda-go/model"
+	"sync"
+)
+
+var (
+	ErrOrderGuardSet = errors.New("order guard already set")
+)
+
+// OrderGuard vets every request that can create an order before it is sent.
+// A non-nil error aborts the request and is returned wrapped in a GuardError.
+type OrderGuard interface {
+	CheckOrderCreate(accountID AccountID, request OrderRequest) error
+	CheckOrderReplace(accountID AccountID, specifier OrderSpecifier, request OrderRequest) error
+	CheckTradeModify(accountID AccountID, specifier TradeSpecifier, request *TradeModifyRequest) error
+}
+
+// GuardError is returned when the OrderGuard refused a request. The request was
+// never sent.
+type GuardError struct {
+	Err error
+}
+
+func (g GuardError) Error() string {
+	return "order guard: " + g.Err.Error()
+}
+
+func (g GuardError) Unwrap() error {
+	return g.Err
+}
+
+// SetOrderGuard installs the guard that OrderCreate, OrderReplace and TradeModify
+// go through. The guard can only be set once so it cannot be removed or replaced
+// by code that merely shares the Connection.
+func (c *Connection) SetOrderGuard(guard OrderGuard) error {
+	return c.guard.set(guard)
+}
+
+// OrderGuard returns the installed guard or nil.
+func (c *Connection) OrderGuard() OrderGuard {
+	return c.guard.get()
+}
+
+// GuardedAPI enforces an OrderGuard on an API other than a Connection, such as a
+// fake, the paper broker or a wrapper of a Connection, so the guard cannot be
+// skipped by issuing requests through the wrapper.
+type GuardedAPI struct {
+	API
+	guard guardHolder
+}
+
+func NewGuardedAPI(api API) *GuardedAPI {
+	return &GuardedAPI{API: api}
+}
+
+// SetOrderGuard installs the guard. Like that of a Connection it can only be set once.
+func (g *GuardedAPI) SetOrderGuard(guard OrderGuard) error {
+	return g.guard.set(guard)
+}
+
+// OrderGuard returns the installed guard or nil.
+func (g *GuardedAPI) OrderGuard() OrderGuard {
+	return g.guard.get()
+}
+
+func (g *GuardedAPI) OrderCreate(
+	accountID AccountID,
+	request OrderRequest,
+) (*CreateOrderResponse, *CreateOrderError, error) {
+	if guard := g.OrderGuard(); guard != nil {
+		if err := guard.CheckOrderCreate(accountID, request); err != nil {
+			return nil, nil, GuardError{Err: err}
+		}
+	}
+	return g.API.OrderCreate(accountID, request)
+}
+
+func (g *GuardedAPI) OrderReplace(
+	accountID AccountID,
+	specifier OrderSpecifier,
+	order OrderRequest,
+) (*CreateOrderResponse, *CreateOrderError, error) {
+	if guard := g.OrderGuard(); guard != nil {
+		if err := guard.CheckOrderReplace(accountID, specifier, order); err != nil {
+			return nil, nil, GuardError{Err: err}
+		}
+	}
+	return g.API.OrderReplace(accountID, specifier, order)
+}
+
+func (g *GuardedAPI) TradeModify(
+	accountID AccountID,
+	specifier TradeSpecifier,
+	request *TradeModifyRequest,
+) (*TradeModifyResponse, *TradeModifyError, error) {
+	if request == nil {
+		return nil, nil, ErrNilRequest
+	}
+	if guard := g.OrderGuard(); guard != nil {
+		if err := guard.CheckTradeModify(accountID, specifier, request); err != nil {
+			return nil, nil, GuardError{Err: err}
+		}
+	}
+	return g.API.TradeModify(accountID, specifier, request)
+}
+
+// guardHolder holds an OrderGuard that can only be set once.
+type guardHolder struct {
+	guard OrderGuard
+	mu    sync.RWMutex
+}
+
+func (h *guardHolder) set(guard OrderGuard) error {
+	if guard == nil {
+		return ErrNilRequest
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.guard != nil {
+		return ErrOrderGuardSet
+	}
+	h.guard = guard
+	return nil
+}
+
+func (h *guardHolder) get() OrderGuard {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.guard
+}
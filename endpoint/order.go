@@ -14,6 +14,11 @@ func (c *Connection) OrderCreate(
 	accountID AccountID,
 	request OrderRequest,
 ) (*CreateOrderResponse, *CreateOrderError, error) {
+	if guard := c.OrderGuard(); guard != nil {
+		if err := guard.CheckOrderCreate(accountID, request); err != nil {
+			return nil, nil, GuardError{Err: err}
+		}
+	}
 	w := &jwriter.Writer{}
 	w.RawByte('{')
 	w.RawString("\"order\":")
@@ -51,7 +56,7 @@ func (c *Connection) OrderCreate(
 	// Set body
 	ctx.req.SetBody(w.Buffer.BuildBytes())
 
-	err := fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+	simulated, err := c.send(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -69,6 +74,7 @@ func (c *Connection) OrderCreate(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return resp, nil, nil
 
 	// HTTP 400 – The Order specification was invalid
@@ -83,6 +89,7 @@ func (c *Connection) OrderCreate(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return nil, resp, StatusCodeError{Code: statusCode}
 
 	default:
@@ -136,8 +143,8 @@ func (c *Connection) OrdersPending(
 func (c *Connection) OrdersBySpecifier(
 	accountID AccountID,
 	specifier OrderSpecifier,
-) (*OrdersResponse, error) {
-	resp := &OrdersResponse{}
+) (*OrderResponse, error) {
+	resp := &OrderResponse{}
 	url := bytebufferpool.Get()
 	_, _ = url.WriteString(c.host)
 	_, _ = url.WriteString("/v3/accounts/")
@@ -159,6 +166,11 @@ func (c *Connection) OrderReplace(
 	specifier OrderSpecifier,
 	order OrderRequest,
 ) (*CreateOrderResponse, *CreateOrderError, error) {
+	if guard := c.OrderGuard(); guard != nil {
+		if err := guard.CheckOrderReplace(accountID, specifier, order); err != nil {
+			return nil, nil, GuardError{Err: err}
+		}
+	}
 	w := &jwriter.Writer{}
 	w.RawByte('{')
 	w.RawString("\"order\":")
@@ -197,7 +209,7 @@ func (c *Connection) OrderReplace(
 	// Set body
 	ctx.req.SetBody(w.Buffer.BuildBytes())
 
-	err := fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+	simulated, err := c.send(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -215,6 +227,7 @@ func (c *Connection) OrderReplace(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return resp, nil, nil
 
 	// HTTP 400 – The Order specification was invalid
@@ -229,6 +242,7 @@ func (c *Connection) OrderReplace(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return nil, resp, StatusCodeError{Code: statusCode}
 
 	default:
@@ -253,7 +267,7 @@ func (c *Connection) OrderCancel(
 	ctx := newCall(c, fasthttp.MethodPut, url, AcceptDatetimeFormat_RFC3339)
 	defer ctx.release()
 
-	err := fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+	simulated, err := c.send(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -271,6 +285,7 @@ func (c *Connection) OrderCancel(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return resp, nil, nil
 
 	// HTTP 404 – The Account or Order specified does not exist.
@@ -284,6 +299,7 @@ func (c *Connection) OrderCancel(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return nil, resp, StatusCodeError{Code: statusCode}
 
 	default:
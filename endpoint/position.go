@@ -90,7 +90,7 @@ func (c *Connection) PositionClose(
 	request.MarshalEasyJSON(w)
 	ctx.req.SetBody(w.Buffer.BuildBytes())
 
-	err := fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+	simulated, err := c.send(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -108,6 +108,7 @@ func (c *Connection) PositionClose(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return resp, nil, nil
 
 	// HTTP 400 – The Parameters provided that describe the Position closeout are invalid.
@@ -122,6 +123,7 @@ func (c *Connection) PositionClose(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return nil, resp, StatusCodeError{Code: statusCode}
 
 	default:
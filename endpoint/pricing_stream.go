@@ -49,7 +49,13 @@ func (c *Connection) StartPricingStream(
 	_, _ = url.WriteString((string)(accountID))
 	_, _ = url.WriteString("/pricing/stream?")
 	request.AppendQuery(url)
-	return c.doStream(url, &pricingHandler{handler: handler})
+	return c.doStream(url, newPricingHandler(handler))
+}
+
+// HandlePricingLine parses a line of the pricing stream and passes it to the handler
+// the way a Stream does.
+func HandlePricingLine(line []byte, handler PricingStreamHandler) error {
+	return (&pricingHandler{handler: handler}).handle(line)
 }
 
 func AcquireClientPrice() *ClientPrice {
@@ -70,10 +76,19 @@ type PricingStreamHandler interface {
 
 type pricingHandler struct {
 	handler PricingStreamHandler
+	raw     RawStreamHandler
 	price   StreamClientPrice
 }
 
+func newPricingHandler(handler PricingStreamHandler) *pricingHandler {
+	raw, _ := handler.(RawStreamHandler)
+	return &pricingHandler{handler: handler, raw: raw}
+}
+
 func (t *pricingHandler) handle(b []byte) error {
+	if t.raw != nil {
+		t.raw.OnRaw(b)
+	}
 	//price := AcquireClientPrice()
 	p := t.price
 	p.UnmarshalJSON(b)
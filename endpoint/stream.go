@@ -66,6 +66,13 @@ type streamHandler interface {
 	onClose()
 }
 
+// RawStreamHandler is implemented by pricing and transaction stream handlers that
+// also want the raw lines of the stream, for example to record them. OnRaw is called
+// with every line before it is parsed and must not retain it.
+type RawStreamHandler interface {
+	OnRaw(line []byte)
+}
+
 type Stream struct {
 	started time.Time
 	req     *http.Request
@@ -143,6 +150,9 @@ type streamReader struct {
 	r io.Reader
 	b []byte
 	l int
+	// Offset of the partial line to move to the front of the buffer once the
+	// frames returned by the previous call are no longer used
+	m int
 }
 
 func newStreamReader(rd io.Reader) *streamReader {
@@ -155,6 +165,10 @@ func newStreamReader(rd io.Reader) *streamReader {
 }
 
 func (lr *streamReader) next(frames [][]byte) ([][]byte, error) {
+	if lr.m > 0 {
+		copy(lr.b, lr.b[lr.m:lr.m+lr.l])
+		lr.m = 0
+	}
 	for {
 		// Resize buffer to fit line
 		if lr.l > 0 && len(lr.b)-lr.l < 256 {
@@ -168,11 +182,12 @@ func (lr *streamReader) next(frames [][]byte) ([][]byte, error) {
 		}
 
 		// Read more bytes
+		available := len(lr.b) - lr.l
 		n, err := lr.r.Read(lr.b[lr.l:])
 
 		count := 0
 		// Process more?
-		if n > 0 && n < len(lr.b[lr.l:]) {
+		if n > 0 {
 			idx := lr.l
 			sz := idx + n
 			mark := 0
@@ -185,12 +200,15 @@ func (lr *streamReader) next(frames [][]byte) ([][]byte, error) {
 			}
 
 			if idx > mark {
-				if lr.b[idx-1] == '}' {
+				// A full buffer may end inside a message
+				if lr.b[idx-1] == '}' && n < available {
 					frames = append(frames, lr.b[mark:idx])
 					lr.l = 0
 					count++
+				} else if count == 0 {
+					lr.l = idx
 				} else {
-					copy(lr.b[0:], lr.b[mark:])
+					lr.m = mark
 					lr.l = idx - mark
 				}
 			} else {
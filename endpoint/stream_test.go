@@ -3,6 +3,7 @@ package endpoint
 import (
 	"bytes"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -51,6 +52,35 @@ func TestLineReader(t *testing.T) {
 	}
 }
 
+func TestLineReaderLongLines(t *testing.T) {
+	long := "{\"type\":\"TX\",\"comment\":\"" + strings.Repeat("x", 1500) + "\"}"
+	frames := newFrameReader(
+		// Lines longer than the buffer, the second split across reads
+		bytes.NewBufferString(long+"\n"+long[:600]),
+		bytes.NewBufferString(long[600:]+"\n"),
+	)
+
+	rd := newStreamReader(frames)
+	var lines []string
+	for {
+		frame, err := rd.next(nil)
+		for _, line := range frame {
+			lines = append(lines, string(line))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines got %d", len(lines))
+	}
+	for _, line := range lines {
+		if line != long {
+			t.Fatal("did not expect: " + line[:32])
+		}
+	}
+}
+
 func TestJsonObjectTrim(t *testing.T) {
 	type test struct {
 		b      []byte
@@ -94,7 +94,7 @@ func (c *Connection) TradeClose(
 	ctx.req.SetBody(b.Bytes())
 	bytebufferpool.Put(b)
 
-	err := fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+	simulated, err := c.send(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -112,6 +112,7 @@ func (c *Connection) TradeClose(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return resp, nil, nil
 
 	// HTTP 400 – The Trade cannot be closed as requested.
@@ -126,6 +127,7 @@ func (c *Connection) TradeClose(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return nil, resp, StatusCodeError{Code: statusCode}
 
 	default:
@@ -212,6 +214,11 @@ func (c *Connection) TradeModify(
 	if request == nil {
 		return nil, nil, ErrNilRequest
 	}
+	if guard := c.OrderGuard(); guard != nil {
+		if err := guard.CheckTradeModify(accountID, specifier, request); err != nil {
+			return nil, nil, GuardError{Err: err}
+		}
+	}
 	url := bytebufferpool.Get()
 	_, _ = url.WriteString(c.host)
 	_, _ = url.WriteString("/v3/accounts/")
@@ -227,7 +234,7 @@ func (c *Connection) TradeModify(
 	// Set body
 	ctx.req.SetBody(w.Buffer.BuildBytes())
 
-	err := fasthttp.DoRedirects(ctx.req, ctx.resp, maxRedirectsCount)
+	simulated, err := c.send(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -245,6 +252,7 @@ func (c *Connection) TradeModify(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return resp, nil, nil
 
 	// HTTP 400 – The Trade’s dependent Orders cannot be modified as requested.
@@ -258,6 +266,7 @@ func (c *Connection) TradeModify(
 		if err != nil {
 			return nil, nil, err
 		}
+		resp.Simulated = simulated
 		return nil, resp, StatusCodeError{Code: statusCode}
 
 	default:
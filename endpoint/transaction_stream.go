@@ -72,15 +72,33 @@ func (c *Connection) StartTransactionStream(
 	_, _ = url.WriteString("/v3/accounts/")
 	_, _ = url.WriteString((string)(accountID))
 	_, _ = url.WriteString("/transactions/stream")
-	return c.doStream(url, &txHandler{handler: handler})
+	return c.doStream(url, newTxHandler(handler))
+}
+
+// HandleTransactionLine parses a line of the transaction stream and passes it to the
+// handler the way a Stream does.
+func HandleTransactionLine(line []byte, handler TxStreamHandler) error {
+	return (&txHandler{handler: handler}).handle(line)
 }
 
 type txHandler struct {
 	tx      TransactionParser
 	handler TxStreamHandler
+	raw     RawStreamHandler
+}
+
+func newTxHandler(handler TxStreamHandler) *txHandler {
+	raw, _ := handler.(RawStreamHandler)
+	return &txHandler{handler: handler, raw: raw}
 }
 
 func (t *txHandler) handle(msg []byte) error {
+	if t.raw != nil {
+		t.raw.OnRaw(msg)
+	}
+	// Parsed messages share pointers with the parser and fields absent from a
+	// message are left untouched, so start from a clean parser every time.
+	t.tx = TransactionParser{}
 	err := t.tx.UnmarshalJSON(msg)
 	if err != nil {
 		return err
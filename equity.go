@@ -0,0 +1,240 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// EquityPoint is the balance of an Account after a transaction that changed it.
+// The amounts are in the home currency of the Account, the components are
+// cumulative from the first transaction added.
+type EquityPoint struct {
+	Time          time.Time             `json:"time"`
+	TransactionID model.TransactionID   `json:"transactionID"`
+	Type          model.TransactionType `json:"type"`
+	// The change of the balance by the transaction.
+	Amount     float64 `json:"amount"`
+	Balance    float64 `json:"balance"`
+	RealizedPL float64 `json:"realizedPL"`
+	Financing  float64 `json:"financing"`
+	// Commission and guaranteed execution fees are positive costs.
+	Commission             float64 `json:"commission"`
+	GuaranteedExecutionFee float64 `json:"guaranteedExecutionFee"`
+	Dividends              float64 `json:"dividends"`
+	Transfers              float64 `json:"transfers"`
+	// The reported AccountBalance minus the reconstructed balance, zero if they match.
+	Difference float64 `json:"difference"`
+}
+
+// BalanceMismatchError is returned by a strict EquityCurve for a transaction whose
+// AccountBalance differs from the reconstructed balance.
+type BalanceMismatchError struct {
+	TransactionID model.TransactionID
+	Reported      float64
+	Reconstructed float64
+}
+
+func (e *BalanceMismatchError) Error() string {
+	return "transaction " + string(e.TransactionID) + " reports balance " +
+		strconv.FormatFloat(e.Reported, 'f', 4, 64) + " but " +
+		strconv.FormatFloat(e.Reconstructed, 'f', 4, 64) + " was reconstructed"
+}
+
+// EquityConfig configures an EquityCurve.
+type EquityConfig struct {
+	// The largest difference to a reported AccountBalance that still matches.
+	// Defaults to half of the 0.0001 precision of AccountUnits.
+	Tolerance float64
+	// Fail with a BalanceMismatchError instead of recording the difference and
+	// continuing from the reported balance.
+	Strict bool
+}
+
+// EquityCurve rebuilds the balance of an Account over time by replaying the
+// realized P/L, financing, commission and guaranteed execution fees of order
+// fills, fund transfers, daily financing and dividend adjustments. Every
+// transaction that reports an AccountBalance is a checkpoint. The opening balance
+// is derived from the first one, so any range of the history can be replayed.
+type EquityCurve struct {
+	config EquityConfig
+	points []EquityPoint
+	last   EquityPoint
+	opened bool
+	replay txReplay
+}
+
+func NewEquityCurve(config EquityConfig) *EquityCurve {
+	if config.Tolerance <= 0 {
+		config.Tolerance = 0.00005
+	}
+	return &EquityCurve{config: config}
+}
+
+// AddParsed adds the transactions of a TransactionsResponse.
+func (c *EquityCurve) AddParsed(transactions []*model.TransactionParser) error {
+	return c.Add(parsed(transactions)...)
+}
+
+// Add adds transactions in ID order. Transactions that were already added are
+// skipped, so overlapping ranges may be added.
+func (c *EquityCurve) Add(messages ...model.TransactionMessage) error {
+	return c.replay.add(messages, func(msg model.TransactionMessage, tx *model.Transaction) error {
+		p := c.last
+		p.TransactionID = tx.Id
+		p.Amount = 0
+		p.Difference = 0
+		var reported model.AccountUnits
+		switch tx := msg.(type) {
+		case *model.OrderFillTransaction:
+			pl := accountUnits(tx.Pl)
+			financing := accountUnits(tx.Financing)
+			commission := accountUnits(tx.Commission)
+			fee := accountUnits(tx.GuaranteedExecutionFee)
+			p.Type = tx.Type
+			p.Amount = pl + financing - commission - fee
+			p.RealizedPL += pl
+			p.Financing += financing
+			p.Commission += commission
+			p.GuaranteedExecutionFee += fee
+			reported = tx.AccountBalance
+		case *model.TransferFundsTransaction:
+			p.Type = tx.Type
+			p.Amount = accountUnits(tx.Amount)
+			p.Transfers += p.Amount
+			reported = tx.AccountBalance
+		case *model.DailyFinancingTransaction:
+			p.Type = tx.Type
+			p.Amount = accountUnits(tx.Financing)
+			p.Financing += p.Amount
+			reported = tx.AccountBalance
+		case *model.DividendAdjustmentTransaction:
+			p.Type = tx.Type
+			p.Amount = accountUnits(tx.DividendAdjustment)
+			p.Dividends += p.Amount
+			reported = tx.AccountBalance
+		default:
+			return nil
+		}
+		var err error
+		if p.Time, err = tx.Time.Parse(); err != nil {
+			return err
+		}
+		p.Balance += p.Amount
+		if len(reported) > 0 {
+			balance := accountUnits(reported)
+			if !c.opened {
+				// The opening balance is whatever makes the first checkpoint match
+				p.Balance = balance
+			} else if math.Abs(balance-p.Balance) > c.config.Tolerance {
+				if c.config.Strict {
+					return &BalanceMismatchError{TransactionID: p.TransactionID, Reported: balance, Reconstructed: p.Balance}
+				}
+				p.Difference = balance - p.Balance
+			}
+			p.Balance = balance
+			c.opened = true
+		}
+		c.last = p
+		c.points = append(c.points, p)
+		return nil
+	})
+}
+
+// Points returns a point per transaction that changed the balance.
+func (c *EquityCurve) Points() []EquityPoint {
+	return c.points
+}
+
+// Balance returns the balance after the last transaction.
+func (c *EquityCurve) Balance() float64 {
+	return c.last.Balance
+}
+
+// Mismatches returns the points whose reported AccountBalance differed from the
+// reconstructed balance.
+func (c *EquityCurve) Mismatches() []EquityPoint {
+	var mismatches []EquityPoint
+	for _, p := range c.points {
+		if p.Difference != 0 {
+			mismatches = append(mismatches, p)
+		}
+	}
+	return mismatches
+}
+
+// ResampleEquity returns the balance at the end of every period of the granularity
+// from the period of the first point to that of the last, as for a daily
+// statement. Each point is the last one within its period with its Time set to the
+// end of the period and its Amount to the change over the period. Periods without
+// transactions repeat the previous balance.
+func ResampleEquity(
+	points []EquityPoint,
+	g model.CandlestickGranularity,
+	alignment *Alignment,
+) ([]EquityPoint, error) {
+	if alignment == nil {
+		alignment = DefaultAlignment()
+	}
+	if len(points) == 0 {
+		return nil, nil
+	}
+	start, err := alignment.Start(g, points[0].Time)
+	if err != nil {
+		return nil, err
+	}
+	end, err := alignment.Next(g, start)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		result  []EquityPoint
+		current = points[0]
+		opening = points[0].Balance - points[0].Amount
+	)
+	for i := 0; i < len(points); {
+		if points[i].Time.Before(end) {
+			current = points[i]
+			i++
+			continue
+		}
+		current.Time = end
+		current.Amount = current.Balance - opening
+		result = append(result, current)
+		opening = current.Balance
+		if end, err = alignment.Next(g, end); err != nil {
+			return nil, err
+		}
+	}
+	current.Time = end
+	current.Amount = current.Balance - opening
+	return append(result, current), nil
+}
+
+// WriteEquityCSV writes the points as CSV.
+func WriteEquityCSV(w io.Writer, points []EquityPoint) error {
+	rows := make([][]string, 0, len(points))
+	for i := range points {
+		p := &points[i]
+		rows = append(rows, []string{
+			p.Time.Format(time.RFC3339Nano),
+			string(p.TransactionID),
+			string(p.Type),
+			formatAmount(p.Amount),
+			formatAmount(p.Balance),
+			formatAmount(p.RealizedPL),
+			formatAmount(p.Financing),
+			formatAmount(p.Commission),
+			formatAmount(p.GuaranteedExecutionFee),
+			formatAmount(p.Dividends),
+			formatAmount(p.Transfers),
+			formatAmount(p.Difference),
+		})
+	}
+	return writeCSV(w, []string{
+		"time", "transaction_id", "type", "amount", "balance", "realized_pl", "financing", "commission",
+		"guaranteed_execution_fee", "dividends", "transfers", "difference",
+	}, rows)
+}
@@ -0,0 +1,121 @@
+package oanda
+
+import (
+	"bytes"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// financedTrade holds a long of 10000 EUR_USD over two rollovers that charge 1.1
+// each and closes it with 48 profit the day after.
+func financedTrade(t *testing.T) (*endpoint.Connection, []*model.TransactionParser) {
+	t.Helper()
+	const account = oandatest.TestAccount
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	s, conn := newTestServer(t, 10000, oandatest.Tick{Instrument: "EUR_USD", Time: start, Bid: 1.0999, Ask: 1.1001})
+	s.AddInstrument(&model.Instrument{
+		Name:              "EUR_USD",
+		Type:              model.InstrumentType_CURRENCY,
+		PipLocation:       -4,
+		DisplayPrecision:  5,
+		MinimumTradeSize:  "1",
+		MaximumOrderUnits: "100000000",
+		MarginRate:        "0.02",
+		Financing:         &model.InstrumentFinancing{LongRate: "-0.0365", ShortRate: "0.0100"},
+	})
+	if _, _, err := conn.OrderCreate(account, &model.MarketOrderRequest{
+		Type:        model.OrderType_MARKET,
+		Instrument:  "EUR_USD",
+		Units:       "10000",
+		TimeInForce: model.TimeInForce_FOK,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.Quote(oandatest.Tick{Instrument: "EUR_USD", Time: start.Add(48 * time.Hour), Bid: 1.1049, Ask: 1.1051})
+	if _, _, err := conn.PositionClose(account, "EUR_USD", &model.PositionCloseRequest{LongUnits: "ALL"}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := conn.TransactionsIDRange(account, &model.TransactionsIDRangeRequest{From: "1", To: "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, resp.Transactions
+}
+
+func TestEquityCurve(t *testing.T) {
+	conn, transactions := financedTrade(t)
+	summary, err := conn.AccountSummary("101-001-1-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	curve := NewEquityCurve(EquityConfig{Strict: true})
+	if err = curve.AddParsed(transactions); err != nil {
+		t.Fatal(err)
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+	points := curve.Points()
+	if len(points) != 5 || points[0].Type != model.TransactionType_TRANSFER_FUNDS ||
+		points[2].Type != model.TransactionType_DAILY_FINANCING {
+		t.Fatalf("unexpected points %+v", points)
+	}
+	last := points[len(points)-1]
+	if curve.Balance() != accountUnits(summary.Account.Balance) || !near(last.Balance, 10045.8) ||
+		!near(last.RealizedPL, 48) || !near(last.Financing, -2.2) || last.Transfers != 10000 {
+		t.Fatalf("unexpected balance %v %+v", summary.Account.Balance, last)
+	}
+	if len(curve.Mismatches()) != 0 {
+		t.Fatalf("unexpected mismatches %+v", curve.Mismatches())
+	}
+
+	// Daily statements end at 17:00 New York time, the rollovers open the next day
+	daily, err := ResampleEquity(points, model.CandlestickGranularity_D, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 3 || !daily[0].Time.Equal(time.Date(2021, 3, 1, 22, 0, 0, 0, time.UTC)) ||
+		!near(daily[0].Balance, 10000) || !near(daily[1].Amount, -1.1) || !near(daily[2].Amount, 46.9) {
+		t.Fatalf("unexpected daily %+v", daily)
+	}
+
+	var b bytes.Buffer
+	if err = WriteEquityCSV(&b, daily); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "2021-03-01T22:00:00Z,") || !strings.Contains(lines[3], ",10045.8000,") {
+		t.Fatalf("unexpected csv %s", b.String())
+	}
+}
+
+func TestEquityCurveMismatch(t *testing.T) {
+	transfer := func(id model.TransactionID, amount, balance model.AccountUnits) *model.TransferFundsTransaction {
+		return &model.TransferFundsTransaction{
+			Transaction:    model.Transaction{Id: id, Time: "2021-03-01T12:00:00.000000000Z"},
+			Type:           model.TransactionType_TRANSFER_FUNDS,
+			Amount:         amount,
+			AccountBalance: balance,
+		}
+	}
+	// The opening balance is derived from the first checkpoint
+	curve := NewEquityCurve(EquityConfig{})
+	err := curve.Add(transfer("7", "100.0000", "600.0000"), transfer("8", "100.0000", "800.0000"), transfer("9", "50.0000", "850.0000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatches := curve.Mismatches()
+	if curve.Balance() != 850 || len(mismatches) != 1 || mismatches[0].TransactionID != "8" || mismatches[0].Difference != 100 {
+		t.Fatalf("unexpected mismatches %v %+v", curve.Balance(), mismatches)
+	}
+
+	strict := NewEquityCurve(EquityConfig{Strict: true})
+	err = strict.Add(transfer("7", "100.0000", "600.0000"), transfer("8", "100.0000", "800.0000"))
+	if mismatch, ok := err.(*BalanceMismatchError); !ok || mismatch.Reported != 800 || mismatch.Reconstructed != 700 {
+		t.Fatalf("expected a mismatch got %v", err)
+	}
+}
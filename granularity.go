@@ -0,0 +1,207 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+	"time"
+)
+
+// GranularityDuration returns the nominal duration of a candle of the granularity.
+// Monthly candles are reported as 31 days. Returns false for unknown granularities.
+func GranularityDuration(g model.CandlestickGranularity) (time.Duration, bool) {
+	switch g {
+	case model.CandlestickGranularity_S5:
+		return time.Second * 5, true
+	case model.CandlestickGranularity_S10:
+		return time.Second * 10, true
+	case model.CandlestickGranularity_S15:
+		return time.Second * 15, true
+	case model.CandlestickGranularity_S30:
+		return time.Second * 30, true
+	case model.CandlestickGranularity_M1:
+		return time.Minute, true
+	case model.CandlestickGranularity_M2:
+		return time.Minute * 2, true
+	case model.CandlestickGranularity_M4:
+		return time.Minute * 4, true
+	case model.CandlestickGranularity_M5:
+		return time.Minute * 5, true
+	case model.CandlestickGranularity_M10:
+		return time.Minute * 10, true
+	case model.CandlestickGranularity_M15:
+		return time.Minute * 15, true
+	case model.CandlestickGranularity_M30:
+		return time.Minute * 30, true
+	case model.CandlestickGranularity_H1:
+		return time.Hour, true
+	case model.CandlestickGranularity_H2:
+		return time.Hour * 2, true
+	case model.CandlestickGranularity_H3:
+		return time.Hour * 3, true
+	case model.CandlestickGranularity_H4:
+		return time.Hour * 4, true
+	case model.CandlestickGranularity_H6:
+		return time.Hour * 6, true
+	case model.CandlestickGranularity_H8:
+		return time.Hour * 8, true
+	case model.CandlestickGranularity_H12:
+		return time.Hour * 12, true
+	case model.CandlestickGranularity_D:
+		return time.Hour * 24, true
+	case model.CandlestickGranularity_W:
+		return time.Hour * 24 * 7, true
+	case model.CandlestickGranularity_M:
+		return time.Hour * 24 * 31, true
+	}
+	return 0, false
+}
+
+// Alignment reproduces how OANDA aligns candle start times.
+//
+// Second and minute granularities up to M1 are aligned to the minute, M2 to H1 to the
+// hour, and H2 to D to the DailyAlignment hour in the AlignmentTimezone. Weekly
+// candles start on the WeeklyAlignment day at the DailyAlignment hour and monthly
+// candles with the trading day of the first day of the month.
+type Alignment struct {
+	DailyAlignment    int
+	AlignmentTimezone string
+	WeeklyAlignment   model.WeeklyAlignment
+	loc               *time.Location
+	weekday           time.Weekday
+}
+
+// DefaultAlignment returns OANDA's default alignment of 17:00 New York time with
+// weeks starting on Friday.
+func DefaultAlignment() *Alignment {
+	a, _ := NewAlignment(17, "America/New_York", model.WeeklyAlignment_Friday)
+	return a
+}
+
+func NewAlignment(
+	dailyAlignment int,
+	timezone string,
+	weeklyAlignment model.WeeklyAlignment,
+) (*Alignment, error) {
+	if dailyAlignment < 0 || dailyAlignment > 23 {
+		return nil, errors.New("daily alignment must be between 0 and 23")
+	}
+	if len(timezone) == 0 {
+		timezone = "America/New_York"
+	}
+	loc := newYork
+	if timezone != "America/New_York" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, err
+		}
+	}
+	if len(weeklyAlignment) == 0 {
+		weeklyAlignment = model.WeeklyAlignment_Friday
+	}
+	weekday := time.Weekday(-1)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if d.String() == string(weeklyAlignment) {
+			weekday = d
+		}
+	}
+	if weekday < 0 {
+		return nil, errors.New("invalid weekly alignment: " + string(weeklyAlignment))
+	}
+	return &Alignment{
+		DailyAlignment:    dailyAlignment,
+		AlignmentTimezone: timezone,
+		WeeklyAlignment:   weeklyAlignment,
+		loc:               loc,
+		weekday:           weekday,
+	}, nil
+}
+
+// AlignmentOf returns the Alignment of the request.
+func AlignmentOf(request *model.InstrumentCandlesRequest) (*Alignment, error) {
+	return NewAlignment(request.DailyAlignment, request.AlignmentTimezone, request.WeeklyAlignment)
+}
+
+// Start returns the start time of the candle of the granularity containing t.
+func (a *Alignment) Start(g model.CandlestickGranularity, t time.Time) (time.Time, error) {
+	d, ok := GranularityDuration(g)
+	if !ok {
+		return time.Time{}, ErrInvalidGranularity
+	}
+	t = t.UTC()
+	switch {
+	case g == model.CandlestickGranularity_M:
+		return a.monthAnchor(t).UTC(), nil
+	case g == model.CandlestickGranularity_W:
+		return a.weekAnchor(t).UTC(), nil
+	case d >= 2*time.Hour:
+		anchor := a.dayAnchor(t)
+		return anchor.Add(t.Sub(anchor) / d * d).UTC(), nil
+	default:
+		return t.Truncate(d), nil
+	}
+}
+
+// Next returns the start time of the candle following the one starting at start.
+// Day aligned candles never span the daily alignment, so the last candle of a day
+// that is shortened or extended by a daylight saving transition ends at the next
+// daily alignment.
+func (a *Alignment) Next(g model.CandlestickGranularity, start time.Time) (time.Time, error) {
+	d, ok := GranularityDuration(g)
+	if !ok {
+		return time.Time{}, ErrInvalidGranularity
+	}
+	start = start.UTC()
+	switch {
+	case g == model.CandlestickGranularity_M:
+		day := a.tradingDate(a.monthAnchor(start))
+		return a.dayAnchor(time.Date(day.Year(), day.Month()+1, 1, 12, 0, 0, 0, a.loc)).UTC(), nil
+	case g == model.CandlestickGranularity_W:
+		anchor := a.weekAnchor(start).In(a.loc)
+		return time.Date(anchor.Year(), anchor.Month(), anchor.Day()+7, a.DailyAlignment, 0, 0, 0, a.loc).UTC(), nil
+	case d >= 2*time.Hour:
+		anchor := a.dayAnchor(start).In(a.loc)
+		day := time.Date(anchor.Year(), anchor.Month(), anchor.Day()+1, a.DailyAlignment, 0, 0, 0, a.loc)
+		next := start.Add(d)
+		if next.After(day) {
+			next = day
+		}
+		return next.UTC(), nil
+	default:
+		return start.Truncate(d).Add(d), nil
+	}
+}
+
+// dayAnchor returns the most recent daily alignment at or before t.
+func (a *Alignment) dayAnchor(t time.Time) time.Time {
+	local := t.In(a.loc)
+	anchor := time.Date(local.Year(), local.Month(), local.Day(), a.DailyAlignment, 0, 0, 0, a.loc)
+	if anchor.After(t) {
+		anchor = time.Date(local.Year(), local.Month(), local.Day()-1, a.DailyAlignment, 0, 0, 0, a.loc)
+	}
+	return anchor
+}
+
+// weekAnchor returns the most recent weekly alignment at or before t.
+func (a *Alignment) weekAnchor(t time.Time) time.Time {
+	day := a.dayAnchor(t)
+	back := (int(day.Weekday()) - int(a.weekday) + 7) % 7
+	return time.Date(day.Year(), day.Month(), day.Day()-back, a.DailyAlignment, 0, 0, 0, a.loc)
+}
+
+// tradingDate returns the local date of the trading day starting at the daily
+// anchor. A day is named after the date whose noon it contains, so with the default
+// alignment the day starting 17:00 on the 4th is the 5th.
+func (a *Alignment) tradingDate(anchor time.Time) time.Time {
+	anchor = anchor.In(a.loc)
+	if a.DailyAlignment > 12 {
+		return time.Date(anchor.Year(), anchor.Month(), anchor.Day()+1, 0, 0, 0, 0, a.loc)
+	}
+	return time.Date(anchor.Year(), anchor.Month(), anchor.Day(), 0, 0, 0, 0, a.loc)
+}
+
+// monthAnchor returns the start of the trading day that begins the month of the
+// trading day containing t.
+func (a *Alignment) monthAnchor(t time.Time) time.Time {
+	day := a.tradingDate(a.dayAnchor(t))
+	return a.dayAnchor(time.Date(day.Year(), day.Month(), 1, 12, 0, 0, 0, a.loc))
+}
@@ -0,0 +1,287 @@
+package oanda
+
+import (
+	"bytes"
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How long instruments loaded from OANDA are cached before being reloaded.
+	DefaultInstrumentTTL = time.Hour
+	// How long to wait before retrying a failed reload.
+	instrumentRetryInterval = time.Minute
+)
+
+var (
+	ErrInstrumentNotFound = errors.New("instrument not found")
+)
+
+// GuaranteedStopLoss holds the guaranteed Stop Loss Order parameters of an instrument.
+type GuaranteedStopLoss struct {
+	Mode             model.GuaranteedStopLossOrderModeForInstrument
+	ExecutionPremium model.DecimalNumber
+	MinimumDistance  model.DecimalNumber
+	LevelRestriction *model.GuaranteedStopLossOrderLevelRestriction
+}
+
+// InstrumentRegistry caches the instruments tradeable by an Account. Instruments
+// loaded from OANDA are reloaded on first access after the TTL expires. If reloading
+// fails the previously loaded instruments are kept.
+type InstrumentRegistry struct {
+	accountID   model.AccountID
+	load        func() ([]*model.Instrument, error)
+	ttl         time.Duration
+	instruments []*model.Instrument
+	byName      map[model.InstrumentName]*model.Instrument
+	loaded      time.Time
+	attempted   time.Time
+	err         error
+	refreshMu   sync.Mutex
+	mu          sync.RWMutex
+}
+
+// NewInstrumentRegistry loads the instruments of the Account. A ttl of zero uses
+// DefaultInstrumentTTL.
+func NewInstrumentRegistry(
+	conn endpoint.AccountsAPI,
+	limiter *RateLimiter,
+	accountID model.AccountID,
+	ttl time.Duration,
+) (*InstrumentRegistry, error) {
+	if ttl <= 0 {
+		ttl = DefaultInstrumentTTL
+	}
+	r := &InstrumentRegistry{
+		accountID: accountID,
+		ttl:       ttl,
+		load: func() ([]*model.Instrument, error) {
+			limiter.Wait()
+			resp, err := conn.AccountInstruments(accountID)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Instruments, nil
+		},
+	}
+	if err := r.Refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadInstrumentRegistry reads instruments from a JSON file holding either an
+// AccountInstruments response or a plain array of instruments. The registry is
+// never reloaded.
+func LoadInstrumentRegistry(path string) (*InstrumentRegistry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	instruments, err := parseInstruments(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewInstrumentRegistryFrom(instruments), nil
+}
+
+// NewInstrumentRegistryFrom creates a registry of fixed instruments that is never
+// reloaded.
+func NewInstrumentRegistryFrom(instruments []*model.Instrument) *InstrumentRegistry {
+	r := &InstrumentRegistry{}
+	r.set(instruments)
+	return r
+}
+
+func parseInstruments(data []byte) ([]*model.Instrument, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var instruments []*model.Instrument
+		if err := unmarshalInstruments(data, &instruments); err != nil {
+			return nil, err
+		}
+		return instruments, nil
+	}
+	resp := &model.AccountInstrumentsResponse{}
+	if err := resp.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return resp.Instruments, nil
+}
+
+// unmarshalInstruments decodes a JSON array through the easyjson unmarshaler of
+// the response by wrapping it.
+func unmarshalInstruments(data []byte, instruments *[]*model.Instrument) error {
+	wrapped := make([]byte, 0, len(data)+16)
+	wrapped = append(wrapped, `{"instruments":`...)
+	wrapped = append(wrapped, data...)
+	wrapped = append(wrapped, '}')
+	resp := &model.AccountInstrumentsResponse{}
+	if err := resp.UnmarshalJSON(wrapped); err != nil {
+		return err
+	}
+	*instruments = resp.Instruments
+	return nil
+}
+
+func (r *InstrumentRegistry) set(instruments []*model.Instrument) {
+	byName := make(map[model.InstrumentName]*model.Instrument, len(instruments))
+	list := make([]*model.Instrument, 0, len(instruments))
+	for _, instrument := range instruments {
+		if instrument == nil {
+			continue
+		}
+		byName[instrument.Name] = instrument
+		list = append(list, instrument)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	r.mu.Lock()
+	r.instruments = list
+	r.byName = byName
+	r.loaded = time.Now()
+	r.err = nil
+	r.mu.Unlock()
+}
+
+func (r *InstrumentRegistry) AccountID() model.AccountID {
+	return r.accountID
+}
+
+// Refresh reloads the instruments. It is a no-op for registries loaded from a file.
+func (r *InstrumentRegistry) Refresh() error {
+	if r.load == nil {
+		return nil
+	}
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+	r.mu.Lock()
+	r.attempted = time.Now()
+	r.mu.Unlock()
+	instruments, err := r.load()
+	if err != nil {
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+		return err
+	}
+	r.set(instruments)
+	return nil
+}
+
+// The time the instruments were last loaded.
+func (r *InstrumentRegistry) Loaded() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loaded
+}
+
+// The error of the most recent reload or nil if it succeeded.
+func (r *InstrumentRegistry) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+func (r *InstrumentRegistry) expire() {
+	if r.load == nil {
+		return
+	}
+	r.mu.RLock()
+	expired := time.Since(r.loaded) > r.ttl
+	if r.err != nil && time.Since(r.attempted) < instrumentRetryInterval {
+		// Do not retry a failed reload on every access
+		expired = false
+	}
+	r.mu.RUnlock()
+	if expired {
+		// Errors are kept on the registry and the stale instruments are served
+		_ = r.Refresh()
+	}
+}
+
+// Get returns the instrument with the name.
+func (r *InstrumentRegistry) Get(name model.InstrumentName) (*model.Instrument, error) {
+	r.expire()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	instrument := r.byName[name]
+	if instrument == nil {
+		return nil, ErrInstrumentNotFound
+	}
+	return instrument, nil
+}
+
+// Instruments returns every instrument ordered by name.
+func (r *InstrumentRegistry) Instruments() []*model.Instrument {
+	r.expire()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	instruments := make([]*model.Instrument, len(r.instruments))
+	copy(instruments, r.instruments)
+	return instruments
+}
+
+// ByType returns the instruments of the type ordered by name.
+func (r *InstrumentRegistry) ByType(t model.InstrumentType) []*model.Instrument {
+	r.expire()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var instruments []*model.Instrument
+	for _, instrument := range r.instruments {
+		if instrument.Type == t {
+			instruments = append(instruments, instrument)
+		}
+	}
+	return instruments
+}
+
+// Financing returns the financing rates of the instrument.
+func (r *InstrumentRegistry) Financing(name model.InstrumentName) (*model.InstrumentFinancing, error) {
+	instrument, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return instrument.Financing, nil
+}
+
+// Commission returns the commission structure of the instrument. It is nil for
+// instruments that do not charge commission.
+func (r *InstrumentRegistry) Commission(name model.InstrumentName) (*model.InstrumentCommission, error) {
+	instrument, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return instrument.Commission, nil
+}
+
+// GuaranteedStopLoss returns the guaranteed Stop Loss Order parameters of the instrument.
+func (r *InstrumentRegistry) GuaranteedStopLoss(name model.InstrumentName) (*GuaranteedStopLoss, error) {
+	instrument, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &GuaranteedStopLoss{
+		Mode:             instrument.GuaranteedStopLossOrderMode,
+		ExecutionPremium: instrument.GuaranteedStopLossOrderExecutionPremium,
+		MinimumDistance:  instrument.MinimumGuaranteedStopLossDistance,
+		LevelRestriction: instrument.GuaranteedStopLossOrderLevelRestriction,
+	}, nil
+}
+
+// SplitInstrument splits an instrument name such as EUR_USD into its base and quote
+// currency. CFDs such as DE30_EUR split into the index and its quote currency.
+func SplitInstrument(name model.InstrumentName) (base, quote model.Currency, ok bool) {
+	i := strings.LastIndexByte(string(name), '_')
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	return model.Currency(name[:i]), model.Currency(name[i+1:]), true
+}
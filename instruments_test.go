@@ -0,0 +1,82 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+	"testing"
+	"time"
+)
+
+func TestInstrumentRegistry(t *testing.T) {
+	registry, err := LoadInstrumentRegistry("endpoint/instruments.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.Instruments()) != 69 {
+		t.Fatalf("expected 69 instruments got %d", len(registry.Instruments()))
+	}
+	if len(registry.ByType(model.InstrumentType_CURRENCY)) != 69 || len(registry.ByType(model.InstrumentType_CFD)) != 0 {
+		t.Fatal("unexpected instruments by type")
+	}
+	instrument, err := registry.Get("EUR_USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instrument.PipLocation != -4 || instrument.MarginRate != "0.02" {
+		t.Fatal("unexpected instrument")
+	}
+	financing, err := registry.Financing("EUR_USD")
+	if err != nil || financing.LongRate != "-0.017" || len(financing.FinancingDaysOfWeek) != 7 {
+		t.Fatal("unexpected financing")
+	}
+	commission, err := registry.Commission("EUR_USD")
+	if err != nil || commission.Commission != "50" {
+		t.Fatal("unexpected commission")
+	}
+	gslo, err := registry.GuaranteedStopLoss("EUR_USD")
+	if err != nil || gslo.Mode != "DISABLED" {
+		t.Fatal("unexpected guaranteed stop loss")
+	}
+	if _, err = registry.Get("XXX_YYY"); err != ErrInstrumentNotFound {
+		t.Fatal("expected ErrInstrumentNotFound")
+	}
+
+	base, quote, ok := SplitInstrument("EUR_USD")
+	if !ok || base != "EUR" || quote != "USD" {
+		t.Fatal("unexpected split")
+	}
+	if base, quote, ok = SplitInstrument("DE30_EUR"); !ok || base != "DE30" || quote != "EUR" {
+		t.Fatal("unexpected split")
+	}
+	if _, _, ok = SplitInstrument("EURUSD"); ok {
+		t.Fatal("expected split to fail")
+	}
+}
+
+func TestInstrumentRegistryTTL(t *testing.T) {
+	var (
+		loads int
+		fail  bool
+	)
+	registry := &InstrumentRegistry{
+		ttl: time.Millisecond,
+		load: func() ([]*model.Instrument, error) {
+			loads++
+			if fail {
+				return nil, errors.New("unavailable")
+			}
+			return []*model.Instrument{{Name: "EUR_USD"}}, nil
+		},
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	fail = true
+	if _, err := registry.Get("EUR_USD"); err != nil {
+		t.Fatal("stale instrument not served")
+	}
+	if loads != 2 || registry.Err() == nil {
+		t.Fatalf("expected a failed reload got %d loads", loads)
+	}
+}
@@ -0,0 +1,91 @@
+package oanda
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// OANDA allows 120 requests per second per token. Stay below it to leave room
+	// for retries and clock skew.
+	DefaultRateLimit = 100
+	// The number of requests that may be issued back to back before spacing applies.
+	DefaultRateBurst = 20
+	// The maximum number of concurrent requests issued by a single operation.
+	DefaultConcurrency = 8
+)
+
+// RateLimiter spaces out requests to at most a fixed number per second while
+// allowing a small burst. It is safe for concurrent use and may be shared by
+// multiple Clients using the same token.
+type RateLimiter struct {
+	interval time.Duration
+	window   time.Duration
+	next     time.Time
+	mu       sync.Mutex
+}
+
+func NewRateLimiter(perSecond, burst int) *RateLimiter {
+	if perSecond < 1 {
+		perSecond = DefaultRateLimit
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	interval := time.Second / time.Duration(perSecond)
+	return &RateLimiter{
+		interval: interval,
+		window:   interval * time.Duration(burst-1),
+	}
+}
+
+// Wait blocks until the next request is allowed.
+func (r *RateLimiter) Wait() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if earliest := now.Add(-r.window); r.next.Before(earliest) {
+		r.next = earliest
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// parallel invokes fn for every index in [0, n) using at most workers goroutines.
+// The limiter is waited on before each invocation.
+func parallel(n, workers int, limiter *RateLimiter, fn func(i int)) {
+	if n == 0 {
+		return
+	}
+	if workers < 1 {
+		workers = DefaultConcurrency
+	}
+	if workers > n {
+		workers = n
+	}
+	var (
+		wg   sync.WaitGroup
+		next = make(chan int)
+	)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				limiter.Wait()
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
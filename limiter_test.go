@@ -0,0 +1,38 @@
+package oanda
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(100, 5)
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		limiter.Wait()
+	}
+	// 5 burst + 20 spaced at 10ms
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Fatalf("limiter too permissive: %s", elapsed)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	var (
+		count int64
+		seen  = make([]int32, 50)
+	)
+	parallel(len(seen), 4, nil, func(i int) {
+		atomic.AddInt64(&count, 1)
+		atomic.AddInt32(&seen[i], 1)
+	})
+	if count != 50 {
+		t.Fatalf("expected 50 calls got %d", count)
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("index %d called %d times", i, n)
+		}
+	}
+}
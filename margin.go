@@ -0,0 +1,306 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrNoQuote = errors.New("no quote for instrument")
+)
+
+// TradeState is the locally calculated state of an open trade. Amounts are in the
+// home currency.
+type TradeState struct {
+	ID           model.TradeID
+	Instrument   model.InstrumentName
+	Units        float64
+	Price        float64
+	UnrealizedPL float64
+	MarginUsed   float64
+}
+
+func (t *TradeState) Calculated() model.CalculatedTradeState {
+	return model.CalculatedTradeState{
+		ID:           t.ID,
+		UnrealizedPL: formatAccountUnits(t.UnrealizedPL),
+		MarginUsed:   formatAccountUnits(t.MarginUsed),
+	}
+}
+
+// PositionState is the locally calculated state of the open trades of an instrument.
+// Amounts are in the home currency.
+type PositionState struct {
+	Instrument        model.InstrumentName
+	LongUnits         float64
+	ShortUnits        float64
+	LongUnrealizedPL  float64
+	ShortUnrealizedPL float64
+	NetUnrealizedPL   float64
+	PositionValue     float64
+	MarginUsed        float64
+}
+
+func (p *PositionState) Calculated() model.CalculatedPositionState {
+	return model.CalculatedPositionState{
+		Instrument:        p.Instrument,
+		NetUnrealizedPL:   formatAccountUnits(p.NetUnrealizedPL),
+		LongUnrealizedPL:  formatAccountUnits(p.LongUnrealizedPL),
+		ShortUnrealizedPL: formatAccountUnits(p.ShortUnrealizedPL),
+		MarginUsed:        formatAccountUnits(p.MarginUsed),
+	}
+}
+
+// AccountState is the locally calculated equivalent of CalculatedAccountState.
+// Amounts are in the home currency.
+type AccountState struct {
+	Balance                     float64
+	UnrealizedPL                float64
+	NAV                         float64
+	MarginUsed                  float64
+	MarginAvailable             float64
+	PositionValue               float64
+	MarginCloseoutUnrealizedPL  float64
+	MarginCloseoutNAV           float64
+	MarginCloseoutMarginUsed    float64
+	MarginCloseoutPercent       float64
+	MarginCloseoutPositionValue float64
+	WithdrawalLimit             float64
+	MarginCallMarginUsed        float64
+	MarginCallPercent           float64
+	Trades                      []TradeState
+	Positions                   []PositionState
+}
+
+// CloseoutDistance is the amount the margin closeout NAV can fall before the Account
+// is margin closed out. It is negative once the Account is in margin closeout.
+func (s *AccountState) CloseoutDistance() float64 {
+	return s.MarginCloseoutNAV - s.MarginCloseoutMarginUsed
+}
+
+func (s *AccountState) Calculated() *model.CalculatedAccountState {
+	return &model.CalculatedAccountState{
+		UnrealizedPL:                formatAccountUnits(s.UnrealizedPL),
+		NAV:                         formatAccountUnits(s.NAV),
+		MarginUsed:                  formatAccountUnits(s.MarginUsed),
+		MarginAvailable:             formatAccountUnits(s.MarginAvailable),
+		PositionValue:               formatAccountUnits(s.PositionValue),
+		MarginCloseoutUnrealizedPL:  formatAccountUnits(s.MarginCloseoutUnrealizedPL),
+		MarginCloseoutNAV:           formatAccountUnits(s.MarginCloseoutNAV),
+		MarginCloseoutMarginUsed:    formatAccountUnits(s.MarginCloseoutMarginUsed),
+		MarginCloseoutPercent:       model.DecimalNumber(strconv.FormatFloat(s.MarginCloseoutPercent, 'f', 5, 64)),
+		MarginCloseoutPositionValue: model.DecimalNumber(formatAccountUnits(s.MarginCloseoutPositionValue)),
+		WithdrawalLimit:             formatAccountUnits(s.WithdrawalLimit),
+		MarginCallMarginUsed:        formatAccountUnits(s.MarginCallMarginUsed),
+		MarginCallPercent:           model.DecimalNumber(strconv.FormatFloat(s.MarginCallPercent, 'f', 5, 64)),
+	}
+}
+
+func formatAccountUnits(v float64) model.AccountUnits {
+	return model.AccountUnits(strconv.FormatFloat(v, 'f', 4, 64))
+}
+
+func accountUnits(v model.AccountUnits) float64 {
+	return model.DecimalNumber(v).AsFloat64(0)
+}
+
+// MarginCalculator recalculates the unrealized P/L and margin of an Account from
+// the latest quotes, following OANDA's margin rules:
+//
+//   - Unrealized P/L closes longs at the bid and shorts at the ask.
+//   - Position value and margin closeout values use mid prices.
+//   - The margin rate of an instrument is the larger of the instrument's and the
+//     Account's margin rate.
+//   - The margin of a hedged position is that of its larger side.
+//   - Margin closeout happens when the margin closeout NAV falls to half the margin used.
+type MarginCalculator struct {
+	converter   *CurrencyConverter
+	instruments *InstrumentRegistry
+}
+
+func NewMarginCalculator(converter *CurrencyConverter, instruments *InstrumentRegistry) *MarginCalculator {
+	return &MarginCalculator{
+		converter:   converter,
+		instruments: instruments,
+	}
+}
+
+// Calculate recalculates the state of the Account snapshot. The snapshot provides
+// the balance, margin rate and open trades.
+func (m *MarginCalculator) Calculate(account *model.Account) (*AccountState, error) {
+	if account == nil {
+		return nil, errors.New("account required")
+	}
+	var (
+		accountRate = model.DecimalNumber(account.MarginRate).AsFloat64(0)
+		balance     = accountUnits(account.Balance)
+		positions   = make(map[model.InstrumentName]*positionTotals)
+		state       = &AccountState{
+			Balance: balance,
+			Trades:  make([]TradeState, 0, len(account.Trades)),
+		}
+	)
+
+	for _, trade := range account.Trades {
+		if trade == nil {
+			continue
+		}
+		units := trade.CurrentUnits.AsFloat64(0)
+		if units == 0 {
+			continue
+		}
+		t, err := m.trade(trade, units, accountRate, positions)
+		if err != nil {
+			return nil, err
+		}
+		state.Trades = append(state.Trades, t)
+	}
+
+	names := make([]string, 0, len(positions))
+	for name := range positions {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	state.Positions = make([]PositionState, 0, len(names))
+	for _, name := range names {
+		p := positions[model.InstrumentName(name)]
+		// A hedged position is margined on its larger side
+		margin := math.Max(p.longValue, p.shortValue) * p.rate
+		state.Positions = append(state.Positions, PositionState{
+			Instrument:        p.instrument,
+			LongUnits:         p.longUnits,
+			ShortUnits:        p.shortUnits,
+			LongUnrealizedPL:  p.longPL,
+			ShortUnrealizedPL: p.shortPL,
+			NetUnrealizedPL:   p.longPL + p.shortPL,
+			PositionValue:     p.longValue + p.shortValue,
+			MarginUsed:        margin,
+		})
+		state.UnrealizedPL += p.longPL + p.shortPL
+		state.MarginCloseoutUnrealizedPL += p.closeoutPL
+		state.PositionValue += p.longValue + p.shortValue
+		state.MarginUsed += margin
+	}
+
+	state.NAV = balance + state.UnrealizedPL
+	state.MarginAvailable = math.Max(0, state.NAV-state.MarginUsed)
+	state.MarginCloseoutNAV = balance + state.MarginCloseoutUnrealizedPL
+	state.MarginCloseoutMarginUsed = state.MarginUsed / 2
+	state.MarginCloseoutPositionValue = state.PositionValue
+	state.MarginCallMarginUsed = state.MarginUsed
+	if state.MarginCloseoutNAV > 0 {
+		state.MarginCloseoutPercent = state.MarginCloseoutMarginUsed / state.MarginCloseoutNAV
+		state.MarginCallPercent = state.MarginCallMarginUsed / state.MarginCloseoutNAV
+	} else if state.MarginUsed > 0 {
+		state.MarginCloseoutPercent = 1
+		state.MarginCallPercent = 1
+	}
+	state.WithdrawalLimit = math.Max(0, math.Min(balance, state.NAV)-state.MarginUsed)
+	return state, nil
+}
+
+// CalculateAccount recalculates the state of the most recently loaded details of
+// the Account.
+func (m *MarginCalculator) CalculateAccount(account *Account) (*AccountState, error) {
+	details, err := account.State()
+	if details == nil {
+		if err == nil {
+			err = errors.New("account not loaded")
+		}
+		return nil, err
+	}
+	return m.Calculate(details)
+}
+
+type positionTotals struct {
+	instrument model.InstrumentName
+	rate       float64
+	longUnits  float64
+	shortUnits float64
+	longPL     float64
+	shortPL    float64
+	longValue  float64
+	shortValue float64
+	closeoutPL float64
+}
+
+func (m *MarginCalculator) trade(
+	trade *model.TradeSummary,
+	units float64,
+	accountRate float64,
+	positions map[model.InstrumentName]*positionTotals,
+) (TradeState, error) {
+	quote, ok := m.converter.pricing.Quote(trade.Instrument)
+	if !ok {
+		return TradeState{}, ErrNoQuote
+	}
+	_, quoteCurrency, ok := SplitInstrument(trade.Instrument)
+	if !ok {
+		return TradeState{}, ErrInstrumentNotFound
+	}
+	rate, err := m.marginRate(trade.Instrument, accountRate)
+	if err != nil {
+		return TradeState{}, err
+	}
+
+	price := trade.Price.AsFloat64(0)
+	exit := quote.Bid
+	if units < 0 {
+		exit = quote.Ask
+	}
+	pl, err := m.converter.ToHome(units*(exit-price), quoteCurrency)
+	if err != nil {
+		return TradeState{}, err
+	}
+	closeoutPL, err := m.converter.ToHome(units*(quote.Mid()-price), quoteCurrency)
+	if err != nil {
+		return TradeState{}, err
+	}
+	value, err := m.converter.HomeValue(math.Abs(units)*quote.Mid(), quoteCurrency)
+	if err != nil {
+		return TradeState{}, err
+	}
+
+	p := positions[trade.Instrument]
+	if p == nil {
+		p = &positionTotals{instrument: trade.Instrument, rate: rate}
+		positions[trade.Instrument] = p
+	}
+	if units > 0 {
+		p.longUnits += units
+		p.longPL += pl
+		p.longValue += value
+	} else {
+		p.shortUnits += units
+		p.shortPL += pl
+		p.shortValue += value
+	}
+	p.closeoutPL += closeoutPL
+
+	return TradeState{
+		ID:           trade.Id,
+		Instrument:   trade.Instrument,
+		Units:        units,
+		Price:        price,
+		UnrealizedPL: pl,
+		MarginUsed:   value * rate,
+	}, nil
+}
+
+// marginRate returns the larger of the instrument's and the Account's margin rate.
+func (m *MarginCalculator) marginRate(instrument model.InstrumentName, accountRate float64) (float64, error) {
+	rate := accountRate
+	if m.instruments != nil {
+		i, err := m.instruments.Get(instrument)
+		if err != nil {
+			return 0, err
+		}
+		if r := i.MarginRate.AsFloat64(0); r > rate {
+			rate = r
+		}
+	}
+	return rate, nil
+}
@@ -0,0 +1,73 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMarginCalculator(t *testing.T) {
+	pricing := NewPricing()
+	pricing.Update(Quote{Instrument: "EUR_USD", Time: time.Now(), Bid: 1.2, Ask: 1.2002})
+	pricing.Update(Quote{Instrument: "USD_JPY", Time: time.Now(), Bid: 100, Ask: 100.02})
+	registry := NewInstrumentRegistryFrom([]*model.Instrument{
+		{Name: "EUR_USD", MarginRate: "0.02"},
+		{Name: "USD_JPY", MarginRate: "0.04"},
+	})
+	calc := NewMarginCalculator(NewCurrencyConverter(pricing, "USD"), registry)
+
+	account := &model.Account{
+		Currency:   "USD",
+		Balance:    "10000",
+		MarginRate: "0.03",
+		Trades: []*model.TradeSummary{
+			{Id: "1", Instrument: "EUR_USD", Price: "1.1", CurrentUnits: "10000"},
+			// Hedged short on the same instrument
+			{Id: "2", Instrument: "EUR_USD", Price: "1.21", CurrentUnits: "-5000"},
+			{Id: "3", Instrument: "USD_JPY", Price: "101", CurrentUnits: "1000"},
+		},
+	}
+	state, err := calc.Calculate(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) < 1e-6
+	}
+
+	// Long closes at the bid, short at the ask, JPY P/L converts at the USD_JPY mid
+	if !near(state.Trades[0].UnrealizedPL, 1000) || !near(state.Trades[1].UnrealizedPL, 49) {
+		t.Fatalf("unexpected EUR_USD P/L %v %v", state.Trades[0].UnrealizedPL, state.Trades[1].UnrealizedPL)
+	}
+	if !near(state.Trades[2].UnrealizedPL, 1000*(100-101)/100.01) {
+		t.Fatalf("unexpected USD_JPY P/L %v", state.Trades[2].UnrealizedPL)
+	}
+
+	// The account rate applies to EUR_USD and the instrument rate to USD_JPY.
+	// The hedged EUR_USD position is margined on its long side.
+	eurusd := state.Positions[0]
+	if eurusd.Instrument != "EUR_USD" || !near(eurusd.MarginUsed, 10000*1.2001*0.03) {
+		t.Fatalf("unexpected EUR_USD margin %v", eurusd.MarginUsed)
+	}
+	usdjpy := state.Positions[1]
+	if !near(usdjpy.MarginUsed, 1000*0.04) {
+		t.Fatalf("unexpected USD_JPY margin %v", usdjpy.MarginUsed)
+	}
+	if !near(state.MarginUsed, eurusd.MarginUsed+usdjpy.MarginUsed) ||
+		!near(state.NAV, 10000+state.UnrealizedPL) ||
+		!near(state.MarginAvailable, state.NAV-state.MarginUsed) {
+		t.Fatal("unexpected account totals")
+	}
+	if !near(state.MarginCloseoutPercent, state.MarginUsed/2/state.MarginCloseoutNAV) || state.CloseoutDistance() <= 0 {
+		t.Fatal("unexpected closeout")
+	}
+	if calculated := state.Calculated(); calculated.MarginUsed != formatAccountUnits(state.MarginUsed) {
+		t.Fatal("unexpected calculated state")
+	}
+
+	account.Trades = append(account.Trades, &model.TradeSummary{Id: "4", Instrument: "GBP_USD", Price: "1", CurrentUnits: "1"})
+	if _, err = calc.Calculate(account); err != ErrNoQuote {
+		t.Fatal("expected ErrNoQuote")
+	}
+}
@@ -0,0 +1,36 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"time"
+)
+
+var newYork = model.NewYork()
+
+// MarketClosed reports whether the FX market is closed at t. The market closes
+// Friday 17:00 New York time and reopens Sunday 17:00. Christmas Day and New Year's
+// Day are treated as closed from 17:00 the previous day.
+func MarketClosed(t time.Time) bool {
+	ny := t.In(newYork)
+	switch ny.Weekday() {
+	case time.Friday:
+		if ny.Hour() >= 17 {
+			return true
+		}
+	case time.Saturday:
+		return true
+	case time.Sunday:
+		if ny.Hour() < 17 {
+			return true
+		}
+	}
+	// Holidays run from 17:00 on the eve to 17:00 on the day
+	day := ny.Add(7 * time.Hour)
+	switch {
+	case day.Month() == time.December && day.Day() == 25:
+		return true
+	case day.Month() == time.January && day.Day() == 1:
+		return true
+	}
+	return false
+}
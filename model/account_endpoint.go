@@ -33,6 +33,9 @@ type AccountConfigurationResponse struct {
 	ClientConfigureTransaction *ClientConfigureTransaction `json:"clientConfigureTransaction"`
 	// The ID of the last Transaction created for the Account.
 	LastTransactionID TransactionID `json:"lastTransactionID"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type AccountConfigurationError struct {
@@ -45,6 +48,9 @@ type AccountConfigurationError struct {
 	ErrorCode string `json:"errorCode"`
 	// The human-readable description of the error that has occurred.
 	ErrorMessage string `json:"errorMessage"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type AccountInstrumentsResponse struct {
@@ -216,8 +216,11 @@ func (s *InstrumentCandlesRequest) AppendQuery(b *bytebufferpool.ByteBuffer) str
 	_, _ = b.WriteString("&smooth=")
 	_, _ = b.WriteString(strconv.FormatBool(s.Smooth))
 
-	_, _ = b.WriteString("&count=")
-	_, _ = b.WriteString(strconv.Itoa(s.Count))
+	// Count must not be sent when the range is bounded on both ends
+	if s.Count > 0 && (len(s.From) == 0 || len(s.To) == 0) {
+		_, _ = b.WriteString("&count=")
+		_, _ = b.WriteString(strconv.Itoa(s.Count))
+	}
 
 	if len(s.Granularity) == 0 {
 		s.Granularity = CandlestickGranularity_S5
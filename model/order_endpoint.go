@@ -109,7 +109,14 @@ func (g *OrdersRequest) AppendQuery(b *bytebufferpool.ByteBuffer) {
 
 type OrdersResponse struct {
 	// The list of pending Order details
-	Orders []*Order `json:"orders"`
+	Orders []*OrderParser `json:"orders"`
+	// The ID of the most recent Transaction created for the Account
+	LastTransactionID TransactionID `json:"lastTransactionID"`
+}
+
+type OrderResponse struct {
+	// The details of the Order requested
+	Order *OrderParser `json:"order"`
 	// The ID of the most recent Transaction created for the Account
 	LastTransactionID TransactionID `json:"lastTransactionID"`
 }
@@ -140,6 +147,9 @@ type CreateOrderResponse struct {
 	RelatedTransactionIDs []TransactionID `json:"relatedTransactionIDs"`
 	// The ID of the most recent Transaction created for the Account
 	LastTransactionID TransactionID `json:"lastTransactionID"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type CreateOrderError struct {
@@ -156,6 +166,9 @@ type CreateOrderError struct {
 	ErrorCode string `json:"errorCode"`
 	// The human-readable description of the error that has occurred.
 	ErrorMessage string `json:"errorMessage"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type CancelOrderResponse struct {
@@ -166,6 +179,9 @@ type CancelOrderResponse struct {
 	RelatedTransactionIDs []TransactionID `json:"relatedTransactionIDs"`
 	// The ID of the most recent Transaction created for the Account
 	LastTransactionID TransactionID `json:"lastTransactionID"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type CancelOrderError struct {
@@ -182,6 +198,9 @@ type CancelOrderError struct {
 	ErrorCode string `json:"errorCode"`
 	// The human-readable description of the error that has occurred.
 	ErrorMessage string `json:"errorMessage"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type OrderClientExtensionsRequest struct {
@@ -44,21 +44,21 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel(in *jlexer.Lexer, out *Or
 				in.Delim('[')
 				if out.Orders == nil {
 					if !in.IsDelim(']') {
-						out.Orders = make([]*Order, 0, 8)
+						out.Orders = make([]*OrderParser, 0, 8)
 					} else {
-						out.Orders = []*Order{}
+						out.Orders = []*OrderParser{}
 					}
 				} else {
 					out.Orders = (out.Orders)[:0]
 				}
 				for !in.IsDelim(']') {
-					var v1 *Order
+					var v1 *OrderParser
 					if in.IsNull() {
 						in.Skip()
 						v1 = nil
 					} else {
 						if v1 == nil {
-							v1 = new(Order)
+							v1 = new(OrderParser)
 						}
 						(*v1).UnmarshalEasyJSON(in)
 					}
@@ -260,7 +260,92 @@ func (v *OrdersRequest) UnmarshalJSON(data []byte) error {
 func (v *OrdersRequest) UnmarshalEasyJSON(l *jlexer.Lexer) {
 	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel1(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel2(in *jlexer.Lexer, out *OrderClientExtensionsResponse) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel2(in *jlexer.Lexer, out *OrderResponse) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "order":
+			if in.IsNull() {
+				in.Skip()
+				out.Order = nil
+			} else {
+				if out.Order == nil {
+					out.Order = new(OrderParser)
+				}
+				(*out.Order).UnmarshalEasyJSON(in)
+			}
+		case "lastTransactionID":
+			out.LastTransactionID = TransactionID(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel2(out *jwriter.Writer, in OrderResponse) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"order\":"
+		out.RawString(prefix[1:])
+		if in.Order == nil {
+			out.RawString("null")
+		} else {
+			(*in.Order).MarshalEasyJSON(out)
+		}
+	}
+	{
+		const prefix string = ",\"lastTransactionID\":"
+		out.RawString(prefix)
+		out.String(string(in.LastTransactionID))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v OrderResponse) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel2(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v OrderResponse) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel2(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *OrderResponse) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel2(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *OrderResponse) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel2(l, v)
+}
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel3(in *jlexer.Lexer, out *OrderClientExtensionsResponse) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -324,7 +409,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel2(in *jlexer.Lexer, out *O
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel2(out *jwriter.Writer, in OrderClientExtensionsResponse) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel3(out *jwriter.Writer, in OrderClientExtensionsResponse) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -364,27 +449,27 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel2(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v OrderClientExtensionsResponse) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel2(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel3(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v OrderClientExtensionsResponse) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel2(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel3(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *OrderClientExtensionsResponse) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel2(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel3(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *OrderClientExtensionsResponse) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel2(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel3(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel3(in *jlexer.Lexer, out *OrderClientExtensionsRequest) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel4(in *jlexer.Lexer, out *OrderClientExtensionsRequest) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -433,7 +518,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel3(in *jlexer.Lexer, out *O
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel3(out *jwriter.Writer, in OrderClientExtensionsRequest) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel4(out *jwriter.Writer, in OrderClientExtensionsRequest) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -461,27 +546,27 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel3(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v OrderClientExtensionsRequest) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel3(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel4(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v OrderClientExtensionsRequest) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel3(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel4(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *OrderClientExtensionsRequest) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel3(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel4(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *OrderClientExtensionsRequest) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel3(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel4(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel4(in *jlexer.Lexer, out *OrderClientExtensionsError) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel5(in *jlexer.Lexer, out *OrderClientExtensionsError) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -549,7 +634,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel4(in *jlexer.Lexer, out *O
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel4(out *jwriter.Writer, in OrderClientExtensionsError) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel5(out *jwriter.Writer, in OrderClientExtensionsError) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -599,27 +684,27 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel4(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v OrderClientExtensionsError) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel4(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel5(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v OrderClientExtensionsError) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel4(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel5(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *OrderClientExtensionsError) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel4(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel5(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *OrderClientExtensionsError) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel4(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel5(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel5(in *jlexer.Lexer, out *CreateOrderResponse) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel6(in *jlexer.Lexer, out *CreateOrderResponse) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -723,7 +808,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel5(in *jlexer.Lexer, out *C
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel5(out *jwriter.Writer, in CreateOrderResponse) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel6(out *jwriter.Writer, in CreateOrderResponse) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -799,27 +884,27 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel5(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v CreateOrderResponse) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel5(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel6(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v CreateOrderResponse) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel5(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel6(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *CreateOrderResponse) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel5(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel6(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *CreateOrderResponse) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel5(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel6(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel6(in *jlexer.Lexer, out *CreateOrderRequest) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel7(in *jlexer.Lexer, out *CreateOrderRequest) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -858,7 +943,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel6(in *jlexer.Lexer, out *C
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel6(out *jwriter.Writer, in CreateOrderRequest) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel7(out *jwriter.Writer, in CreateOrderRequest) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -877,27 +962,27 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel6(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v CreateOrderRequest) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel6(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel7(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v CreateOrderRequest) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel6(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel7(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *CreateOrderRequest) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel6(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel7(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *CreateOrderRequest) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel6(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel7(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel7(in *jlexer.Lexer, out *CreateOrderError) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel8(in *jlexer.Lexer, out *CreateOrderError) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -965,7 +1050,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel7(in *jlexer.Lexer, out *C
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel7(out *jwriter.Writer, in CreateOrderError) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel8(out *jwriter.Writer, in CreateOrderError) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -1015,27 +1100,27 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel7(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v CreateOrderError) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel7(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel8(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v CreateOrderError) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel7(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel8(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *CreateOrderError) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel7(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel8(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *CreateOrderError) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel7(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel8(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel8(in *jlexer.Lexer, out *CancelOrderResponse) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel9(in *jlexer.Lexer, out *CancelOrderResponse) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -1099,7 +1184,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel8(in *jlexer.Lexer, out *C
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel8(out *jwriter.Writer, in CancelOrderResponse) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel9(out *jwriter.Writer, in CancelOrderResponse) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -1139,27 +1224,27 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel8(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v CancelOrderResponse) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel8(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel9(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v CancelOrderResponse) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel8(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel9(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *CancelOrderResponse) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel8(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel9(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *CancelOrderResponse) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel8(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel9(l, v)
 }
-func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel9(in *jlexer.Lexer, out *CancelOrderError) {
+func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel10(in *jlexer.Lexer, out *CancelOrderError) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -1227,7 +1312,7 @@ func easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel9(in *jlexer.Lexer, out *C
 		in.Consumed()
 	}
 }
-func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel9(out *jwriter.Writer, in CancelOrderError) {
+func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel10(out *jwriter.Writer, in CancelOrderError) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -1277,23 +1362,23 @@ func easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel9(out *jwriter.Writer, in
 // MarshalJSON supports json.Marshaler interface
 func (v CancelOrderError) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel9(&w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel10(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v CancelOrderError) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel9(w, v)
+	easyjsonBdf69d58EncodeGithubComKamaiuOandaGoModel10(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *CancelOrderError) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel9(&r, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel10(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *CancelOrderError) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel9(l, v)
+	easyjsonBdf69d58DecodeGithubComKamaiuOandaGoModel10(l, v)
 }
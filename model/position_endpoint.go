@@ -50,6 +50,9 @@ type PositionCloseResponse struct {
 	RelatedTransactionIDs []TransactionID `json:"relatedTransactionIDs"`
 	// The ID of the most recent Transaction created for the Account
 	LastTransactionID TransactionID `json:"lastTransactionID"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type PositionCloseError struct {
@@ -68,4 +71,7 @@ type PositionCloseError struct {
 	ErrorCode string `json:"errorCode"`
 	// The human-readable description of the error that has occurred.
 	ErrorMessage string `json:"errorMessage"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
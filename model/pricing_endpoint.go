@@ -211,21 +211,20 @@ func NewPricingRequest() *PricingRequest {
 }
 
 func (p *PricingRequest) AppendQuery(b *bytebufferpool.ByteBuffer) {
-	if len(p.Since) == 0 {
-		p.WithSince(time.Now())
-	}
-	_, _ = b.WriteString("since=")
-	_, _ = b.WriteString((string)(p.Since))
-	_, _ = b.WriteString("includeHomeConversions=")
-	_, _ = b.WriteString(strconv.FormatBool(p.IncludeHomeConversions))
-	if len(p.Instruments) > 0 {
-		for i, instrument := range p.Instruments {
-			if i > 0 {
-				_, _ = b.WriteString(UrlEncodedComma)
-			}
-			_, _ = b.WriteString((string)(instrument))
+	_, _ = b.WriteString("instruments=")
+	for i, instrument := range p.Instruments {
+		if i > 0 {
+			_, _ = b.WriteString(UrlEncodedComma)
 		}
+		_, _ = b.WriteString((string)(instrument))
 	}
+	// Without since every requested price is returned
+	if len(p.Since) > 0 {
+		_, _ = b.WriteString("&since=")
+		_, _ = b.WriteString(url.QueryEscape((string)(p.Since)))
+	}
+	_, _ = b.WriteString("&includeHomeConversions=")
+	_, _ = b.WriteString(strconv.FormatBool(p.IncludeHomeConversions))
 }
 
 type PricingResponse struct {
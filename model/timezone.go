@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+var newYork = mustLoadLocation("America/New_York")
+
+// NewYork returns the America/New_York location that OANDA uses for the trading
+// week, the daily candle alignment and the financing rollover.
+func NewYork() *time.Location {
+	return newYork
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		// Only possible before go1.15 without the zoneinfo files of the system
+		panic("model: " + err.Error())
+	}
+	return loc
+}
@@ -82,6 +82,9 @@ type TradeCloseResponse struct {
 	RelatedTransactionIDs []TransactionID `json:"relatedTransactionIDs"`
 	// The ID of the most recent Transaction created for the Account
 	LastTransactionID TransactionID `json:"lastTransactionID"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type TradeCloseError struct {
@@ -96,6 +99,9 @@ type TradeCloseError struct {
 	ErrorCode string `json:"errorCode"`
 	// The human-readable description of the error that has occurred.
 	ErrorMessage string `json:"errorMessage"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type TradeClientExtensionsRequest struct {
@@ -193,6 +199,9 @@ type TradeModifyResponse struct {
 	RelatedTransactionIDs []TransactionID `json:"relatedTransactionIDs"`
 	// The ID of the most recent Transaction created for the Account
 	LastTransactionID TransactionID `json:"lastTransactionID"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
 
 type TradeModifyError struct {
@@ -225,4 +234,7 @@ type TradeModifyError struct {
 	ErrorCode string `json:"errorCode"`
 	// The human-readable description of the error that has occurred.
 	ErrorMessage string `json:"errorMessage"`
+	// Set when the request was simulated by a dry-run Connection and never
+	// sent to OANDA.
+	Simulated bool `json:"-"`
 }
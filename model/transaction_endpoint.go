@@ -189,7 +189,7 @@ func (t *TransactionsIDRangeRequest) WithType(types ...TransactionFilter) *Trans
 func (g *TransactionsIDRangeRequest) AppendQuery(b *bytebufferpool.ByteBuffer) {
 	_, _ = b.WriteString("from=")
 	_, _ = b.WriteString((string)(g.From))
-	_, _ = b.WriteString("&from=")
+	_, _ = b.WriteString("&to=")
 	_, _ = b.WriteString((string)(g.To))
 	if len(g.Type) > 0 {
 		_, _ = b.WriteString("&type=")
@@ -0,0 +1,8 @@
+//go:build go1.15
+// +build go1.15
+
+package model
+
+// The timezone database is embedded so NewYork does not depend on the zoneinfo
+// files of the system running the program.
+import _ "time/tzdata"
@@ -6,46 +6,315 @@ import (
 	"github.com/kamaiu/oanda-go/endpoint"
 	"github.com/kamaiu/oanda-go/model"
 	"sync"
+	"time"
+)
+
+var (
+	ErrNoAccounts   = errors.New("no accounts")
+	ErrClientClosed = errors.New("client closed")
 )
 
 type Client struct {
 	token        string
-	conn         *endpoint.Connection
+	conn         endpoint.API
+	limiter      *RateLimiter
 	accounts     []*Account
 	accountsByID map[model.AccountID]*Account
+	instruments  map[model.AccountID]*InstrumentRegistry
+	streams      map[*endpoint.Stream]struct{}
+	done         chan struct{}
+	closed       bool
+	wg           sync.WaitGroup
 	mu           sync.RWMutex
 }
 
+// NewClient connects with the token and loads every Account authorized for it.
+// Accounts are loaded concurrently under the default rate limit. Failing to load
+// an individual Account does not fail the Client; the error is available through
+// Account.Err.
 func NewClient(token string, live bool) (*Client, error) {
-	conn := endpoint.NewConnection(token, live)
+	return NewClientWithLimiter(token, live, NewRateLimiter(DefaultRateLimit, DefaultRateBurst))
+}
+
+// NewClientWithLimiter is like NewClient but issues requests through the supplied
+// RateLimiter. Share a single limiter between Clients that use the same token.
+func NewClientWithLimiter(token string, live bool, limiter *RateLimiter) (*Client, error) {
+	client, err := NewClientWithAPI(endpoint.NewConnection(token, live), limiter)
+	if err != nil {
+		return nil, err
+	}
+	client.token = token
+	return client, nil
+}
+
+// NewClientWithAPI is like NewClientWithLimiter but issues requests through the
+// supplied API, for example a wrapped Connection or a test fake. An API other than
+// a Connection is wrapped in an endpoint.GuardedAPI so that SetOrderGuard applies.
+func NewClientWithAPI(api endpoint.API, limiter *RateLimiter) (*Client, error) {
+	switch api.(type) {
+	case *endpoint.Connection, *endpoint.GuardedAPI:
+	default:
+		api = endpoint.NewGuardedAPI(api)
+	}
 	client := &Client{
-		token:        token,
-		conn:         conn,
+		conn:         api,
+		limiter:      limiter,
 		accounts:     nil,
 		accountsByID: make(map[model.AccountID]*Account),
+		instruments:  make(map[model.AccountID]*InstrumentRegistry),
+		streams:      make(map[*endpoint.Stream]struct{}),
+		done:         make(chan struct{}),
+	}
+	if err := client.Refresh(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Connection returns the Connection the Client was created with or nil if it was
+// created with another API.
+func (c *Client) Connection() *endpoint.Connection {
+	conn, _ := c.conn.(*endpoint.Connection)
+	return conn
+}
+
+// API returns the API the Client issues its requests through.
+func (c *Client) API() endpoint.API {
+	return c.conn
+}
+
+// SetOrderGuard installs the guard that every order created through the Client or
+// its API goes through. The guard can only be set once.
+func (c *Client) SetOrderGuard(guard endpoint.OrderGuard) error {
+	switch api := c.conn.(type) {
+	case *endpoint.Connection:
+		return api.SetOrderGuard(guard)
+	case *endpoint.GuardedAPI:
+		return api.SetOrderGuard(guard)
 	}
+	return nil
+}
+
+func (c *Client) Limiter() *RateLimiter {
+	return c.limiter
+}
+
+// Candles returns a downloader for candle history that shares the Client's rate limit.
+func (c *Client) Candles() *Candles {
+	return NewCandles(c.conn, c.limiter)
+}
+
+// OrderTracker returns a tracker for orders of the Account that shares the Client's
+// rate limit. Register it with the Account's transaction stream to follow fills.
+func (c *Client) OrderTracker(accountID model.AccountID) *OrderTracker {
+	return NewOrderTracker(c.conn, c.limiter, accountID)
+}
+
+// OrderSubmitter returns a submitter that creates orders of the Account at most once.
+func (c *Client) OrderSubmitter(accountID model.AccountID) *OrderSubmitter {
+	return NewOrderSubmitter(c.conn, c.limiter, accountID)
+}
 
-	// Load accounts
-	accounts, err := conn.Accounts()
+// Bulk returns the bulk operations of the Account that share the Client's rate limit.
+func (c *Client) Bulk(accountID model.AccountID) *Bulk {
+	return NewBulk(c.conn, c.limiter, accountID)
+}
+
+// Instruments returns the InstrumentRegistry of the Account, loading it on first use.
+func (c *Client) Instruments(accountID model.AccountID) (*InstrumentRegistry, error) {
+	c.mu.RLock()
+	registry := c.instruments[accountID]
+	c.mu.RUnlock()
+	if registry != nil {
+		return registry, nil
+	}
+	registry, err := NewInstrumentRegistry(c.conn, c.limiter, accountID, DefaultInstrumentTTL)
 	if err != nil {
 		return nil, err
 	}
-	if accounts == nil {
-		return nil, errors.New("no accounts")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing := c.instruments[accountID]; existing != nil {
+		return existing, nil
+	}
+	c.instruments[accountID] = registry
+	return registry, nil
+}
+
+// All Accounts in the order they were returned by OANDA.
+func (c *Client) Accounts() []*Account {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	accounts := make([]*Account, len(c.accounts))
+	copy(accounts, c.accounts)
+	return accounts
+}
+
+// Account returns the Account with the supplied id or nil if it is unknown.
+func (c *Client) Account(id model.AccountID) *Account {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.accountsByID[id]
+}
+
+// Refresh reloads the list of Accounts and the details of each one concurrently.
+// Newly authorized Accounts are added. An error is only returned if the list itself
+// could not be loaded; per-Account failures are recorded on the Account.
+func (c *Client) Refresh() error {
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return ErrClientClosed
 	}
-	client.accounts = make([]*Account, 0, len(accounts.Accounts))
-	for _, props := range accounts.Accounts {
-		details, err := conn.Account(props.ID)
-		if err != nil {
-			return nil, err
+
+	c.limiter.Wait()
+	resp, err := c.conn.Accounts()
+	if err != nil {
+		return err
+	}
+	if resp == nil || len(resp.Accounts) == 0 {
+		return ErrNoAccounts
+	}
+
+	c.mu.Lock()
+	accounts := make([]*Account, 0, len(resp.Accounts))
+	properties := make([]*model.AccountProperties, 0, len(resp.Accounts))
+	byID := make(map[model.AccountID]*Account, len(resp.Accounts))
+	for _, props := range resp.Accounts {
+		if props == nil {
+			continue
 		}
-		account := newAccount(props, details)
-		if details == nil {
-			account.err = fmt.Errorf("could not retrieve account: %s", props.ID)
+		account := c.accountsByID[props.ID]
+		if account == nil {
+			account = newAccount(props, nil)
 		}
-		client.accounts = append(client.accounts, account)
-		client.accountsByID[props.ID] = account
+		byID[props.ID] = account
+		accounts = append(accounts, account)
+		properties = append(properties, props)
 	}
+	// Accounts no longer authorized for the token are dropped
+	c.accounts = accounts
+	c.accountsByID = byID
+	c.mu.Unlock()
 
-	return client, nil
+	parallel(len(accounts), DefaultConcurrency, c.limiter, func(i int) {
+		account := accounts[i]
+		details, err := c.conn.Account(account.ID())
+		if err == nil && details == nil {
+			err = fmt.Errorf("could not retrieve account: %s", account.ID())
+		}
+		account.update(properties[i], details, err)
+	})
+	return nil
+}
+
+// StartRefresh calls Refresh every interval until the Client is closed.
+// Errors are passed to onError if it is not nil.
+func (c *Client) StartRefresh(interval time.Duration, onError func(err error)) error {
+	return c.startPoller(interval, func() {
+		if err := c.Refresh(); err != nil && onError != nil {
+			onError(err)
+		}
+	})
+}
+
+func (c *Client) startPoller(interval time.Duration, fn func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+	return nil
+}
+
+// StartPricingStream starts a pricing stream that is closed together with the Client.
+func (c *Client) StartPricingStream(
+	accountID model.AccountID,
+	request *model.PricingStreamRequest,
+	handler endpoint.PricingStreamHandler,
+) (*endpoint.Stream, error) {
+	c.limiter.Wait()
+	stream, err := c.conn.StartPricingStream(accountID, request, handler)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.track(stream); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// StartTransactionStream starts a transaction stream that is closed together with the Client.
+func (c *Client) StartTransactionStream(
+	accountID model.AccountID,
+	handler endpoint.TxStreamHandler,
+) (*endpoint.Stream, error) {
+	c.limiter.Wait()
+	stream, err := c.conn.StartTransactionStream(accountID, handler)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.track(stream); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (c *Client) track(stream *endpoint.Stream) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		_ = stream.Close()
+		return ErrClientClosed
+	}
+	c.streams[stream] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		<-stream.Done()
+		c.mu.Lock()
+		delete(c.streams, stream)
+		c.mu.Unlock()
+	}()
+	return nil
+}
+
+// Close stops every poller and closes every stream started through the Client.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	streams := make([]*endpoint.Stream, 0, len(c.streams))
+	for stream := range c.streams {
+		streams = append(streams, stream)
+	}
+	c.mu.Unlock()
+
+	var err error
+	for _, stream := range streams {
+		if e := stream.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	c.wg.Wait()
+	return err
 }
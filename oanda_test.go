@@ -0,0 +1,57 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"testing"
+)
+
+// countingAPI wraps an API and counts the orders created through it.
+type countingAPI struct {
+	endpoint.API
+	creates int
+}
+
+func (c *countingAPI) OrderCreate(
+	accountID model.AccountID,
+	request model.OrderRequest,
+) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+	c.creates++
+	return c.API.OrderCreate(accountID, request)
+}
+
+// newTestServer starts an oandatest.Server with oandatest.TestAccount that is
+// closed when the test ends.
+func newTestServer(t *testing.T, balance float64, ticks ...oandatest.Tick) (*oandatest.Server, *endpoint.Connection) {
+	s := oandatest.NewTestServer(balance, ticks...)
+	t.Cleanup(s.Close)
+	return s, s.Connect()
+}
+
+func TestClientWithAPI(t *testing.T) {
+	_, conn := newTestServer(t, 10000, oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1, Ask: 1.1002})
+	api := &countingAPI{API: conn}
+	client, err := NewClientWithAPI(api, NewRateLimiter(DefaultRateLimit, DefaultRateBurst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if client.Connection() != nil {
+		t.Fatal("expected no Connection for a wrapped API")
+	}
+	if len(client.Accounts()) != 1 {
+		t.Fatalf("expected 1 account got %d", len(client.Accounts()))
+	}
+	resp, _, err := client.OrderSubmitter("101-001-1-001").Create(&model.MarketOrderRequest{
+		Type:       model.OrderType_MARKET,
+		Instrument: "EUR_USD",
+		Units:      "100",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.OrderFillTransaction == nil || api.creates != 1 {
+		t.Fatalf("expected 1 filled order through the wrapper got %d", api.creates)
+	}
+}
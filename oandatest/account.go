@@ -0,0 +1,700 @@
+package oandatest
+
+import (
+	"encoding/json"
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// account is the state of an Account. Transaction IDs are sequential per Account,
+// an Order has the ID of the Transaction that created it and a Trade the ID of the
+// fill that opened it.
+type account struct {
+	s            *Server
+	id           model.AccountID
+	alias        string
+	currency     model.Currency
+	marginRate   float64
+	created      time.Time
+	balance      float64
+	pl           float64
+	financing    float64
+	lastID       int64
+	batch        string
+	batchStart   int
+	transactions []*model.TransactionParser
+	orders       []*order
+	ordersByID   map[string]*order
+	trades       []*trade
+	tradesByID   map[string]*trade
+	positions    map[model.InstrumentName]*position
+	instruments  []model.InstrumentName
+	streams      map[*subscriber]struct{}
+}
+
+// position is the realized P/L and the financing of each side of the Position of an
+// instrument.
+type position struct {
+	long           float64
+	short          float64
+	longFinancing  float64
+	shortFinancing float64
+}
+
+func newAccount(s *Server, id model.AccountID, currency model.Currency) *account {
+	return &account{
+		s:          s,
+		id:         id,
+		currency:   currency,
+		created:    s.now(),
+		ordersByID: make(map[string]*order),
+		tradesByID: make(map[string]*trade),
+		positions:  make(map[model.InstrumentName]*position),
+		streams:    make(map[*subscriber]struct{}),
+	}
+}
+
+// begin starts the batch of Transactions created by a request or a price.
+func (a *account) begin() {
+	a.batch = strconv.FormatInt(a.lastID+1, 10)
+	a.batchStart = len(a.transactions)
+}
+
+// newTx allocates the next Transaction ID. Transactions must be recorded in the
+// order they are allocated in.
+func (a *account) newTx(typ string) *model.TransactionParser {
+	a.lastID++
+	return &model.TransactionParser{
+		Id:        strconv.FormatInt(a.lastID, 10),
+		Type:      typ,
+		AccountID: string(a.id),
+		UserID:    1,
+		BatchID:   a.batch,
+		Time:      formatTime(a.s.now()),
+	}
+}
+
+// record stores the Transaction and sends it on the transaction streams.
+func (a *account) record(tx *model.TransactionParser) {
+	a.transactions = append(a.transactions, tx)
+	if len(a.streams) == 0 {
+		return
+	}
+	b, err := tx.MarshalJSON()
+	if err != nil {
+		return
+	}
+	for sub := range a.streams {
+		if !sub.send(b) {
+			delete(a.streams, sub)
+		}
+	}
+}
+
+func (a *account) lastTransactionID() model.TransactionID {
+	return model.TransactionID(strconv.FormatInt(a.lastID, 10))
+}
+
+// related returns the IDs of the Transactions of the current batch.
+func (a *account) related() []model.TransactionID {
+	ids := make([]model.TransactionID, 0, len(a.transactions)-a.batchStart)
+	for _, tx := range a.transactions[a.batchStart:] {
+		ids = append(ids, model.TransactionID(tx.Id))
+	}
+	return ids
+}
+
+// batchTx returns the Transaction of the current batch with the type for the Order.
+func (a *account) batchTx(typ string, orderID string) *model.TransactionParser {
+	for _, tx := range a.transactions[a.batchStart:] {
+		if tx.Type == typ && tx.OrderID == orderID {
+			return tx
+		}
+	}
+	return nil
+}
+
+func (a *account) transaction(id string) *model.TransactionParser {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 1 || n > int64(len(a.transactions)) {
+		return nil
+	}
+	return a.transactions[n-1]
+}
+
+func (a *account) position(instrument model.InstrumentName) *position {
+	p := a.positions[instrument]
+	if p == nil {
+		p = &position{}
+		a.positions[instrument] = p
+		a.instruments = append(a.instruments, instrument)
+	}
+	return p
+}
+
+func (a *account) openTrades(instrument model.InstrumentName) []*trade {
+	var trades []*trade
+	for _, t := range a.trades {
+		if t.units != 0 && (len(instrument) == 0 || t.Instrument == instrument) {
+			trades = append(trades, t)
+		}
+	}
+	return trades
+}
+
+// rate is the margin rate of the instrument. The Account rate applies when it
+// requires more margin.
+func (a *account) rate(instrument model.InstrumentName) float64 {
+	rate := 0.0
+	if i := a.s.instruments[instrument]; i != nil {
+		rate = i.MarginRate.AsFloat64(0)
+	}
+	if a.marginRate > rate {
+		rate = a.marginRate
+	}
+	return rate
+}
+
+// quoteConversion converts amounts of the quote currency of the instrument into
+// the home currency.
+func (a *account) quoteConversion(instrument model.InstrumentName) float64 {
+	_, quote, ok := splitInstrument(instrument)
+	if !ok {
+		return 1
+	}
+	return a.s.conversion(quote, a.currency)
+}
+
+// value returns the unrealized P/L, the value and the margin used of the Trade.
+// Longs close at the bid and shorts at the ask, values use the mid price.
+func (a *account) value(t *trade) (unrealized float64, value float64, margin float64) {
+	bid, ask, ok := a.s.quote(t.Instrument)
+	if !ok {
+		bid, ask = t.price, t.price
+	}
+	closePrice := ask
+	if t.units > 0 {
+		closePrice = bid
+	}
+	conversion := a.quoteConversion(t.Instrument)
+	unrealized = (closePrice - t.price) * t.units * conversion
+	value = math.Abs(t.units) * (bid + ask) / 2 * conversion
+	margin = value * a.rate(t.Instrument)
+	return
+}
+
+// finance pays or charges the daily financing of the open Trades at the rollover.
+// Amounts are the annual rate of the side of the Trade applied to its value at the
+// mid price for the days the instrument charges on the day of the rollover.
+func (a *account) finance(at time.Time) {
+	var (
+		total     float64
+		amounts   = make(map[model.InstrumentName]float64)
+		positions = make(map[model.InstrumentName]*model.PositionFinancing)
+	)
+	for _, t := range a.openTrades("") {
+		i := a.s.instruments[t.Instrument]
+		if i == nil || i.Financing == nil {
+			continue
+		}
+		days := financingDays(i.Financing, at)
+		bid, ask, ok := a.s.quote(t.Instrument)
+		if days == 0 || !ok {
+			continue
+		}
+		rate := i.Financing.LongRate
+		if t.units < 0 {
+			rate = i.Financing.ShortRate
+		}
+		quoteFinancing := math.Abs(t.units) * (bid + ask) / 2 * rate.AsFloat64(0) * days / 365
+		amount := quoteFinancing * a.quoteConversion(t.Instrument)
+		t.financing += amount
+		if t.units > 0 {
+			a.position(t.Instrument).longFinancing += amount
+		} else {
+			a.position(t.Instrument).shortFinancing += amount
+		}
+		total += amount
+		amounts[t.Instrument] += amount
+		pf := positions[t.Instrument]
+		if pf == nil {
+			pf = &model.PositionFinancing{
+				Instrument:           t.Instrument,
+				AccountFinancingMode: model.FinancingMode_DAILY,
+			}
+			positions[t.Instrument] = pf
+		}
+		pf.OpenTradeFinancings = append(pf.OpenTradeFinancings, &model.OpenTradeFinancing{
+			TradeID:        t.Id,
+			Financing:      formatAccountUnits(amount),
+			QuoteFinancing: formatUnits(quoteFinancing),
+			FinancingRate:  rate,
+		})
+	}
+	if len(positions) == 0 {
+		return
+	}
+	a.balance += total
+	a.financing += total
+
+	a.begin()
+	tx := a.newTx(string(model.TransactionType_DAILY_FINANCING))
+	tx.Time = formatTime(at)
+	tx.Financing = formatAccountUnits(total)
+	tx.AccountBalance = formatAccountUnits(a.balance)
+	tx.AccountFinancingMode = model.FinancingMode_DAILY
+	for _, instrument := range a.instruments {
+		if pf := positions[instrument]; pf != nil {
+			pf.Financing = formatAccountUnits(amounts[instrument])
+			tx.PositionFinancings = append(tx.PositionFinancings, pf)
+		}
+	}
+	a.record(tx)
+}
+
+// financingDays returns the days the rollover charges. Instruments without a
+// schedule charge one day every day.
+func financingDays(financing *model.InstrumentFinancing, at time.Time) float64 {
+	if len(financing.FinancingDaysOfWeek) == 0 {
+		return 1
+	}
+	day := model.DayOfWeek(strings.ToUpper(at.Weekday().String()))
+	for _, d := range financing.FinancingDaysOfWeek {
+		if d.DayOfWeek == day {
+			return float64(d.DaysCharged)
+		}
+	}
+	return 0
+}
+
+type accountState struct {
+	unrealized         float64
+	nav                float64
+	marginUsed         float64
+	marginAvailable    float64
+	positionValue      float64
+	closeoutMarginUsed float64
+	closeoutPercent    float64
+	marginCallPercent  float64
+	withdrawalLimit    float64
+}
+
+func (a *account) state() accountState {
+	var st accountState
+	for _, t := range a.openTrades("") {
+		unrealized, value, margin := a.value(t)
+		st.unrealized += unrealized
+		st.positionValue += value
+		st.marginUsed += margin
+	}
+	st.nav = a.balance + st.unrealized
+	st.marginAvailable = math.Max(0, st.nav-st.marginUsed)
+	st.closeoutMarginUsed = st.marginUsed / 2
+	if st.nav > 0 {
+		st.closeoutPercent = st.closeoutMarginUsed / st.nav
+		st.marginCallPercent = st.marginUsed / st.nav
+	}
+	st.withdrawalLimit = math.Max(0, math.Min(a.balance, st.nav)-st.marginUsed)
+	return st
+}
+
+func (a *account) pendingCount() int64 {
+	var n int64
+	for _, o := range a.orders {
+		if o.State == model.OrderState_PENDING {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *account) openPositionCount() int64 {
+	var n int64
+	for _, instrument := range a.instruments {
+		if len(a.openTrades(instrument)) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *account) summary() *model.AccountSummary {
+	st := a.state()
+	summary := &model.AccountSummary{
+		Id:                          a.id,
+		Alias:                       a.alias,
+		Currency:                    a.currency,
+		CreatedByUserID:             1,
+		CreatedTime:                 formatTime(a.created),
+		GuaranteedStopLossOrderMode: model.GuaranteedStopLossOrderMode_DISABLED,
+		ResettablePLTime:            "0",
+		OpenTradeCount:              int64(len(a.openTrades(""))),
+		OpenPositionCount:           a.openPositionCount(),
+		PendingOrderCount:           a.pendingCount(),
+		HedgingEnabled:              false,
+		UnrealizedPL:                formatAccountUnits(st.unrealized),
+		NAV:                         formatAccountUnits(st.nav),
+		MarginUsed:                  formatAccountUnits(st.marginUsed),
+		MarginAvailable:             formatAccountUnits(st.marginAvailable),
+		PositionValue:               formatAccountUnits(st.positionValue),
+		MarginCloseoutUnrealizedPL:  formatAccountUnits(st.unrealized),
+		MarginCloseoutNAV:           formatAccountUnits(st.nav),
+		MarginCloseoutMarginUsed:    formatAccountUnits(st.closeoutMarginUsed),
+		MarginCloseoutPercent:       formatPercent(st.closeoutPercent),
+		MarginCloseoutPositionValue: model.DecimalNumber(formatAccountUnits(st.positionValue)),
+		WithdrawalLimit:             formatAccountUnits(st.withdrawalLimit),
+		MarginCallMarginUsed:        formatAccountUnits(st.marginUsed),
+		MarginCallPercent:           formatPercent(st.marginCallPercent),
+		Balance:                     formatAccountUnits(a.balance),
+		PL:                          formatAccountUnits(a.pl),
+		ResettablePL:                formatAccountUnits(a.pl),
+		Financing:                   formatAccountUnits(a.financing),
+		Commission:                  formatAccountUnits(0),
+		DividendAdjustment:          formatAccountUnits(0),
+		GuaranteedExecutionFees:     formatAccountUnits(0),
+		LastTransactionID:           a.lastTransactionID(),
+	}
+	if a.marginRate > 0 {
+		summary.MarginRate = formatUnits(a.marginRate)
+	}
+	return summary
+}
+
+// account renders the full Account. The pending Orders are rendered in full like
+// the v20 API does rather than as the base Order of model.Account.
+func (a *account) account() (json.RawMessage, error) {
+	summary := a.summary()
+	acc := &model.Account{
+		Id:                          summary.Id,
+		Alias:                       summary.Alias,
+		Currency:                    summary.Currency,
+		CreatedByUserID:             summary.CreatedByUserID,
+		CreatedTime:                 summary.CreatedTime,
+		GuaranteedStopLossOrderMode: summary.GuaranteedStopLossOrderMode,
+		ResettablePLTime:            summary.ResettablePLTime,
+		MarginRate:                  summary.MarginRate,
+		OpenTradeCount:              summary.OpenTradeCount,
+		OpenPositionCount:           summary.OpenPositionCount,
+		PendingOrderCount:           summary.PendingOrderCount,
+		HedgingEnabled:              summary.HedgingEnabled,
+		UnrealizedPL:                summary.UnrealizedPL,
+		NAV:                         summary.NAV,
+		MarginUsed:                  summary.MarginUsed,
+		MarginAvailable:             summary.MarginAvailable,
+		PositionValue:               summary.PositionValue,
+		MarginCloseoutUnrealizedPL:  summary.MarginCloseoutUnrealizedPL,
+		MarginCloseoutNAV:           summary.MarginCloseoutNAV,
+		MarginCloseoutMarginUsed:    summary.MarginCloseoutMarginUsed,
+		MarginCloseoutPercent:       summary.MarginCloseoutPercent,
+		MarginCloseoutPositionValue: summary.MarginCloseoutPositionValue,
+		WithdrawalLimit:             summary.WithdrawalLimit,
+		MarginCallMarginUsed:        summary.MarginCallMarginUsed,
+		MarginCallPercent:           summary.MarginCallPercent,
+		Balance:                     summary.Balance,
+		PL:                          summary.PL,
+		ResettablePL:                summary.ResettablePL,
+		Financing:                   summary.Financing,
+		Commission:                  summary.Commission,
+		DividendAdjustment:          summary.DividendAdjustment,
+		GuaranteedExecutionFees:     summary.GuaranteedExecutionFees,
+		LastTransactionID:           summary.LastTransactionID,
+		Trades:                      []*model.TradeSummary{},
+		Positions:                   []*model.Position{},
+	}
+	for _, t := range a.openTrades("") {
+		acc.Trades = append(acc.Trades, a.tradeSummary(t))
+	}
+	for _, instrument := range a.instruments {
+		acc.Positions = append(acc.Positions, a.renderPosition(instrument))
+	}
+	b, err := acc.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	orders := make([]*model.OrderParser, 0)
+	for _, o := range a.orders {
+		if o.State == model.OrderState_PENDING {
+			orders = append(orders, o.render())
+		}
+	}
+	if fields["orders"], err = json.Marshal(orders); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// changesState is the price dependent state of the Account.
+func (a *account) changesState() *model.AccountChangesState {
+	summary := a.summary()
+	st := &model.AccountChangesState{
+		UnrealizedPL:                summary.UnrealizedPL,
+		NAV:                         summary.NAV,
+		MarginUsed:                  summary.MarginUsed,
+		MarginAvailable:             summary.MarginAvailable,
+		PositionValue:               summary.PositionValue,
+		MarginCloseoutUnrealizedPL:  summary.MarginCloseoutUnrealizedPL,
+		MarginCloseoutNAV:           summary.MarginCloseoutNAV,
+		MarginCloseoutMarginUsed:    summary.MarginCloseoutMarginUsed,
+		MarginCloseoutPercent:       summary.MarginCloseoutPercent,
+		MarginCloseoutPositionValue: summary.MarginCloseoutPositionValue,
+		WithdrawalLimit:             summary.WithdrawalLimit,
+		MarginCallMarginUsed:        summary.MarginCallMarginUsed,
+		MarginCallPercent:           summary.MarginCallPercent,
+		Balance:                     summary.Balance,
+		PL:                          summary.PL,
+		ResettablePL:                summary.ResettablePL,
+		Financing:                   summary.Financing,
+		Commission:                  summary.Commission,
+		DividendAdjustment:          summary.DividendAdjustment,
+		GuaranteedExecutionFees:     summary.GuaranteedExecutionFees,
+		Orders:                      []*model.DynamicOrderState{},
+		Trades:                      []*model.CalculatedTradeState{},
+		Positions:                   []*model.CalculatedPositionState{},
+	}
+	for _, t := range a.openTrades("") {
+		unrealized, _, margin := a.value(t)
+		st.Trades = append(st.Trades, &model.CalculatedTradeState{
+			ID:           t.Id,
+			UnrealizedPL: formatAccountUnits(unrealized),
+			MarginUsed:   formatAccountUnits(margin),
+		})
+	}
+	for _, instrument := range a.instruments {
+		var long, short, margin float64
+		for _, t := range a.openTrades(instrument) {
+			unrealized, _, m := a.value(t)
+			if t.units > 0 {
+				long += unrealized
+			} else {
+				short += unrealized
+			}
+			margin += m
+		}
+		st.Positions = append(st.Positions, &model.CalculatedPositionState{
+			Instrument:        instrument,
+			NetUnrealizedPL:   formatAccountUnits(long + short),
+			LongUnrealizedPL:  formatAccountUnits(long),
+			ShortUnrealizedPL: formatAccountUnits(short),
+			MarginUsed:        formatAccountUnits(margin),
+		})
+	}
+	return st
+}
+
+// changes collects the Orders, Trades, Positions and Transactions changed after the
+// Transaction.
+func (a *account) changes(since int64) map[string]interface{} {
+	var (
+		created   = make([]*model.OrderParser, 0)
+		cancelled = make([]*model.OrderParser, 0)
+		filled    = make([]*model.OrderParser, 0)
+		opened    = make([]*model.TradeSummary, 0)
+		reduced   = make([]*model.TradeSummary, 0)
+		closed    = make([]*model.TradeSummary, 0)
+		positions = make([]*model.Position, 0)
+		txs       = make([]*model.TransactionParser, 0)
+		touched   = make(map[model.InstrumentName]bool)
+	)
+	after := func(id string) bool {
+		n, err := strconv.ParseInt(id, 10, 64)
+		return err == nil && n > since
+	}
+	for _, o := range a.orders {
+		if after(o.Id) {
+			created = append(created, o.render())
+		}
+		if after(o.CancellingTransactionID) {
+			cancelled = append(cancelled, o.render())
+		}
+		if after(o.FillingTransactionID) {
+			filled = append(filled, o.render())
+		}
+	}
+	for _, t := range a.trades {
+		if after(string(t.Id)) {
+			opened = append(opened, a.tradeSummary(t))
+			touched[t.Instrument] = true
+		}
+		changed := false
+		for _, id := range t.ClosingTransactionIDs {
+			changed = changed || after(string(id))
+		}
+		if changed {
+			touched[t.Instrument] = true
+			if t.units == 0 {
+				closed = append(closed, a.tradeSummary(t))
+			} else {
+				reduced = append(reduced, a.tradeSummary(t))
+			}
+		}
+	}
+	for _, instrument := range a.instruments {
+		if touched[instrument] {
+			positions = append(positions, a.renderPosition(instrument))
+		}
+	}
+	for _, tx := range a.transactions {
+		if after(tx.Id) {
+			txs = append(txs, tx)
+		}
+	}
+	return map[string]interface{}{
+		"ordersCreated":   created,
+		"ordersCancelled": cancelled,
+		"ordersFilled":    filled,
+		"ordersTriggered": []*model.OrderParser{},
+		"tradesOpened":    opened,
+		"tradesReduced":   reduced,
+		"tradesClosed":    closed,
+		"positions":       positions,
+		"transactions":    txs,
+	}
+}
+
+func (a *account) renderTrade(t *trade) *model.Trade {
+	unrealized, _, margin := a.value(t)
+	r := t.Trade
+	r.CurrentUnits = formatUnits(t.units)
+	r.RealizedPL = formatAccountUnits(t.realized)
+	r.UnrealizedPL = formatAccountUnits(unrealized)
+	r.MarginUsed = formatAccountUnits(margin)
+	r.Financing = formatAccountUnits(t.financing)
+	r.DividendAdjustment = formatAccountUnits(0)
+	r.TakeProfitOrder = nil
+	r.StopLossOrder = nil
+	r.TrailingStopLossOrder = nil
+	if t.units == 0 {
+		r.UnrealizedPL = formatAccountUnits(0)
+		r.MarginUsed = formatAccountUnits(0)
+	}
+	if o := t.takeProfit; o != nil {
+		r.TakeProfitOrder = &model.TakeProfitOrder{
+			Order:            o.base(),
+			Type:             model.OrderType_TAKE_PROFIT,
+			TradeID:          t.Id,
+			Price:            o.Price,
+			TimeInForce:      o.TimeInForce,
+			GtdTime:          o.GtdTime,
+			TriggerCondition: model.OrderTriggerCondition(o.TriggerCondition),
+		}
+	}
+	if o := t.stopLoss; o != nil {
+		r.StopLossOrder = &model.StopLossOrder{
+			Order:            o.base(),
+			Type:             model.OrderType_STOP_LOSS,
+			TradeID:          t.Id,
+			Price:            o.Price,
+			TimeInForce:      o.TimeInForce,
+			GtdTime:          o.GtdTime,
+			TriggerCondition: model.OrderTriggerCondition(o.TriggerCondition),
+		}
+	}
+	if o := t.trailingStop; o != nil {
+		r.TrailingStopLossOrder = &model.TrailingStopLossOrder{
+			Order:             o.base(),
+			Type:              model.OrderType_TRAILING_STOP_LOSS,
+			TradeID:           t.Id,
+			Distance:          o.Distance,
+			TimeInForce:       o.TimeInForce,
+			GtdTime:           o.GtdTime,
+			TriggerCondition:  model.OrderTriggerCondition(o.TriggerCondition),
+			TrailingStopValue: o.TrailingStopValue,
+		}
+	}
+	return &r
+}
+
+func (a *account) tradeSummary(t *trade) *model.TradeSummary {
+	r := a.renderTrade(t)
+	summary := &model.TradeSummary{
+		Id:                    r.Id,
+		Instrument:            r.Instrument,
+		Price:                 r.Price,
+		OpenTime:              r.OpenTime,
+		State:                 r.State,
+		InitialUnits:          r.InitialUnits,
+		InitialMarginRequired: r.InitialMarginRequired,
+		CurrentUnits:          r.CurrentUnits,
+		RealizedPL:            r.RealizedPL,
+		UnrealizedPL:          r.UnrealizedPL,
+		MarginUsed:            r.MarginUsed,
+		AverageClosePrice:     r.AverageClosePrice,
+		ClosingTransactionIDs: r.ClosingTransactionIDs,
+		Financing:             r.Financing,
+		DividendAdjustment:    r.DividendAdjustment,
+		CloseTime:             r.CloseTime,
+		ClientExtensions:      r.ClientExtensions,
+	}
+	if r.TakeProfitOrder != nil {
+		summary.TakeProfitOrderID = r.TakeProfitOrder.Id
+	}
+	if r.StopLossOrder != nil {
+		summary.StopLossOrderID = r.StopLossOrder.Id
+	}
+	if r.TrailingStopLossOrder != nil {
+		summary.TrailingStopLossOrderID = r.TrailingStopLossOrder.Id
+	}
+	return summary
+}
+
+func (a *account) renderPosition(instrument model.InstrumentName) *model.Position {
+	p := a.positions[instrument]
+	if p == nil {
+		p = &position{}
+	}
+	side := func(long bool, pl float64, financing float64) (*model.PositionSide, float64, float64) {
+		var units, cost, unrealized, margin float64
+		ids := make([]model.TradeID, 0)
+		for _, t := range a.openTrades(instrument) {
+			if (t.units > 0) != long {
+				continue
+			}
+			u, _, m := a.value(t)
+			units += t.units
+			cost += t.units * t.price
+			unrealized += u
+			margin += m
+			ids = append(ids, t.Id)
+		}
+		s := &model.PositionSide{
+			Units:                   formatUnits(units),
+			TradeIDs:                ids,
+			Pl:                      formatAccountUnits(pl),
+			UnrealizedPL:            formatAccountUnits(unrealized),
+			ResettablePL:            formatAccountUnits(pl),
+			Financing:               formatAccountUnits(financing),
+			DividendAdjustment:      formatAccountUnits(0),
+			GuaranteedExecutionFees: formatAccountUnits(0),
+		}
+		if units != 0 {
+			s.AveragePrice = formatPrice(a.s.instruments[instrument], cost/units)
+		}
+		return s, unrealized, margin
+	}
+	long, longUnrealized, longMargin := side(true, p.long, p.longFinancing)
+	short, shortUnrealized, shortMargin := side(false, p.short, p.shortFinancing)
+	return &model.Position{
+		Instrument:              instrument,
+		Pl:                      formatAccountUnits(p.long + p.short),
+		UnrealizedPL:            formatAccountUnits(longUnrealized + shortUnrealized),
+		MarginUsed:              formatAccountUnits(longMargin + shortMargin),
+		ResettablePL:            formatAccountUnits(p.long + p.short),
+		Financing:               formatAccountUnits(p.longFinancing + p.shortFinancing),
+		Commission:              formatAccountUnits(0),
+		DividendAdjustment:      formatAccountUnits(0),
+		GuaranteedExecutionFees: formatAccountUnits(0),
+		Long:                    long,
+		Short:                   short,
+	}
+}
+
+func formatPercent(v float64) model.DecimalNumber {
+	return model.DecimalNumber(strconv.FormatFloat(v, 'f', 5, 64))
+}
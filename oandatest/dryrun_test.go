@@ -0,0 +1,135 @@
+package oandatest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	s, c := newTestServer(t)
+	live, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "1000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	liveTrade := live.OrderFillTransaction.TradeOpened.TradeID
+	audit := &bytes.Buffer{}
+	if err = c.SetDryRun(endpoint.NewDryRun(audit)); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SetDryRun(endpoint.NewDryRun(nil)); err != endpoint.ErrDryRunSet {
+		t.Fatalf("expected ErrDryRunSet got %v", err)
+	}
+	before := s.Transactions(TestAccount, "")
+
+	// Market Orders fill at the live price
+	resp, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "500"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Simulated || resp.OrderFillTransaction == nil || resp.OrderFillTransaction.TradeOpened == nil {
+		t.Fatalf("expected a simulated fill got %+v", resp)
+	}
+	expectNear(t, "price", resp.OrderFillTransaction.Price.AsFloat64(0), 1.1002)
+	if !strings.HasPrefix(string(resp.LastTransactionID), endpoint.DryRunIDPrefix) {
+		t.Fatalf("expected a dry-run transaction ID got %s", resp.LastTransactionID)
+	}
+
+	// Local validation
+	_, reject, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "0"))
+	if err == nil || reject == nil || !reject.Simulated || reject.ErrorCode != "UNITS_INVALID" {
+		t.Fatalf("expected a simulated UNITS_INVALID reject got %v %+v", err, reject)
+	}
+
+	// Pending Orders can be cancelled once
+	limit, _, err := c.OrderCreate(TestAccount, &model.LimitOrderRequest{
+		Type:       model.OrderType_LIMIT,
+		Instrument: "EUR_USD",
+		Units:      "1000",
+		Price:      "1.0900",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderID := model.OrderSpecifier(limit.OrderCreateTransaction.Id)
+	if cancel, _, err := c.OrderCancel(TestAccount, orderID); err != nil || !cancel.Simulated {
+		t.Fatalf("expected a simulated cancel got %v", err)
+	}
+	if _, cancelReject, err := c.OrderCancel(TestAccount, orderID); err == nil || cancelReject == nil {
+		t.Fatal("expected the cancelled order to be gone")
+	}
+
+	// Live Trades are modified and closed in the simulation only
+	modify, _, err := c.TradeModify(TestAccount, model.TradeSpecifier(liveTrade), &model.TradeModifyRequest{
+		StopLoss: &model.StopLossDetails{Price: "1.0900"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !modify.Simulated || modify.StopLossOrderTransaction == nil {
+		t.Fatalf("expected a simulated stop loss got %+v", modify)
+	}
+	closed, _, err := c.TradeClose(TestAccount, model.TradeSpecifier(liveTrade), "ALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fill := closed.OrderFillTransaction; fill == nil || len(fill.TradesClosed) != 1 || fill.Units != "-1000" {
+		t.Fatalf("expected the trade to close got %+v", closed.OrderFillTransaction)
+	}
+	if _, _, err = c.TradeClose(TestAccount, model.TradeSpecifier(liveTrade), "ALL"); err == nil {
+		t.Fatal("expected the closed trade to be gone")
+	}
+
+	// The Position is the live Position with the simulated changes
+	position, _, err := c.PositionClose(TestAccount, "EUR_USD", &model.PositionCloseRequest{LongUnits: "ALL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fill := position.LongOrderFillTransaction; fill == nil || fill.Units != "-500" {
+		t.Fatalf("expected the simulated trade to close got %+v", position.LongOrderFillTransaction)
+	}
+
+	config, _, err := c.AccountConfigure(TestAccount, &model.AccountConfigurationRequest{Alias: "dry"})
+	if err != nil || !config.Simulated {
+		t.Fatalf("expected a simulated configuration got %v", err)
+	}
+
+	// Nothing reached the live Account
+	if txs := s.Transactions(TestAccount, ""); len(txs) != len(before) {
+		t.Fatalf("expected no live transactions got %d", len(txs)-len(before))
+	}
+	trades, err := c.TradesOpen(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades.Trades) != 1 || trades.Trades[0].StopLossOrder != nil {
+		t.Fatal("expected the live trade to be untouched")
+	}
+
+	// Every simulated request is audited
+	records := c.DryRun().Records()
+	if len(records) != 10 {
+		t.Fatalf("expected 10 records got %d", len(records))
+	}
+	scanner := bufio.NewScanner(audit)
+	lines := 0
+	for ; scanner.Scan(); lines++ {
+		record := endpoint.DryRunRecord{}
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.URL != records[lines].URL || record.StatusCode != records[lines].StatusCode {
+			t.Fatalf("unexpected audit line %s", scanner.Text())
+		}
+	}
+	if lines != len(records) {
+		t.Fatalf("expected %d audit lines got %d", len(records), lines)
+	}
+	if records[0].Method != "POST" || !strings.Contains(string(records[0].Body), `"units":"500"`) {
+		t.Fatalf("unexpected record %+v", records[0])
+	}
+}
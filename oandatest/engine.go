@@ -0,0 +1,804 @@
+package oandatest
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type order struct {
+	model.OrderParser
+	// Signed units, 0 for the Take Profit, Stop Loss and Trailing Stop Loss Orders
+	// which close their Trade
+	units float64
+	// Price of the Order, the current stop of Trailing Stop Loss Orders
+	price float64
+	// Distance a Trailing Stop Loss Order trails the price by
+	distance float64
+	gtd      time.Time
+	// Instrument of the Order or of its Trade
+	instrument model.InstrumentName
+	// Trade the Order closes
+	trade *trade
+}
+
+type trade struct {
+	model.Trade
+	// Signed current units
+	units        float64
+	price        float64
+	realized     float64
+	financing    float64
+	takeProfit   *order
+	stopLoss     *order
+	trailingStop *order
+}
+
+// orderSpec is an Order to create. Trade closes, Position closeouts and margin
+// closeouts are market orders with fields requests cannot set.
+type orderSpec struct {
+	model.OrderRequestParser
+	reason         string
+	replaces       *order
+	trade          *trade
+	tradeClose     *model.MarketOrderTradeClose
+	longCloseout   *model.MarketOrderPositionCloseout
+	shortCloseout  *model.MarketOrderPositionCloseout
+	marginCloseout *model.MarketOrderMarginCloseout
+}
+
+func (o *order) render() *model.OrderParser {
+	r := o.OrderParser
+	return &r
+}
+
+func (o *order) base() model.Order {
+	return model.Order{
+		Id:               model.OrderID(o.Id),
+		CreateTime:       o.CreateTime,
+		State:            o.State,
+		ClientExtensions: o.ClientExtensions,
+	}
+}
+
+func supportedOrderType(typ string) bool {
+	switch model.OrderType(typ) {
+	case model.OrderType_MARKET, model.OrderType_LIMIT, model.OrderType_STOP,
+		model.OrderType_TAKE_PROFIT, model.OrderType_STOP_LOSS, model.OrderType_TRAILING_STOP_LOSS:
+		return true
+	}
+	return false
+}
+
+func dependent(typ string) bool {
+	switch model.OrderType(typ) {
+	case model.OrderType_TAKE_PROFIT, model.OrderType_STOP_LOSS, model.OrderType_TRAILING_STOP_LOSS:
+		return true
+	}
+	return false
+}
+
+// dependentOrder returns the Order of the dependent type attached to the Trade.
+func (t *trade) dependentOrder(typ string) *order {
+	switch model.OrderType(typ) {
+	case model.OrderType_TAKE_PROFIT:
+		return t.takeProfit
+	case model.OrderType_STOP_LOSS:
+		return t.stopLoss
+	case model.OrderType_TRAILING_STOP_LOSS:
+		return t.trailingStop
+	}
+	return nil
+}
+
+func (t *trade) attach(o *order) {
+	switch model.OrderType(o.Type) {
+	case model.OrderType_TAKE_PROFIT:
+		t.takeProfit = o
+	case model.OrderType_STOP_LOSS:
+		t.stopLoss = o
+	case model.OrderType_TRAILING_STOP_LOSS:
+		t.trailingStop = o
+	}
+}
+
+func (t *trade) detach(o *order) {
+	if t.takeProfit == o {
+		t.takeProfit = nil
+	}
+	if t.stopLoss == o {
+		t.stopLoss = nil
+	}
+	if t.trailingStop == o {
+		t.trailingStop = nil
+	}
+}
+
+func (a *account) findOrder(specifier string) *order {
+	if strings.HasPrefix(specifier, "@") {
+		for _, o := range a.orders {
+			if o.ClientExtensions != nil && string(o.ClientExtensions.ID) == specifier[1:] {
+				return o
+			}
+		}
+		return nil
+	}
+	return a.ordersByID[specifier]
+}
+
+func (a *account) findTrade(specifier string) *trade {
+	if strings.HasPrefix(specifier, "@") {
+		for _, t := range a.trades {
+			if t.ClientExtensions != nil && string(t.ClientExtensions.ID) == specifier[1:] {
+				return t
+			}
+		}
+		return nil
+	}
+	return a.tradesByID[specifier]
+}
+
+// validate returns the reason to reject the Order or an empty string.
+func (a *account) validate(spec *orderSpec) model.TransactionRejectReason {
+	req := &spec.OrderRequestParser
+	if dependent(req.Type) {
+		t := spec.trade
+		if t == nil {
+			if len(req.TradeID) == 0 && len(req.ClientTradeID) == 0 {
+				return model.TransactionRejectReason_TRADE_ID_UNSPECIFIED
+			}
+			if len(req.TradeID) > 0 {
+				t = a.findTrade(req.TradeID)
+			} else {
+				t = a.findTrade("@" + req.ClientTradeID)
+			}
+		}
+		if t == nil || t.units == 0 {
+			return model.TransactionRejectReason_TRADE_DOESNT_EXIST
+		}
+		spec.trade = t
+		if existing := t.dependentOrder(req.Type); existing != nil && existing != spec.replaces {
+			switch model.OrderType(req.Type) {
+			case model.OrderType_TAKE_PROFIT:
+				return model.TransactionRejectReason_TAKE_PROFIT_ORDER_ALREADY_EXISTS
+			case model.OrderType_TRAILING_STOP_LOSS:
+				return model.TransactionRejectReason_TRAILING_STOP_LOSS_ORDER_ALREADY_EXISTS
+			}
+			return model.TransactionRejectReason_STOP_LOSS_ORDER_ALREADY_EXISTS
+		}
+		if req.Type == string(model.OrderType_STOP_LOSS) && len(req.Price) == 0 && len(req.Distance) > 0 {
+			distance := req.Distance.AsFloat64(0)
+			if distance <= 0 {
+				return model.TransactionRejectReason_PRICE_DISTANCE_INVALID
+			}
+			req.Price = formatPrice(a.s.instruments[t.Instrument], t.price-math.Copysign(distance, t.units))
+		}
+		if req.Type == string(model.OrderType_TRAILING_STOP_LOSS) {
+			if len(req.Distance) == 0 {
+				return model.TransactionRejectReason_PRICE_DISTANCE_MISSING
+			}
+			if req.Distance.AsFloat64(0) <= 0 {
+				return model.TransactionRejectReason_PRICE_DISTANCE_INVALID
+			}
+			if _, _, ok := a.s.quote(t.Instrument); !ok {
+				return model.TransactionRejectReason_INSTRUMENT_PRICE_UNKNOWN
+			}
+		}
+	} else {
+		if len(req.Instrument) == 0 {
+			return model.TransactionRejectReason_INSTRUMENT_MISSING
+		}
+		if _, ok := a.s.instruments[req.Instrument]; !ok {
+			return model.TransactionRejectReason_INSTRUMENT_UNKNOWN
+		}
+		if len(req.Units) == 0 {
+			return model.TransactionRejectReason_UNITS_MISSING
+		}
+		if units, err := strconv.ParseFloat(string(req.Units), 64); err != nil || units == 0 {
+			return model.TransactionRejectReason_UNITS_INVALID
+		}
+	}
+	switch req.Type {
+	case string(model.OrderType_MARKET):
+		if _, _, ok := a.s.quote(req.Instrument); !ok {
+			return model.TransactionRejectReason_INSTRUMENT_PRICE_UNKNOWN
+		}
+		switch req.TimeInForce {
+		case "", model.TimeInForce_FOK, model.TimeInForce_IOC:
+		default:
+			return model.TransactionRejectReason_TIME_IN_FORCE_INVALID
+		}
+	case string(model.OrderType_TRAILING_STOP_LOSS):
+		// The stop follows the price
+	default:
+		if len(req.Price) == 0 {
+			return model.TransactionRejectReason_PRICE_MISSING
+		}
+		if price, err := strconv.ParseFloat(string(req.Price), 64); err != nil || price <= 0 {
+			return model.TransactionRejectReason_PRICE_INVALID
+		}
+	}
+	if req.TimeInForce == model.TimeInForce_GTD {
+		if len(req.GtdTime) == 0 {
+			return model.TransactionRejectReason_TIME_IN_FORCE_GTD_TIMESTAMP_MISSING
+		}
+		if gtd, err := req.GtdTime.Parse(); err != nil || !gtd.After(a.s.now()) {
+			return model.TransactionRejectReason_TIME_IN_FORCE_GTD_TIMESTAMP_IN_PAST
+		}
+	}
+	if tp := req.TakeProfitOnFill; tp != nil {
+		if len(tp.Price) == 0 {
+			return model.TransactionRejectReason_TAKE_PROFIT_ON_FILL_PRICE_MISSING
+		}
+		if tp.Price.AsFloat64(0) <= 0 {
+			return model.TransactionRejectReason_TAKE_PROFIT_ON_FILL_PRICE_INVALID
+		}
+	}
+	if sl := req.StopLossOnFill; sl != nil {
+		if len(sl.Price) == 0 && len(sl.Distance) == 0 {
+			return model.TransactionRejectReason_STOP_LOSS_ON_FILL_PRICE_AND_DISTANCE_BOTH_MISSING
+		}
+		if len(sl.Price) > 0 && sl.Price.AsFloat64(0) <= 0 {
+			return model.TransactionRejectReason_STOP_LOSS_ON_FILL_PRICE_INVALID
+		}
+	}
+	if tsl := req.TrailingStopLossOnFill; tsl != nil {
+		if len(tsl.Distance) == 0 {
+			return model.TransactionRejectReason_TRAILING_STOP_LOSS_ON_FILL_PRICE_DISTANCE_MISSING
+		}
+		if tsl.Distance.AsFloat64(0) <= 0 {
+			return model.TransactionRejectReason_TRAILING_STOP_LOSS_ON_FILL_PRICE_DISTANCE_INVALID
+		}
+	}
+	if req.ClientExtensions != nil && len(req.ClientExtensions.ID) > 0 {
+		for _, o := range a.orders {
+			if o != spec.replaces && o.State == model.OrderState_PENDING && o.ClientExtensions != nil &&
+				o.ClientExtensions.ID == req.ClientExtensions.ID {
+				return model.TransactionRejectReason_CLIENT_ORDER_ID_ALREADY_EXISTS
+			}
+		}
+	}
+	return ""
+}
+
+// orderTx fills the fields of the Transaction that creates or rejects the Order.
+func orderTx(tx *model.TransactionParser, spec *orderSpec) {
+	req := &spec.OrderRequestParser
+	tx.Instrument = req.Instrument
+	tx.Units = req.Units
+	tx.Price = req.Price
+	tx.PriceBound = req.PriceBound
+	tx.Distance = req.Distance
+	tx.TimeInForce = req.TimeInForce
+	tx.GtdTime = req.GtdTime
+	tx.PositionFill = req.PositionFill
+	tx.TriggerCondition = req.TriggerCondition
+	tx.TradeID = req.TradeID
+	tx.ClientTradeID = req.ClientTradeID
+	tx.ClientExtensions = req.ClientExtensions
+	tx.TradeClientExtensions = req.TradeClientExtensions
+	tx.TakeProfitOnFill = req.TakeProfitOnFill
+	tx.StopLossOnFill = req.StopLossOnFill
+	tx.TrailingStopLossOnFill = req.TrailingStopLossOnFill
+	tx.TradeClose = spec.tradeClose
+	tx.LongPositionCloseout = spec.longCloseout
+	tx.ShortPositionCloseout = spec.shortCloseout
+	tx.MarginCloseout = spec.marginCloseout
+	tx.Reason = spec.reason
+	if spec.replaces != nil {
+		tx.ReplacesOrderID = spec.replaces.Id
+	}
+}
+
+// submit validates and creates the Order, then fills Market Orders and the other
+// Orders whose price is already crossed. It returns either the create or the reject
+// Transaction.
+func (a *account) submit(spec *orderSpec) (create *model.TransactionParser, reject *model.TransactionParser) {
+	req := &spec.OrderRequestParser
+	if len(req.TimeInForce) == 0 {
+		if req.Type == string(model.OrderType_MARKET) {
+			req.TimeInForce = model.TimeInForce_FOK
+		} else {
+			req.TimeInForce = model.TimeInForce_GTC
+		}
+	}
+	if len(req.PositionFill) == 0 && !dependent(req.Type) {
+		req.PositionFill = model.OrderPositionFill_DEFAULT
+	}
+	if len(req.TriggerCondition) == 0 && req.Type != string(model.OrderType_MARKET) {
+		req.TriggerCondition = string(model.OrderTriggerCondition_DEFAULT)
+	}
+	if len(spec.reason) == 0 {
+		spec.reason = "CLIENT_ORDER"
+	}
+
+	if reason := a.validate(spec); len(reason) > 0 {
+		reject = a.newTx(req.Type + "_ORDER_REJECT")
+		orderTx(reject, spec)
+		reject.RejectReason = string(reason)
+		a.record(reject)
+		return nil, reject
+	}
+
+	create = a.newTx(req.Type + "_ORDER")
+	orderTx(create, spec)
+	a.record(create)
+
+	o := &order{
+		OrderParser: model.OrderParser{
+			Id:                     create.Id,
+			CreateTime:             create.Time,
+			State:                  model.OrderState_PENDING,
+			Type:                   req.Type,
+			Instrument:             req.Instrument,
+			Units:                  req.Units,
+			Price:                  req.Price,
+			PriceBound:             req.PriceBound,
+			Distance:               req.Distance,
+			TimeInForce:            req.TimeInForce,
+			GtdTime:                req.GtdTime,
+			PositionFill:           req.PositionFill,
+			TriggerCondition:       req.TriggerCondition,
+			ClientExtensions:       req.ClientExtensions,
+			TradeClientExtensions:  req.TradeClientExtensions,
+			TakeProfitOnFill:       req.TakeProfitOnFill,
+			StopLossOnFill:         req.StopLossOnFill,
+			TrailingStopLossOnFill: req.TrailingStopLossOnFill,
+			TradeClose:             spec.tradeClose,
+			LongPositionCloseout:   spec.longCloseout,
+			ShortPositionCloseout:  spec.shortCloseout,
+			MarginCloseout:         spec.marginCloseout,
+		},
+		instrument: req.Instrument,
+		trade:      spec.trade,
+	}
+	o.units, _ = strconv.ParseFloat(string(req.Units), 64)
+	o.price, _ = strconv.ParseFloat(string(req.Price), 64)
+	if req.TimeInForce == model.TimeInForce_GTD {
+		o.gtd, _ = req.GtdTime.Parse()
+	}
+	if spec.replaces != nil {
+		o.ReplacesOrderID = spec.replaces.Id
+	}
+	if t := spec.trade; t != nil {
+		o.instrument = t.Instrument
+		if dependent(req.Type) {
+			o.Instrument = ""
+			o.TradeID = string(t.Id)
+			o.units = 0
+			t.attach(o)
+		}
+	}
+	a.orders = append(a.orders, o)
+	a.ordersByID[o.Id] = o
+
+	bid, ask, ok := a.s.quote(o.instrument)
+	if ok && req.Type == string(model.OrderType_TRAILING_STOP_LOSS) {
+		o.distance = req.Distance.AsFloat64(0)
+		a.trail(o, bid, ask)
+	}
+	switch {
+	case req.Type == string(model.OrderType_MARKET):
+		a.execute(o)
+	case ok && a.triggered(o, bid, ask):
+		a.execute(o)
+	case req.TimeInForce == model.TimeInForce_FOK || req.TimeInForce == model.TimeInForce_IOC:
+		a.cancel(o, string(model.OrderCancelReason_TIME_IN_FORCE_EXPIRED), "")
+	}
+	return create, nil
+}
+
+// cancel cancels the pending Order and detaches it from its Trade.
+func (a *account) cancel(o *order, reason string, replacedBy string) *model.TransactionParser {
+	tx := a.cancelTx(o, reason, replacedBy)
+	o.State = model.OrderState_CANCELLED
+	o.CancellingTransactionID = tx.Id
+	o.CancelledTime = tx.Time
+	o.ReplacedByOrderID = replacedBy
+	if t := o.trade; t != nil {
+		t.detach(o)
+	}
+	return tx
+}
+
+// cancelTx records the cancel Transaction of the Order without changing the Order.
+func (a *account) cancelTx(o *order, reason string, replacedBy string) *model.TransactionParser {
+	tx := a.newTx(string(model.TransactionType_ORDER_CANCEL))
+	tx.OrderID = o.Id
+	if o.ClientExtensions != nil {
+		tx.ClientOrderID = string(o.ClientExtensions.ID)
+	}
+	tx.Reason = reason
+	tx.ReplacedByOrderID = replacedBy
+	a.record(tx)
+	return tx
+}
+
+// closing returns the signed units the Order executes.
+func (o *order) closing() float64 {
+	if o.units == 0 && o.trade != nil {
+		return -o.trade.units
+	}
+	return o.units
+}
+
+// trail moves the stop of a Trailing Stop Loss Order behind the price. The stop of a
+// long Trade trails the bid and the stop of a short Trade the ask, it never moves
+// back.
+func (a *account) trail(o *order, bid float64, ask float64) {
+	if o.Type != string(model.OrderType_TRAILING_STOP_LOSS) {
+		return
+	}
+	buy := o.closing() > 0
+	stop := bid - o.distance
+	if buy {
+		stop = ask + o.distance
+	}
+	if o.price == 0 || (buy && stop < o.price) || (!buy && stop > o.price) {
+		o.price = stop
+		o.TrailingStopValue = formatPrice(a.s.instruments[o.instrument], stop)
+	}
+}
+
+// triggered reports whether the price crosses the price of the Order.
+func (a *account) triggered(o *order, bid float64, ask float64) bool {
+	if o.Type == string(model.OrderType_MARKET) {
+		return true
+	}
+	buy := o.closing() > 0
+	p := bid
+	switch model.OrderTriggerCondition(o.TriggerCondition) {
+	case model.OrderTriggerCondition_BID:
+	case model.OrderTriggerCondition_ASK:
+		p = ask
+	case model.OrderTriggerCondition_MID:
+		p = (bid + ask) / 2
+	case model.OrderTriggerCondition_INVERSE:
+		if !buy {
+			p = ask
+		}
+	default:
+		if buy {
+			p = ask
+		}
+	}
+	limit := o.Type == string(model.OrderType_LIMIT) || o.Type == string(model.OrderType_TAKE_PROFIT)
+	if limit == buy {
+		return p <= o.price
+	}
+	return p >= o.price
+}
+
+// match expires and fills the pending Orders of the instrument at its new price.
+// Every Order executes in a batch of its own.
+func (a *account) match(instrument model.InstrumentName) {
+	bid, ask, ok := a.s.quote(instrument)
+	if !ok {
+		return
+	}
+	var pending []*order
+	for _, o := range a.orders {
+		if o.State == model.OrderState_PENDING && o.instrument == instrument {
+			pending = append(pending, o)
+		}
+	}
+	now := a.s.now()
+	for _, o := range pending {
+		if o.State != model.OrderState_PENDING {
+			continue
+		}
+		if !o.gtd.IsZero() && !now.Before(o.gtd) {
+			a.begin()
+			a.cancel(o, string(model.OrderCancelReason_TIME_IN_FORCE_EXPIRED), "")
+			continue
+		}
+		a.trail(o, bid, ask)
+		if a.triggered(o, bid, ask) {
+			a.begin()
+			a.execute(o)
+		}
+	}
+}
+
+// closeout closes every open Position at market once the margin closeout percent
+// reaches 100%.
+func (a *account) closeout() {
+	st := a.state()
+	if st.marginUsed == 0 || st.nav > st.closeoutMarginUsed {
+		return
+	}
+	a.begin()
+	for _, instrument := range a.instruments {
+		var long, short float64
+		for _, t := range a.openTrades(instrument) {
+			if t.units > 0 {
+				long += t.units
+			} else {
+				short += t.units
+			}
+		}
+		for _, units := range []float64{-long, -short} {
+			if units == 0 {
+				continue
+			}
+			a.submit(&orderSpec{
+				OrderRequestParser: model.OrderRequestParser{
+					Type:         string(model.OrderType_MARKET),
+					Instrument:   instrument,
+					Units:        formatUnits(units),
+					TimeInForce:  model.TimeInForce_IOC,
+					PositionFill: model.OrderPositionFill_REDUCE_ONLY,
+				},
+				reason:         string(model.MarketOrderReason_MARGIN_CLOSEOUT),
+				marginCloseout: &model.MarketOrderMarginCloseout{Reason: model.MarketOrderMarginCloseoutReason_MARGIN_CHECK_VIOLATION},
+			})
+		}
+	}
+}
+
+// plan returns the Trades the Order reduces in order and the units it opens when it
+// fills the units.
+func (a *account) plan(o *order, units float64) (reduce []*trade, open float64) {
+	switch {
+	case o.trade != nil:
+		return []*trade{o.trade}, 0
+	case o.LongPositionCloseout != nil || o.ShortPositionCloseout != nil || o.MarginCloseout != nil:
+		for _, t := range a.openTrades(o.instrument) {
+			if (t.units > 0) != (units > 0) {
+				reduce = append(reduce, t)
+			}
+		}
+		return reduce, 0
+	}
+	remaining := math.Abs(units)
+	for _, t := range a.openTrades(o.instrument) {
+		if (t.units > 0) != (units > 0) && remaining > 0 {
+			reduce = append(reduce, t)
+			remaining -= math.Min(remaining, math.Abs(t.units))
+		}
+	}
+	if o.PositionFill == model.OrderPositionFill_REDUCE_ONLY {
+		remaining = 0
+	}
+	return reduce, math.Copysign(remaining, units)
+}
+
+// execute fills the triggered Order at the current price or cancels it. Fill or kill
+// Orders larger than the liquidity at the price are cancelled, immediate or cancel
+// Orders fill the liquidity and cancel the rest.
+func (a *account) execute(o *order) {
+	bid, ask, _ := a.s.quote(o.instrument)
+	units := o.closing()
+	price := ask
+	if units < 0 {
+		price = bid
+	}
+	if o.Type == string(model.OrderType_MARKET) && len(o.PriceBound) > 0 {
+		bound := o.PriceBound.AsFloat64(0)
+		if (units > 0 && price > bound) || (units < 0 && price < bound) {
+			a.cancel(o, string(model.OrderCancelReason_BOUNDS_VIOLATION), "")
+			return
+		}
+	}
+	// Immediate or cancel Orders fill what the price offers
+	available := a.s.liquidity(o.instrument, units > 0)
+	limited := math.Abs(units) > available
+	if limited && o.TimeInForce == model.TimeInForce_IOC {
+		if available == 0 {
+			a.cancel(o, string(model.OrderCancelReason_INSUFFICIENT_LIQUIDITY), "")
+			return
+		}
+		units = math.Copysign(available, units)
+	}
+	reduce, open := a.plan(o, units)
+	if len(reduce) == 0 && open == 0 {
+		a.cancel(o, string(model.OrderCancelReason_POSITION_CLOSEOUT_FAILED), "")
+		return
+	}
+	if open != 0 {
+		required := math.Abs(open) * (bid + ask) / 2 * a.quoteConversion(o.instrument) * a.rate(o.instrument)
+		if required > a.state().marginAvailable {
+			a.cancel(o, string(model.OrderCancelReason_INSUFFICIENT_MARGIN), "")
+			return
+		}
+	}
+	if limited && o.TimeInForce == model.TimeInForce_FOK {
+		a.cancel(o, string(model.OrderCancelReason_INSUFFICIENT_LIQUIDITY), "")
+		return
+	}
+	a.fill(o, price, reduce, open, units)
+	if limited && o.TimeInForce == model.TimeInForce_IOC {
+		a.cancelTx(o, string(model.OrderCancelReason_INSUFFICIENT_LIQUIDITY), "")
+	}
+}
+
+func fillReason(o *order) string {
+	switch {
+	case o.TradeClose != nil:
+		return string(model.OrderFillReason_MARKET_ORDER_TRADE_CLOSE)
+	case o.LongPositionCloseout != nil || o.ShortPositionCloseout != nil:
+		return string(model.OrderFillReason_MARKET_ORDER_POSITION_CLOSEOUT)
+	case o.MarginCloseout != nil:
+		return string(model.OrderFillReason_MARKET_ORDER_MARGIN_CLOSEOUT)
+	}
+	return o.Type + "_ORDER"
+}
+
+func (a *account) fill(o *order, price float64, reduce []*trade, open float64, units float64) {
+	var (
+		instrument = a.s.instruments[o.instrument]
+		conversion = a.quoteConversion(o.instrument)
+		remaining  = math.Abs(units)
+		closed     []*trade
+		pl         float64
+	)
+	bid, ask, _ := a.s.quote(o.instrument)
+	halfSpread := (ask - bid) / 2 * conversion
+
+	tx := a.newTx(string(model.TransactionType_ORDER_FILL))
+	tx.OrderID = o.Id
+	if o.ClientExtensions != nil {
+		tx.ClientOrderID = string(o.ClientExtensions.ID)
+	}
+	tx.Instrument = o.instrument
+	tx.Price = formatPrice(instrument, price)
+	tx.FullVWAP = tx.Price
+	if p := a.s.prices[o.instrument]; p != nil {
+		tx.FullPrice = *p
+	}
+	tx.Reason = fillReason(o)
+	tx.Financing = formatAccountUnits(0)
+	tx.Commission = formatAccountUnits(0)
+	tx.GuaranteedExecutionFee = formatAccountUnits(0)
+	tx.GainQuoteHomeConversionFactor = formatUnits(conversion)
+	tx.LossQuoteHomeConversionFactor = formatUnits(conversion)
+
+	var filled float64
+	for _, t := range reduce {
+		if remaining <= 0 {
+			break
+		}
+		size := math.Min(math.Abs(t.units), remaining)
+		side := math.Copysign(1, t.units)
+		realized := (price - t.price) * size * side * conversion
+		t.units -= side * size
+		t.realized += realized
+		t.ClosingTransactionIDs = append(t.ClosingTransactionIDs, model.TransactionID(tx.Id))
+		remaining -= size
+		filled -= side * size
+		pl += realized
+		if side > 0 {
+			a.position(o.instrument).long += realized
+		} else {
+			a.position(o.instrument).short += realized
+		}
+		r := &model.TradeReduce{
+			TradeID:        t.Id,
+			Units:          formatUnits(-side * size),
+			Price:          tx.Price,
+			RealizedPL:     formatAccountUnits(realized),
+			Financing:      formatAccountUnits(0),
+			HalfSpreadCost: formatAccountUnits(halfSpread * size),
+		}
+		if t.units == 0 {
+			t.State = model.TradeState_CLOSED
+			t.CloseTime = tx.Time
+			t.AverageClosePrice = tx.Price
+			tx.TradesClosed = append(tx.TradesClosed, r)
+			closed = append(closed, t)
+		} else {
+			tx.TradeReduced = r
+			o.TradeReducedID = string(t.Id)
+		}
+	}
+
+	var opened *trade
+	if open != 0 {
+		initialMargin := math.Abs(open) * price * conversion * a.rate(o.instrument)
+		opened = &trade{
+			Trade: model.Trade{
+				Id:                    model.TradeID(tx.Id),
+				Instrument:            o.instrument,
+				Price:                 tx.Price,
+				OpenTime:              tx.Time,
+				State:                 model.TradeState_OPEN,
+				InitialUnits:          formatUnits(open),
+				InitialMarginRequired: formatAccountUnits(initialMargin),
+				ClientExtensions:      o.TradeClientExtensions,
+			},
+			units: open,
+			price: price,
+		}
+		filled += open
+		tx.TradeOpened = &model.TradeOpen{
+			TradeID:                model.TradeID(tx.Id),
+			Units:                  formatUnits(open),
+			Price:                  tx.Price,
+			ClientExtensions:       o.TradeClientExtensions,
+			HalfSpreadCost:         formatAccountUnits(halfSpread * math.Abs(open)),
+			InitialMarginRequired:  formatAccountUnits(initialMargin),
+			GuaranteedExecutionFee: formatAccountUnits(0),
+		}
+		a.position(o.instrument)
+		a.trades = append(a.trades, opened)
+		a.tradesByID[tx.Id] = opened
+		o.TradeOpenedID = tx.Id
+	}
+
+	a.balance += pl
+	a.pl += pl
+	tx.Units = formatUnits(filled)
+	tx.Pl = formatAccountUnits(pl)
+	tx.QuotePL = formatUnits(pl / conversion)
+	tx.HalfSpreadCost = formatAccountUnits(halfSpread * math.Abs(filled))
+	tx.AccountBalance = formatAccountUnits(a.balance)
+	a.record(tx)
+
+	o.State = model.OrderState_FILLED
+	o.FillingTransactionID = tx.Id
+	o.FilledTime = tx.Time
+	for _, t := range closed {
+		o.TradeClosedIDs = append(o.TradeClosedIDs, t.Id)
+	}
+	if t := o.trade; t != nil && dependent(o.Type) {
+		t.detach(o)
+	}
+
+	// Closing a Trade cancels its dependent Orders
+	for _, t := range closed {
+		for _, d := range []*order{t.takeProfit, t.stopLoss, t.trailingStop} {
+			if d != nil {
+				a.cancel(d, string(model.OrderCancelReason_LINKED_TRADE_CLOSED), "")
+			}
+		}
+	}
+
+	if opened == nil {
+		return
+	}
+	if tp := o.TakeProfitOnFill; tp != nil {
+		a.submit(&orderSpec{
+			OrderRequestParser: model.OrderRequestParser{
+				Type:             string(model.OrderType_TAKE_PROFIT),
+				TradeID:          string(opened.Id),
+				Price:            tp.Price,
+				TimeInForce:      tp.TimeInForce,
+				GtdTime:          tp.GtdTime,
+				ClientExtensions: tp.ClientExtensions,
+			},
+			reason: "ON_FILL",
+			trade:  opened,
+		})
+	}
+	if sl := o.StopLossOnFill; sl != nil {
+		a.submit(&orderSpec{
+			OrderRequestParser: model.OrderRequestParser{
+				Type:             string(model.OrderType_STOP_LOSS),
+				TradeID:          string(opened.Id),
+				Price:            sl.Price,
+				Distance:         sl.Distance,
+				TimeInForce:      sl.TimeInForce,
+				GtdTime:          sl.GtdTime,
+				ClientExtensions: sl.ClientExtensions,
+			},
+			reason: "ON_FILL",
+			trade:  opened,
+		})
+	}
+	if tsl := o.TrailingStopLossOnFill; tsl != nil {
+		a.submit(&orderSpec{
+			OrderRequestParser: model.OrderRequestParser{
+				Type:             string(model.OrderType_TRAILING_STOP_LOSS),
+				TradeID:          string(opened.Id),
+				Distance:         tsl.Distance,
+				TimeInForce:      tsl.TimeInForce,
+				GtdTime:          tsl.GtdTime,
+				ClientExtensions: tsl.ClientExtensions,
+			},
+			reason: "ON_FILL",
+			trade:  opened,
+		})
+	}
+}
@@ -0,0 +1,903 @@
+package oandatest
+
+import (
+	"encoding/json"
+	"github.com/kamaiu/oanda-go/model"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// serve handles the requests below /v3/accounts/{accountID}. The caller holds the
+// lock of the Server.
+func (a *account) serve(w http.ResponseWriter, r *http.Request, p []string) {
+	get := r.Method == http.MethodGet
+	put := r.Method == http.MethodPut
+	q := r.URL.Query()
+	switch {
+	case get && match(p):
+		b, err := a.account()
+		if err != nil {
+			replyError(w, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		reply(w, http.StatusOK, map[string]interface{}{
+			"account":           json.RawMessage(b),
+			"lastTransactionID": a.lastTransactionID(),
+		})
+
+	case get && match(p, "summary"):
+		reply(w, http.StatusOK, &model.AccountSummaryResponse{
+			Account:           a.summary(),
+			LastTransactionID: a.lastTransactionID(),
+		})
+
+	case get && match(p, "instruments"):
+		a.instrumentsResponse(w, q.Get("instruments"))
+
+	case r.Method == http.MethodPatch && match(p, "configuration"):
+		a.configure(w, r)
+
+	case get && match(p, "changes"):
+		since, err := strconv.ParseInt(q.Get("sinceTransactionID"), 10, 64)
+		if err != nil || since > a.lastID {
+			replyError(w, http.StatusBadRequest, "", errInvalid("sinceTransactionID").Error())
+			return
+		}
+		reply(w, http.StatusOK, map[string]interface{}{
+			"changes":           a.changes(since),
+			"state":             a.changesState(),
+			"lastTransactionID": a.lastTransactionID(),
+		})
+
+	case r.Method == http.MethodPost && match(p, "orders"):
+		a.orderCreate(w, r)
+
+	case get && match(p, "orders"):
+		a.ordersResponse(w, q.Get("state"), q)
+
+	case get && match(p, "pendingOrders"):
+		a.ordersResponse(w, string(model.OrderStateFilter_PENDING), nil)
+
+	case get && match(p, "orders", "*"):
+		o := a.findOrder(p[1])
+		if o == nil {
+			replyError(w, http.StatusNotFound, string(model.TransactionRejectReason_ORDER_DOESNT_EXIST), "The Order specified does not exist")
+			return
+		}
+		reply(w, http.StatusOK, &model.OrderResponse{Order: o.render(), LastTransactionID: a.lastTransactionID()})
+
+	case put && match(p, "orders", "*"):
+		a.orderReplace(w, r, p[1])
+
+	case put && match(p, "orders", "*", "cancel"):
+		a.orderCancel(w, p[1])
+
+	case put && match(p, "orders", "*", "clientExtensions"):
+		a.orderClientExtensions(w, r, p[1])
+
+	case get && match(p, "trades"):
+		a.tradesResponse(w, q.Get("state"), q)
+
+	case get && match(p, "openTrades"):
+		a.tradesResponse(w, string(model.TradeStateFilter_OPEN), nil)
+
+	case get && match(p, "trades", "*"):
+		t := a.findTrade(p[1])
+		if t == nil {
+			replyError(w, http.StatusNotFound, string(model.TransactionRejectReason_TRADE_DOESNT_EXIST), "The Trade specified does not exist")
+			return
+		}
+		reply(w, http.StatusOK, &model.TradeResponse{Trade: a.renderTrade(t), LastTransactionID: a.lastTransactionID()})
+
+	case put && match(p, "trades", "*", "close"):
+		a.tradeClose(w, r, p[1])
+
+	case put && match(p, "trades", "*", "clientExtensions"):
+		a.tradeClientExtensions(w, r, p[1])
+
+	case put && match(p, "trades", "*", "orders"):
+		a.tradeModify(w, r, p[1])
+
+	case get && (match(p, "positions") || match(p, "openPositions")):
+		resp := &model.PositionsResponse{Positions: []*model.Position{}, LastTransactionID: a.lastTransactionID()}
+		for _, instrument := range a.instruments {
+			if p[0] == "positions" || len(a.openTrades(instrument)) > 0 {
+				resp.Positions = append(resp.Positions, a.renderPosition(instrument))
+			}
+		}
+		reply(w, http.StatusOK, resp)
+
+	case get && match(p, "positions", "*"):
+		instrument := model.InstrumentName(p[1])
+		if _, ok := a.s.instruments[instrument]; !ok {
+			replyError(w, http.StatusNotFound, "", "The Instrument specified does not exist")
+			return
+		}
+		reply(w, http.StatusOK, &model.PositionResponse{Position: a.renderPosition(instrument), LastTransactionID: a.lastTransactionID()})
+
+	case put && match(p, "positions", "*", "close"):
+		a.positionClose(w, r, model.InstrumentName(p[1]))
+
+	case get && match(p, "pricing"):
+		instruments := splitList(q.Get("instruments"))
+		if len(instruments) == 0 {
+			replyError(w, http.StatusBadRequest, "", errInvalid("instruments").Error())
+			return
+		}
+		resp, err := a.s.pricingResponse(instruments, q.Get("since"), q.Get("includeHomeConversions") == "true", a.currency)
+		if err != nil {
+			replyError(w, http.StatusBadRequest, "", err.Error())
+			return
+		}
+		reply(w, http.StatusOK, resp)
+
+	case get && match(p, "candles", "latest"):
+		reply(w, http.StatusOK, a.s.latestCandles(q.Get("candleSpecifications")))
+
+	case get && match(p, "instruments", "*", "candles"):
+		a.s.serveCandles(w, r, model.InstrumentName(p[1]), true)
+
+	case get && match(p, "transactions"):
+		a.transactionPages(w, q)
+
+	case get && match(p, "transactions", "idrange"):
+		from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+		to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+		a.transactionRange(w, from, to, q.Get("type"))
+
+	case get && match(p, "transactions", "sinceid"):
+		since, _ := strconv.ParseInt(q.Get("id"), 10, 64)
+		if since == a.lastID {
+			// Nothing newer, which is not an error
+			reply(w, http.StatusOK, &model.TransactionsResponse{
+				Transactions:      []*model.TransactionParser{},
+				LastTransactionID: a.lastTransactionID(),
+			})
+			return
+		}
+		a.transactionRange(w, since+1, a.lastID, q.Get("type"))
+
+	case get && match(p, "transactions", "*"):
+		tx := a.transaction(p[1])
+		if tx == nil {
+			replyError(w, http.StatusNotFound, "", "The Transaction specified does not exist")
+			return
+		}
+		reply(w, http.StatusOK, &model.TransactionResponse{Transaction: tx, LastTransactionID: a.lastTransactionID()})
+
+	default:
+		replyError(w, http.StatusNotFound, "", "Not found")
+	}
+}
+
+// replyBatch replies with the fields and the Transactions of the current batch.
+func (a *account) replyBatch(w http.ResponseWriter, code int, fields map[string]interface{}) {
+	fields["relatedTransactionIDs"] = a.related()
+	fields["lastTransactionID"] = a.lastTransactionID()
+	reply(w, code, fields)
+}
+
+// set adds the field unless the Transaction is nil.
+func set(fields map[string]interface{}, name string, tx *model.TransactionParser) {
+	if tx != nil {
+		fields[name] = tx
+	}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (a *account) instrumentsResponse(w http.ResponseWriter, filter string) {
+	resp := &model.AccountInstrumentsResponse{Instruments: []*model.Instrument{}, LastTransactionID: a.lastTransactionID()}
+	names := splitList(filter)
+	if len(names) == 0 {
+		for _, name := range a.s.names {
+			names = append(names, string(name))
+		}
+	}
+	for _, name := range names {
+		if i := a.s.instruments[model.InstrumentName(name)]; i != nil {
+			resp.Instruments = append(resp.Instruments, i)
+		}
+	}
+	reply(w, http.StatusOK, resp)
+}
+
+func (a *account) configure(w http.ResponseWriter, r *http.Request) {
+	req := &model.AccountConfigurationRequest{}
+	if err := readJSON(r, req); err != nil {
+		replyError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	a.begin()
+	var rate float64
+	if len(req.MarginRate) > 0 {
+		var err error
+		if rate, err = strconv.ParseFloat(string(req.MarginRate), 64); err != nil || rate <= 0 || rate > 1 {
+			tx := a.newTx(string(model.TransactionType_CLIENT_CONFIGURE_REJECT))
+			tx.Alias = req.Alias
+			tx.MarginRate = req.MarginRate
+			tx.RejectReason = string(model.TransactionRejectReason_MARGIN_RATE_INVALID)
+			a.record(tx)
+			a.replyBatch(w, http.StatusBadRequest, map[string]interface{}{
+				"clientConfigureRejectTransaction": tx,
+				"errorCode":                        tx.RejectReason,
+				"errorMessage":                     "The margin rate provided is invalid",
+			})
+			return
+		}
+	}
+	tx := a.newTx(string(model.TransactionType_CLIENT_CONFIGURE))
+	tx.Alias = req.Alias
+	tx.MarginRate = req.MarginRate
+	a.record(tx)
+	if len(req.Alias) > 0 {
+		a.alias = req.Alias
+	}
+	if rate > 0 {
+		a.marginRate = rate
+	}
+	a.replyBatch(w, http.StatusOK, map[string]interface{}{"clientConfigureTransaction": tx})
+}
+
+func (a *account) orderCreate(w http.ResponseWriter, r *http.Request) {
+	req := &struct {
+		Order *model.OrderRequestParser `json:"order"`
+	}{}
+	if err := readJSON(r, req); err != nil || req.Order == nil {
+		replyError(w, http.StatusBadRequest, "", "Invalid value specified for 'order'")
+		return
+	}
+	if !supportedOrderType(req.Order.Type) {
+		replyError(w, http.StatusBadRequest, "UNSUPPORTED_ORDER_TYPE", "The order type is not supported")
+		return
+	}
+	a.begin()
+	create, reject := a.submit(&orderSpec{OrderRequestParser: *req.Order})
+	if reject != nil {
+		a.replyBatch(w, http.StatusBadRequest, map[string]interface{}{
+			"orderRejectTransaction": reject,
+			"errorCode":              reject.RejectReason,
+			"errorMessage":           "The Order specification was invalid",
+		})
+		return
+	}
+	fields := map[string]interface{}{"orderCreateTransaction": create}
+	set(fields, "orderFillTransaction", a.batchTx(string(model.TransactionType_ORDER_FILL), create.Id))
+	set(fields, "orderCancelTransaction", a.batchTx(string(model.TransactionType_ORDER_CANCEL), create.Id))
+	a.replyBatch(w, http.StatusCreated, fields)
+}
+
+func (a *account) orderReplace(w http.ResponseWriter, r *http.Request, specifier string) {
+	req := &struct {
+		Order *model.OrderRequestParser `json:"order"`
+	}{}
+	if err := readJSON(r, req); err != nil || req.Order == nil {
+		replyError(w, http.StatusBadRequest, "", "Invalid value specified for 'order'")
+		return
+	}
+	if !supportedOrderType(req.Order.Type) || req.Order.Type == string(model.OrderType_MARKET) {
+		replyError(w, http.StatusBadRequest, "UNSUPPORTED_ORDER_TYPE", "The order type is not supported")
+		return
+	}
+	o := a.findOrder(specifier)
+	if o == nil || o.State != model.OrderState_PENDING {
+		replyError(w, http.StatusNotFound, string(model.TransactionRejectReason_ORDER_DOESNT_EXIST), "The Order specified does not exist")
+		return
+	}
+	a.begin()
+	spec := &orderSpec{OrderRequestParser: *req.Order, reason: "REPLACEMENT", replaces: o}
+	if reason := a.validate(spec); len(reason) > 0 {
+		_, reject := a.submit(spec)
+		a.replyBatch(w, http.StatusBadRequest, map[string]interface{}{
+			"orderRejectTransaction": reject,
+			"errorCode":              reject.RejectReason,
+			"errorMessage":           "The Order specification was invalid",
+		})
+		return
+	}
+	// The replacement takes the next ID after the cancel
+	cancel := a.cancel(o, string(model.OrderCancelReason_CLIENT_REQUEST_REPLACED), strconv.FormatInt(a.lastID+2, 10))
+	create, _ := a.submit(spec)
+	fields := map[string]interface{}{
+		"orderCancelTransaction": cancel,
+		"orderCreateTransaction": create,
+	}
+	set(fields, "orderFillTransaction", a.batchTx(string(model.TransactionType_ORDER_FILL), create.Id))
+	set(fields, "replacingOrderCancelTransaction", a.batchTx(string(model.TransactionType_ORDER_CANCEL), create.Id))
+	a.replyBatch(w, http.StatusCreated, fields)
+}
+
+func (a *account) orderCancel(w http.ResponseWriter, specifier string) {
+	a.begin()
+	o := a.findOrder(specifier)
+	if o == nil || o.State != model.OrderState_PENDING {
+		tx := a.newTx(string(model.TransactionType_ORDER_CANCEL_REJECT))
+		if o != nil {
+			tx.OrderID = o.Id
+		}
+		tx.RejectReason = string(model.TransactionRejectReason_ORDER_DOESNT_EXIST)
+		a.record(tx)
+		a.replyBatch(w, http.StatusNotFound, map[string]interface{}{
+			"orderCancelRejectTransaction": tx,
+			"errorCode":                    tx.RejectReason,
+			"errorMessage":                 "The Order specified does not exist",
+		})
+		return
+	}
+	tx := a.cancel(o, string(model.OrderCancelReason_CLIENT_REQUEST), "")
+	a.replyBatch(w, http.StatusOK, map[string]interface{}{"orderCancelTransaction": tx})
+}
+
+func (a *account) orderClientExtensions(w http.ResponseWriter, r *http.Request, specifier string) {
+	req := &model.OrderClientExtensionsRequest{}
+	if err := readJSON(r, req); err != nil {
+		replyError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	a.begin()
+	o := a.findOrder(specifier)
+	if o == nil || o.State != model.OrderState_PENDING {
+		tx := a.newTx(string(model.TransactionType_ORDER_CLIENT_EXTENSIONS_MODIFY_REJECT))
+		tx.ClientExtensionsModify = req.ClientExtensions
+		tx.TradeClientExtensionsModify = req.TradeClientExtensions
+		tx.RejectReason = string(model.TransactionRejectReason_ORDER_DOESNT_EXIST)
+		a.record(tx)
+		a.replyBatch(w, http.StatusNotFound, map[string]interface{}{
+			"orderClientExtensionsModifyRejectTransaction": tx,
+			"errorCode":    tx.RejectReason,
+			"errorMessage": "The Order specified does not exist",
+		})
+		return
+	}
+	tx := a.newTx(string(model.TransactionType_ORDER_CLIENT_EXTENSIONS_MODIFY))
+	tx.OrderID = o.Id
+	tx.ClientExtensionsModify = req.ClientExtensions
+	tx.TradeClientExtensionsModify = req.TradeClientExtensions
+	if o.ClientExtensions != nil {
+		tx.ClientOrderID = string(o.ClientExtensions.ID)
+	}
+	a.record(tx)
+	if req.ClientExtensions != nil {
+		o.ClientExtensions = req.ClientExtensions
+	}
+	if req.TradeClientExtensions != nil {
+		o.TradeClientExtensions = req.TradeClientExtensions
+	}
+	a.replyBatch(w, http.StatusOK, map[string]interface{}{"orderClientExtensionsModifyTransaction": tx})
+}
+
+// ordersResponse lists the Orders in the state, most recent first, filtered by the
+// query of an orders request.
+func (a *account) ordersResponse(w http.ResponseWriter, state string, q url.Values) {
+	count, before, ids, instrument := listFilter(q)
+	resp := &model.OrdersResponse{Orders: []*model.OrderParser{}, LastTransactionID: a.lastTransactionID()}
+	for i := len(a.orders) - 1; i >= 0 && len(resp.Orders) < count; i-- {
+		o := a.orders[i]
+		id, _ := strconv.ParseInt(o.Id, 10, 64)
+		if (len(state) > 0 && state != string(model.OrderStateFilter_ALL) && state != string(o.State)) ||
+			(before > 0 && id >= before) ||
+			(ids != nil && !ids[o.Id]) ||
+			(len(instrument) > 0 && o.instrument != instrument) {
+			continue
+		}
+		resp.Orders = append(resp.Orders, o.render())
+	}
+	reply(w, http.StatusOK, resp)
+}
+
+// tradesResponse lists the Trades in the state, most recent first, filtered by the
+// query of a trades request.
+func (a *account) tradesResponse(w http.ResponseWriter, state string, q url.Values) {
+	count, before, ids, instrument := listFilter(q)
+	resp := &model.TradesResponse{Trades: []*model.Trade{}, LastTransactionID: a.lastTransactionID()}
+	for i := len(a.trades) - 1; i >= 0 && len(resp.Trades) < count; i-- {
+		t := a.trades[i]
+		id, _ := strconv.ParseInt(string(t.Id), 10, 64)
+		if (len(state) > 0 && state != string(model.TradeStateFilter_ALL) && state != string(t.State)) ||
+			(before > 0 && id >= before) ||
+			(ids != nil && !ids[string(t.Id)]) ||
+			(len(instrument) > 0 && t.Instrument != instrument) {
+			continue
+		}
+		resp.Trades = append(resp.Trades, a.renderTrade(t))
+	}
+	reply(w, http.StatusOK, resp)
+}
+
+func listFilter(q url.Values) (count int, before int64, ids map[string]bool, instrument model.InstrumentName) {
+	count = 50
+	if q == nil {
+		return unlimited, 0, nil, ""
+	}
+	if n, err := strconv.Atoi(q.Get("count")); err == nil && n > 0 {
+		count = n
+	}
+	before, _ = strconv.ParseInt(q.Get("beforeID"), 10, 64)
+	if list := splitList(q.Get("ids")); len(list) > 0 {
+		ids = make(map[string]bool, len(list))
+		for _, id := range list {
+			ids[id] = true
+		}
+	}
+	return count, before, ids, model.InstrumentName(q.Get("instrument"))
+}
+
+// unlimited is the count of the lists without a count parameter.
+const unlimited = 1 << 30
+
+func (a *account) tradeClose(w http.ResponseWriter, r *http.Request, specifier string) {
+	req := &struct {
+		Units string `json:"units"`
+	}{}
+	if err := readJSON(r, req); err != nil {
+		replyError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	a.begin()
+	t := a.findTrade(specifier)
+	reject := func(code int, reason model.TransactionRejectReason) {
+		tx := a.newTx(string(model.TransactionType_MARKET_ORDER_REJECT))
+		tx.Reason = string(model.MarketOrderReason_TRADE_CLOSE)
+		tx.TradeClose = &model.MarketOrderTradeClose{TradeID: model.TradeID(strings.TrimPrefix(specifier, "@")), Units: req.Units}
+		if t != nil {
+			tx.Instrument = t.Instrument
+			tx.TradeClose.TradeID = t.Id
+		}
+		tx.RejectReason = string(reason)
+		a.record(tx)
+		a.replyBatch(w, code, map[string]interface{}{
+			"orderRejectTransaction": tx,
+			"errorCode":              tx.RejectReason,
+			"errorMessage":           "The Trade cannot be closed as requested",
+		})
+	}
+	if t == nil || t.units == 0 {
+		reject(http.StatusNotFound, model.TransactionRejectReason_TRADE_DOESNT_EXIST)
+		return
+	}
+	units := math64abs(t.units)
+	if len(req.Units) > 0 && req.Units != "ALL" {
+		n, err := strconv.ParseFloat(req.Units, 64)
+		if err != nil || n <= 0 {
+			reject(http.StatusBadRequest, model.TransactionRejectReason_CLOSE_TRADE_PARTIAL_UNITS_MISSING)
+			return
+		}
+		if n > units {
+			reject(http.StatusBadRequest, model.TransactionRejectReason_CLOSE_TRADE_UNITS_EXCEED_TRADE_SIZE)
+			return
+		}
+		units = n
+	}
+	if t.units > 0 {
+		units = -units
+	}
+	closeUnits := req.Units
+	if len(closeUnits) == 0 {
+		closeUnits = "ALL"
+	}
+	tradeClose := &model.MarketOrderTradeClose{TradeID: t.Id, Units: closeUnits}
+	if t.ClientExtensions != nil {
+		tradeClose.ClientTradeID = string(t.ClientExtensions.ID)
+	}
+	create, rejected := a.submit(&orderSpec{
+		OrderRequestParser: model.OrderRequestParser{
+			Type:         string(model.OrderType_MARKET),
+			Instrument:   t.Instrument,
+			Units:        formatUnits(units),
+			TimeInForce:  model.TimeInForce_FOK,
+			PositionFill: model.OrderPositionFill_REDUCE_ONLY,
+		},
+		reason:     string(model.MarketOrderReason_TRADE_CLOSE),
+		trade:      t,
+		tradeClose: tradeClose,
+	})
+	if rejected != nil {
+		a.replyBatch(w, http.StatusBadRequest, map[string]interface{}{
+			"orderRejectTransaction": rejected,
+			"errorCode":              rejected.RejectReason,
+			"errorMessage":           "The Trade cannot be closed as requested",
+		})
+		return
+	}
+	fields := map[string]interface{}{"orderCreateTransaction": create}
+	set(fields, "orderFillTransaction", a.batchTx(string(model.TransactionType_ORDER_FILL), create.Id))
+	set(fields, "orderCancelTransaction", a.batchTx(string(model.TransactionType_ORDER_CANCEL), create.Id))
+	a.replyBatch(w, http.StatusOK, fields)
+}
+
+func (a *account) tradeClientExtensions(w http.ResponseWriter, r *http.Request, specifier string) {
+	req := &model.TradeClientExtensionsRequest{}
+	if err := readJSON(r, req); err != nil {
+		replyError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	a.begin()
+	t := a.findTrade(specifier)
+	if t == nil || t.units == 0 {
+		tx := a.newTx(string(model.TransactionType_TRADE_CLIENT_EXTENSIONS_MODIFY_REJECT))
+		tx.TradeClientExtensionsModify = req.ClientExtensions
+		tx.RejectReason = string(model.TransactionRejectReason_TRADE_DOESNT_EXIST)
+		a.record(tx)
+		a.replyBatch(w, http.StatusNotFound, map[string]interface{}{
+			"tradeClientExtensionsModifyRejectTransaction": tx,
+			"errorCode":    tx.RejectReason,
+			"errorMessage": "The Trade specified does not exist",
+		})
+		return
+	}
+	tx := a.newTx(string(model.TransactionType_TRADE_CLIENT_EXTENSIONS_MODIFY))
+	tx.TradeID = string(t.Id)
+	if t.ClientExtensions != nil {
+		tx.ClientTradeID = string(t.ClientExtensions.ID)
+	}
+	tx.TradeClientExtensionsModify = req.ClientExtensions
+	a.record(tx)
+	if req.ClientExtensions != nil {
+		t.ClientExtensions = req.ClientExtensions
+	}
+	a.replyBatch(w, http.StatusOK, map[string]interface{}{"tradeClientExtensionsModifyTransaction": tx})
+}
+
+// tradeModify creates, replaces and cancels the Take Profit and Stop Loss Orders of
+// a Trade. A null field cancels the Order, an absent field leaves it alone.
+func (a *account) tradeModify(w http.ResponseWriter, r *http.Request, specifier string) {
+	fields := make(map[string]json.RawMessage)
+	if err := readJSON(r, &fields); err != nil {
+		replyError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	if v, ok := fields["guaranteedStopLoss"]; ok && string(v) != "null" {
+		replyError(w, http.StatusBadRequest, "UNSUPPORTED_ORDER_TYPE", "The order type is not supported")
+		return
+	}
+	t := a.findTrade(specifier)
+	if t == nil || t.units == 0 {
+		replyError(w, http.StatusNotFound, string(model.TransactionRejectReason_TRADE_DOESNT_EXIST), "The Trade specified does not exist")
+		return
+	}
+
+	type change struct {
+		name     string
+		existing *order
+		spec     *orderSpec
+		present  bool
+	}
+	var changes []*change
+	names := map[model.OrderType]string{
+		model.OrderType_TAKE_PROFIT:        "takeProfit",
+		model.OrderType_STOP_LOSS:          "stopLoss",
+		model.OrderType_TRAILING_STOP_LOSS: "trailingStopLoss",
+	}
+	for _, typ := range []model.OrderType{model.OrderType_TAKE_PROFIT, model.OrderType_STOP_LOSS, model.OrderType_TRAILING_STOP_LOSS} {
+		c := &change{name: names[typ], existing: t.dependentOrder(string(typ))}
+		v, ok := fields[c.name]
+		c.present = ok
+		if ok && string(v) != "null" {
+			details := &model.StopLossDetails{}
+			if err := json.Unmarshal(v, details); err != nil {
+				replyError(w, http.StatusBadRequest, "", errInvalid(c.name).Error())
+				return
+			}
+			c.spec = &orderSpec{
+				OrderRequestParser: model.OrderRequestParser{
+					Type:             string(typ),
+					TradeID:          string(t.Id),
+					Price:            details.Price,
+					Distance:         details.Distance,
+					TimeInForce:      details.TimeInForce,
+					GtdTime:          details.GtdTime,
+					ClientExtensions: details.ClientExtensions,
+				},
+				trade:    t,
+				replaces: c.existing,
+			}
+			if typ == model.OrderType_TRAILING_STOP_LOSS {
+				c.spec.Price = ""
+			}
+			if c.existing != nil {
+				c.spec.reason = "REPLACEMENT"
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	a.begin()
+	var rejected bool
+	for _, c := range changes {
+		if c.spec != nil && len(a.validate(c.spec)) > 0 {
+			rejected = true
+		}
+	}
+	resp := make(map[string]interface{})
+	if rejected {
+		for _, c := range changes {
+			if c.spec != nil {
+				if _, reject := a.submit(c.spec); reject != nil {
+					resp[c.name+"OrderRejectTransaction"] = reject
+					resp["errorCode"] = reject.RejectReason
+				}
+			}
+		}
+		resp["errorMessage"] = "The Trade's dependent Orders cannot be modified as requested"
+		a.replyBatch(w, http.StatusBadRequest, resp)
+		return
+	}
+	for _, c := range changes {
+		if !c.present {
+			continue
+		}
+		if c.existing != nil {
+			reason, replacedBy := string(model.OrderCancelReason_CLIENT_REQUEST), ""
+			if c.spec != nil {
+				reason, replacedBy = string(model.OrderCancelReason_CLIENT_REQUEST_REPLACED), strconv.FormatInt(a.lastID+2, 10)
+			}
+			resp[c.name+"OrderCancelTransaction"] = a.cancel(c.existing, reason, replacedBy)
+		}
+		if c.spec != nil {
+			create, _ := a.submit(c.spec)
+			resp[c.name+"OrderTransaction"] = create
+			set(resp, c.name+"OrderFillTransaction", a.batchTx(string(model.TransactionType_ORDER_FILL), create.Id))
+			set(resp, c.name+"OrderCreatedCancelTransaction", a.batchTx(string(model.TransactionType_ORDER_CANCEL), create.Id))
+		}
+	}
+	a.replyBatch(w, http.StatusOK, resp)
+}
+
+func (a *account) positionClose(w http.ResponseWriter, r *http.Request, instrument model.InstrumentName) {
+	req := &model.PositionCloseRequest{}
+	if err := readJSON(r, req); err != nil {
+		replyError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	if _, ok := a.s.instruments[instrument]; !ok {
+		replyError(w, http.StatusNotFound, "", "The Instrument specified does not exist")
+		return
+	}
+	type side struct {
+		name       string
+		units      string
+		extensions *model.ClientExtensions
+		long       bool
+		open       float64
+		close      float64
+		reason     model.TransactionRejectReason
+	}
+	sides := []*side{
+		{name: "long", units: req.LongUnits, extensions: req.LongClientExtensions, long: true},
+		{name: "short", units: req.ShortUnits, extensions: req.ShortClientExtensions},
+	}
+	var closing, rejected bool
+	for _, s := range sides {
+		if len(s.units) == 0 || s.units == "NONE" {
+			continue
+		}
+		closing = true
+		for _, t := range a.openTrades(instrument) {
+			if (t.units > 0) == s.long {
+				s.open += math64abs(t.units)
+			}
+		}
+		switch {
+		case s.open == 0:
+			s.reason = model.TransactionRejectReason_CLOSEOUT_POSITION_DOESNT_EXIST
+		case s.units == "ALL":
+			s.close = s.open
+		default:
+			n, err := strconv.ParseFloat(s.units, 64)
+			switch {
+			case err != nil || n <= 0:
+				s.reason = model.TransactionRejectReason_CLOSEOUT_POSITION_PARTIAL_UNITS_MISSING
+			case n > s.open:
+				s.reason = model.TransactionRejectReason_CLOSEOUT_POSITION_UNITS_EXCEED_POSITION_SIZE
+			default:
+				s.close = n
+			}
+		}
+		rejected = rejected || len(s.reason) > 0
+	}
+	if !closing {
+		replyError(w, http.StatusBadRequest, string(model.TransactionRejectReason_CLOSEOUT_POSITION_INCOMPLETE_SPECIFICATION),
+			"The Position closeout specification is incomplete")
+		return
+	}
+
+	a.begin()
+	resp := make(map[string]interface{})
+	if rejected {
+		for _, s := range sides {
+			if len(s.reason) == 0 {
+				continue
+			}
+			tx := a.newTx(string(model.TransactionType_MARKET_ORDER_REJECT))
+			tx.Instrument = instrument
+			tx.Reason = string(model.MarketOrderReason_POSITION_CLOSEOUT)
+			tx.ClientExtensions = s.extensions
+			tx.RejectReason = string(s.reason)
+			closeout := &model.MarketOrderPositionCloseout{Instrument: instrument, Units: s.units}
+			if s.long {
+				tx.LongPositionCloseout = closeout
+			} else {
+				tx.ShortPositionCloseout = closeout
+			}
+			a.record(tx)
+			resp[s.name+"OrderRejectTransaction"] = tx
+			resp["errorCode"] = tx.RejectReason
+		}
+		resp["errorMessage"] = "The Position cannot be closed as requested"
+		code := http.StatusBadRequest
+		if resp["errorCode"] == string(model.TransactionRejectReason_CLOSEOUT_POSITION_DOESNT_EXIST) {
+			code = http.StatusNotFound
+		}
+		a.replyBatch(w, code, resp)
+		return
+	}
+	for _, s := range sides {
+		if s.close == 0 {
+			continue
+		}
+		units := s.close
+		if s.long {
+			units = -units
+		}
+		spec := &orderSpec{
+			OrderRequestParser: model.OrderRequestParser{
+				Type:             string(model.OrderType_MARKET),
+				Instrument:       instrument,
+				Units:            formatUnits(units),
+				TimeInForce:      model.TimeInForce_FOK,
+				PositionFill:     model.OrderPositionFill_REDUCE_ONLY,
+				ClientExtensions: s.extensions,
+			},
+			reason: string(model.MarketOrderReason_POSITION_CLOSEOUT),
+		}
+		closeout := &model.MarketOrderPositionCloseout{Instrument: instrument, Units: s.units}
+		if s.long {
+			spec.longCloseout = closeout
+		} else {
+			spec.shortCloseout = closeout
+		}
+		create, reject := a.submit(spec)
+		if reject != nil {
+			resp[s.name+"OrderRejectTransaction"] = reject
+			continue
+		}
+		resp[s.name+"OrderCreateTransaction"] = create
+		set(resp, s.name+"OrderFillTransaction", a.batchTx(string(model.TransactionType_ORDER_FILL), create.Id))
+		set(resp, s.name+"OrderCancelTransaction", a.batchTx(string(model.TransactionType_ORDER_CANCEL), create.Id))
+	}
+	a.replyBatch(w, http.StatusOK, resp)
+}
+
+// typeMatches reports whether the Transaction type passes the filter.
+func typeMatches(filters []string, typ string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		switch model.TransactionFilter(filter) {
+		case model.TransactionFilter_ORDER:
+			if strings.Contains(typ, "ORDER") {
+				return true
+			}
+		case model.TransactionFilter_FUNDING:
+			if strings.HasPrefix(typ, "TRANSFER_FUNDS") || typ == string(model.TransactionType_DAILY_FINANCING) {
+				return true
+			}
+		case model.TransactionFilter_ADMIN:
+			switch model.TransactionType(typ) {
+			case model.TransactionType_CREATE, model.TransactionType_CLOSE, model.TransactionType_REOPEN,
+				model.TransactionType_CLIENT_CONFIGURE, model.TransactionType_CLIENT_CONFIGURE_REJECT:
+				return true
+			}
+		default:
+			if filter == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *account) transactionRange(w http.ResponseWriter, from int64, to int64, types string) {
+	if from < 1 || to < from {
+		replyError(w, http.StatusBadRequest, "", errInvalid("from").Error())
+		return
+	}
+	filters := splitList(types)
+	resp := &model.TransactionsResponse{Transactions: []*model.TransactionParser{}, LastTransactionID: a.lastTransactionID()}
+	for _, tx := range a.transactions {
+		id, _ := strconv.ParseInt(tx.Id, 10, 64)
+		if id >= from && id <= to && typeMatches(filters, tx.Type) {
+			resp.Transactions = append(resp.Transactions, tx)
+		}
+	}
+	reply(w, http.StatusOK, resp)
+}
+
+// transactionPages lists the ID ranges of the Transactions within the time range.
+func (a *account) transactionPages(w http.ResponseWriter, q url.Values) {
+	pageSize := 100
+	if n, err := strconv.Atoi(q.Get("pageSize")); err == nil && n > 0 {
+		pageSize = n
+	}
+	from, to := a.created, a.s.now()
+	if v := q.Get("from"); len(v) > 0 {
+		t, err := model.DateTime(v).Parse()
+		if err != nil {
+			replyError(w, http.StatusBadRequest, "", errInvalid("from").Error())
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); len(v) > 0 {
+		t, err := model.DateTime(v).Parse()
+		if err != nil {
+			replyError(w, http.StatusBadRequest, "", errInvalid("to").Error())
+			return
+		}
+		to = t
+	}
+	filters := splitList(q.Get("type"))
+	var ids []string
+	for _, tx := range a.transactions {
+		t, _ := tx.Time.Parse()
+		if !t.Before(from) && !t.After(to) && typeMatches(filters, tx.Type) {
+			ids = append(ids, tx.Id)
+		}
+	}
+	resp := &model.TransactionsPagesResponse{
+		From:              formatTime(from),
+		To:                formatTime(to),
+		PageSize:          int64(pageSize),
+		Count:             int64(len(ids)),
+		Pages:             []string{},
+		LastTransactionID: a.lastTransactionID(),
+	}
+	for _, filter := range filters {
+		resp.Type = append(resp.Type, model.TransactionFilter(filter))
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		x, _ := strconv.ParseInt(ids[i], 10, 64)
+		y, _ := strconv.ParseInt(ids[j], 10, 64)
+		return x < y
+	})
+	for i := 0; i < len(ids); i += pageSize {
+		j := i + pageSize
+		if j > len(ids) {
+			j = len(ids)
+		}
+		page := a.s.URL() + "/v3/accounts/" + string(a.id) + "/transactions/idrange?from=" + ids[i] + "&to=" + ids[j-1]
+		if len(filters) > 0 {
+			page += "&type=" + strings.Join(filters, ",")
+		}
+		resp.Pages = append(resp.Pages, page)
+	}
+	reply(w, http.StatusOK, resp)
+}
+
+func math64abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,732 @@
+// Package oandatest provides a fake of the OANDA v20 REST and streaming APIs for
+// testing without credentials or network access.
+//
+//	srv := oandatest.NewServer()
+//	defer srv.Close()
+//	srv.AddAccount("101-001-1-001", "USD", 100000)
+//	srv.Quote(oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1, Ask: 1.1002})
+//	conn := srv.Connect()
+package oandatest
+
+import (
+	"encoding/json"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHeartbeat is the interval of the heartbeats sent on streams.
+	DefaultHeartbeat = 5 * time.Second
+	// DefaultLiquidity is the liquidity of prices that do not set one.
+	DefaultLiquidity = 10000000
+	// Hour of the daily financing rollover in New York time.
+	rolloverHour = 17
+	// Format of the times the server sends.
+	timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+var newYork = model.NewYork()
+
+// Tick is a price of an instrument. The Time defaults to the current time and the
+// Liquidity, the units available on each side, to DefaultLiquidity.
+type Tick struct {
+	Instrument model.InstrumentName
+	Time       time.Time
+	Bid        float64
+	Ask        float64
+	Liquidity  int64
+}
+
+// StreamTick converts a price of the pricing stream. The liquidity is the smaller of
+// the liquidity of the best bid and ask. It returns false for heartbeats and prices
+// without a bid or an ask.
+func StreamTick(price *model.StreamClientPrice) (Tick, bool) {
+	if price == nil || price.IsHeartbeat || len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return Tick{}, false
+	}
+	liquidity := price.Bids[0].Liquidity
+	if price.Asks[0].Liquidity < liquidity {
+		liquidity = price.Asks[0].Liquidity
+	}
+	return Tick{
+		Instrument: model.InstrumentName(price.Instrument),
+		Time:       price.Time,
+		Bid:        price.Bids[0].Price,
+		Ask:        price.Asks[0].Price,
+		Liquidity:  liquidity,
+	}, true
+}
+
+type candleKey struct {
+	instrument  model.InstrumentName
+	granularity model.CandlestickGranularity
+}
+
+// Server is an httptest server that serves the endpoints of endpoint.Connection from
+// memory. Orders are matched against the prices supplied with Quote or scripted with
+// Script: market orders fill at the current price, limit and stop orders as well as
+// the take profit, stop loss and trailing stop loss orders of trades fill once a price
+// crosses them. Every Transaction is also sent on the transaction streams of its
+// Account.
+//
+// Accounts are not hedging and close trades first in first out. Fill or kill and
+// immediate or cancel orders are limited by the liquidity of the price, the other
+// orders fill in full. Open trades are financed daily at 17:00 New York time with
+// the rates of their instrument and positions are closed out once the margin
+// closeout percent reaches 100%.
+type Server struct {
+	srv         *httptest.Server
+	heartbeat   time.Duration
+	accounts    map[model.AccountID]*account
+	accountIDs  []model.AccountID
+	instruments map[model.InstrumentName]*model.Instrument
+	names       []model.InstrumentName
+	prices      map[model.InstrumentName]*model.ClientPrice
+	script      []Tick
+	candles     map[candleKey][]*model.Candlestick
+	pricing     map[*subscriber]struct{}
+	clock       time.Time
+	done        chan struct{}
+	closed      bool
+	mu          sync.Mutex
+}
+
+// NewServer starts a Server without accounts or prices.
+func NewServer() *Server {
+	s := &Server{
+		heartbeat:   DefaultHeartbeat,
+		accounts:    make(map[model.AccountID]*account),
+		instruments: make(map[model.InstrumentName]*model.Instrument),
+		prices:      make(map[model.InstrumentName]*model.ClientPrice),
+		candles:     make(map[candleKey][]*model.Candlestick),
+		pricing:     make(map[*subscriber]struct{}),
+		done:        make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(s)
+	return s
+}
+
+// TestAccount is the Account opened by NewTestServer.
+const TestAccount model.AccountID = "101-001-1-001"
+
+// NewTestServer starts a Server, applies the prices and opens TestAccount with the
+// balance in USD.
+func NewTestServer(balance float64, ticks ...Tick) *Server {
+	s := NewServer()
+	s.Quote(ticks...)
+	s.AddAccount(TestAccount, "USD", balance)
+	return s
+}
+
+// URL is the base URL of both the REST and the streaming endpoints.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Connect returns a Connection to the Server.
+func (s *Server) Connect() *endpoint.Connection {
+	conn, err := endpoint.NewConnectionURL("token", s.URL(), s.URL())
+	if err != nil {
+		// The URL of an httptest server is always valid
+		panic(err)
+	}
+	return conn
+}
+
+// WithHeartbeat sets the heartbeat interval of streams opened afterwards.
+func (s *Server) WithHeartbeat(heartbeat time.Duration) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	s.heartbeat = heartbeat
+	return s
+}
+
+// Close ends every open stream and shuts the server down.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+	s.srv.Close()
+}
+
+// AddAccount opens an Account with the home currency and deposits the balance.
+func (s *Server) AddAccount(id model.AccountID, currency model.Currency, balance float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[id]; ok {
+		return
+	}
+	a := newAccount(s, id, currency)
+	s.accounts[id] = a
+	s.accountIDs = append(s.accountIDs, id)
+	a.begin()
+	tx := a.newTx(string(model.TransactionType_CREATE))
+	tx.HomeCurrency = currency
+	a.record(tx)
+	if balance > 0 {
+		a.balance = balance
+		tx = a.newTx(string(model.TransactionType_TRANSFER_FUNDS))
+		tx.Amount = formatAccountUnits(balance)
+		tx.FundingReason = "CLIENT_FUNDING"
+		tx.AccountBalance = formatAccountUnits(balance)
+		a.record(tx)
+	}
+}
+
+// AddInstrument makes the instrument tradeable. Instruments quoted without being
+// added are tradeable currency pairs with a margin rate of 0.02.
+func (s *Server) AddInstrument(instrument *model.Instrument) {
+	if instrument == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addInstrument(instrument)
+}
+
+func (s *Server) addInstrument(instrument *model.Instrument) {
+	if _, ok := s.instruments[instrument.Name]; !ok {
+		s.names = append(s.names, instrument.Name)
+	}
+	s.instruments[instrument.Name] = instrument
+}
+
+func defaultInstrument(name model.InstrumentName) *model.Instrument {
+	var (
+		pip       int64 = -4
+		precision int64 = 5
+	)
+	if strings.HasSuffix(string(name), "_JPY") {
+		pip, precision = -2, 3
+	}
+	return &model.Instrument{
+		Name:                name,
+		Type:                model.InstrumentType_CURRENCY,
+		DisplayName:         strings.Replace(string(name), "_", "/", 1),
+		PipLocation:         pip,
+		DisplayPrecision:    precision,
+		TradeUnitsPrecision: 0,
+		MinimumTradeSize:    "1",
+		MaximumPositionSize: "0",
+		MaximumOrderUnits:   "100000000",
+		MarginRate:          "0.02",
+	}
+}
+
+// Quote applies the prices in order. Every price fills the pending orders it
+// crosses and is sent on the pricing streams.
+func (s *Server) Quote(ticks ...Tick) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tick := range ticks {
+		s.apply(tick)
+	}
+}
+
+// Script queues prices to apply later with Step or Play.
+func (s *Server) Script(ticks ...Tick) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, ticks...)
+}
+
+// Step applies the next scripted price and reports whether there was one.
+func (s *Server) Step() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.script) == 0 {
+		return false
+	}
+	tick := s.script[0]
+	s.script = s.script[1:]
+	s.apply(tick)
+	return true
+}
+
+// Play applies every remaining scripted price.
+func (s *Server) Play() {
+	for s.Step() {
+	}
+}
+
+func (s *Server) apply(tick Tick) {
+	if tick.Time.IsZero() {
+		tick.Time = time.Now()
+	}
+	tick.Time = tick.Time.UTC()
+	if tick.Liquidity <= 0 {
+		tick.Liquidity = DefaultLiquidity
+	}
+	if tick.Time.After(s.clock) {
+		if !s.clock.IsZero() {
+			s.finance(s.clock, tick.Time)
+		}
+		s.clock = tick.Time
+	}
+	instrument, ok := s.instruments[tick.Instrument]
+	if !ok {
+		instrument = defaultInstrument(tick.Instrument)
+		s.addInstrument(instrument)
+	}
+	price := &model.ClientPrice{
+		Type:        "PRICE",
+		Instrument:  tick.Instrument,
+		Time:        formatTime(tick.Time),
+		Tradeable:   true,
+		Bids:        []model.PriceBucket{{Price: formatPrice(instrument, tick.Bid), Liquidity: tick.Liquidity}},
+		Asks:        []model.PriceBucket{{Price: formatPrice(instrument, tick.Ask), Liquidity: tick.Liquidity}},
+		CloseoutBid: formatPrice(instrument, tick.Bid),
+		CloseoutAsk: formatPrice(instrument, tick.Ask),
+	}
+	s.prices[tick.Instrument] = price
+	for _, id := range s.accountIDs {
+		s.accounts[id].match(tick.Instrument)
+		s.accounts[id].closeout()
+	}
+	if len(s.pricing) > 0 {
+		b, err := price.MarshalJSON()
+		if err == nil {
+			for sub := range s.pricing {
+				if sub.instruments[tick.Instrument] {
+					sub.send(b)
+				}
+			}
+		}
+	}
+}
+
+// finance applies the daily financing of the rollovers after from up to to.
+func (s *Server) finance(from time.Time, to time.Time) {
+	ny := from.In(newYork)
+	rollover := time.Date(ny.Year(), ny.Month(), ny.Day(), rolloverHour, 0, 0, 0, newYork)
+	if !rollover.After(from) {
+		rollover = rollover.AddDate(0, 0, 1)
+	}
+	for ; !rollover.After(to); rollover = rollover.AddDate(0, 0, 1) {
+		for _, id := range s.accountIDs {
+			s.accounts[id].finance(rollover)
+		}
+	}
+}
+
+// Price returns a copy of the current price of the instrument or nil if it has not
+// been quoted.
+func (s *Server) Price(instrument model.InstrumentName) *model.ClientPrice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price := s.prices[instrument]
+	if price == nil {
+		return nil
+	}
+	p := *price
+	return &p
+}
+
+// Transactions returns the Transactions of the Account after the Transaction ID
+// without going through the API.
+func (s *Server) Transactions(id model.AccountID, since model.TransactionID) []*model.TransactionParser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.accounts[id]
+	if a == nil {
+		return nil
+	}
+	n, _ := strconv.ParseInt(string(since), 10, 64)
+	if n < 0 || n >= int64(len(a.transactions)) {
+		return nil
+	}
+	txs := make([]*model.TransactionParser, len(a.transactions)-int(n))
+	copy(txs, a.transactions[n:])
+	return txs
+}
+
+// SetCandles replaces the candles served for the instrument and granularity. The
+// candles must be in chronological order.
+func (s *Server) SetCandles(
+	instrument model.InstrumentName,
+	granularity model.CandlestickGranularity,
+	candles ...*model.Candlestick,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.candles[candleKey{instrument: instrument, granularity: granularity}] = candles
+}
+
+// now is the time of the latest price or the current time if there is none.
+func (s *Server) now() time.Time {
+	if s.clock.IsZero() {
+		return time.Now().UTC()
+	}
+	return s.clock
+}
+
+// quote returns the bid and ask of the instrument.
+func (s *Server) quote(instrument model.InstrumentName) (bid float64, ask float64, ok bool) {
+	price := s.prices[instrument]
+	if price == nil || len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return 0, 0, false
+	}
+	return price.Bids[0].Price.AsFloat64(0), price.Asks[0].Price.AsFloat64(0), true
+}
+
+// liquidity returns the units available at the current price of the instrument to
+// buy or to sell.
+func (s *Server) liquidity(instrument model.InstrumentName, buy bool) float64 {
+	price := s.prices[instrument]
+	if price == nil {
+		return 0
+	}
+	buckets := price.Bids
+	if buy {
+		buckets = price.Asks
+	}
+	if len(buckets) == 0 {
+		return 0
+	}
+	return float64(buckets[0].Liquidity)
+}
+
+// conversion returns the factor that converts amounts of the currency into the home
+// currency at mid prices, or 1 if there is no price to convert with.
+func (s *Server) conversion(currency model.Currency, home model.Currency) float64 {
+	if currency == home {
+		return 1
+	}
+	if bid, ask, ok := s.quote(model.InstrumentName(currency + "_" + home)); ok {
+		return (bid + ask) / 2
+	}
+	if bid, ask, ok := s.quote(model.InstrumentName(home + "_" + currency)); ok && bid+ask > 0 {
+		return 2 / (bid + ask)
+	}
+	return 1
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		replyError(w, http.StatusUnauthorized, "", "Insufficient authorization to perform request.")
+		return
+	}
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(p) < 2 || p[0] != "v3" {
+		replyError(w, http.StatusNotFound, "", "Not found")
+		return
+	}
+	p = p[1:]
+
+	// Streams are served without holding the lock
+	if r.Method == http.MethodGet && match(p, "accounts", "*", "pricing", "stream") {
+		s.streamPricing(w, r, model.AccountID(p[1]))
+		return
+	}
+	if r.Method == http.MethodGet && match(p, "accounts", "*", "transactions", "stream") {
+		s.streamTransactions(w, r, model.AccountID(p[1]))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && match(p, "accounts"):
+		resp := &model.AccountsResponse{Accounts: make([]*model.AccountProperties, 0, len(s.accountIDs))}
+		for _, id := range s.accountIDs {
+			resp.Accounts = append(resp.Accounts, &model.AccountProperties{ID: id, Tags: []string{}})
+		}
+		reply(w, http.StatusOK, resp)
+
+	case len(p) > 1 && p[0] == "accounts":
+		a := s.accounts[model.AccountID(p[1])]
+		if a == nil {
+			replyError(w, http.StatusNotFound, "", "The Account specified does not exist.")
+			return
+		}
+		a.serve(w, r, p[2:])
+
+	case r.Method == http.MethodGet && match(p, "instruments", "*", "candles"):
+		s.serveCandles(w, r, model.InstrumentName(p[1]), false)
+
+	case r.Method == http.MethodGet && match(p, "instruments", "*", "orderBook"):
+		resp := &model.OrderBookResponse{OrderBook: &model.OrderBook{}}
+		s.book(model.InstrumentName(p[1]), (*bookFields)(resp.OrderBook))
+		reply(w, http.StatusOK, resp)
+
+	case r.Method == http.MethodGet && match(p, "instruments", "*", "positionBook"):
+		resp := &model.PositionBookResponse{PositionBook: &model.PositionBook{}}
+		s.book(model.InstrumentName(p[1]), (*bookFields)(resp.PositionBook))
+		reply(w, http.StatusOK, resp)
+
+	default:
+		replyError(w, http.StatusNotFound, "", "Not found")
+	}
+}
+
+type bookFields model.OrderBook
+
+// book fills an empty order or position book around the current price.
+func (s *Server) book(instrument model.InstrumentName, book *bookFields) {
+	book.Instrument = instrument
+	book.Time = formatTime(s.now())
+	book.Buckets = []*model.OrderBookBucket{}
+	if i := s.instruments[instrument]; i != nil {
+		if bid, ask, ok := s.quote(instrument); ok {
+			book.Price = formatPrice(i, (bid+ask)/2)
+		}
+		book.BucketWidth = model.PriceValue(strconv.FormatFloat(pipSize(i), 'f', -1, 64))
+	}
+}
+
+// serveCandles serves the scripted candles filtered by the query of an instrument
+// candles request.
+func (s *Server) serveCandles(w http.ResponseWriter, r *http.Request, instrument model.InstrumentName, account bool) {
+	q := r.URL.Query()
+	granularity := model.CandlestickGranularity(q.Get("granularity"))
+	if len(granularity) == 0 {
+		granularity = model.CandlestickGranularity_S5
+	}
+	candles, err := s.selectCandles(instrument, granularity, q.Get("price"), q.Get("from"), q.Get("to"), q.Get("count"), q.Get("includeFirst") != "false")
+	if err != nil {
+		replyError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	if account {
+		reply(w, http.StatusOK, &model.PricingCandlesResponse{Instrument: instrument, Granularity: granularity, Candles: candles})
+	} else {
+		reply(w, http.StatusOK, &model.CandlestickResponse{Instrument: instrument, Granularity: granularity, Candles: candles})
+	}
+}
+
+func (s *Server) selectCandles(
+	instrument model.InstrumentName,
+	granularity model.CandlestickGranularity,
+	price string,
+	from string,
+	to string,
+	count string,
+	includeFirst bool,
+) ([]*model.Candlestick, error) {
+	n := 500
+	if len(count) > 0 {
+		var err error
+		if n, err = strconv.Atoi(count); err != nil || n > 5000 {
+			return nil, errInvalid("count")
+		}
+		if n < 1 {
+			n = 500
+		}
+	}
+	var fromTime, toTime time.Time
+	if len(from) > 0 {
+		t, err := model.DateTime(from).Parse()
+		if err != nil {
+			return nil, errInvalid("from")
+		}
+		fromTime = t
+	}
+	if len(to) > 0 {
+		t, err := model.DateTime(to).Parse()
+		if err != nil {
+			return nil, errInvalid("to")
+		}
+		toTime = t
+	}
+
+	all := s.candles[candleKey{instrument: instrument, granularity: granularity}]
+	selected := make([]*model.Candlestick, 0, len(all))
+	for _, c := range all {
+		t, _ := c.Time.Parse()
+		if !fromTime.IsZero() && (t.Before(fromTime) || (!includeFirst && t.Equal(fromTime))) {
+			continue
+		}
+		if !toTime.IsZero() && !t.Before(toTime) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+	if len(from) == 0 || len(to) == 0 {
+		if len(selected) > n {
+			if len(from) > 0 {
+				selected = selected[:n]
+			} else {
+				selected = selected[len(selected)-n:]
+			}
+		}
+	}
+
+	if len(price) == 0 {
+		price = string(model.PricingComponent_MID)
+	}
+	result := make([]*model.Candlestick, len(selected))
+	for i, c := range selected {
+		candle := *c
+		if !strings.Contains(price, "B") {
+			candle.Bid = nil
+		}
+		if !strings.Contains(price, "A") {
+			candle.Ask = nil
+		}
+		if !strings.Contains(price, "M") {
+			candle.Mid = nil
+		}
+		result[i] = &candle
+	}
+	return result, nil
+}
+
+func (s *Server) latestCandles(specs string) *model.CandlesLatestResponse {
+	resp := &model.CandlesLatestResponse{LatestCandles: []*model.CandlestickResponse{}}
+	for _, spec := range strings.Split(specs, ",") {
+		if len(spec) == 0 {
+			continue
+		}
+		instrument, granularity, price := model.CandleSpecification(spec).Parse()
+		candles, _ := s.selectCandles(instrument, model.CandlestickGranularity(granularity), string(price), "", "", "2", true)
+		resp.LatestCandles = append(resp.LatestCandles, &model.CandlestickResponse{
+			Instrument:  instrument,
+			Granularity: model.CandlestickGranularity(granularity),
+			Candles:     candles,
+		})
+	}
+	return resp
+}
+
+func (s *Server) pricingResponse(instruments []string, since string, conversions bool, home model.Currency) (*model.PricingResponse, error) {
+	resp := &model.PricingResponse{Prices: []*model.ClientPrice{}, Time: formatTime(s.now())}
+	var sinceTime time.Time
+	if len(since) > 0 {
+		t, err := model.DateTime(since).Parse()
+		if err != nil {
+			return nil, errInvalid("since")
+		}
+		sinceTime = t
+	}
+	currencies := make(map[model.Currency]bool)
+	for _, name := range instruments {
+		instrument := model.InstrumentName(name)
+		if _, ok := s.instruments[instrument]; !ok {
+			return nil, errInvalid("instruments")
+		}
+		if base, quote, ok := splitInstrument(instrument); ok {
+			currencies[base] = true
+			currencies[quote] = true
+		}
+		price := s.prices[instrument]
+		if price == nil {
+			continue
+		}
+		if !sinceTime.IsZero() {
+			if t, _ := price.Time.Parse(); !t.After(sinceTime) {
+				continue
+			}
+		}
+		p := *price
+		resp.Prices = append(resp.Prices, &p)
+	}
+	if conversions {
+		names := make([]string, 0, len(currencies))
+		for currency := range currencies {
+			names = append(names, string(currency))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			factor := model.DecimalNumber(strconv.FormatFloat(s.conversion(model.Currency(name), home), 'f', 8, 64))
+			resp.HomeConversions = append(resp.HomeConversions, &model.HomeConversions{
+				Currency:      model.Currency(name),
+				AccountGain:   factor,
+				AccountLoss:   factor,
+				PositionValue: factor,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// match reports whether the path segments equal the pattern where "*" matches any
+// segment.
+func match(p []string, pattern ...string) bool {
+	if len(p) != len(pattern) {
+		return false
+	}
+	for i := range p {
+		if pattern[i] != "*" && pattern[i] != p[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, code int, resp interface{}) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		replyError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
+
+type errorResponse struct {
+	ErrorCode    string `json:"errorCode,omitempty"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+func replyError(w http.ResponseWriter, code int, errorCode string, message string) {
+	b, _ := json.Marshal(&errorResponse{ErrorCode: errorCode, ErrorMessage: message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
+
+type errInvalid string
+
+func (e errInvalid) Error() string {
+	return "Invalid value specified for '" + string(e) + "'"
+}
+
+func formatTime(t time.Time) model.DateTime {
+	return model.DateTime(t.UTC().Format(timeFormat))
+}
+
+func formatPrice(instrument *model.Instrument, v float64) model.PriceValue {
+	precision := 5
+	if instrument != nil && instrument.DisplayPrecision > 0 {
+		precision = int(instrument.DisplayPrecision)
+	}
+	return model.PriceValue(strconv.FormatFloat(v, 'f', precision, 64))
+}
+
+func formatUnits(v float64) model.DecimalNumber {
+	return model.DecimalNumber(strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func formatAccountUnits(v float64) model.AccountUnits {
+	return model.AccountUnits(strconv.FormatFloat(v, 'f', 4, 64))
+}
+
+func pipSize(instrument *model.Instrument) float64 {
+	size := 1.0
+	for i := instrument.PipLocation; i < 0; i++ {
+		size /= 10
+	}
+	return size
+}
+
+func splitInstrument(instrument model.InstrumentName) (base model.Currency, quote model.Currency, ok bool) {
+	i := strings.IndexByte(string(instrument), '_')
+	if i < 1 || i == len(instrument)-1 {
+		return "", "", false
+	}
+	return model.Currency(instrument[:i]), model.Currency(instrument[i+1:]), true
+}
@@ -0,0 +1,602 @@
+package oandatest
+
+import (
+	"bytes"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*Server, *endpoint.Connection) {
+	s := NewTestServer(10000, Tick{Instrument: "EUR_USD", Bid: 1.1000, Ask: 1.1002})
+	t.Cleanup(s.Close)
+	return s, s.Connect()
+}
+
+func expectNear(t *testing.T, name string, got float64, expected float64) {
+	t.Helper()
+	if math.Abs(got-expected) > 1e-6 {
+		t.Fatalf("%s: expected %v got %v", name, expected, got)
+	}
+}
+
+func marketOrder(instrument model.InstrumentName, units string) *model.MarketOrderRequest {
+	return &model.MarketOrderRequest{
+		Type:       model.OrderType_MARKET,
+		Instrument: instrument,
+		Units:      model.DecimalNumber(units),
+	}
+}
+
+func TestServerAccounts(t *testing.T) {
+	_, c := newTestServer(t)
+	accounts, err := c.Accounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts.Accounts) != 1 || accounts.Accounts[0].ID != TestAccount {
+		t.Fatalf("unexpected accounts %v", accounts.Accounts)
+	}
+	summary, err := c.AccountSummary(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNear(t, "balance", model.DecimalNumber(summary.Account.Balance).AsFloat64(0), 10000)
+	if summary.LastTransactionID != "2" {
+		t.Fatalf("expected last transaction 2 got %s", summary.LastTransactionID)
+	}
+	if _, _, err = c.AccountConfigure(TestAccount, &model.AccountConfigurationRequest{Alias: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	account, err := c.Account(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Alias != "test" {
+		t.Fatalf("expected alias test got %q", account.Alias)
+	}
+	if _, err = c.AccountSummary("101-001-1-002"); err == nil {
+		t.Fatal("expected an error for an unknown account")
+	}
+}
+
+func TestServerMarketOrder(t *testing.T) {
+	s, c := newTestServer(t)
+	resp, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "1000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill := resp.OrderFillTransaction
+	if fill == nil || fill.TradeOpened == nil {
+		t.Fatalf("expected a fill opening a trade got %+v", resp)
+	}
+	expectNear(t, "fill price", fill.Price.AsFloat64(0), 1.1002)
+
+	s.Quote(Tick{Instrument: "EUR_USD", Bid: 1.1050, Ask: 1.1052})
+	closed, _, err := c.TradeClose(TestAccount, model.TradeSpecifier(fill.TradeOpened.TradeID), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.OrderFillTransaction == nil || len(closed.OrderFillTransaction.TradesClosed) != 1 {
+		t.Fatalf("expected the trade to close got %+v", closed)
+	}
+	expectNear(t, "pl", model.DecimalNumber(closed.OrderFillTransaction.Pl).AsFloat64(0), 4.8)
+
+	summary, err := c.AccountSummary(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNear(t, "balance", model.DecimalNumber(summary.Account.Balance).AsFloat64(0), 10004.8)
+	if summary.Account.OpenTradeCount != 0 {
+		t.Fatalf("expected no open trades got %d", summary.Account.OpenTradeCount)
+	}
+}
+
+func TestServerOrderReject(t *testing.T) {
+	_, c := newTestServer(t)
+	_, reject, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "0"))
+	if err == nil || reject == nil || reject.OrderRejectTransaction == nil {
+		t.Fatalf("expected a reject got %v %v", reject, err)
+	}
+	if reject.OrderRejectTransaction.RejectReason != string(model.TransactionRejectReason_UNITS_INVALID) {
+		t.Fatalf("expected UNITS_INVALID got %s", reject.OrderRejectTransaction.RejectReason)
+	}
+	resp, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "100000000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.OrderCancelTransaction == nil || resp.OrderCancelTransaction.Reason != model.OrderCancelReason_INSUFFICIENT_MARGIN {
+		t.Fatalf("expected the order to be cancelled for insufficient margin got %+v", resp.OrderCancelTransaction)
+	}
+}
+
+func TestServerLimitOrder(t *testing.T) {
+	s, c := newTestServer(t)
+	resp, _, err := c.OrderCreate(TestAccount, &model.LimitOrderRequest{
+		Type:       model.OrderType_LIMIT,
+		Instrument: "EUR_USD",
+		Units:      "-1000",
+		Price:      "1.1050",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.OrderFillTransaction != nil {
+		t.Fatal("expected the limit order to rest")
+	}
+	pending, err := c.OrdersPending(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending.Orders) != 1 {
+		t.Fatalf("expected 1 pending order got %d", len(pending.Orders))
+	}
+
+	s.Script(
+		Tick{Instrument: "EUR_USD", Bid: 1.1040, Ask: 1.1042},
+		Tick{Instrument: "EUR_USD", Bid: 1.1051, Ask: 1.1053},
+	)
+	s.Step()
+	if trades, _ := c.TradesOpen(TestAccount); len(trades.Trades) != 0 {
+		t.Fatal("expected the limit order not to fill yet")
+	}
+	s.Play()
+	trades, err := c.TradesOpen(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades.Trades) != 1 || trades.Trades[0].CurrentUnits.AsFloat64(0) != -1000 {
+		t.Fatalf("expected a short trade got %+v", trades.Trades)
+	}
+	expectNear(t, "price", trades.Trades[0].Price.AsFloat64(0), 1.1051)
+
+	cancelled, err := c.Orders(TestAccount, &model.OrdersRequest{State: model.OrderStateFilter_FILLED})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelled.Orders) != 1 {
+		t.Fatalf("expected 1 filled order got %d", len(cancelled.Orders))
+	}
+}
+
+func TestServerTakeProfitStopLoss(t *testing.T) {
+	s, c := newTestServer(t)
+	order := marketOrder("EUR_USD", "1000")
+	order.TakeProfitOnFill = &model.TakeProfitDetails{Price: "1.1100"}
+	resp, _, err := c.OrderCreate(TestAccount, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tradeID := model.TradeSpecifier(resp.OrderFillTransaction.TradeOpened.TradeID)
+
+	// Dependent orders left out of the request are cancelled
+	modify, _, err := c.TradeModify(TestAccount, tradeID, &model.TradeModifyRequest{
+		TakeProfit: &model.TakeProfitDetails{Price: "1.1120"},
+		StopLoss:   &model.StopLossDetails{Distance: "0.0050"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modify.StopLossOrderTransaction == nil || modify.TakeProfitOrderCancelTransaction == nil {
+		t.Fatal("expected a stop loss order and the take profit to be replaced")
+	}
+	expectNear(t, "stop loss", modify.StopLossOrderTransaction.Price.AsFloat64(0), 1.0952)
+
+	pending, err := c.OrdersPending(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending.Orders) != 2 {
+		t.Fatalf("expected take profit and stop loss got %d orders", len(pending.Orders))
+	}
+
+	s.Quote(Tick{Instrument: "EUR_USD", Bid: 1.0950, Ask: 1.0952})
+	trade, err := c.Trade(TestAccount, tradeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Trade.State != model.TradeState_CLOSED {
+		t.Fatalf("expected the stop loss to close the trade got %s", trade.Trade.State)
+	}
+	expectNear(t, "realized", model.DecimalNumber(trade.Trade.RealizedPL).AsFloat64(0), -5.2)
+	if pending, _ = c.OrdersPending(TestAccount); len(pending.Orders) != 0 {
+		t.Fatalf("expected the take profit to be cancelled got %d orders", len(pending.Orders))
+	}
+}
+
+func TestServerPositionClose(t *testing.T) {
+	_, c := newTestServer(t)
+	for _, units := range []string{"1000", "2000"} {
+		if _, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", units)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	position, err := c.Position(TestAccount, "EUR_USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNear(t, "long units", position.Position.Long.Units.AsFloat64(0), 3000)
+
+	_, reject, err := c.PositionClose(TestAccount, "EUR_USD", &model.PositionCloseRequest{ShortUnits: "ALL"})
+	if err == nil || reject == nil {
+		t.Fatal("expected a reject closing a short position that does not exist")
+	}
+	resp, _, err := c.PositionClose(TestAccount, "EUR_USD", &model.PositionCloseRequest{LongUnits: "ALL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.LongOrderFillTransaction == nil || len(resp.LongOrderFillTransaction.TradesClosed) != 2 {
+		t.Fatalf("expected both trades to close got %+v", resp.LongOrderFillTransaction)
+	}
+	open, err := c.PositionsOpen(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open.Positions) != 0 {
+		t.Fatalf("expected no open positions got %d", len(open.Positions))
+	}
+}
+
+func TestServerTrailingStopLoss(t *testing.T) {
+	s, c := newTestServer(t)
+	order := marketOrder("EUR_USD", "1000")
+	order.TrailingStopLossOnFill = &model.TrailingStopLossDetails{Distance: "0.0020"}
+	resp, _, err := c.OrderCreate(TestAccount, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tradeID := model.TradeSpecifier(resp.OrderFillTransaction.TradeOpened.TradeID)
+
+	// The stop follows the bid up but not down
+	s.Quote(
+		Tick{Instrument: "EUR_USD", Bid: 1.1050, Ask: 1.1052},
+		Tick{Instrument: "EUR_USD", Bid: 1.1040, Ask: 1.1042},
+	)
+	trade, err := c.Trade(TestAccount, tradeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Trade.TrailingStopLossOrder == nil {
+		t.Fatal("expected a trailing stop loss order")
+	}
+	expectNear(t, "trailing stop", trade.Trade.TrailingStopLossOrder.TrailingStopValue.AsFloat64(0), 1.1030)
+
+	s.Quote(Tick{Instrument: "EUR_USD", Bid: 1.1030, Ask: 1.1032})
+	if trade, err = c.Trade(TestAccount, tradeID); err != nil {
+		t.Fatal(err)
+	}
+	if trade.Trade.State != model.TradeState_CLOSED {
+		t.Fatalf("expected the trailing stop to close the trade got %s", trade.Trade.State)
+	}
+	expectNear(t, "realized", model.DecimalNumber(trade.Trade.RealizedPL).AsFloat64(0), 2.8)
+}
+
+func TestServerLiquidity(t *testing.T) {
+	s, c := newTestServer(t)
+	s.Quote(Tick{Instrument: "EUR_USD", Bid: 1.1000, Ask: 1.1002, Liquidity: 1000})
+
+	order := marketOrder("EUR_USD", "3000")
+	order.TimeInForce = model.TimeInForce_IOC
+	resp, _, err := c.OrderCreate(TestAccount, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.OrderFillTransaction == nil || resp.OrderFillTransaction.Units.AsFloat64(0) != 1000 {
+		t.Fatalf("expected 1000 units to fill got %+v", resp.OrderFillTransaction)
+	}
+	if resp.OrderCancelTransaction == nil || resp.OrderCancelTransaction.Reason != model.OrderCancelReason_INSUFFICIENT_LIQUIDITY {
+		t.Fatalf("expected the rest to be cancelled got %+v", resp.OrderCancelTransaction)
+	}
+
+	if resp, _, err = c.OrderCreate(TestAccount, marketOrder("EUR_USD", "3000")); err != nil {
+		t.Fatal(err)
+	}
+	if resp.OrderFillTransaction != nil || resp.OrderCancelTransaction == nil ||
+		resp.OrderCancelTransaction.Reason != model.OrderCancelReason_INSUFFICIENT_LIQUIDITY {
+		t.Fatal("expected the fill or kill order to be cancelled")
+	}
+}
+
+func TestServerFinancing(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewTestServer(10000, Tick{Instrument: "EUR_USD", Time: start, Bid: 1.0999, Ask: 1.1001})
+	t.Cleanup(s.Close)
+	instrument := defaultInstrument("EUR_USD")
+	instrument.Financing = &model.InstrumentFinancing{LongRate: "-0.0365", ShortRate: "0.0100"}
+	s.AddInstrument(instrument)
+	c := s.Connect()
+	if _, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "10000")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two rollovers at 1.1 charge 10000 * 1.1 * 0.0365 / 365 each
+	s.Quote(Tick{Instrument: "EUR_USD", Time: start.Add(48 * time.Hour), Bid: 1.0999, Ask: 1.1001})
+	summary, err := c.AccountSummary(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNear(t, "financing", model.DecimalNumber(summary.Account.Financing).AsFloat64(0), -2.2)
+	expectNear(t, "balance", model.DecimalNumber(summary.Account.Balance).AsFloat64(0), 9997.8)
+	var charges int
+	for _, tx := range s.Transactions(TestAccount, "0") {
+		if tx.Type == string(model.TransactionType_DAILY_FINANCING) {
+			charges++
+		}
+	}
+	if charges != 2 {
+		t.Fatalf("expected 2 daily financing transactions got %d", charges)
+	}
+}
+
+func TestServerFinancingRollover(t *testing.T) {
+	for _, test := range []struct {
+		start    time.Time
+		rollover time.Time
+	}{
+		// 17:00 New York is 22:00 UTC in winter and 21:00 UTC in summer
+		{time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC), time.Date(2021, 1, 4, 22, 0, 0, 0, time.UTC)},
+		{time.Date(2021, 7, 5, 12, 0, 0, 0, time.UTC), time.Date(2021, 7, 5, 21, 0, 0, 0, time.UTC)},
+	} {
+		s := NewTestServer(10000, Tick{Instrument: "EUR_USD", Time: test.start, Bid: 1.0999, Ask: 1.1001})
+		t.Cleanup(s.Close)
+		instrument := defaultInstrument("EUR_USD")
+		instrument.Financing = &model.InstrumentFinancing{LongRate: "-0.0365", ShortRate: "0.0100"}
+		s.AddInstrument(instrument)
+		if _, _, err := s.Connect().OrderCreate(TestAccount, marketOrder("EUR_USD", "10000")); err != nil {
+			t.Fatal(err)
+		}
+		charges := func() (times []string) {
+			for _, tx := range s.Transactions(TestAccount, "0") {
+				if tx.Type == string(model.TransactionType_DAILY_FINANCING) {
+					times = append(times, string(tx.Time))
+				}
+			}
+			return times
+		}
+		s.Quote(Tick{Instrument: "EUR_USD", Time: test.rollover.Add(-time.Minute), Bid: 1.0999, Ask: 1.1001})
+		if times := charges(); len(times) != 0 {
+			t.Fatalf("unexpected financing before the rollover %v", times)
+		}
+		s.Quote(Tick{Instrument: "EUR_USD", Time: test.rollover, Bid: 1.0999, Ask: 1.1001})
+		times := charges()
+		if len(times) != 1 {
+			t.Fatalf("expected financing at %v got %v", test.rollover, times)
+		}
+		if at, err := model.DateTime(times[0]).Parse(); err != nil || !at.Equal(test.rollover) {
+			t.Fatalf("expected financing at %v got %v", test.rollover, times[0])
+		}
+	}
+}
+
+func TestServerMarginCloseout(t *testing.T) {
+	s, c := newTestServer(t)
+	if _, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "400000")); err != nil {
+		t.Fatal(err)
+	}
+	s.Quote(Tick{Instrument: "EUR_USD", Bid: 1.0850, Ask: 1.0852})
+	summary, err := c.AccountSummary(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Account.OpenTradeCount != 0 {
+		t.Fatalf("expected the position to be closed out got %d trades", summary.Account.OpenTradeCount)
+	}
+	var closeout bool
+	for _, tx := range s.Transactions(TestAccount, "0") {
+		closeout = closeout || tx.Reason == string(model.OrderFillReason_MARKET_ORDER_MARGIN_CLOSEOUT)
+	}
+	if !closeout {
+		t.Fatal("expected a margin closeout fill")
+	}
+}
+
+func TestServerSnapshot(t *testing.T) {
+	s, c := newTestServer(t)
+	order := marketOrder("EUR_USD", "1000")
+	order.TrailingStopLossOnFill = &model.TrailingStopLossDetails{Distance: "0.0020"}
+	if _, _, err := c.OrderCreate(TestAccount, order); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := s.Snapshot(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewServer()
+	t.Cleanup(restored.Close)
+	if err := restored.Restore(&b); err != nil {
+		t.Fatal(err)
+	}
+	rc := restored.Connect()
+	summary, err := rc.AccountSummary(TestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Account.OpenTradeCount != 1 || summary.Account.PendingOrderCount != 1 || summary.LastTransactionID != "5" {
+		t.Fatalf("unexpected restored account %+v", summary.Account)
+	}
+	restored.Quote(Tick{Instrument: "EUR_USD", Bid: 1.0980, Ask: 1.0982})
+	if summary, _ = rc.AccountSummary(TestAccount); summary.Account.OpenTradeCount != 0 {
+		t.Fatal("expected the restored trailing stop to close the trade")
+	}
+}
+
+func TestServerTransactions(t *testing.T) {
+	_, c := newTestServer(t)
+	resp, _, err := c.OrderCreate(TestAccount, marketOrder("EUR_USD", "1000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	since, err := c.TransactionsSinceID(TestAccount, model.NewTransactionsSinceIDRequest("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(since.Transactions) != 2 || since.Transactions[1].Type != string(model.TransactionType_ORDER_FILL) {
+		t.Fatalf("expected the order and its fill got %d transactions", len(since.Transactions))
+	}
+	since, err = c.TransactionsSinceID(TestAccount, model.NewTransactionsSinceIDRequest(resp.LastTransactionID))
+	if err != nil || len(since.Transactions) != 0 {
+		t.Fatalf("expected no transactions after the last one %v", err)
+	}
+	funding, err := c.TransactionsIDRange(TestAccount, model.NewTransactionsIDRangeRequest("1", resp.LastTransactionID, model.TransactionFilter_FUNDING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(funding.Transactions) != 1 {
+		t.Fatalf("expected 1 funding transaction got %d", len(funding.Transactions))
+	}
+	pages, err := c.Transactions(TestAccount, model.NewTransactionsRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages.Count != 4 || len(pages.Pages) != 1 {
+		t.Fatalf("expected 4 transactions on 1 page got %d on %d", pages.Count, len(pages.Pages))
+	}
+	changes, err := c.AccountChanges(TestAccount, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changes.TradesOpened) != 1 || len(changes.Changes.OrdersFilled) != 1 {
+		t.Fatalf("expected 1 opened trade and 1 filled order got %+v", changes.Changes)
+	}
+}
+
+func TestServerCandlesAndPricing(t *testing.T) {
+	s, c := newTestServer(t)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var candles []*model.Candlestick
+	for i := 0; i < 10; i++ {
+		candles = append(candles, &model.Candlestick{
+			Time:     formatTime(start.Add(time.Duration(i) * time.Minute)),
+			Mid:      &model.CandlestickData{Open: "1.1", High: "1.2", Low: "1.0", Close: "1.1"},
+			Volume:   1,
+			Complete: true,
+		})
+	}
+	s.SetCandles("EUR_USD", model.CandlestickGranularity_M1, candles...)
+	resp, err := c.InstrumentCandles(&model.InstrumentCandlesRequest{
+		Instrument:  "EUR_USD",
+		Granularity: model.CandlestickGranularity_M1,
+		Count:       3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Candles) != 3 || resp.Candles[2].Time != candles[9].Time {
+		t.Fatalf("expected the latest 3 candles got %d", len(resp.Candles))
+	}
+	pricing, err := c.Pricing(TestAccount, &model.PricingRequest{Instruments: []model.InstrumentName{"EUR_USD"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pricing.Prices) != 1 {
+		t.Fatalf("expected 1 price got %d", len(pricing.Prices))
+	}
+	expectNear(t, "bid", pricing.Prices[0].Bids[0].Price.AsFloat64(0), 1.1)
+}
+
+type testTxHandler struct {
+	mu         sync.Mutex
+	types      []string
+	heartbeats int
+	messages   chan struct{}
+}
+
+func (h *testTxHandler) OnMessage(msg model.TransactionMessage) error {
+	h.mu.Lock()
+	if tx, ok := msg.(*model.OrderFillTransaction); ok {
+		h.types = append(h.types, string(tx.Type))
+	} else {
+		h.types = append(h.types, "OTHER")
+	}
+	h.mu.Unlock()
+	h.messages <- struct{}{}
+	return nil
+}
+
+func (h *testTxHandler) OnHeartbeat(model.DateTime, model.TransactionID) error {
+	h.mu.Lock()
+	h.heartbeats++
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *testTxHandler) OnClose() {}
+
+type testPriceHandler struct {
+	bids       chan float64
+	mu         sync.Mutex
+	heartbeats int
+}
+
+func (h *testPriceHandler) OnMessage(price *model.StreamClientPrice) error {
+	h.bids <- price.Bids[0].Price
+	return nil
+}
+
+func (h *testPriceHandler) OnHeartbeat(time.Time) {
+	h.mu.Lock()
+	h.heartbeats++
+	h.mu.Unlock()
+}
+
+func (h *testPriceHandler) OnClose() {}
+
+func TestServerStreams(t *testing.T) {
+	s, c := newTestServer(t)
+	s.WithHeartbeat(10 * time.Millisecond)
+
+	tx := &testTxHandler{messages: make(chan struct{}, 16)}
+	txStream, err := c.StartTransactionStream(TestAccount, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txStream.Close()
+	prices := &testPriceHandler{bids: make(chan float64, 16)}
+	priceStream, err := c.StartPricingStream(TestAccount, model.NewPricingStreamRequest("EUR_USD"), prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer priceStream.Close()
+
+	receive := func(ch chan float64) float64 {
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a price")
+			return 0
+		}
+	}
+	expectNear(t, "snapshot", receive(prices.bids), 1.1)
+	time.Sleep(50 * time.Millisecond)
+	s.Quote(Tick{Instrument: "EUR_USD", Bid: 1.1010, Ask: 1.1012})
+	expectNear(t, "price", receive(prices.bids), 1.101)
+
+	if _, _, err = c.OrderCreate(TestAccount, marketOrder("EUR_USD", "1000")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-tx.messages:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a transaction")
+		}
+	}
+	tx.mu.Lock()
+	if len(tx.types) != 2 || tx.types[1] != string(model.TransactionType_ORDER_FILL) {
+		t.Fatalf("expected the order and its fill got %v", tx.types)
+	}
+	if tx.heartbeats == 0 {
+		t.Fatal("expected transaction heartbeats")
+	}
+	tx.mu.Unlock()
+	prices.mu.Lock()
+	if prices.heartbeats == 0 {
+		t.Fatal("expected pricing heartbeats")
+	}
+	prices.mu.Unlock()
+}
@@ -0,0 +1,216 @@
+package oandatest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"time"
+)
+
+// snapshotVersion is increased whenever the snapshot format changes.
+const snapshotVersion = 1
+
+var (
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+type snapshot struct {
+	Version     int                  `json:"version"`
+	Clock       time.Time            `json:"clock"`
+	Instruments []*model.Instrument  `json:"instruments"`
+	Prices      []*model.ClientPrice `json:"prices"`
+	Accounts    []*accountSnapshot   `json:"accounts"`
+}
+
+type accountSnapshot struct {
+	ID           model.AccountID            `json:"id"`
+	Alias        string                     `json:"alias"`
+	Currency     model.Currency             `json:"currency"`
+	MarginRate   float64                    `json:"marginRate"`
+	Created      time.Time                  `json:"created"`
+	Balance      float64                    `json:"balance"`
+	PL           float64                    `json:"pl"`
+	Financing    float64                    `json:"financing"`
+	LastID       int64                      `json:"lastID"`
+	Transactions []*model.TransactionParser `json:"transactions"`
+	Orders       []*orderSnapshot           `json:"orders"`
+	Trades       []*tradeSnapshot           `json:"trades"`
+	Positions    []*positionSnapshot        `json:"positions"`
+}
+
+type orderSnapshot struct {
+	Order      model.OrderParser    `json:"order"`
+	Units      float64              `json:"units"`
+	Price      float64              `json:"price"`
+	Distance   float64              `json:"distance"`
+	Gtd        time.Time            `json:"gtd"`
+	Instrument model.InstrumentName `json:"instrument"`
+	TradeID    string               `json:"tradeID"`
+}
+
+type tradeSnapshot struct {
+	Trade     model.Trade `json:"trade"`
+	Units     float64     `json:"units"`
+	Price     float64     `json:"price"`
+	Realized  float64     `json:"realized"`
+	Financing float64     `json:"financing"`
+}
+
+type positionSnapshot struct {
+	Instrument     model.InstrumentName `json:"instrument"`
+	Long           float64              `json:"long"`
+	Short          float64              `json:"short"`
+	LongFinancing  float64              `json:"longFinancing"`
+	ShortFinancing float64              `json:"shortFinancing"`
+}
+
+// Snapshot writes the instruments, the latest prices and the complete state of every
+// Account as JSON. Scripted prices, candles and open streams are not included.
+func (s *Server) Snapshot(w io.Writer) error {
+	s.mu.Lock()
+	snap := &snapshot{Version: snapshotVersion, Clock: s.clock}
+	for _, name := range s.names {
+		snap.Instruments = append(snap.Instruments, s.instruments[name])
+		if price := s.prices[name]; price != nil {
+			snap.Prices = append(snap.Prices, price)
+		}
+	}
+	for _, id := range s.accountIDs {
+		snap.Accounts = append(snap.Accounts, s.accounts[id].snapshot())
+	}
+	b, err := json.Marshal(snap)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Restore replaces the instruments, prices and Accounts with those of a snapshot.
+// Transaction streams of replaced Accounts stop receiving Transactions.
+func (s *Server) Restore(r io.Reader) error {
+	snap := &snapshot{}
+	if err := json.NewDecoder(r).Decode(snap); err != nil {
+		return err
+	}
+	if snap.Version != snapshotVersion {
+		return ErrSnapshotVersion
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = snap.Clock
+	s.instruments = make(map[model.InstrumentName]*model.Instrument)
+	s.names = nil
+	for _, instrument := range snap.Instruments {
+		s.addInstrument(instrument)
+	}
+	s.prices = make(map[model.InstrumentName]*model.ClientPrice)
+	for _, price := range snap.Prices {
+		s.prices[price.Instrument] = price
+	}
+	s.accounts = make(map[model.AccountID]*account)
+	s.accountIDs = nil
+	for _, as := range snap.Accounts {
+		s.accounts[as.ID] = s.restoreAccount(as)
+		s.accountIDs = append(s.accountIDs, as.ID)
+	}
+	return nil
+}
+
+func (a *account) snapshot() *accountSnapshot {
+	as := &accountSnapshot{
+		ID:           a.id,
+		Alias:        a.alias,
+		Currency:     a.currency,
+		MarginRate:   a.marginRate,
+		Created:      a.created,
+		Balance:      a.balance,
+		PL:           a.pl,
+		Financing:    a.financing,
+		LastID:       a.lastID,
+		Transactions: a.transactions,
+	}
+	for _, o := range a.orders {
+		saved := &orderSnapshot{
+			Order:      o.OrderParser,
+			Units:      o.units,
+			Price:      o.price,
+			Distance:   o.distance,
+			Gtd:        o.gtd,
+			Instrument: o.instrument,
+		}
+		if o.trade != nil {
+			saved.TradeID = string(o.trade.Id)
+		}
+		as.Orders = append(as.Orders, saved)
+	}
+	for _, t := range a.trades {
+		as.Trades = append(as.Trades, &tradeSnapshot{
+			Trade:     t.Trade,
+			Units:     t.units,
+			Price:     t.price,
+			Realized:  t.realized,
+			Financing: t.financing,
+		})
+	}
+	for _, instrument := range a.instruments {
+		p := a.positions[instrument]
+		as.Positions = append(as.Positions, &positionSnapshot{
+			Instrument:     instrument,
+			Long:           p.long,
+			Short:          p.short,
+			LongFinancing:  p.longFinancing,
+			ShortFinancing: p.shortFinancing,
+		})
+	}
+	return as
+}
+
+func (s *Server) restoreAccount(as *accountSnapshot) *account {
+	a := newAccount(s, as.ID, as.Currency)
+	a.alias = as.Alias
+	a.marginRate = as.MarginRate
+	a.created = as.Created
+	a.balance = as.Balance
+	a.pl = as.PL
+	a.financing = as.Financing
+	a.lastID = as.LastID
+	a.transactions = as.Transactions
+	for _, ts := range as.Trades {
+		t := &trade{
+			Trade:     ts.Trade,
+			units:     ts.Units,
+			price:     ts.Price,
+			realized:  ts.Realized,
+			financing: ts.Financing,
+		}
+		a.trades = append(a.trades, t)
+		a.tradesByID[string(t.Id)] = t
+	}
+	for _, saved := range as.Orders {
+		o := &order{
+			OrderParser: saved.Order,
+			units:       saved.Units,
+			price:       saved.Price,
+			distance:    saved.Distance,
+			gtd:         saved.Gtd,
+			instrument:  saved.Instrument,
+			trade:       a.tradesByID[saved.TradeID],
+		}
+		if o.trade != nil && o.State == model.OrderState_PENDING && dependent(o.Type) {
+			o.trade.attach(o)
+		}
+		a.orders = append(a.orders, o)
+		a.ordersByID[o.Id] = o
+	}
+	for _, ps := range as.Positions {
+		p := a.position(ps.Instrument)
+		p.long = ps.Long
+		p.short = ps.Short
+		p.longFinancing = ps.LongFinancing
+		p.shortFinancing = ps.ShortFinancing
+	}
+	return a
+}
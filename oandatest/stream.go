@@ -0,0 +1,161 @@
+package oandatest
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"net/http"
+	"time"
+)
+
+// subscriber is an open stream. Messages are dropped together with the stream if the
+// client does not keep up.
+type subscriber struct {
+	ch          chan []byte
+	instruments map[model.InstrumentName]bool
+	closed      bool
+}
+
+func newSubscriber() *subscriber {
+	return &subscriber{ch: make(chan []byte, 1024)}
+}
+
+// send queues the message and reports whether the stream is still open. The caller
+// holds the lock of the Server.
+func (sub *subscriber) send(b []byte) bool {
+	if sub.closed {
+		return false
+	}
+	select {
+	case sub.ch <- b:
+		return true
+	default:
+		sub.closed = true
+		close(sub.ch)
+		return false
+	}
+}
+
+func (s *Server) streamPricing(w http.ResponseWriter, r *http.Request, id model.AccountID) {
+	q := r.URL.Query()
+	s.mu.Lock()
+	a := s.accounts[id]
+	if a == nil {
+		s.mu.Unlock()
+		replyError(w, http.StatusNotFound, "", "The Account specified does not exist.")
+		return
+	}
+	sub := newSubscriber()
+	sub.instruments = make(map[model.InstrumentName]bool)
+	for _, name := range splitList(q.Get("instruments")) {
+		instrument := model.InstrumentName(name)
+		if _, ok := s.instruments[instrument]; !ok {
+			s.mu.Unlock()
+			replyError(w, http.StatusBadRequest, "", errInvalid("instruments").Error())
+			return
+		}
+		sub.instruments[instrument] = true
+	}
+	if len(sub.instruments) == 0 {
+		s.mu.Unlock()
+		replyError(w, http.StatusBadRequest, "", errInvalid("instruments").Error())
+		return
+	}
+	if q.Get("snapshot") != "false" {
+		for _, instrument := range s.names {
+			if price := s.prices[instrument]; price != nil && sub.instruments[instrument] {
+				if b, err := price.MarshalJSON(); err == nil {
+					sub.send(b)
+				}
+			}
+		}
+	}
+	s.pricing[sub] = struct{}{}
+	heartbeat := s.heartbeat
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pricing, sub)
+		s.mu.Unlock()
+	}()
+	s.stream(w, r, sub, heartbeat, func() ([]byte, error) {
+		s.mu.Lock()
+		now := s.now()
+		s.mu.Unlock()
+		return (&model.PricingHeartbeat{Type: "HEARTBEAT", Time: formatTime(now)}).MarshalJSON()
+	})
+}
+
+func (s *Server) streamTransactions(w http.ResponseWriter, r *http.Request, id model.AccountID) {
+	s.mu.Lock()
+	a := s.accounts[id]
+	if a == nil {
+		s.mu.Unlock()
+		replyError(w, http.StatusNotFound, "", "The Account specified does not exist.")
+		return
+	}
+	sub := newSubscriber()
+	a.streams[sub] = struct{}{}
+	heartbeat := s.heartbeat
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(a.streams, sub)
+		s.mu.Unlock()
+	}()
+	s.stream(w, r, sub, heartbeat, func() ([]byte, error) {
+		s.mu.Lock()
+		hb := &model.TransactionHeartbeat{
+			Type:              "HEARTBEAT",
+			LastTransactionID: model.TransactionID(a.lastTransactionID()),
+			Time:              formatTime(s.now()),
+		}
+		s.mu.Unlock()
+		return hb.MarshalJSON()
+	})
+}
+
+// stream writes the queued messages and the heartbeats as lines until the client goes
+// away, the server closes or the subscriber falls behind.
+func (s *Server) stream(
+	w http.ResponseWriter,
+	r *http.Request,
+	sub *subscriber,
+	heartbeat time.Duration,
+	heartbeatMessage func() ([]byte, error),
+) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	write := func(b []byte) bool {
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case b, ok := <-sub.ch:
+			if !ok || !write(b) {
+				return
+			}
+		case <-ticker.C:
+			b, err := heartbeatMessage()
+			if err != nil || !write(b) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,595 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"strings"
+	"sync"
+)
+
+// OrderStatus is the lifecycle state of an order followed by an OrderTracker.
+type OrderStatus string
+
+const (
+	// The request was sent and no outcome is known yet.
+	OrderStatus_SUBMITTED OrderStatus = "SUBMITTED"
+	// The order was created and waits to be filled or cancelled.
+	OrderStatus_PENDING   OrderStatus = "PENDING"
+	OrderStatus_FILLED    OrderStatus = "FILLED"
+	OrderStatus_CANCELLED OrderStatus = "CANCELLED"
+	OrderStatus_REJECTED  OrderStatus = "REJECTED"
+	// The request failed without an outcome from OANDA.
+	OrderStatus_FAILED OrderStatus = "FAILED"
+)
+
+// Terminal reports whether the status is final.
+func (s OrderStatus) Terminal() bool {
+	switch s {
+	case OrderStatus_FILLED, OrderStatus_CANCELLED, OrderStatus_REJECTED, OrderStatus_FAILED:
+		return true
+	}
+	return false
+}
+
+// The number of untracked orders whose transactions are held in case a handle
+// claims them later.
+const orderTrackerBacklog = 256
+
+var (
+	ErrClientIDInUse = errors.New("client order id already tracked")
+)
+
+// OrderError is returned by OrderHandle.Wait when an order was cancelled or rejected.
+type OrderError struct {
+	OrderID model.OrderID
+	Status  OrderStatus
+	// The cancel or reject reason reported by OANDA.
+	Reason string
+}
+
+func (e *OrderError) Error() string {
+	msg := "order " + strings.ToLower(string(e.Status))
+	if len(e.Reason) > 0 {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// OrderStatusFunc is called after the status of an order changes.
+type OrderStatusFunc func(h *OrderHandle, status OrderStatus)
+
+// OrderHandle follows a single order to its final state.
+type OrderHandle struct {
+	clientID  model.ClientID
+	orderID   model.OrderID
+	status    OrderStatus
+	create    model.TransactionMessage
+	fill      *model.OrderFillTransaction
+	cancel    *model.OrderCancelTransaction
+	reject    model.TransactionMessage
+	reason    string
+	err       error
+	listeners []OrderStatusFunc
+	done      chan struct{}
+	mu        sync.RWMutex
+}
+
+func newOrderHandle(clientID model.ClientID, status OrderStatus, listeners []OrderStatusFunc) *OrderHandle {
+	return &OrderHandle{
+		clientID:  clientID,
+		status:    status,
+		listeners: listeners,
+		done:      make(chan struct{}),
+	}
+}
+
+// The client order ID or empty if the order was submitted without one.
+func (h *OrderHandle) ClientID() model.ClientID {
+	return h.clientID
+}
+
+// The OANDA order ID or empty until the order is created.
+func (h *OrderHandle) OrderID() model.OrderID {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.orderID
+}
+
+func (h *OrderHandle) Status() OrderStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.status
+}
+
+// Done is closed once the order reaches a terminal status.
+func (h *OrderHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait blocks until the order reaches a terminal status and returns the fill.
+// The error is an *OrderError if the order was cancelled or rejected and the
+// request error if it failed.
+func (h *OrderHandle) Wait() (*model.OrderFillTransaction, error) {
+	<-h.done
+	return h.Fill(), h.Err()
+}
+
+// Err returns the reason the order did not fill or nil.
+func (h *OrderHandle) Err() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	switch h.status {
+	case OrderStatus_FAILED:
+		return h.err
+	case OrderStatus_CANCELLED, OrderStatus_REJECTED:
+		return &OrderError{OrderID: h.orderID, Status: h.status, Reason: h.reason}
+	}
+	return nil
+}
+
+// The transaction that created the order or nil.
+func (h *OrderHandle) Create() model.TransactionMessage {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.create
+}
+
+// The transaction that filled the order or nil.
+func (h *OrderHandle) Fill() *model.OrderFillTransaction {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.fill
+}
+
+// The transaction that cancelled the order or nil. An order that only partially
+// filled may have both a fill and a cancel for the remaining units.
+func (h *OrderHandle) Cancel() *model.OrderCancelTransaction {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cancel
+}
+
+// The transaction that rejected the order or nil.
+func (h *OrderHandle) Reject() model.TransactionMessage {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.reject
+}
+
+// TradeIDs returns the trades opened, closed or reduced by the fill.
+func (h *OrderHandle) TradeIDs() []model.TradeID {
+	fill := h.Fill()
+	if fill == nil {
+		return nil
+	}
+	var ids []model.TradeID
+	if fill.TradeOpened != nil {
+		ids = append(ids, fill.TradeOpened.TradeID)
+	}
+	for _, closed := range fill.TradesClosed {
+		if closed != nil {
+			ids = append(ids, closed.TradeID)
+		}
+	}
+	if fill.TradeReduced != nil {
+		ids = append(ids, fill.TradeReduced.TradeID)
+	}
+	return ids
+}
+
+// update records the transaction and advances the status. The status never moves
+// backwards, so applying the same transaction from the REST response and the
+// stream is harmless.
+func (h *OrderHandle) update(msg model.TransactionMessage, info orderTxInfo) *orderEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.orderID) == 0 && len(info.orderID) > 0 {
+		h.orderID = info.orderID
+	}
+	switch v := msg.(type) {
+	case *model.OrderFillTransaction:
+		if h.fill == nil {
+			h.fill = v
+		}
+	case *model.OrderCancelTransaction:
+		if h.cancel == nil {
+			h.cancel = v
+		}
+	default:
+		if info.status == OrderStatus_PENDING && h.create == nil {
+			h.create = msg
+		} else if info.status == OrderStatus_REJECTED && h.reject == nil {
+			h.reject = msg
+		}
+	}
+	if h.status.Terminal() || orderStatusRank(info.status) <= orderStatusRank(h.status) {
+		return nil
+	}
+	h.status = info.status
+	h.reason = info.reason
+	return h.advanced()
+}
+
+func (h *OrderHandle) failed(err error) *orderEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.status.Terminal() {
+		return nil
+	}
+	h.status = OrderStatus_FAILED
+	h.err = err
+	return h.advanced()
+}
+
+func (h *OrderHandle) advanced() *orderEvent {
+	if h.status.Terminal() {
+		close(h.done)
+	}
+	if len(h.listeners) == 0 {
+		return nil
+	}
+	return &orderEvent{handle: h, status: h.status, listeners: h.listeners}
+}
+
+func orderStatusRank(s OrderStatus) int {
+	switch s {
+	case OrderStatus_SUBMITTED:
+		return 1
+	case OrderStatus_PENDING:
+		return 2
+	case "":
+		return 0
+	}
+	return 3
+}
+
+type orderEvent struct {
+	handle    *OrderHandle
+	status    OrderStatus
+	listeners []OrderStatusFunc
+}
+
+func fireOrderEvents(events []*orderEvent) {
+	for _, e := range events {
+		for _, fn := range e.listeners {
+			fn(e.handle, e.status)
+		}
+	}
+}
+
+// OrderTracker submits orders and follows them through the transaction stream to
+// their fill, cancellation or rejection. Transactions are correlated with orders by
+// OrderID and by the client order ID of ClientExtensions. Transactions that arrive
+// on the stream before the REST response are held until the response names the
+// order.
+//
+// Register the OrderTracker as the endpoint.TxStreamHandler of the Account's
+// transaction stream.
+type OrderTracker struct {
+	accountID model.AccountID
+	create    func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error)
+	byClient  map[model.ClientID]*OrderHandle
+	byOrder   map[model.OrderID]*OrderHandle
+	unmatched map[model.OrderID][]model.TransactionMessage
+	backlog   []model.OrderID
+	mu        sync.Mutex
+}
+
+// NewOrderTracker returns a tracker that submits orders through an OrderSubmitter,
+// so every order is given a client order ID and never created twice.
+func NewOrderTracker(conn endpoint.API, limiter *RateLimiter, accountID model.AccountID) *OrderTracker {
+	t := newOrderTracker(accountID)
+	t.create = NewOrderSubmitter(conn, limiter, accountID).Create
+	return t
+}
+
+func newOrderTracker(accountID model.AccountID) *OrderTracker {
+	return &OrderTracker{
+		accountID: accountID,
+		byClient:  make(map[model.ClientID]*OrderHandle),
+		byOrder:   make(map[model.OrderID]*OrderHandle),
+		unmatched: make(map[model.OrderID][]model.TransactionMessage),
+	}
+}
+
+func (t *OrderTracker) AccountID() model.AccountID {
+	return t.accountID
+}
+
+// Submit creates the order and returns a handle that follows it. A client order ID
+// is assigned to the request if it has none. The listeners are called after every
+// status change, outside of any lock and in the order the changes happen. An error
+// is only returned if the order could not be submitted; the outcome of the
+// request, including a transport error, is reported by the handle.
+func (t *OrderTracker) Submit(request model.OrderRequest, listeners ...OrderStatusFunc) (*OrderHandle, error) {
+	if request == nil {
+		return nil, endpoint.ErrNilRequest
+	}
+	h, err := t.register(EnsureClientID(request), listeners)
+	if err != nil {
+		return nil, err
+	}
+	resp, rejected, err := t.create(request)
+	t.record(h, resp, rejected, err)
+	return h, nil
+}
+
+// Track follows an existing order, for example a pending order created before the
+// tracker was started or a dependent Stop Loss Order. Transactions of the order
+// already seen on the stream are applied immediately. Tracking an order that is
+// already tracked adds the listeners to its handle.
+func (t *OrderTracker) Track(orderID model.OrderID, listeners ...OrderStatusFunc) *OrderHandle {
+	t.mu.Lock()
+	if h := t.byOrder[orderID]; h != nil {
+		t.mu.Unlock()
+		h.mu.Lock()
+		h.listeners = append(h.listeners, listeners...)
+		h.mu.Unlock()
+		return h
+	}
+	h := newOrderHandle("", OrderStatus_PENDING, listeners)
+	h.orderID = orderID
+	t.byOrder[orderID] = h
+	events := t.drain(h, orderID)
+	t.mu.Unlock()
+	fireOrderEvents(events)
+	return h
+}
+
+// register creates the handle of an order about to be submitted.
+func (t *OrderTracker) register(clientID model.ClientID, listeners []OrderStatusFunc) (*OrderHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(clientID) > 0 {
+		if _, ok := t.byClient[clientID]; ok {
+			return nil, ErrClientIDInUse
+		}
+	}
+	h := newOrderHandle(clientID, OrderStatus_SUBMITTED, listeners)
+	if len(clientID) > 0 {
+		t.byClient[clientID] = h
+	}
+	return h, nil
+}
+
+// record applies the result of an OrderCreate request to the handle.
+func (t *OrderTracker) record(
+	h *OrderHandle,
+	resp *model.CreateOrderResponse,
+	rejected *model.CreateOrderError,
+	err error,
+) {
+	var messages []model.TransactionMessage
+	switch {
+	case resp != nil:
+		if resp.OrderCreateTransaction != nil {
+			messages = append(messages, resp.OrderCreateTransaction.Parse())
+		}
+		if resp.OrderFillTransaction != nil {
+			messages = append(messages, resp.OrderFillTransaction)
+		}
+		if resp.OrderCancelTransaction != nil {
+			messages = append(messages, resp.OrderCancelTransaction)
+		}
+	case rejected != nil && rejected.OrderRejectTransaction != nil:
+		messages = append(messages, rejected.OrderRejectTransaction.Parse())
+	}
+
+	var events []*orderEvent
+	t.mu.Lock()
+	for _, msg := range messages {
+		if info, ok := orderTransaction(msg); ok {
+			events = append(events, t.apply(h, msg, info)...)
+		}
+	}
+	if len(messages) == 0 {
+		if err == nil {
+			err = errors.New("empty order response")
+		}
+		if e := h.failed(err); e != nil {
+			events = append(events, e)
+		}
+		t.forget(h)
+	}
+	t.mu.Unlock()
+	fireOrderEvents(events)
+}
+
+// apply must be called with the lock held.
+func (t *OrderTracker) apply(h *OrderHandle, msg model.TransactionMessage, info orderTxInfo) []*orderEvent {
+	var events []*orderEvent
+	known := len(h.OrderID()) > 0
+	if e := h.update(msg, info); e != nil {
+		events = append(events, e)
+	}
+	if !known && len(info.orderID) > 0 {
+		t.byOrder[info.orderID] = h
+		events = append(events, t.drain(h, info.orderID)...)
+	}
+	if h.Status().Terminal() {
+		t.forget(h)
+	}
+	return events
+}
+
+// drain applies the transactions held for the order.
+func (t *OrderTracker) drain(h *OrderHandle, orderID model.OrderID) []*orderEvent {
+	held := t.unmatched[orderID]
+	if len(held) == 0 {
+		return nil
+	}
+	delete(t.unmatched, orderID)
+	var events []*orderEvent
+	for _, msg := range held {
+		if info, ok := orderTransaction(msg); ok {
+			events = append(events, t.apply(h, msg, info)...)
+		}
+	}
+	return events
+}
+
+// forget stops routing transactions to a handle that reached a terminal status.
+func (t *OrderTracker) forget(h *OrderHandle) {
+	if len(h.clientID) > 0 && t.byClient[h.clientID] == h {
+		delete(t.byClient, h.clientID)
+	}
+	if id := h.OrderID(); len(id) > 0 && t.byOrder[id] == h {
+		delete(t.byOrder, id)
+	}
+}
+
+// hold keeps a transaction of an order that is not tracked (yet).
+func (t *OrderTracker) hold(orderID model.OrderID, msg model.TransactionMessage) {
+	if _, ok := t.unmatched[orderID]; !ok {
+		t.backlog = append(t.backlog, orderID)
+	}
+	t.unmatched[orderID] = append(t.unmatched[orderID], msg)
+	for len(t.unmatched) > orderTrackerBacklog && len(t.backlog) > 0 {
+		delete(t.unmatched, t.backlog[0])
+		t.backlog = t.backlog[1:]
+	}
+	if len(t.backlog) > 2*orderTrackerBacklog {
+		// Drop the IDs of drained orders
+		backlog := make([]model.OrderID, 0, len(t.unmatched))
+		for _, id := range t.backlog {
+			if _, ok := t.unmatched[id]; ok {
+				backlog = append(backlog, id)
+			}
+		}
+		t.backlog = backlog
+	}
+}
+
+func (t *OrderTracker) OnMessage(msg model.TransactionMessage) error {
+	info, ok := orderTransaction(msg)
+	if !ok {
+		return nil
+	}
+	t.mu.Lock()
+	h := t.byOrder[info.orderID]
+	if h == nil && len(info.clientID) > 0 {
+		h = t.byClient[info.clientID]
+	}
+	if h == nil {
+		if len(info.orderID) > 0 {
+			t.hold(info.orderID, msg)
+		}
+		t.mu.Unlock()
+		return nil
+	}
+	events := t.apply(h, msg, info)
+	t.mu.Unlock()
+	fireOrderEvents(events)
+	return nil
+}
+
+func (t *OrderTracker) OnHeartbeat(time model.DateTime, lastTransactionID model.TransactionID) error {
+	return nil
+}
+
+func (t *OrderTracker) OnClose() {}
+
+// orderTxInfo is what correlates a transaction with an order.
+type orderTxInfo struct {
+	orderID  model.OrderID
+	clientID model.ClientID
+	status   OrderStatus
+	reason   string
+}
+
+// orderTransaction extracts the order a transaction belongs to and the status it
+// moves the order to. Returns false for transactions that do not change the state
+// of an order.
+func orderTransaction(msg model.TransactionMessage) (orderTxInfo, bool) {
+	var (
+		info orderTxInfo
+		ext  *model.ClientExtensions
+	)
+	switch v := msg.(type) {
+	case *model.MarketOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.FixedPriceOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.LimitOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.StopOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.MarketIfTouchedOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.TakeProfitOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.StopLossOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.GuaranteedStopLossOrderTransaction:
+		ext = v.ClientExtensions
+	case *model.TrailingStopLossOrderTransaction:
+		ext = v.ClientExtensions
+
+	case *model.MarketOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+	case *model.LimitOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+	case *model.StopOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+	case *model.MarketIfTouchedOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+	case *model.TakeProfitOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+	case *model.StopLossOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+	case *model.GuaranteedStopLossOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+	case *model.TrailingStopLossOrderRejectTransaction:
+		ext, info.reason, info.status = v.ClientExtensions, string(v.RejectReason), OrderStatus_REJECTED
+
+	case *model.OrderFillTransaction:
+		info.orderID = v.OrderID
+		info.clientID = v.ClientOrderID
+		info.status = OrderStatus_FILLED
+		info.reason = string(v.Reason)
+		return info, true
+	case *model.OrderCancelTransaction:
+		info.orderID = v.OrderID
+		info.clientID = model.ClientID(v.ClientOrderID)
+		info.status = OrderStatus_CANCELLED
+		info.reason = string(v.Reason)
+		return info, true
+	default:
+		return info, false
+	}
+
+	if ext != nil {
+		info.clientID = ext.ID
+	}
+	// Rejected orders are never assigned an OrderID
+	if info.status != OrderStatus_REJECTED {
+		info.orderID = model.OrderID(msg.Get().Id)
+		info.status = OrderStatus_PENDING
+	}
+	return info, true
+}
+
+// orderRequestExtensions returns the location of the ClientExtensions of an order
+// request or nil for an unsupported request type.
+func orderRequestExtensions(request model.OrderRequest) **model.ClientExtensions {
+	switch v := request.(type) {
+	case *model.MarketOrderRequest:
+		return &v.ClientExtensions
+	case *model.LimitOrderRequest:
+		return &v.ClientExtensions
+	case *model.StopOrderRequest:
+		return &v.ClientExtensions
+	case *model.MarketIfTouchedOrderRequest:
+		return &v.ClientExtensions
+	case *model.TakeProfitOrderRequest:
+		return &v.ClientExtensions
+	case *model.StopLossOrderRequest:
+		return &v.ClientExtensions
+	case *model.GuaranteedStopLossOrderRequest:
+		return &v.ClientExtensions
+	case *model.TrailingStopLossOrderRequest:
+		return &v.ClientExtensions
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"testing"
+)
+
+func newTestOrderFill(id model.TransactionID, orderID model.OrderID, clientID model.ClientID) *model.OrderFillTransaction {
+	return &model.OrderFillTransaction{
+		Transaction:   model.Transaction{Id: id},
+		Type:          "ORDER_FILL",
+		OrderID:       orderID,
+		ClientOrderID: clientID,
+		Instrument:    "EUR_USD",
+		Units:         "100",
+		Price:         "1.10000",
+		TradeOpened:   &model.TradeOpen{TradeID: model.TradeID(id), Units: "100"},
+	}
+}
+
+func TestOrderTracker(t *testing.T) {
+	tracker := newOrderTracker("101-001-1-001")
+
+	// The stream delivers the create and the fill before the REST response
+	var statuses []OrderStatus
+	tracker.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		create := &model.TransactionParser{
+			Id:               "10",
+			Type:             "MARKET_ORDER",
+			Instrument:       "EUR_USD",
+			Units:            "100",
+			ClientExtensions: &model.ClientExtensions{ID: "my-order"},
+		}
+		fill := newTestOrderFill("11", "10", "my-order")
+		_ = tracker.OnMessage(create.Parse())
+		_ = tracker.OnMessage(fill)
+		return &model.CreateOrderResponse{
+			OrderCreateTransaction: create,
+			OrderFillTransaction:   fill,
+			LastTransactionID:      "11",
+		}, nil, nil
+	}
+	request := &model.MarketOrderRequest{
+		Type:             model.OrderType_MARKET,
+		Instrument:       "EUR_USD",
+		Units:            "100",
+		ClientExtensions: &model.ClientExtensions{ID: "my-order"},
+	}
+	h, err := tracker.Submit(request, func(h *OrderHandle, status OrderStatus) {
+		statuses = append(statuses, status)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill, err := h.Wait()
+	if err != nil || fill == nil || fill.Id != "11" {
+		t.Fatalf("unexpected fill %v %v", fill, err)
+	}
+	if h.OrderID() != "10" || h.Create() == nil || len(h.TradeIDs()) != 1 || h.TradeIDs()[0] != "11" {
+		t.Fatalf("unexpected handle %s %v", h.OrderID(), h.TradeIDs())
+	}
+	if len(statuses) != 2 || statuses[0] != OrderStatus_PENDING || statuses[1] != OrderStatus_FILLED {
+		t.Fatalf("unexpected status changes %v", statuses)
+	}
+	if len(tracker.byClient) != 0 || len(tracker.byOrder) != 0 {
+		t.Fatal("filled order still tracked")
+	}
+
+	// A fill without the client ID is held until the response names the order
+	tracker.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		_ = tracker.OnMessage(newTestOrderFill("21", "20", ""))
+		return &model.CreateOrderResponse{
+			OrderCreateTransaction: &model.TransactionParser{Id: "20", Type: "LIMIT_ORDER"},
+		}, nil, nil
+	}
+	if h, err = tracker.Submit(&model.LimitOrderRequest{Instrument: "EUR_USD", Units: "100", Price: "1.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if h.Status() != OrderStatus_FILLED || h.Fill().Id != "21" {
+		t.Fatalf("held fill not applied: %s", h.Status())
+	}
+
+	// Rejected
+	tracker.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		return nil, &model.CreateOrderError{
+			OrderRejectTransaction: &model.TransactionParser{
+				Id:           "30",
+				Type:         "MARKET_ORDER_REJECT",
+				RejectReason: "INSUFFICIENT_MARGIN",
+			},
+		}, endpoint.StatusCodeError{Code: 400}
+	}
+	if h, err = tracker.Submit(&model.MarketOrderRequest{Instrument: "EUR_USD", Units: "100"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = h.Wait()
+	if e, ok := err.(*OrderError); !ok || e.Status != OrderStatus_REJECTED || e.Reason != "INSUFFICIENT_MARGIN" {
+		t.Fatalf("expected rejection got %v", err)
+	}
+
+	// Transport failure
+	failure := errors.New("connection reset")
+	tracker.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		return nil, nil, failure
+	}
+	if h, err = tracker.Submit(&model.MarketOrderRequest{Instrument: "EUR_USD", Units: "100"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.Wait(); err != failure || h.Status() != OrderStatus_FAILED {
+		t.Fatalf("expected failure got %v", err)
+	}
+
+	// Track an existing order until it is cancelled
+	h = tracker.Track("40")
+	_ = tracker.OnMessage(&model.OrderCancelTransaction{
+		Transaction: model.Transaction{Id: "41"},
+		OrderID:     "40",
+		Reason:      "TIME_IN_FORCE_EXPIRED",
+	})
+	if _, err = h.Wait(); err == nil || h.Cancel() == nil || h.Status() != OrderStatus_CANCELLED {
+		t.Fatalf("expected cancellation got %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+// Package paper forward tests strategies on live prices with a local simulated broker.
+// Prices from the pricing stream of a live or practice Account are applied to the
+// simulated broker of package oandatest, which fills the orders and keeps the trades,
+// positions and Account state of any number of paper Accounts. The state is saved to
+// a file so that a restart continues where the previous run stopped.
+//
+//	broker, _ := paper.New(paper.Config{
+//		Live:          conn,
+//		LiveAccountID: accountID,
+//		Instruments:   []model.InstrumentName{"EUR_USD"},
+//		Path:          "paper.json",
+//	})
+//	broker.AddAccount("paper-1", "USD", 100000)
+//	_ = broker.Start()
+//	defer broker.Close()
+//	strategy := NewStrategy(broker.API(), "paper-1")
+package paper
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSaveInterval is how often the state is saved while the Broker runs.
+	DefaultSaveInterval = time.Minute
+	// The pricing stream is reopened after a delay that doubles up to the maximum.
+	reconnectDelay    = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+var (
+	ErrNoLiveAPI     = errors.New("live api required")
+	ErrNoInstruments = errors.New("instruments required")
+	ErrBrokerClosed  = errors.New("paper broker closed")
+	ErrBrokerStarted = errors.New("paper broker already started")
+)
+
+// Config configures a Broker.
+type Config struct {
+	// Live is the API the prices, the instruments and the market data come from.
+	Live endpoint.API
+	// LiveAccountID is the Account the pricing stream is opened for.
+	LiveAccountID model.AccountID
+	// Instruments to stream prices for.
+	Instruments []model.InstrumentName
+	// Path of the state file. The state is kept in memory only if it is empty.
+	Path string
+	// SaveInterval defaults to DefaultSaveInterval.
+	SaveInterval time.Duration
+}
+
+// Broker is a simulated broker driven by live prices.
+type Broker struct {
+	config  Config
+	srv     *oandatest.Server
+	conn    *endpoint.Connection
+	stream  *endpoint.Stream
+	started bool
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+	saveMu  sync.Mutex
+	mu      sync.Mutex
+}
+
+// New restores the state saved at the Path, if any, and loads the instruments from
+// the live API.
+func New(config Config) (*Broker, error) {
+	if config.Live == nil {
+		return nil, ErrNoLiveAPI
+	}
+	if len(config.Instruments) == 0 {
+		return nil, ErrNoInstruments
+	}
+	if config.SaveInterval <= 0 {
+		config.SaveInterval = DefaultSaveInterval
+	}
+	srv := oandatest.NewServer()
+	if err := restore(srv, config.Path); err != nil {
+		srv.Close()
+		return nil, err
+	}
+	names := make([]string, len(config.Instruments))
+	for i, instrument := range config.Instruments {
+		names[i] = string(instrument)
+	}
+	instruments, err := config.Live.AccountInstruments(config.LiveAccountID, names...)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	for _, instrument := range instruments.Instruments {
+		srv.AddInstrument(instrument)
+	}
+	conn, err := endpoint.NewConnectionURL("paper", srv.URL(), srv.URL())
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	return &Broker{
+		config: config,
+		srv:    srv,
+		conn:   conn,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+func restore(srv *oandatest.Server, path string) error {
+	if len(path) == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return srv.Restore(f)
+}
+
+// AddAccount opens a paper Account unless it was restored from the state file.
+func (b *Broker) AddAccount(id model.AccountID, currency model.Currency, balance float64) {
+	b.srv.AddAccount(id, currency, balance)
+}
+
+// API trades the paper Accounts. Candles, order books and position books come from
+// the live API.
+func (b *Broker) API() endpoint.API {
+	return &api{
+		API:           b.conn,
+		live:          b.config.Live,
+		liveAccountID: b.config.LiveAccountID,
+	}
+}
+
+// Start opens the live pricing stream. The stream is reopened whenever it ends until
+// the Broker is closed. If the stream cannot be opened Start may be called again.
+func (b *Broker) Start() error {
+	b.mu.Lock()
+	switch {
+	case b.closed:
+		b.mu.Unlock()
+		return ErrBrokerClosed
+	case b.started:
+		b.mu.Unlock()
+		return ErrBrokerStarted
+	}
+	b.started = true
+	b.mu.Unlock()
+	if err := b.open(); err != nil {
+		b.mu.Lock()
+		b.started = false
+		b.mu.Unlock()
+		return err
+	}
+	b.wg.Add(1)
+	go b.run()
+	return nil
+}
+
+func (b *Broker) open() error {
+	stream, err := b.config.Live.StartPricingStream(
+		b.config.LiveAccountID,
+		&model.PricingStreamRequest{Instruments: b.config.Instruments, Snapshot: true},
+		&feed{srv: b.srv},
+	)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return stream.Close()
+	}
+	b.stream = stream
+	return nil
+}
+
+// run saves the state periodically and reopens the pricing stream when it ends.
+func (b *Broker) run() {
+	defer b.wg.Done()
+	save := time.NewTicker(b.config.SaveInterval)
+	defer save.Stop()
+	delay := reconnectDelay
+	for {
+		var (
+			ended <-chan struct{}
+			retry <-chan time.Time
+		)
+		b.mu.Lock()
+		if b.stream != nil {
+			ended = b.stream.Done()
+		} else {
+			retry = time.After(delay)
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-b.done:
+			return
+		case <-save.C:
+			_ = b.Save()
+		case <-ended:
+			b.mu.Lock()
+			b.stream = nil
+			b.mu.Unlock()
+		case <-retry:
+			if err := b.open(); err != nil {
+				if delay *= 2; delay > maxReconnectDelay {
+					delay = maxReconnectDelay
+				}
+			} else {
+				delay = reconnectDelay
+			}
+		}
+	}
+}
+
+// Save writes the state to the Path. The file is replaced atomically.
+func (b *Broker) Save() error {
+	if len(b.config.Path) == 0 {
+		return nil
+	}
+	b.saveMu.Lock()
+	defer b.saveMu.Unlock()
+	tmpPath := b.config.Path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = b.srv.Snapshot(tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, b.config.Path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
+
+// Close stops the pricing stream, saves the state and shuts the simulated broker
+// down.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	stream := b.stream
+	b.stream = nil
+	b.mu.Unlock()
+	if stream != nil {
+		_ = stream.Close()
+	}
+	b.wg.Wait()
+	err := b.Save()
+	b.srv.Close()
+	return err
+}
+
+// feed applies the live prices to the simulated broker.
+type feed struct {
+	srv *oandatest.Server
+}
+
+func (f *feed) OnMessage(price *model.StreamClientPrice) error {
+	if tick, ok := oandatest.StreamTick(price); ok {
+		f.srv.Quote(tick)
+	}
+	return nil
+}
+
+func (f *feed) OnHeartbeat(time.Time) {}
+
+func (f *feed) OnClose() {}
+
+// api serves the paper Accounts with the market data of the live API.
+type api struct {
+	endpoint.API
+	live          endpoint.API
+	liveAccountID model.AccountID
+}
+
+func (a *api) InstrumentCandles(request *model.InstrumentCandlesRequest) (*model.CandlestickResponse, error) {
+	return a.live.InstrumentCandles(request)
+}
+
+func (a *api) InstrumentOrderBook(instrument model.InstrumentName, t time.Time) (*model.OrderBook, error) {
+	return a.live.InstrumentOrderBook(instrument, t)
+}
+
+func (a *api) InstrumentPositionBook(instrument model.InstrumentName, t time.Time) (*model.PositionBook, error) {
+	return a.live.InstrumentPositionBook(instrument, t)
+}
+
+func (a *api) CandlesLatest(
+	_ model.AccountID,
+	request *model.CandlesLatestRequest,
+) (*model.CandlesLatestResponse, error) {
+	return a.live.CandlesLatest(a.liveAccountID, request)
+}
+
+func (a *api) PricingCandles(
+	_ model.AccountID,
+	instrument model.InstrumentName,
+	request *model.PricingCandlesRequest,
+) (*model.PricingCandlesResponse, error) {
+	return a.live.PricingCandles(a.liveAccountID, instrument, request)
+}
@@ -0,0 +1,172 @@
+package paper
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	liveAccount  model.AccountID = oandatest.TestAccount
+	paperAccount model.AccountID = "paper-1"
+)
+
+func newLive(t *testing.T) (*oandatest.Server, endpoint.API) {
+	live := oandatest.NewTestServer(1000, oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1000, Ask: 1.1002})
+	t.Cleanup(live.Close)
+	return live, live.Connect()
+}
+
+// waitPrice waits for the live price to reach the paper broker.
+func waitPrice(t *testing.T, api endpoint.API, bid float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := api.Pricing(paperAccount, &model.PricingRequest{Instruments: []model.InstrumentName{"EUR_USD"}})
+		if err == nil && len(resp.Prices) == 1 && resp.Prices[0].Bids[0].Price.AsFloat64(0) == bid {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("price %v did not arrive", bid)
+}
+
+// failingAPI fails to open the first pricing stream.
+type failingAPI struct {
+	endpoint.API
+	failed bool
+}
+
+func (f *failingAPI) StartPricingStream(
+	accountID model.AccountID,
+	request *model.PricingStreamRequest,
+	handler endpoint.PricingStreamHandler,
+) (*endpoint.Stream, error) {
+	if !f.failed {
+		f.failed = true
+		return nil, errors.New("stream unavailable")
+	}
+	return f.API.StartPricingStream(accountID, request, handler)
+}
+
+func TestBrokerStartRetry(t *testing.T) {
+	_, conn := newLive(t)
+	broker, err := New(Config{
+		Live:          &failingAPI{API: conn},
+		LiveAccountID: liveAccount,
+		Instruments:   []model.InstrumentName{"EUR_USD"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	broker.AddAccount(paperAccount, "USD", 10000)
+	if err = broker.Start(); err == nil {
+		t.Fatal("expected the first stream to fail")
+	}
+	if err = broker.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitPrice(t, broker.API(), 1.1000)
+	if err = broker.Start(); err != ErrBrokerStarted {
+		t.Fatalf("expected ErrBrokerStarted got %v", err)
+	}
+}
+
+func TestBroker(t *testing.T) {
+	live, conn := newLive(t)
+	config := Config{
+		Live:          conn,
+		LiveAccountID: liveAccount,
+		Instruments:   []model.InstrumentName{"EUR_USD"},
+		Path:          filepath.Join(t.TempDir(), "paper.json"),
+	}
+	broker, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.AddAccount(paperAccount, "USD", 10000)
+	if err = broker.Start(); err != nil {
+		t.Fatal(err)
+	}
+	api := broker.API()
+	waitPrice(t, api, 1.1000)
+
+	order := &model.MarketOrderRequest{
+		Type:           model.OrderType_MARKET,
+		Instrument:     "EUR_USD",
+		Units:          "1000",
+		StopLossOnFill: &model.StopLossDetails{Price: "1.0950"},
+	}
+	resp, _, err := api.OrderCreate(paperAccount, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.OrderFillTransaction == nil {
+		t.Fatal("expected the order to fill")
+	}
+	// The live Account is not touched
+	if summary, _ := conn.AccountSummary(liveAccount); summary.Account.OpenTradeCount != 0 {
+		t.Fatal("expected no trades on the live account")
+	}
+	live.Quote(oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1010, Ask: 1.1012})
+	waitPrice(t, api, 1.1010)
+	if err = broker.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted broker continues with the saved state
+	if broker, err = New(config); err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	broker.AddAccount(paperAccount, "USD", 10000)
+	if err = broker.Start(); err != nil {
+		t.Fatal(err)
+	}
+	api = broker.API()
+	changes, err := api.AccountChanges(paperAccount, resp.LastTransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.State == nil || len(changes.State.Trades) != 1 {
+		t.Fatal("expected the open trade to be restored")
+	}
+	live.Quote(oandatest.Tick{Instrument: "EUR_USD", Bid: 1.0940, Ask: 1.0942})
+	waitPrice(t, api, 1.0940)
+	trades, err := api.TradesOpen(paperAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades.Trades) != 0 {
+		t.Fatal("expected the restored stop loss to close the trade")
+	}
+}
+
+func TestBrokerMarketData(t *testing.T) {
+	live, conn := newLive(t)
+	live.SetCandles("EUR_USD", model.CandlestickGranularity_M1, &model.Candlestick{
+		Time:     "2021-03-01T12:00:00.000000000Z",
+		Mid:      &model.CandlestickData{Open: "1.1", High: "1.1", Low: "1.1", Close: "1.1"},
+		Complete: true,
+	})
+	broker, err := New(Config{Live: conn, LiveAccountID: liveAccount, Instruments: []model.InstrumentName{"EUR_USD"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	broker.AddAccount(paperAccount, "USD", 10000)
+	candles, err := broker.API().PricingCandles(paperAccount, "EUR_USD", &model.PricingCandlesRequest{
+		Granularity: model.CandlestickGranularity_M1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles.Candles) != 1 {
+		t.Fatalf("expected the live candle got %d", len(candles.Candles))
+	}
+}
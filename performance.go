@@ -0,0 +1,496 @@
+package oanda
+
+import (
+	"fmt"
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TradeResult is the outcome of a Trade reconstructed from the transactions. The
+// amounts are in the home currency of the Account.
+type TradeResult struct {
+	TradeID    model.TradeID        `json:"tradeID"`
+	Instrument model.InstrumentName `json:"instrument"`
+	// The tag of the Trade's client extensions, or of the Order that opened it.
+	Tag model.ClientTag `json:"tag"`
+	// The initial units, negative for a short Trade.
+	Units     float64 `json:"units"`
+	OpenPrice float64 `json:"openPrice"`
+	// The units weighted average price of the closed units.
+	ClosePrice float64   `json:"closePrice"`
+	OpenTime   time.Time `json:"openTime"`
+	// The time the last units were closed, zero while the Trade is open.
+	CloseTime time.Time `json:"closeTime"`
+	Closed    bool      `json:"closed"`
+	// The profit or loss realized by the closing fills.
+	RealizedPL float64 `json:"realizedPL"`
+	// The financing paid or collected, including daily financing.
+	Financing float64 `json:"financing"`
+	// The commission of the fills allocated by units, a positive cost.
+	Commission float64 `json:"commission"`
+	// The guaranteed stop loss execution fees, a positive cost.
+	GuaranteedExecutionFee float64 `json:"guaranteedExecutionFee"`
+	// The net result: RealizedPL plus Financing minus Commission and fees.
+	PL float64 `json:"pl"`
+
+	closedUnits float64
+	closedValue float64
+}
+
+func (t *TradeResult) net() {
+	t.PL = t.RealizedPL + t.Financing - t.Commission - t.GuaranteedExecutionFee
+}
+
+// PerformanceStats summarizes the closed Trades of a group. The amounts are in the
+// home currency of the Account, durations are nanoseconds in JSON.
+type PerformanceStats struct {
+	// The instrument, period or tag of the group. Empty for the total.
+	Key    string `json:"key"`
+	Trades int    `json:"trades"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	// Wins divided by Trades.
+	WinRate     float64 `json:"winRate"`
+	GrossProfit float64 `json:"grossProfit"`
+	// The sum of the losing Trades, zero or negative.
+	GrossLoss   float64 `json:"grossLoss"`
+	NetPL       float64 `json:"netPL"`
+	AverageWin  float64 `json:"averageWin"`
+	AverageLoss float64 `json:"averageLoss"`
+	// The average net result per Trade.
+	Expectancy float64 `json:"expectancy"`
+	// GrossProfit divided by the absolute GrossLoss, zero without losses.
+	ProfitFactor float64 `json:"profitFactor"`
+	// The largest decline of the cumulative result of the Trades in close order.
+	MaxDrawdown float64 `json:"maxDrawdown"`
+	// The time at least one of the Trades was open.
+	Exposure        time.Duration `json:"exposure"`
+	AverageDuration time.Duration `json:"averageDuration"`
+}
+
+// PerformanceReport is the trading performance of an Account over the transactions
+// added to a Performance. Only closed Trades enter the statistics.
+type PerformanceReport struct {
+	// The times of the first and last transaction.
+	From         time.Time                    `json:"from"`
+	To           time.Time                    `json:"to"`
+	Period       model.CandlestickGranularity `json:"period"`
+	Total        PerformanceStats             `json:"total"`
+	ByInstrument []PerformanceStats           `json:"byInstrument"`
+	ByPeriod     []PerformanceStats           `json:"byPeriod"`
+	ByTag        []PerformanceStats           `json:"byTag"`
+	// Every Trade opened in the transactions in open order, including open ones.
+	Trades []*TradeResult `json:"trades"`
+}
+
+// PerformanceConfig configures a Performance.
+type PerformanceConfig struct {
+	// The period Trades are grouped by their close time, D, W or M. Defaults to M.
+	Period model.CandlestickGranularity
+	// The alignment of the periods. Defaults to DefaultAlignment.
+	Alignment *Alignment
+}
+
+// Performance reconstructs the Trades of an Account from its transactions, as
+// returned by TransactionsIDRange or TxLog.Range, and reports their performance.
+// Trades opened before the first transaction are ignored.
+type Performance struct {
+	config    PerformanceConfig
+	trades    map[model.TradeID]*TradeResult
+	opened    []*TradeResult
+	orderTags map[model.OrderID]model.ClientTag
+	replay    txReplay
+	from      time.Time
+	to        time.Time
+}
+
+func NewPerformance(config PerformanceConfig) *Performance {
+	if len(config.Period) == 0 {
+		config.Period = model.CandlestickGranularity_M
+	}
+	if config.Alignment == nil {
+		config.Alignment = DefaultAlignment()
+	}
+	return &Performance{
+		config:    config,
+		trades:    make(map[model.TradeID]*TradeResult),
+		orderTags: make(map[model.OrderID]model.ClientTag),
+	}
+}
+
+// AddParsed adds the transactions of a TransactionsResponse.
+func (p *Performance) AddParsed(transactions []*model.TransactionParser) error {
+	return p.Add(parsed(transactions)...)
+}
+
+// Add adds transactions in ID order. Transactions that were already added are
+// skipped, so overlapping ranges may be added.
+func (p *Performance) Add(messages ...model.TransactionMessage) error {
+	return p.replay.add(messages, func(msg model.TransactionMessage, tx *model.Transaction) error {
+		t, err := tx.Time.Parse()
+		if err != nil {
+			return err
+		}
+		if p.from.IsZero() {
+			p.from = t
+		}
+		p.to = t
+		p.add(msg, t)
+		return nil
+	})
+}
+
+func (p *Performance) add(msg model.TransactionMessage, t time.Time) {
+	switch tx := msg.(type) {
+	case *model.MarketOrderTransaction:
+		p.orderTag(tx.Id, tx.TradeClientExtensions, tx.ClientExtensions)
+	case *model.FixedPriceOrderTransaction:
+		p.orderTag(tx.Id, tx.TradeClientExtensions, tx.ClientExtensions)
+	case *model.LimitOrderTransaction:
+		p.orderTag(tx.Id, tx.TradeClientExtensions, tx.ClientExtensions)
+	case *model.StopOrderTransaction:
+		p.orderTag(tx.Id, tx.TradeClientExtensions, tx.ClientExtensions)
+	case *model.MarketIfTouchedOrderTransaction:
+		p.orderTag(tx.Id, tx.TradeClientExtensions, tx.ClientExtensions)
+	case *model.TradeClientExtensionsModifyTransaction:
+		if trade := p.trades[tx.TradeID]; trade != nil && tx.TradeClientExtensionsModify != nil {
+			trade.Tag = tx.TradeClientExtensionsModify.Tag
+		}
+	case *model.OrderFillTransaction:
+		p.fill(tx, t)
+	case *model.DailyFinancingTransaction:
+		for _, position := range tx.PositionFinancings {
+			if position == nil {
+				continue
+			}
+			for _, financing := range position.OpenTradeFinancings {
+				if financing == nil {
+					continue
+				}
+				if trade := p.trades[financing.TradeID]; trade != nil {
+					trade.Financing += accountUnits(financing.Financing)
+					trade.net()
+				}
+			}
+		}
+	}
+}
+
+func (p *Performance) orderTag(id model.TransactionID, trade *model.ClientExtensions, order *model.ClientExtensions) {
+	switch {
+	case trade != nil && len(trade.Tag) > 0:
+		p.orderTags[model.OrderID(id)] = trade.Tag
+	case order != nil && len(order.Tag) > 0:
+		p.orderTags[model.OrderID(id)] = order.Tag
+	}
+}
+
+func (p *Performance) fill(fill *model.OrderFillTransaction, t time.Time) {
+	reduces := fillReduces(fill)
+	share := commissionShare(fill, reduces)
+	for _, r := range reduces {
+		if r == nil {
+			continue
+		}
+		trade := p.trades[r.TradeID]
+		if trade == nil {
+			continue
+		}
+		closed := math.Abs(r.Units.AsFloat64(0))
+		trade.closedUnits += closed
+		trade.closedValue += closed * r.Price.AsFloat64(0)
+		trade.ClosePrice = trade.closedValue / trade.closedUnits
+		trade.RealizedPL += accountUnits(r.RealizedPL)
+		trade.Financing += accountUnits(r.Financing)
+		trade.GuaranteedExecutionFee += accountUnits(r.GuaranteedExecutionFee)
+		trade.Commission += share(r.Units)
+		if trade.closedUnits >= math.Abs(trade.Units)-1e-9 {
+			trade.Closed = true
+			trade.CloseTime = t
+		}
+		trade.net()
+	}
+	if open := fill.TradeOpened; open != nil {
+		trade := &TradeResult{
+			TradeID:                open.TradeID,
+			Instrument:             fill.Instrument,
+			Tag:                    p.orderTags[fill.OrderID],
+			Units:                  open.Units.AsFloat64(0),
+			OpenPrice:              open.Price.AsFloat64(0),
+			OpenTime:               t,
+			Commission:             share(open.Units),
+			GuaranteedExecutionFee: accountUnits(open.GuaranteedExecutionFee),
+		}
+		if open.ClientExtensions != nil && len(open.ClientExtensions.Tag) > 0 {
+			trade.Tag = open.ClientExtensions.Tag
+		}
+		trade.net()
+		p.trades[trade.TradeID] = trade
+		p.opened = append(p.opened, trade)
+	}
+}
+
+// fillReduces returns the Trades closed and reduced by the fill.
+func fillReduces(fill *model.OrderFillTransaction) []*model.TradeReduce {
+	reduces := fill.TradesClosed
+	if fill.TradeReduced != nil {
+		reduces = append(reduces[:len(reduces):len(reduces)], fill.TradeReduced)
+	}
+	return reduces
+}
+
+// commissionShare returns a function that allocates the commission of the fill to
+// its Trades in proportion to their units.
+func commissionShare(fill *model.OrderFillTransaction, reduces []*model.TradeReduce) func(units model.DecimalNumber) float64 {
+	var total float64
+	for _, r := range reduces {
+		if r != nil {
+			total += math.Abs(r.Units.AsFloat64(0))
+		}
+	}
+	if fill.TradeOpened != nil {
+		total += math.Abs(fill.TradeOpened.Units.AsFloat64(0))
+	}
+	commission := accountUnits(fill.Commission)
+	return func(units model.DecimalNumber) float64 {
+		if total == 0 {
+			return 0
+		}
+		return commission * math.Abs(units.AsFloat64(0)) / total
+	}
+}
+
+// Trades returns the Trades opened in the transactions in open order.
+func (p *Performance) Trades() []*TradeResult {
+	return p.opened
+}
+
+// Report returns the statistics of the closed Trades in total and by instrument,
+// period of the close time and tag.
+func (p *Performance) Report() (*PerformanceReport, error) {
+	var closed []*TradeResult
+	for _, trade := range p.opened {
+		if trade.Closed {
+			closed = append(closed, trade)
+		}
+	}
+	sort.SliceStable(closed, func(i, j int) bool {
+		return closed[i].CloseTime.Before(closed[j].CloseTime)
+	})
+
+	var (
+		instruments = make(map[string][]*TradeResult)
+		periods     = make(map[string][]*TradeResult)
+		tags        = make(map[string][]*TradeResult)
+	)
+	for _, trade := range closed {
+		period, err := p.periodKey(trade.CloseTime)
+		if err != nil {
+			return nil, err
+		}
+		instruments[string(trade.Instrument)] = append(instruments[string(trade.Instrument)], trade)
+		periods[period] = append(periods[period], trade)
+		tags[string(trade.Tag)] = append(tags[string(trade.Tag)], trade)
+	}
+	return &PerformanceReport{
+		From:         p.from,
+		To:           p.to,
+		Period:       p.config.Period,
+		Total:        performanceStats("", closed),
+		ByInstrument: performanceGroups(instruments),
+		ByPeriod:     performanceGroups(periods),
+		ByTag:        performanceGroups(tags),
+		Trades:       p.opened,
+	}, nil
+}
+
+// periodKey names the period containing t by the date of its first trading day,
+// or by the month for monthly periods.
+func (p *Performance) periodKey(t time.Time) (string, error) {
+	a := p.config.Alignment
+	start, err := a.Start(p.config.Period, t)
+	if err != nil {
+		return "", err
+	}
+	switch p.config.Period {
+	case model.CandlestickGranularity_M:
+		return a.tradingDate(start).Format("2006-01"), nil
+	case model.CandlestickGranularity_W, model.CandlestickGranularity_D:
+		return a.tradingDate(start).Format("2006-01-02"), nil
+	}
+	return start.Format(time.RFC3339), nil
+}
+
+func performanceGroups(groups map[string][]*TradeResult) []PerformanceStats {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	stats := make([]PerformanceStats, 0, len(keys))
+	for _, key := range keys {
+		stats = append(stats, performanceStats(key, groups[key]))
+	}
+	return stats
+}
+
+// performanceStats summarizes closed Trades sorted by close time.
+func performanceStats(key string, trades []*TradeResult) PerformanceStats {
+	s := PerformanceStats{Key: key, Trades: len(trades)}
+	if len(trades) == 0 {
+		return s
+	}
+	var (
+		cumulative float64
+		peak       float64
+		duration   time.Duration
+	)
+	for _, trade := range trades {
+		switch {
+		case trade.PL > 0:
+			s.Wins++
+			s.GrossProfit += trade.PL
+		case trade.PL < 0:
+			s.Losses++
+			s.GrossLoss += trade.PL
+		}
+		cumulative += trade.PL
+		if cumulative > peak {
+			peak = cumulative
+		}
+		if peak-cumulative > s.MaxDrawdown {
+			s.MaxDrawdown = peak - cumulative
+		}
+		duration += trade.CloseTime.Sub(trade.OpenTime)
+	}
+	s.NetPL = s.GrossProfit + s.GrossLoss
+	s.WinRate = float64(s.Wins) / float64(s.Trades)
+	s.Expectancy = s.NetPL / float64(s.Trades)
+	if s.Wins > 0 {
+		s.AverageWin = s.GrossProfit / float64(s.Wins)
+	}
+	if s.Losses > 0 {
+		s.AverageLoss = s.GrossLoss / float64(s.Losses)
+		s.ProfitFactor = s.GrossProfit / -s.GrossLoss
+	}
+	s.AverageDuration = duration / time.Duration(len(trades))
+	s.Exposure = exposure(trades)
+	return s
+}
+
+// exposure returns the length of the union of the open intervals of the Trades.
+func exposure(trades []*TradeResult) time.Duration {
+	sorted := make([]*TradeResult, len(trades))
+	copy(sorted, trades)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].OpenTime.Before(sorted[j].OpenTime)
+	})
+	var (
+		total      time.Duration
+		start, end time.Time
+	)
+	for _, trade := range sorted {
+		if trade.OpenTime.After(end) {
+			total += end.Sub(start)
+			start, end = trade.OpenTime, trade.CloseTime
+		} else if trade.CloseTime.After(end) {
+			end = trade.CloseTime
+		}
+	}
+	return total + end.Sub(start)
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *PerformanceReport) WriteJSON(w io.Writer) error {
+	return writeJSON(w, r)
+}
+
+var performanceHeader = []string{
+	"trades", "wins", "losses", "win_rate", "gross_profit", "gross_loss", "net_pl", "average_win",
+	"average_loss", "expectancy", "profit_factor", "max_drawdown", "exposure_s", "average_duration_s",
+}
+
+func (s *PerformanceStats) row() []string {
+	return []string{
+		strconv.Itoa(s.Trades),
+		strconv.Itoa(s.Wins),
+		strconv.Itoa(s.Losses),
+		strconv.FormatFloat(s.WinRate, 'f', 4, 64),
+		formatAmount(s.GrossProfit),
+		formatAmount(s.GrossLoss),
+		formatAmount(s.NetPL),
+		formatAmount(s.AverageWin),
+		formatAmount(s.AverageLoss),
+		formatAmount(s.Expectancy),
+		strconv.FormatFloat(s.ProfitFactor, 'f', 4, 64),
+		formatAmount(s.MaxDrawdown),
+		strconv.FormatInt(int64(s.Exposure/time.Second), 10),
+		strconv.FormatInt(int64(s.AverageDuration/time.Second), 10),
+	}
+}
+
+func performanceGroup(name string, stats []PerformanceStats) reportGroup {
+	g := reportGroup{name: name}
+	for i := range stats {
+		g.keys = append(g.keys, stats[i].Key)
+		g.rows = append(g.rows, stats[i].row())
+	}
+	return g
+}
+
+// groups returns the groups of the report in table order.
+func (r *PerformanceReport) groups() []reportGroup {
+	return []reportGroup{
+		performanceGroup("total", []PerformanceStats{r.Total}),
+		performanceGroup("instrument", r.ByInstrument),
+		performanceGroup("period", r.ByPeriod),
+		performanceGroup("tag", r.ByTag),
+	}
+}
+
+// WriteCSV writes the statistics as CSV with a row per group. The first columns are
+// the kind of group (total, instrument, period or tag) and its key.
+func (r *PerformanceReport) WriteCSV(w io.Writer) error {
+	return writeGroupsCSV(w, performanceHeader, r.groups())
+}
+
+// WriteTradesCSV writes the Trades of the report as CSV.
+func (r *PerformanceReport) WriteTradesCSV(w io.Writer) error {
+	rows := make([][]string, 0, len(r.Trades))
+	for _, t := range r.Trades {
+		var closeTime string
+		if t.Closed {
+			closeTime = t.CloseTime.Format(time.RFC3339Nano)
+		}
+		rows = append(rows, []string{
+			string(t.TradeID),
+			string(t.Instrument),
+			string(t.Tag),
+			strconv.FormatFloat(t.Units, 'f', -1, 64),
+			strconv.FormatFloat(t.OpenPrice, 'f', -1, 64),
+			strconv.FormatFloat(t.ClosePrice, 'f', -1, 64),
+			t.OpenTime.Format(time.RFC3339Nano),
+			closeTime,
+			strconv.FormatBool(t.Closed),
+			formatAmount(t.RealizedPL),
+			formatAmount(t.Financing),
+			formatAmount(t.Commission),
+			formatAmount(t.GuaranteedExecutionFee),
+			formatAmount(t.PL),
+		})
+	}
+	return writeCSV(w, []string{
+		"trade_id", "instrument", "tag", "units", "open_price", "close_price", "open_time", "close_time",
+		"closed", "realized_pl", "financing", "commission", "guaranteed_execution_fee", "pl",
+	}, rows)
+}
+
+// WriteMarkdown writes the statistics as Markdown tables, one per kind of group.
+func (r *PerformanceReport) WriteMarkdown(w io.Writer) error {
+	title := fmt.Sprintf("Performance %s to %s", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	return writeGroupsMarkdown(w, title, performanceHeader, r.groups())
+}
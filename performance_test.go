@@ -0,0 +1,175 @@
+package oanda
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tradePerformance opens and closes a winning long tagged trend and a losing short
+// tagged revert that closes on the next trading day.
+func tradePerformance(t *testing.T) ([]*model.TransactionParser, time.Time) {
+	t.Helper()
+	const account = oandatest.TestAccount
+	s, conn := newTestServer(t, 1000)
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	market := func(units string, tag model.ClientTag) {
+		_, _, err := conn.OrderCreate(account, &model.MarketOrderRequest{
+			Type:                  model.OrderType_MARKET,
+			Instrument:            "EUR_USD",
+			Units:                 model.DecimalNumber(units),
+			TimeInForce:           model.TimeInForce_FOK,
+			TradeClientExtensions: &model.ClientExtensions{Tag: tag},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeTrade := func(id model.TradeID) {
+		if _, _, err := conn.TradeClose(account, model.TradeSpecifier(id), "ALL"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Quote(oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1, Ask: 1.1002, Time: start})
+	market("1000", "trend")
+	trades, err := conn.TradesOpen(account)
+	if err != nil || len(trades.Trades) != 1 {
+		t.Fatal(err)
+	}
+	s.Quote(oandatest.Tick{Instrument: "EUR_USD", Bid: 1.105, Ask: 1.1052, Time: start.Add(time.Hour)})
+	closeTrade(trades.Trades[0].Id)
+	market("-1000", "revert")
+	trades, _ = conn.TradesOpen(account)
+	s.Quote(oandatest.Tick{Instrument: "EUR_USD", Bid: 1.107, Ask: 1.1072, Time: start.Add(11 * time.Hour)})
+	closeTrade(trades.Trades[0].Id)
+
+	resp, err := conn.TransactionsIDRange(account, &model.TransactionsIDRangeRequest{From: "1", To: "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Transactions, start
+}
+
+func TestPerformance(t *testing.T) {
+	transactions, start := tradePerformance(t)
+	p := NewPerformance(PerformanceConfig{Period: model.CandlestickGranularity_D})
+	if err := p.AddParsed(transactions); err != nil {
+		t.Fatal(err)
+	}
+	// Overlapping transactions are skipped
+	if err := p.AddParsed(transactions); err != nil {
+		t.Fatal(err)
+	}
+	report, err := p.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+	if len(report.Trades) != 2 || !report.Trades[0].Closed || report.Trades[0].Tag != "trend" ||
+		!near(report.Trades[0].PL, 4.8) || !near(report.Trades[1].PL, -2.2) {
+		t.Fatalf("unexpected trades %+v %+v", report.Trades[0], report.Trades[1])
+	}
+	if !report.Trades[1].OpenTime.Equal(start.Add(time.Hour)) || report.Trades[1].ClosePrice != 1.1072 {
+		t.Fatalf("unexpected trade %+v", report.Trades[1])
+	}
+	total := report.Total
+	if total.Trades != 2 || total.Wins != 1 || total.Losses != 1 || total.WinRate != 0.5 ||
+		!near(total.NetPL, 2.6) || !near(total.Expectancy, 1.3) || !near(total.ProfitFactor, 4.8/2.2) ||
+		!near(total.AverageLoss, -2.2) || !near(total.MaxDrawdown, 2.2) {
+		t.Fatalf("unexpected total %+v", total)
+	}
+	if total.Exposure != 11*time.Hour || total.AverageDuration != 5*time.Hour+30*time.Minute {
+		t.Fatalf("unexpected exposure %v %v", total.Exposure, total.AverageDuration)
+	}
+	if len(report.ByTag) != 2 || report.ByTag[0].Key != "revert" || report.ByTag[1].Key != "trend" ||
+		report.ByTag[1].WinRate != 1 || report.ByTag[1].MaxDrawdown != 0 {
+		t.Fatalf("unexpected tags %+v", report.ByTag)
+	}
+	// The short closes after the 17:00 New York rollover
+	if len(report.ByPeriod) != 2 || report.ByPeriod[0].Key != "2021-03-01" || report.ByPeriod[1].Key != "2021-03-02" {
+		t.Fatalf("unexpected periods %+v", report.ByPeriod)
+	}
+	if len(report.ByInstrument) != 1 || report.ByInstrument[0].Trades != 2 {
+		t.Fatalf("unexpected instruments %+v", report.ByInstrument)
+	}
+
+	// Daily financing is added to the Trade it was charged for
+	last := transactions[len(transactions)-1]
+	err = p.Add(&model.DailyFinancingTransaction{
+		Transaction: model.Transaction{Id: formatTxID(mustTxID(t, last.Id) + 1), Time: last.Time},
+		PositionFinancings: []*model.PositionFinancing{{
+			Instrument:          "EUR_USD",
+			OpenTradeFinancings: []*model.OpenTradeFinancing{{TradeID: report.Trades[1].TradeID, Financing: "-0.3000"}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, _ = p.Report(); !near(report.Total.NetPL, 2.3) || !near(report.Trades[1].Financing, -0.3) {
+		t.Fatalf("unexpected financing %+v", report.Trades[1])
+	}
+}
+
+func mustTxID(t *testing.T, id string) uint64 {
+	t.Helper()
+	v, err := parseTxID(model.TransactionID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestPerformanceOutput(t *testing.T) {
+	transactions, _ := tradePerformance(t)
+	p := NewPerformance(PerformanceConfig{})
+	if err := p.AddParsed(transactions); err != nil {
+		t.Fatal(err)
+	}
+	report, err := p.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err = report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &PerformanceReport{}
+	if err = json.Unmarshal(b.Bytes(), decoded); err != nil || decoded.Total.Trades != 2 || len(decoded.ByPeriod) != 1 {
+		t.Fatalf("unexpected json %v %s", err, b.String())
+	}
+
+	b.Reset()
+	if err = report.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	// Header, total, one instrument, one month and two tags
+	if len(lines) != 6 || !strings.HasPrefix(lines[1], "total,,2,1,1,0.5000,4.8000,-2.2000,2.6000,") ||
+		!strings.HasPrefix(lines[3], "period,2021-03,") {
+		t.Fatalf("unexpected csv %s", b.String())
+	}
+
+	b.Reset()
+	if err = report.WriteTradesCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	if lines = strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[1], ",trend,1000,") {
+		t.Fatalf("unexpected trades csv %s", b.String())
+	}
+
+	b.Reset()
+	if err = report.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "## Tag") || !strings.Contains(b.String(), "| revert | 1 | 0 | 1 |") {
+		t.Fatalf("unexpected markdown %s", b.String())
+	}
+}
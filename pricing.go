@@ -1,10 +1,340 @@
 package oanda
 
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// The maximum number of candles OANDA returns for a single request.
+	MaxCandlesPerRequest = 5000
+)
+
+var (
+	ErrInvalidRange       = errors.New("invalid time range")
+	ErrInvalidGranularity = errors.New("invalid granularity")
+)
+
+// Quote is the latest top of book price of an instrument.
+type Quote struct {
+	Instrument model.InstrumentName
+	Time       time.Time
+	Bid        float64
+	Ask        float64
+}
+
+func (q Quote) Mid() float64 {
+	return (q.Bid + q.Ask) / 2
+}
+
+// Pricing keeps the latest Quote of every instrument and the latest home currency
+// conversion factors of an Account. It implements endpoint.PricingStreamHandler so
+// it can be fed by a pricing stream, and may also be updated by polling.
 type Pricing struct {
+	quotes      map[model.InstrumentName]Quote
+	conversions map[model.Currency]model.HomeConversions
+	mu          sync.RWMutex
+}
+
+func NewPricing() *Pricing {
+	return &Pricing{
+		quotes:      make(map[model.InstrumentName]Quote),
+		conversions: make(map[model.Currency]model.HomeConversions),
+	}
+}
+
+// Quote returns the latest Quote of the instrument.
+func (p *Pricing) Quote(instrument model.InstrumentName) (Quote, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	q, ok := p.quotes[instrument]
+	return q, ok
+}
+
+// Quotes returns the latest Quote of every instrument.
+func (p *Pricing) Quotes() []Quote {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	quotes := make([]Quote, 0, len(p.quotes))
+	for _, q := range p.quotes {
+		quotes = append(quotes, q)
+	}
+	return quotes
+}
+
+// HomeConversion returns the latest factors converting the currency into the home
+// currency of the Account.
+func (p *Pricing) HomeConversion(currency model.Currency) (model.HomeConversions, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	c, ok := p.conversions[currency]
+	return c, ok
+}
+
+// Update stores the quote unless a newer one is already known.
+func (p *Pricing) Update(q Quote) {
+	p.mu.Lock()
+	if existing, ok := p.quotes[q.Instrument]; !ok || !q.Time.Before(existing.Time) {
+		p.quotes[q.Instrument] = q
+	}
+	p.mu.Unlock()
+}
+
+// UpdatePrice stores the top of book of a price returned by the Pricing endpoint.
+func (p *Pricing) UpdatePrice(price *model.ClientPrice) error {
+	if price == nil || len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return nil
+	}
+	t, err := price.Time.Parse()
+	if err != nil {
+		return err
+	}
+	p.Update(Quote{
+		Instrument: price.Instrument,
+		Time:       t,
+		Bid:        price.Bids[0].Price.AsFloat64(0),
+		Ask:        price.Asks[0].Price.AsFloat64(0),
+	})
+	return nil
+}
+
+// UpdateHomeConversions stores home currency conversion factors.
+func (p *Pricing) UpdateHomeConversions(conversions ...*model.HomeConversions) {
+	p.mu.Lock()
+	for _, c := range conversions {
+		if c != nil {
+			p.conversions[c.Currency] = *c
+		}
+	}
+	p.mu.Unlock()
+}
+
+// Poll fetches the current prices and home conversions of the instruments.
+func (p *Pricing) Poll(
+	conn endpoint.PricingAPI,
+	accountID model.AccountID,
+	instruments ...model.InstrumentName,
+) error {
+	if len(instruments) == 0 {
+		return endpoint.ErrInstrumentsRequired
+	}
+	resp, err := conn.Pricing(accountID, model.NewPricingRequest().
+		WithInstruments(instruments...).
+		WithIncludeHomeConversions(true))
+	if err != nil {
+		return err
+	}
+	for _, price := range resp.Prices {
+		if err = p.UpdatePrice(price); err != nil {
+			return err
+		}
+	}
+	p.UpdateHomeConversions(resp.HomeConversions...)
+	return nil
+}
+
+func (p *Pricing) OnMessage(price *model.StreamClientPrice) error {
+	if price == nil || price.IsHeartbeat || len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return nil
+	}
+	p.Update(Quote{
+		Instrument: model.InstrumentName(price.Instrument),
+		Time:       price.Time,
+		Bid:        price.Bids[0].Price,
+		Ask:        price.Asks[0].Price,
+	})
+	return nil
 }
 
+func (p *Pricing) OnHeartbeat(time.Time) {}
+
+func (p *Pricing) OnClose() {}
+
+// Candles downloads candle history for arbitrary ranges. Ranges larger than a single
+// request allows are split into windows that are fetched concurrently under the
+// rate limit and stitched back together in order.
 type Candles struct {
+	fetch       func(request *model.InstrumentCandlesRequest) (*model.CandlestickResponse, error)
+	limiter     *RateLimiter
+	concurrency int
+}
+
+func NewCandles(conn endpoint.InstrumentsAPI, limiter *RateLimiter) *Candles {
+	return &Candles{
+		fetch:       conn.InstrumentCandles,
+		limiter:     limiter,
+		concurrency: DefaultConcurrency,
+	}
+}
+
+// WithConcurrency sets the maximum number of windows fetched at the same time.
+func (c *Candles) WithConcurrency(concurrency int) *Candles {
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	c.concurrency = concurrency
+	return c
 }
 
+// InstrumentCandles is a contiguous candle history ordered by time.
 type InstrumentCandles struct {
+	Instrument  model.InstrumentName
+	Granularity model.CandlestickGranularity
+	Price       model.PricingComponent
+	From        time.Time
+	To          time.Time
+	Candles     []model.Candlestick
+}
+
+// Download fetches every candle starting within [from, to). The request supplies the
+// instrument, granularity, price components, smoothing and the DailyAlignment,
+// AlignmentTimezone and WeeklyAlignment; its Count, From and To are ignored.
+// If to is zero or in the future the history ends now and the last candle may be
+// incomplete.
+func (c *Candles) Download(
+	request *model.InstrumentCandlesRequest,
+	from, to time.Time,
+) (*InstrumentCandles, error) {
+	if request == nil {
+		return nil, endpoint.ErrNilRequest
+	}
+	if len(request.Instrument) == 0 {
+		return nil, endpoint.ErrInstrumentsRequired
+	}
+	if now := time.Now(); to.IsZero() || to.After(now) {
+		to = now
+	}
+	// OANDA accepts whole seconds
+	from = from.UTC().Truncate(time.Second)
+	to = to.UTC().Truncate(time.Second)
+	if from.IsZero() || !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+	granularity := request.Granularity
+	if len(granularity) == 0 {
+		granularity = model.CandlestickGranularity_S5
+	}
+	windows, err := candleWindows(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		pages = make([][]*model.Candlestick, len(windows)-1)
+		errs  = make([]error, len(windows)-1)
+	)
+	parallel(len(pages), c.concurrency, c.limiter, func(i int) {
+		r := *request
+		r.Granularity = granularity
+		r.Count = 0
+		r.IncludeFirst = true
+		r.WithRange(windows[i], windows[i+1])
+		resp, err := c.fetch(&r)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		if resp != nil {
+			pages[i] = resp.Candles
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	candles, err := stitchCandles(pages, from, to)
+	if err != nil {
+		return nil, err
+	}
+	price := request.Price
+	if len(price) == 0 {
+		price = model.PricingComponent_MID
+	}
+	return &InstrumentCandles{
+		Instrument:  request.Instrument,
+		Granularity: granularity,
+		Price:       price,
+		From:        from,
+		To:          to,
+		Candles:     candles,
+	}, nil
+}
+
+// candleWindows splits [from, to) into consecutive windows that each hold at most
+// MaxCandlesPerRequest candles. The returned boundaries start with from and end
+// with to. Windows are one candle short of the limit so that a daylight saving
+// shift of a daily or weekly alignment can never push a window over it.
+func candleWindows(granularity model.CandlestickGranularity, from, to time.Time) ([]time.Time, error) {
+	d, ok := GranularityDuration(granularity)
+	if !ok {
+		return nil, ErrInvalidGranularity
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+	windows := []time.Time{from}
+	for next := from; next.Before(to); {
+		if granularity == model.CandlestickGranularity_M {
+			next = next.AddDate(0, MaxCandlesPerRequest-1, 0)
+		} else {
+			next = next.Add(d * (MaxCandlesPerRequest - 1))
+		}
+		if next.After(to) {
+			next = to
+		}
+		windows = append(windows, next)
+	}
+	return windows, nil
+}
+
+// stitchCandles joins the pages in order, dropping candles outside [from, to) and
+// the duplicates returned at window boundaries.
+func stitchCandles(pages [][]*model.Candlestick, from, to time.Time) ([]model.Candlestick, error) {
+	type timed struct {
+		t      time.Time
+		candle *model.Candlestick
+	}
+	var (
+		n      = 0
+		sorted []timed
+	)
+	for _, page := range pages {
+		n += len(page)
+	}
+	sorted = make([]timed, 0, n)
+	for _, page := range pages {
+		for _, candle := range page {
+			if candle == nil {
+				continue
+			}
+			t, err := candle.Time.Parse()
+			if err != nil {
+				return nil, err
+			}
+			if t.Before(from) || !t.Before(to) {
+				continue
+			}
+			sorted = append(sorted, timed{t: t, candle: candle})
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].t.Before(sorted[j].t)
+	})
+
+	candles := make([]model.Candlestick, 0, len(sorted))
+	for i, c := range sorted {
+		if i > 0 && c.t.Equal(sorted[i-1].t) {
+			// A later page has the more recent copy of a boundary candle
+			candles[len(candles)-1] = *c.candle
+			continue
+		}
+		candles = append(candles, *c.candle)
+	}
+	return candles, nil
 }
@@ -0,0 +1,84 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCandlesDownload(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	c := &Candles{
+		concurrency: 4,
+		// Emulates OANDA by returning every minute candle from the one covering
+		// "from" up to and including "to"
+		fetch: func(r *model.InstrumentCandlesRequest) (*model.CandlestickResponse, error) {
+			from, _ := r.From.Parse()
+			to, _ := r.To.Parse()
+			if r.Count != 0 {
+				t.Error("count sent together with from and to")
+			}
+			if n := to.Sub(from) / time.Minute; n > MaxCandlesPerRequest {
+				t.Errorf("window holds %d candles", n)
+			}
+			mu.Lock()
+			requests++
+			mu.Unlock()
+			resp := &model.CandlestickResponse{Instrument: r.Instrument, Granularity: r.Granularity}
+			for ts := from.Truncate(time.Minute); !ts.After(to); ts = ts.Add(time.Minute) {
+				resp.Candles = append(resp.Candles, &model.Candlestick{
+					Time:     model.DateTime(ts.Format(time.RFC3339)),
+					Volume:   ts.Unix(),
+					Complete: true,
+				})
+			}
+			return resp, nil
+		},
+	}
+
+	from := time.Date(2021, 1, 4, 0, 0, 30, 0, time.UTC)
+	to := from.Add(12000 * time.Minute)
+	request := model.NewInstrumentCandlesRequest("EUR_USD", time.Time{}).
+		WithGranularity(model.CandlestickGranularity_M1)
+	result, err := c.Download(request, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests got %d", requests)
+	}
+	if len(result.Candles) != 12000 {
+		t.Fatalf("expected 12000 candles got %d", len(result.Candles))
+	}
+	next := from.Truncate(time.Minute).Add(time.Minute)
+	for i, candle := range result.Candles {
+		ts, _ := candle.Time.Parse()
+		if !ts.Equal(next) {
+			t.Fatalf("candle %d: expected %v got %v", i, next, ts)
+		}
+		next = next.Add(time.Minute)
+	}
+
+	if _, err = c.Download(request, to, from); err != ErrInvalidRange {
+		t.Fatal("expected ErrInvalidRange")
+	}
+}
+
+func TestCandleWindows(t *testing.T) {
+	from := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	windows, err := candleWindows(model.CandlestickGranularity_D, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 3 || !windows[0].Equal(from) || !windows[2].Equal(to) {
+		t.Fatalf("unexpected windows %v", windows)
+	}
+	if _, err = candleWindows("X1", from, to); err != ErrInvalidGranularity {
+		t.Fatal("expected ErrInvalidGranularity")
+	}
+}
@@ -0,0 +1,397 @@
+package oanda
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	recordingExt = ".ndjson.gz"
+	// Recording files are named after the receive time of their first line.
+	recordingNameLayout = "20060102T150405.000000000Z"
+	recordingTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+	// DefaultRecordingMaxSize is the uncompressed size after which a new file is started.
+	DefaultRecordingMaxSize = 64 * 1024 * 1024
+	// DefaultRecordingInterval is the age after which a new file is started.
+	DefaultRecordingInterval = time.Hour
+	// DefaultRecordingFlushInterval bounds how long a line stays buffered in memory.
+	// A line is flushed by the next line or by a timer if none follows in time.
+	DefaultRecordingFlushInterval = time.Second
+)
+
+var (
+	ErrRecorderClosed = errors.New("stream recorder closed")
+)
+
+// StreamRecorderConfig configures a StreamRecorder.
+type StreamRecorderConfig struct {
+	// Dir the files are written to.
+	Dir string
+	// Prefix of the file names, for example the stream and the Account.
+	Prefix string
+	// MaxSize defaults to DefaultRecordingMaxSize.
+	MaxSize int64
+	// Interval defaults to DefaultRecordingInterval.
+	Interval time.Duration
+	// FlushInterval defaults to DefaultRecordingFlushInterval.
+	FlushInterval time.Duration
+}
+
+// StreamRecorder writes the raw lines of a pricing or transaction Stream to rotating
+// gzip compressed NDJSON files. Every line is stored with the time it was received:
+//
+//	{"received":"2021-03-01T12:00:00.250000000Z","line":{"type":"PRICE",...}}
+//
+// A new file is started once the current file holds MaxSize bytes of lines or is
+// older than Interval. The files of a prefix sort in the order they were written.
+// A file that was not closed properly, for example after a crash, can still be
+// replayed up to the last flushed line.
+type StreamRecorder struct {
+	config  StreamRecorderConfig
+	f       *os.File
+	gz      *gzip.Writer
+	buf     []byte
+	size    int64
+	opened  time.Time
+	flushed time.Time
+	timer   *time.Timer
+	err     error
+	closed  bool
+	mu      sync.Mutex
+}
+
+// NewStreamRecorder creates the directory of the recorder. The first file is created
+// when the first line is recorded.
+func NewStreamRecorder(config StreamRecorderConfig) (*StreamRecorder, error) {
+	if len(config.Prefix) == 0 {
+		return nil, errors.New("prefix required")
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultRecordingMaxSize
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultRecordingInterval
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultRecordingFlushInterval
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &StreamRecorder{config: config}, nil
+}
+
+// Pricing records the pricing stream and passes it on to handler, which may be nil.
+func (r *StreamRecorder) Pricing(handler endpoint.PricingStreamHandler) endpoint.PricingStreamHandler {
+	return &recordingPricingHandler{recorder: r, handler: handler}
+}
+
+// Transactions records the transaction stream and passes it on to handler, which may
+// be nil.
+func (r *StreamRecorder) Transactions(handler endpoint.TxStreamHandler) endpoint.TxStreamHandler {
+	return &recordingTxHandler{recorder: r, handler: handler}
+}
+
+// Record writes a line received at the time.
+func (r *StreamRecorder) Record(line []byte, received time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRecorderClosed
+	}
+	received = received.UTC()
+	if r.gz != nil && (r.size >= r.config.MaxSize || received.Sub(r.opened) >= r.config.Interval) {
+		if err := r.closeFile(); err != nil {
+			return r.fail(err)
+		}
+	}
+	if r.gz == nil {
+		if err := r.openFile(received); err != nil {
+			return r.fail(err)
+		}
+	}
+	r.buf = append(r.buf[:0], `{"received":"`...)
+	r.buf = received.AppendFormat(r.buf, recordingTimeLayout)
+	r.buf = append(r.buf, `","line":`...)
+	r.buf = append(r.buf, line...)
+	r.buf = append(r.buf, '}', '\n')
+	if _, err := r.gz.Write(r.buf); err != nil {
+		return r.fail(err)
+	}
+	r.size += int64(len(r.buf))
+	if now := time.Now(); now.Sub(r.flushed) >= r.config.FlushInterval {
+		if err := r.flush(now); err != nil {
+			return r.fail(err)
+		}
+	} else if r.timer == nil {
+		r.timer = time.AfterFunc(r.config.FlushInterval-now.Sub(r.flushed), r.flushBuffered)
+	}
+	return nil
+}
+
+// flush must be called with the lock held.
+func (r *StreamRecorder) flush(now time.Time) error {
+	r.flushed = now
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	return r.gz.Flush()
+}
+
+// flushBuffered flushes the lines buffered since the last flush.
+func (r *StreamRecorder) flushBuffered() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timer = nil
+	if r.closed || r.gz == nil {
+		return
+	}
+	if err := r.flush(time.Now()); err != nil {
+		r.fail(err)
+	}
+}
+
+// fail keeps the first error for Err and Close.
+func (r *StreamRecorder) fail(err error) error {
+	if r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+// Err returns the first error that occurred while recording.
+func (r *StreamRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *StreamRecorder) openFile(received time.Time) error {
+	name := r.config.Prefix + "-" + received.Format(recordingNameLayout) + recordingExt
+	// Appending to an existing file adds another gzip member which is read as part
+	// of the same file
+	f, err := os.OpenFile(filepath.Join(r.config.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.gz = gzip.NewWriter(f)
+	r.size = 0
+	r.opened = received
+	r.flushed = time.Now()
+	return nil
+}
+
+func (r *StreamRecorder) closeFile() error {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	err := r.gz.Close()
+	if err == nil {
+		err = r.f.Sync()
+	}
+	if closeErr := r.f.Close(); err == nil {
+		err = closeErr
+	}
+	r.f = nil
+	r.gz = nil
+	return err
+}
+
+// Close completes the current file. It returns the first error that occurred while
+// recording.
+func (r *StreamRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.err
+	}
+	r.closed = true
+	if r.gz != nil {
+		if err := r.closeFile(); err != nil {
+			r.fail(err)
+		}
+	}
+	return r.err
+}
+
+type recordingPricingHandler struct {
+	recorder *StreamRecorder
+	handler  endpoint.PricingStreamHandler
+}
+
+func (h *recordingPricingHandler) OnRaw(line []byte) {
+	_ = h.recorder.Record(line, time.Now())
+}
+
+func (h *recordingPricingHandler) OnMessage(price *model.StreamClientPrice) error {
+	if h.handler == nil {
+		return nil
+	}
+	return h.handler.OnMessage(price)
+}
+
+func (h *recordingPricingHandler) OnHeartbeat(t time.Time) {
+	if h.handler != nil {
+		h.handler.OnHeartbeat(t)
+	}
+}
+
+func (h *recordingPricingHandler) OnClose() {
+	if h.handler != nil {
+		h.handler.OnClose()
+	}
+}
+
+type recordingTxHandler struct {
+	recorder *StreamRecorder
+	handler  endpoint.TxStreamHandler
+}
+
+func (h *recordingTxHandler) OnRaw(line []byte) {
+	_ = h.recorder.Record(line, time.Now())
+}
+
+func (h *recordingTxHandler) OnMessage(msg model.TransactionMessage) error {
+	if h.handler == nil {
+		return nil
+	}
+	return h.handler.OnMessage(msg)
+}
+
+func (h *recordingTxHandler) OnHeartbeat(t model.DateTime, last model.TransactionID) error {
+	if h.handler == nil {
+		return nil
+	}
+	return h.handler.OnHeartbeat(t, last)
+}
+
+func (h *recordingTxHandler) OnClose() {
+	if h.handler != nil {
+		h.handler.OnClose()
+	}
+}
+
+// RecordingFiles lists the files recorded within dir under the prefix in the order
+// they were written.
+func RecordingFiles(dir string, prefix string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"-*"+recordingExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// RecordedLine is a line read back from a recording.
+type RecordedLine struct {
+	Received time.Time       `json:"received"`
+	Line     json.RawMessage `json:"line"`
+}
+
+// ReadRecording calls fn with every line of the files in order. A file that ends in
+// the middle of a line, because it was not closed properly, is read up to the last
+// complete line. An error returned by fn stops the reading and is returned.
+func ReadRecording(files []string, fn func(line *RecordedLine) error) error {
+	for _, path := range files {
+		if err := readRecordingFile(path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readRecordingFile(path string, fn func(line *RecordedLine) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var rd io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		rd = gz
+	}
+	br := bufio.NewReaderSize(rd, 64*1024)
+	for {
+		b, err := br.ReadBytes('\n')
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			// A missing newline marks a torn line
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line := &RecordedLine{}
+		if err = json.Unmarshal(b, line); err != nil {
+			return err
+		}
+		if err = fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayPricing feeds a recorded pricing stream to the handler. Lines are delivered
+// with the pauses between them divided by speed, so 1 replays at the original speed
+// and 10 ten times faster. A speed of zero or less replays as fast as possible.
+// Replaying stops at the first error returned by the handler. OnClose is called once
+// the replay ends.
+func ReplayPricing(files []string, speed float64, handler endpoint.PricingStreamHandler) error {
+	if handler == nil {
+		return endpoint.ErrNilRequest
+	}
+	defer handler.OnClose()
+	return replay(files, speed, func(line []byte) error {
+		return endpoint.HandlePricingLine(line, handler)
+	})
+}
+
+// ReplayTransactions feeds a recorded transaction stream to the handler at the speed
+// like ReplayPricing.
+func ReplayTransactions(files []string, speed float64, handler endpoint.TxStreamHandler) error {
+	if handler == nil {
+		return endpoint.ErrNilRequest
+	}
+	defer handler.OnClose()
+	return replay(files, speed, func(line []byte) error {
+		return endpoint.HandleTransactionLine(line, handler)
+	})
+}
+
+func replay(files []string, speed float64, handle func(line []byte) error) error {
+	var first, start time.Time
+	return ReadRecording(files, func(line *RecordedLine) error {
+		if speed > 0 {
+			if start.IsZero() {
+				first, start = line.Received, time.Now()
+			}
+			at := start.Add(time.Duration(float64(line.Received.Sub(first)) / speed))
+			if wait := time.Until(at); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		return handle(line.Line)
+	})
+}
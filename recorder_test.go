@@ -0,0 +1,209 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedPrices struct {
+	prices     []string
+	heartbeats int
+	closed     bool
+	mu         sync.Mutex
+}
+
+func (h *recordedPrices) OnMessage(price *model.StreamClientPrice) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prices = append(h.prices, string(price.Instrument))
+	return nil
+}
+
+func (h *recordedPrices) OnHeartbeat(time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeats++
+}
+
+func (h *recordedPrices) OnClose() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+}
+
+func (h *recordedPrices) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.prices)
+}
+
+func priceLine(instrument string, bid string) []byte {
+	return []byte(`{"type":"PRICE","instrument":"` + instrument + `","time":"2021-03-01T12:00:00.000000000Z",` +
+		`"bids":[{"price":"` + bid + `","liquidity":1000000}],"asks":[{"price":"1.3","liquidity":1000000}],"tradeable":true}`)
+}
+
+func TestStreamRecorderRotation(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir, Prefix: "pricing", MaxSize: 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		if err = rec.Record(priceLine("EUR_USD", "1.1"), start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	heartbeat := []byte(`{"type":"HEARTBEAT","time":"2021-03-01T12:00:06.000000000Z"}`)
+	// Lines an hour later go into a new file
+	if err = rec.Record(heartbeat, start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err = rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = rec.Record(heartbeat, start); err != ErrRecorderClosed {
+		t.Fatalf("expected ErrRecorderClosed got %v", err)
+	}
+
+	files, err := RecordingFiles(dir, "pricing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("expected 4 files got %d", len(files))
+	}
+	var received []time.Time
+	err = ReadRecording(files, func(line *RecordedLine) error {
+		received = append(received, line.Received)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 7 || !received[6].Equal(start.Add(time.Hour)) {
+		t.Fatalf("unexpected receive times %v", received)
+	}
+
+	handler := &recordedPrices{}
+	if err = ReplayPricing(files, 0, handler); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.prices) != 6 || handler.heartbeats != 1 || !handler.closed {
+		t.Fatalf("unexpected replay %d prices %d heartbeats", len(handler.prices), handler.heartbeats)
+	}
+}
+
+func TestStreamRecorderTornFile(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir, Prefix: "pricing", FlushInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err = rec.Record(priceLine("EUR_USD", "1.1"), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Read the file without closing the recorder as after a crash
+	files, _ := RecordingFiles(dir, "pricing")
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file got %d", len(files))
+	}
+	handler := &recordedPrices{}
+	if err = ReplayPricing(files, 0, handler); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.prices) != 3 {
+		t.Fatalf("expected 3 prices got %d", len(handler.prices))
+	}
+	_ = rec.Close()
+}
+
+func TestStreamRecorderFlushTimer(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir, Prefix: "pricing", FlushInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	if err = rec.Record(priceLine("EUR_USD", "1.1"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// The line is flushed without another line following it
+	files, _ := RecordingFiles(dir, "pricing")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		handler := &recordedPrices{}
+		if err = ReplayPricing(files, 0, handler); err == nil && len(handler.prices) == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected the line to be flushed")
+}
+
+func TestStreamReplaySpeed(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir, Prefix: "pricing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_ = rec.Record(priceLine("EUR_USD", "1.1"), start)
+	_ = rec.Record(priceLine("EUR_USD", "1.2"), start.Add(200*time.Millisecond))
+	if err = rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := RecordingFiles(dir, "pricing")
+	began := time.Now()
+	if err = ReplayPricing(files, 2, &recordedPrices{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(began); elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("expected the replay to take 100ms got %v", elapsed)
+	}
+}
+
+func TestStreamRecorderLive(t *testing.T) {
+	s, conn := newTestServer(t, 1000, oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1, Ask: 1.1002})
+	dir := t.TempDir()
+	rec, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir, Prefix: "pricing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := &recordedPrices{}
+	stream, err := conn.StartPricingStream("101-001-1-001", &model.PricingStreamRequest{
+		Instruments: []model.InstrumentName{"EUR_USD"},
+		Snapshot:    true,
+	}, rec.Pricing(live))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Quote(oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1001, Ask: 1.1003})
+	deadline := time.Now().Add(5 * time.Second)
+	for live.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = stream.Close()
+	if err = rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := RecordingFiles(dir, "pricing")
+	replayed := &recordedPrices{}
+	if err = ReplayPricing(files, 0, replayed); err != nil {
+		t.Fatal(err)
+	}
+	if live.count() < 2 || replayed.count() != live.count() {
+		t.Fatalf("expected the %d live prices replayed got %d", live.count(), replayed.count())
+	}
+	if _, err = os.Stat(files[0]); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,108 @@
+package oanda
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// txReplay feeds transactions to a report in ID order. Transactions that were
+// already added are skipped, so overlapping ranges may be added.
+type txReplay struct {
+	lastID uint64
+}
+
+// parsed returns the messages of the transactions of a TransactionsResponse.
+func parsed(transactions []*model.TransactionParser) []model.TransactionMessage {
+	messages := make([]model.TransactionMessage, len(transactions))
+	for i, tx := range transactions {
+		messages[i] = tx.Parse()
+	}
+	return messages
+}
+
+// add calls fn with every message after the last one added and stops at the
+// first error.
+func (r *txReplay) add(messages []model.TransactionMessage, fn func(model.TransactionMessage, *model.Transaction) error) error {
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		tx := msg.Get()
+		id, err := parseTxID(tx.Id)
+		if err != nil {
+			return err
+		}
+		if id <= r.lastID {
+			continue
+		}
+		if err = fn(msg, tx); err != nil {
+			return err
+		}
+		r.lastID = id
+	}
+	return nil
+}
+
+// reportGroup is a kind of group of a report with a row per key.
+type reportGroup struct {
+	name string
+	keys []string
+	rows [][]string
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+// writeJSON writes the report as indented JSON.
+func writeJSON(w io.Writer, report interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// writeCSV writes the header and the rows as CSV.
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	return cw.WriteAll(rows)
+}
+
+// writeGroupsCSV writes the groups as CSV with a row per key. The first columns
+// are the name of the group and the key.
+func writeGroupsCSV(w io.Writer, header []string, groups []reportGroup) error {
+	var rows [][]string
+	for _, g := range groups {
+		for i, row := range g.rows {
+			rows = append(rows, append([]string{g.name, g.keys[i]}, row...))
+		}
+	}
+	return writeCSV(w, append([]string{"group", "key"}, header...), rows)
+}
+
+// writeGroupsMarkdown writes the title and a Markdown table per group.
+func writeGroupsMarkdown(w io.Writer, title string, header []string, groups []reportGroup) error {
+	var b strings.Builder
+	b.WriteString("# " + title + "\n")
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n## %s%s\n\n", strings.ToUpper(g.name[:1]), g.name[1:])
+		b.WriteString("| " + g.name + " | " + strings.Join(header, " | ") + " |\n")
+		b.WriteString("|" + strings.Repeat(" --- |", len(header)+1) + "\n")
+		for i, row := range g.rows {
+			key := g.keys[i]
+			if len(key) == 0 {
+				key = "-"
+			}
+			b.WriteString("| " + key + " | " + strings.Join(row, " | ") + " |\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
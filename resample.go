@@ -0,0 +1,182 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+	"time"
+)
+
+var (
+	ErrResampleGranularity = errors.New("target granularity is not a multiple of the source granularity")
+	ErrResampleOrder       = errors.New("candles are not in time order")
+)
+
+// Resample combines candles of the source granularity into candles of the higher
+// target granularity using the alignment. The open of each resampled candle is the
+// open of its first source candle, the close that of its last, the high and low the
+// extremes of all of them, and the volume their sum. Bid, ask and mid are combined
+// independently and only if present on every source candle.
+//
+// A resampled candle is complete if a later candle exists or if its last source
+// candle is complete and ends where the resampled candle ends. Resampling complete
+// history therefore matches what InstrumentCandles returns for the same range with
+// smoothing disabled.
+func Resample(
+	candles []model.Candlestick,
+	source model.CandlestickGranularity,
+	target model.CandlestickGranularity,
+	alignment *Alignment,
+) ([]model.Candlestick, error) {
+	if alignment == nil {
+		alignment = DefaultAlignment()
+	}
+	if err := checkResample(source, target); err != nil {
+		return nil, err
+	}
+	if len(candles) == 0 {
+		return nil, nil
+	}
+
+	var (
+		result   = make([]model.Candlestick, 0, 16)
+		current  *model.Candlestick
+		start    time.Time
+		end      time.Time
+		previous time.Time
+		last     *model.Candlestick
+		lastTime time.Time
+	)
+	for i := range candles {
+		candle := &candles[i]
+		t, err := candle.Time.Parse()
+		if err != nil {
+			return nil, err
+		}
+		if !previous.IsZero() && !t.After(previous) {
+			return nil, ErrResampleOrder
+		}
+		previous = t
+
+		if current == nil || !t.Before(end) {
+			if current != nil {
+				// A later candle exists
+				current.Complete = true
+			}
+			if start, err = alignment.Start(target, t); err != nil {
+				return nil, err
+			}
+			if end, err = alignment.Next(target, start); err != nil {
+				return nil, err
+			}
+			result = append(result, model.Candlestick{
+				Time:   model.DateTime(start.Format(candleTimeLayout)),
+				Bid:    copyCandlestickData(candle.Bid),
+				Ask:    copyCandlestickData(candle.Ask),
+				Mid:    copyCandlestickData(candle.Mid),
+				Volume: candle.Volume,
+			})
+			current = &result[len(result)-1]
+		} else {
+			current.Bid = mergeCandlestickData(current.Bid, candle.Bid)
+			current.Ask = mergeCandlestickData(current.Ask, candle.Ask)
+			current.Mid = mergeCandlestickData(current.Mid, candle.Mid)
+			current.Volume += candle.Volume
+		}
+		last = candle
+		lastTime = t
+	}
+
+	if last.Complete {
+		lastEnd, err := alignment.Next(source, lastTime)
+		if err != nil {
+			return nil, err
+		}
+		current.Complete = !lastEnd.Before(end)
+	}
+	return result, nil
+}
+
+// ResampleStore reads the candles within [from, to) from the store and resamples them.
+// The range is widened to whole target candles so the first and last resampled
+// candles are not partial.
+func ResampleStore(
+	store *CandleStore,
+	target model.CandlestickGranularity,
+	alignment *Alignment,
+	from, to time.Time,
+) ([]model.Candlestick, error) {
+	if alignment == nil {
+		alignment = DefaultAlignment()
+	}
+	start, err := alignment.Start(target, from)
+	if err != nil {
+		return nil, err
+	}
+	if !to.IsZero() {
+		end, err := alignment.Start(target, to)
+		if err != nil {
+			return nil, err
+		}
+		if end.Before(to) {
+			if to, err = alignment.Next(target, end); err != nil {
+				return nil, err
+			}
+		}
+	}
+	candles, err := store.Range(start, to)
+	if err != nil {
+		return nil, err
+	}
+	return Resample(candles, store.Granularity(), target, alignment)
+}
+
+func checkResample(source, target model.CandlestickGranularity) error {
+	s, ok := GranularityDuration(source)
+	if !ok {
+		return ErrInvalidGranularity
+	}
+	t, ok := GranularityDuration(target)
+	if !ok {
+		return ErrInvalidGranularity
+	}
+	switch target {
+	case model.CandlestickGranularity_W, model.CandlestickGranularity_M:
+		// Weeks and months are made of whole days
+		if s > time.Hour*24 || (time.Hour*24)%s != 0 {
+			return ErrResampleGranularity
+		}
+	default:
+		if t <= s || t%s != 0 {
+			return ErrResampleGranularity
+		}
+		// Hour aligned candles do not nest within day aligned ones
+		if t >= 2*time.Hour && s < 2*time.Hour && time.Hour%s != 0 {
+			return ErrResampleGranularity
+		}
+	}
+	return nil
+}
+
+func copyCandlestickData(d *model.CandlestickData) *model.CandlestickData {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	return &c
+}
+
+// mergeCandlestickData extends the range of a with the later candle b. The result
+// is nil if either is missing.
+func mergeCandlestickData(a, b *model.CandlestickData) *model.CandlestickData {
+	if a == nil || b == nil {
+		return nil
+	}
+	if b.High.AsFloat64(0) > a.High.AsFloat64(0) {
+		a.High = b.High
+	}
+	if b.Low.AsFloat64(0) < a.Low.AsFloat64(0) {
+		a.Low = b.Low
+	}
+	a.Close = b.Close
+	return a
+}
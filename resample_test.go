@@ -0,0 +1,98 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAlignment(t *testing.T) {
+	a := DefaultAlignment()
+	for _, c := range []struct {
+		g     model.CandlestickGranularity
+		t     time.Time
+		start time.Time
+		next  time.Time
+	}{
+		// Winter, New York is UTC-5
+		{"M5", time.Date(2021, 1, 5, 10, 7, 12, 0, time.UTC), time.Date(2021, 1, 5, 10, 5, 0, 0, time.UTC), time.Date(2021, 1, 5, 10, 10, 0, 0, time.UTC)},
+		{"H2", time.Date(2021, 1, 5, 23, 30, 0, 0, time.UTC), time.Date(2021, 1, 5, 22, 0, 0, 0, time.UTC), time.Date(2021, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"H4", time.Date(2021, 1, 5, 21, 30, 0, 0, time.UTC), time.Date(2021, 1, 5, 18, 0, 0, 0, time.UTC), time.Date(2021, 1, 5, 22, 0, 0, 0, time.UTC)},
+		{"D", time.Date(2021, 1, 5, 12, 0, 0, 0, time.UTC), time.Date(2021, 1, 4, 22, 0, 0, 0, time.UTC), time.Date(2021, 1, 5, 22, 0, 0, 0, time.UTC)},
+		// Summer, New York is UTC-4
+		{"D", time.Date(2021, 7, 5, 12, 0, 0, 0, time.UTC), time.Date(2021, 7, 4, 21, 0, 0, 0, time.UTC), time.Date(2021, 7, 5, 21, 0, 0, 0, time.UTC)},
+		// Weeks start Friday 17:00 New York
+		{"W", time.Date(2021, 1, 6, 12, 0, 0, 0, time.UTC), time.Date(2021, 1, 1, 22, 0, 0, 0, time.UTC), time.Date(2021, 1, 8, 22, 0, 0, 0, time.UTC)},
+		// The day spanning the DST change is 23 hours long
+		{"D", time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC), time.Date(2021, 3, 13, 22, 0, 0, 0, time.UTC), time.Date(2021, 3, 14, 21, 0, 0, 0, time.UTC)},
+		// February trading starts on the evening of January 31st
+		{"M", time.Date(2021, 2, 10, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 31, 22, 0, 0, 0, time.UTC), time.Date(2021, 2, 28, 22, 0, 0, 0, time.UTC)},
+		{"M", time.Date(2021, 1, 31, 23, 0, 0, 0, time.UTC), time.Date(2021, 1, 31, 22, 0, 0, 0, time.UTC), time.Date(2021, 2, 28, 22, 0, 0, 0, time.UTC)},
+	} {
+		start, err := a.Start(c.g, c.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := a.Next(c.g, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !start.Equal(c.start) || !next.Equal(c.next) {
+			t.Errorf("%s %v: got %v..%v expected %v..%v", c.g, c.t, start, next, c.start, c.next)
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	// M1 candles from 20:00 to 23:59 UTC. The New York close is 22:00 UTC.
+	start := time.Date(2021, 1, 5, 20, 0, 0, 0, time.UTC)
+	var candles []model.Candlestick
+	for i := 0; i < 240; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		price := func(offset int) model.PriceValue {
+			return model.PriceValue("1." + strconv.Itoa(20000+i+offset))
+		}
+		candles = append(candles, model.Candlestick{
+			Time: model.DateTime(ts.Format(time.RFC3339)),
+			Mid: &model.CandlestickData{
+				Open: price(0), High: price(5), Low: price(-5), Close: price(1),
+			},
+			Volume:   1,
+			Complete: i < 239,
+		})
+	}
+
+	a, err := NewAlignment(17, "America/New_York", model.WeeklyAlignment_Friday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Resample(candles, "M1", "H2", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected 2 candles got %d", len(result))
+	}
+	first, second := result[0], result[1]
+	if ts, _ := first.Time.Parse(); !ts.Equal(start) {
+		t.Fatalf("unexpected start %v", ts)
+	}
+	if ts, _ := second.Time.Parse(); !ts.Equal(start.Add(2 * time.Hour)) {
+		t.Fatalf("unexpected start %v", ts)
+	}
+	if first.Mid.Open != "1.20000" || first.Mid.Close != "1.20120" ||
+		first.Mid.High != "1.20124" || first.Mid.Low != "1.19995" || first.Volume != 120 {
+		t.Fatalf("unexpected candle %+v", first.Mid)
+	}
+	if !first.Complete || second.Complete || first.Bid != nil {
+		t.Fatal("unexpected completeness")
+	}
+
+	if _, err = Resample(candles, "M1", "M1", a); err != ErrResampleGranularity {
+		t.Fatal("expected ErrResampleGranularity")
+	}
+	if _, err = Resample(candles, "H3", "H8", a); err != ErrResampleGranularity {
+		t.Fatal("expected ErrResampleGranularity")
+	}
+}
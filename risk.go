@@ -0,0 +1,637 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RiskCheck identifies the pre-trade check that refused an order.
+type RiskCheck string
+
+const (
+	RiskCheck_INSTRUMENT      RiskCheck = "INSTRUMENT"
+	RiskCheck_KILL_SWITCH     RiskCheck = "KILL_SWITCH"
+	RiskCheck_MAX_UNITS       RiskCheck = "MAX_UNITS"
+	RiskCheck_MAX_NOTIONAL    RiskCheck = "MAX_NOTIONAL"
+	RiskCheck_MAX_EXPOSURE    RiskCheck = "MAX_EXPOSURE"
+	RiskCheck_MAX_OPEN_TRADES RiskCheck = "MAX_OPEN_TRADES"
+	RiskCheck_ORDER_RATE      RiskCheck = "ORDER_RATE"
+)
+
+// RiskError is returned by the RiskGate for an order that breaches a limit.
+type RiskError struct {
+	Check      RiskCheck
+	Instrument model.InstrumentName
+	// The value the order would have reached and the limit it breaches.
+	Value float64
+	Limit float64
+}
+
+func (e *RiskError) Error() string {
+	msg := "risk check " + string(e.Check) + " failed"
+	if len(e.Instrument) > 0 {
+		msg += " for " + string(e.Instrument)
+	}
+	if e.Limit > 0 {
+		msg += ": " + strconv.FormatFloat(e.Value, 'f', -1, 64) +
+			" exceeds " + strconv.FormatFloat(e.Limit, 'f', -1, 64)
+	}
+	return msg
+}
+
+// RiskLimits configures the RiskGate. A zero limit is not enforced. Units and
+// notional limits apply to the position an order would result in, notional and
+// exposure are in the home currency of the CurrencyConverter.
+type RiskLimits struct {
+	// Maximum absolute units of the position per instrument.
+	MaxUnits map[model.InstrumentName]float64
+	// Applies to instruments missing from MaxUnits.
+	DefaultMaxUnits float64
+	// Maximum notional of the position per instrument.
+	MaxNotional map[model.InstrumentName]float64
+	// Applies to instruments missing from MaxNotional.
+	DefaultMaxNotional float64
+	// Maximum notional of all positions of an Account together.
+	MaxExposure float64
+	// Maximum orders accepted within any second across all Accounts.
+	MaxOrdersPerSecond int
+	// Maximum number of open trades of an Account.
+	MaxOpenTrades int64
+	// The instruments that may be traded. Empty allows every instrument.
+	Instruments []model.InstrumentName
+}
+
+// An order accepted by the RiskGate that does not show up on the transaction stream
+// within this time is assumed to have failed.
+const riskAcceptedTimeout = 10 * time.Second
+
+type riskPosition struct {
+	units float64
+	// The last known price used if there is no quote.
+	price float64
+}
+
+// riskOrder is an order accepted by the RiskGate or pending in the Account.
+type riskOrder struct {
+	instrument model.InstrumentName
+	units      float64
+	price      float64
+	// Whether the order may open a trade.
+	opens bool
+	// The order replaced by an accepted order.
+	replaces model.OrderID
+	// When an accepted order was checked.
+	accepted time.Time
+}
+
+type riskAccount struct {
+	positions map[model.InstrumentName]*riskPosition
+	// The pending orders by ID.
+	orders map[model.OrderID]*riskOrder
+	// The orders accepted but not yet seen on the transaction stream.
+	accepted   []*riskOrder
+	openTrades int64
+	lastID     uint64
+}
+
+// RiskGate is an endpoint.OrderGuard that enforces RiskLimits on every order
+// created through a Connection. Install it with Connection.SetOrderGuard,
+// Client.SetOrderGuard or on any other API with an endpoint.GuardedAPI.
+//
+// The gate knows the positions and open trades of an Account from Update and the
+// pending orders from UpdateOrders. It keeps them current from the order, cancel and
+// fill transactions when registered as the endpoint.TxStreamHandler. Orders it
+// accepted count as pending until their transaction arrives. Positions and market
+// orders are valued at the quotes of the converter's Pricing, other orders at their
+// price.
+//
+// The limits apply to the position that results if every pending order in the
+// direction of an order fills as well. Take Profit, Stop Loss and Trailing Stop
+// Loss Orders and orders that, together with the pending orders in their
+// direction, do not exceed the opposite net position reduce the position. They
+// always pass, even with the kill switch engaged, except for the order rate.
+type RiskGate struct {
+	limits    RiskLimits
+	allowed   map[model.InstrumentName]struct{}
+	converter *CurrencyConverter
+	accounts  map[model.AccountID]*riskAccount
+	orders    []time.Time
+	killed    bool
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func NewRiskGate(limits RiskLimits, converter *CurrencyConverter) *RiskGate {
+	g := &RiskGate{
+		converter: converter,
+		accounts:  make(map[model.AccountID]*riskAccount),
+		now:       time.Now,
+	}
+	g.SetLimits(limits)
+	return g
+}
+
+func (g *RiskGate) Limits() RiskLimits {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.limits
+}
+
+// SetLimits replaces the limits. Orders already accepted are not affected.
+func (g *RiskGate) SetLimits(limits RiskLimits) {
+	allowed := make(map[model.InstrumentName]struct{}, len(limits.Instruments))
+	for _, instrument := range limits.Instruments {
+		allowed[instrument] = struct{}{}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limits = limits
+	g.allowed = allowed
+}
+
+// Kill engages the kill switch. Only position reducing orders pass until Resume.
+func (g *RiskGate) Kill() {
+	g.mu.Lock()
+	g.killed = true
+	g.mu.Unlock()
+}
+
+// Resume releases the kill switch.
+func (g *RiskGate) Resume() {
+	g.mu.Lock()
+	g.killed = false
+	g.mu.Unlock()
+}
+
+func (g *RiskGate) Killed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.killed
+}
+
+// Update replaces the positions and open trades of the Account. Pending orders
+// missing from the Account are dropped. An Account older than the transactions
+// already applied is ignored.
+func (g *RiskGate) Update(account *model.Account) {
+	if account == nil {
+		return
+	}
+	id, _ := parseTxID(account.LastTransactionID)
+	positions := make(map[model.InstrumentName]*riskPosition, len(account.Positions))
+	for _, p := range account.Positions {
+		if p == nil {
+			continue
+		}
+		position := &riskPosition{}
+		if p.Long != nil {
+			position.units += p.Long.Units.AsFloat64(0)
+			position.price = p.Long.AveragePrice.AsFloat64(0)
+		}
+		if p.Short != nil {
+			position.units += p.Short.Units.AsFloat64(0)
+			if position.units < 0 {
+				position.price = p.Short.AveragePrice.AsFloat64(0)
+			}
+		}
+		positions[p.Instrument] = position
+	}
+	pending := make(map[model.OrderID]struct{}, len(account.Orders))
+	for _, o := range account.Orders {
+		if o != nil {
+			pending[o.Id] = struct{}{}
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state := g.account(account.Id)
+	if state.lastID > id {
+		return
+	}
+	state.positions = positions
+	state.openTrades = account.OpenTradeCount
+	state.lastID = id
+	for orderID := range state.orders {
+		if _, ok := pending[orderID]; !ok {
+			delete(state.orders, orderID)
+		}
+	}
+}
+
+// UpdateOrders replaces the pending orders of the Account with those of an
+// OrdersPending response.
+func (g *RiskGate) UpdateOrders(accountID model.AccountID, orders []*model.OrderParser) {
+	pending := make(map[model.OrderID]*riskOrder, len(orders))
+	for _, o := range orders {
+		if o == nil {
+			continue
+		}
+		switch model.OrderType(o.Type) {
+		case model.OrderType_MARKET, model.OrderType_LIMIT, model.OrderType_STOP, model.OrderType_MARKET_IF_TOUCHED:
+			if units := o.Units.AsFloat64(0); units != 0 {
+				pending[model.OrderID(o.Id)] = &riskOrder{
+					instrument: o.Instrument,
+					units:      units,
+					price:      o.Price.AsFloat64(0),
+					opens:      o.PositionFill != model.OrderPositionFill_REDUCE_ONLY,
+				}
+			}
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.account(accountID).orders = pending
+}
+
+func (g *RiskGate) OnMessage(msg model.TransactionMessage) error {
+	tx := msg.Get()
+	id, err := parseTxID(tx.Id)
+	if err != nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	account := g.account(tx.AccountID)
+	if id <= account.lastID {
+		return nil
+	}
+	account.lastID = id
+	orderID := model.OrderID(tx.Id)
+	switch tx := msg.(type) {
+	case *model.MarketOrderTransaction:
+		account.created(orderID, tx.Instrument, tx.Units, "", tx.PositionFill)
+	case *model.LimitOrderTransaction:
+		account.created(orderID, tx.Instrument, tx.Units, tx.Price, tx.PositionFill)
+	case *model.StopOrderTransaction:
+		account.created(orderID, tx.Instrument, tx.Units, tx.Price, tx.PositionFill)
+	case *model.MarketIfTouchedOrderTransaction:
+		account.created(orderID, tx.Instrument, tx.Units, tx.Price, tx.PositionFill)
+	case *model.MarketOrderRejectTransaction:
+		account.settle(tx.Instrument, tx.Units.AsFloat64(0))
+	case *model.LimitOrderRejectTransaction:
+		account.settle(tx.Instrument, tx.Units.AsFloat64(0))
+	case *model.StopOrderRejectTransaction:
+		account.settle(tx.Instrument, tx.Units.AsFloat64(0))
+	case *model.MarketIfTouchedOrderRejectTransaction:
+		account.settle(tx.Instrument, tx.Units.AsFloat64(0))
+	case *model.OrderCancelTransaction:
+		delete(account.orders, tx.OrderID)
+	case *model.OrderFillTransaction:
+		account.fill(tx)
+	}
+	return nil
+}
+
+func (g *RiskGate) OnHeartbeat(time model.DateTime, lastTransactionID model.TransactionID) error {
+	return nil
+}
+
+func (g *RiskGate) OnClose() {}
+
+func (g *RiskGate) account(accountID model.AccountID) *riskAccount {
+	account := g.accounts[accountID]
+	if account == nil {
+		account = &riskAccount{
+			positions: make(map[model.InstrumentName]*riskPosition),
+			orders:    make(map[model.OrderID]*riskOrder),
+		}
+		g.accounts[accountID] = account
+	}
+	return account
+}
+
+// created turns the accepted order matching an order created on the Account into a
+// pending order.
+func (a *riskAccount) created(
+	id model.OrderID,
+	instrument model.InstrumentName,
+	units model.DecimalNumber,
+	price model.PriceValue,
+	fill model.OrderPositionFill,
+) {
+	order := a.settle(instrument, units.AsFloat64(0))
+	if order == nil {
+		order = &riskOrder{
+			instrument: instrument,
+			units:      units.AsFloat64(0),
+			opens:      fill != model.OrderPositionFill_REDUCE_ONLY,
+		}
+	}
+	if order.units == 0 {
+		// Market orders closing a trade or position
+		return
+	}
+	order.price = price.AsFloat64(order.price)
+	order.replaces = ""
+	a.orders[id] = order
+}
+
+// settle removes and returns the first accepted order of the instrument and units.
+func (a *riskAccount) settle(instrument model.InstrumentName, units float64) *riskOrder {
+	for i, order := range a.accepted {
+		if order.instrument == instrument && order.units == units {
+			a.accepted = append(a.accepted[:i], a.accepted[i+1:]...)
+			return order
+		}
+	}
+	return nil
+}
+
+func (a *riskAccount) fill(fill *model.OrderFillTransaction) {
+	units := fill.Units.AsFloat64(0)
+	if order := a.orders[fill.OrderID]; order != nil {
+		order.units -= units
+		if order.units*units <= 0 {
+			delete(a.orders, fill.OrderID)
+		}
+	}
+	position := a.positions[fill.Instrument]
+	if position == nil {
+		position = &riskPosition{}
+		a.positions[fill.Instrument] = position
+	}
+	position.units += units
+	if price := fill.Price.AsFloat64(0); price > 0 {
+		position.price = price
+	}
+	if fill.TradeOpened != nil {
+		a.openTrades++
+	}
+	a.openTrades -= int64(len(fill.TradesClosed))
+	if a.openTrades < 0 {
+		a.openTrades = 0
+	}
+}
+
+// expire drops the accepted orders checked before the cutoff.
+func (a *riskAccount) expire(cutoff time.Time) {
+	i := 0
+	for i < len(a.accepted) && a.accepted[i].accepted.Before(cutoff) {
+		i++
+	}
+	a.accepted = a.accepted[i:]
+}
+
+// pending calls fn for every accepted and pending order except the replaced order
+// and the orders replaced by accepted orders.
+func (a *riskAccount) pending(replaced model.OrderID, fn func(order *riskOrder)) {
+	for _, order := range a.accepted {
+		fn(order)
+	}
+	for id, order := range a.orders {
+		if id == replaced || a.replacing(id) {
+			continue
+		}
+		fn(order)
+	}
+}
+
+func (a *riskAccount) replacing(id model.OrderID) bool {
+	for _, order := range a.accepted {
+		if order.replaces == id {
+			return true
+		}
+	}
+	return false
+}
+
+// worst returns the units of the instrument's position if every pending order in
+// the direction of units fills, and the price to value them at without a quote.
+// With zero units it returns the larger of both directions.
+func (a *riskAccount) worst(instrument model.InstrumentName, units float64, replaced model.OrderID) (float64, float64) {
+	var current, long, short, price float64
+	if position := a.positions[instrument]; position != nil {
+		current = position.units
+		price = position.price
+	}
+	a.pending(replaced, func(order *riskOrder) {
+		if order.instrument != instrument {
+			return
+		}
+		if order.units > 0 {
+			long += order.units
+		} else {
+			short += order.units
+		}
+		if price <= 0 {
+			price = order.price
+		}
+	})
+	switch {
+	case units > 0:
+		return current + long + units, price
+	case units < 0:
+		return current + short + units, price
+	case math.Abs(current+long) >= math.Abs(current+short):
+		return current + long, price
+	}
+	return current + short, price
+}
+
+func (g *RiskGate) CheckOrderCreate(accountID model.AccountID, request model.OrderRequest) error {
+	return g.check(accountID, request, "")
+}
+
+// CheckOrderReplace checks the replacing order without the order it replaces.
+func (g *RiskGate) CheckOrderReplace(accountID model.AccountID, specifier model.OrderSpecifier, request model.OrderRequest) error {
+	return g.check(accountID, request, model.OrderID(specifier))
+}
+
+// CheckTradeModify only limits the order rate since the dependent orders of a trade
+// always reduce its position.
+func (g *RiskGate) CheckTradeModify(accountID model.AccountID, specifier model.TradeSpecifier, request *model.TradeModifyRequest) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.checkRate()
+}
+
+func (g *RiskGate) check(accountID model.AccountID, request model.OrderRequest, replaced model.OrderID) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	order, err := g.checkOrder(accountID, request, replaced)
+	if err != nil {
+		return err
+	}
+	if err = g.checkRate(); err != nil {
+		return err
+	}
+	if order != nil {
+		account := g.account(accountID)
+		account.accepted = append(account.accepted, order)
+	}
+	return nil
+}
+
+// checkOrder must be called with the lock held. It returns the order to count as
+// accepted or nil for orders that close a trade.
+func (g *RiskGate) checkOrder(accountID model.AccountID, request model.OrderRequest, replaced model.OrderID) (*riskOrder, error) {
+	instrument, units, price, fill, ok := orderRequestTerms(request)
+	if !ok {
+		// Orders closing a trade
+		return nil, nil
+	}
+	now := g.now()
+	account := g.account(accountID)
+	account.expire(now.Add(-riskAcceptedTimeout))
+	var current float64
+	if position := account.positions[instrument]; position != nil {
+		current = position.units
+	}
+	result, last := account.worst(instrument, units, replaced)
+	// The order and the pending orders in its direction must not exceed the position
+	reducing := fill != model.OrderPositionFill_OPEN_ONLY && current*units < 0 &&
+		math.Abs(result-current) <= math.Abs(current)
+	order := &riskOrder{
+		instrument: instrument,
+		units:      units,
+		price:      price,
+		opens:      !reducing && fill != model.OrderPositionFill_REDUCE_ONLY,
+		replaces:   replaced,
+		accepted:   now,
+	}
+	if g.killed && !reducing {
+		return nil, &RiskError{Check: RiskCheck_KILL_SWITCH, Instrument: instrument}
+	}
+	if reducing {
+		return order, nil
+	}
+
+	if len(g.allowed) > 0 {
+		if _, ok := g.allowed[instrument]; !ok {
+			return nil, &RiskError{Check: RiskCheck_INSTRUMENT, Instrument: instrument}
+		}
+	}
+	limit, ok := g.limits.MaxUnits[instrument]
+	if !ok {
+		limit = g.limits.DefaultMaxUnits
+	}
+	if limit > 0 && math.Abs(result) > limit {
+		return nil, &RiskError{Check: RiskCheck_MAX_UNITS, Instrument: instrument, Value: math.Abs(result), Limit: limit}
+	}
+	if max := g.limits.MaxOpenTrades; max > 0 && order.opens {
+		trades := account.openTrades
+		account.pending(replaced, func(order *riskOrder) {
+			if order.opens {
+				trades++
+			}
+		})
+		if trades >= max {
+			return nil, &RiskError{Check: RiskCheck_MAX_OPEN_TRADES, Instrument: instrument, Value: float64(trades + 1), Limit: float64(max)}
+		}
+	}
+
+	limit, ok = g.limits.MaxNotional[instrument]
+	if !ok {
+		limit = g.limits.DefaultMaxNotional
+	}
+	if limit <= 0 && g.limits.MaxExposure <= 0 {
+		return order, nil
+	}
+	if price <= 0 {
+		price = g.price(instrument, last)
+	}
+	notional, err := g.notional(instrument, result, price)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && notional > limit {
+		return nil, &RiskError{Check: RiskCheck_MAX_NOTIONAL, Instrument: instrument, Value: notional, Limit: limit}
+	}
+	if max := g.limits.MaxExposure; max > 0 {
+		exposure := notional
+		others := make(map[model.InstrumentName]struct{})
+		for other := range account.positions {
+			others[other] = struct{}{}
+		}
+		account.pending(replaced, func(order *riskOrder) {
+			others[order.instrument] = struct{}{}
+		})
+		delete(others, instrument)
+		for other := range others {
+			units, last := account.worst(other, 0, replaced)
+			value, err := g.notional(other, units, g.price(other, last))
+			if err != nil {
+				return nil, err
+			}
+			exposure += value
+		}
+		if exposure > max {
+			return nil, &RiskError{Check: RiskCheck_MAX_EXPOSURE, Instrument: instrument, Value: exposure, Limit: max}
+		}
+	}
+	return order, nil
+}
+
+// price returns the mid quote of the instrument or the fallback without a quote.
+func (g *RiskGate) price(instrument model.InstrumentName, fallback float64) float64 {
+	if g.converter != nil {
+		if q, ok := g.converter.pricing.Quote(instrument); ok {
+			return q.Mid()
+		}
+	}
+	return fallback
+}
+
+// notional values the units at the price in the home currency.
+func (g *RiskGate) notional(instrument model.InstrumentName, units, price float64) (float64, error) {
+	if units == 0 {
+		return 0, nil
+	}
+	if g.converter == nil {
+		return 0, ErrNoConversion
+	}
+	_, quote, ok := SplitInstrument(instrument)
+	if !ok {
+		return 0, ErrInstrumentNotFound
+	}
+	if price <= 0 {
+		return 0, ErrNoQuote
+	}
+	return g.converter.HomeValue(math.Abs(units)*price, quote)
+}
+
+// checkRate must be called with the lock held. An accepted order counts towards the
+// rate.
+func (g *RiskGate) checkRate() error {
+	max := g.limits.MaxOrdersPerSecond
+	if max <= 0 {
+		return nil
+	}
+	now := g.now()
+	cutoff := now.Add(-time.Second)
+	i := 0
+	for i < len(g.orders) && !g.orders[i].After(cutoff) {
+		i++
+	}
+	g.orders = g.orders[i:]
+	if len(g.orders) >= max {
+		return &RiskError{Check: RiskCheck_ORDER_RATE, Value: float64(len(g.orders) + 1), Limit: float64(max)}
+	}
+	g.orders = append(g.orders, now)
+	return nil
+}
+
+// orderRequestTerms returns the instrument, signed units, price and position fill
+// of an order request. Returns false for orders that close a trade.
+func orderRequestTerms(request model.OrderRequest) (
+	instrument model.InstrumentName,
+	units float64,
+	price float64,
+	fill model.OrderPositionFill,
+	ok bool,
+) {
+	switch v := request.(type) {
+	case *model.MarketOrderRequest:
+		return v.Instrument, v.Units.AsFloat64(0), 0, v.PositionFill, true
+	case *model.LimitOrderRequest:
+		return v.Instrument, v.Units.AsFloat64(0), v.Price.AsFloat64(0), v.PositionFill, true
+	case *model.StopOrderRequest:
+		return v.Instrument, v.Units.AsFloat64(0), v.Price.AsFloat64(0), v.PositionFill, true
+	case *model.MarketIfTouchedOrderRequest:
+		return v.Instrument, v.Units.AsFloat64(0), v.Price.AsFloat64(0), v.PositionFill, true
+	}
+	return "", 0, 0, "", false
+}
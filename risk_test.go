@@ -0,0 +1,208 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"testing"
+	"time"
+)
+
+func expectRisk(t *testing.T, err error, check RiskCheck) {
+	t.Helper()
+	var e *RiskError
+	if check == "" {
+		if err != nil {
+			t.Fatalf("expected order to pass got %v", err)
+		}
+		return
+	}
+	if !errors.As(err, &e) || e.Check != check {
+		t.Fatalf("expected %s got %v", check, err)
+	}
+}
+
+func TestRiskGate(t *testing.T) {
+	pricing := NewPricing()
+	pricing.Update(Quote{Instrument: "EUR_USD", Time: time.Now(), Bid: 1.0999, Ask: 1.1001})
+	pricing.Update(Quote{Instrument: "GBP_USD", Time: time.Now(), Bid: 1.2999, Ask: 1.3001})
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	gate := NewRiskGate(RiskLimits{
+		MaxUnits:           map[model.InstrumentName]float64{"EUR_USD": 1000},
+		DefaultMaxNotional: 2000,
+		MaxExposure:        2000,
+		MaxOrdersPerSecond: 2,
+		MaxOpenTrades:      2,
+		Instruments:        []model.InstrumentName{"EUR_USD", "GBP_USD"},
+	}, NewCurrencyConverter(pricing, "USD"))
+	gate.now = func() time.Time { return now }
+
+	const account = "101-001-1-001"
+	gate.Update(&model.Account{
+		Id:                account,
+		OpenTradeCount:    1,
+		LastTransactionID: "10",
+		Positions: []*model.Position{
+			{Instrument: "EUR_USD", Long: &model.PositionSide{Units: "800", AveragePrice: "1.1"}},
+		},
+	})
+	order := func(instrument model.InstrumentName, units model.DecimalNumber) model.OrderRequest {
+		return &model.MarketOrderRequest{Instrument: instrument, Units: units}
+	}
+	check := func(request model.OrderRequest) error {
+		return gate.CheckOrderCreate(account, request)
+	}
+
+	expectRisk(t, check(order("USD_JPY", "100")), RiskCheck_INSTRUMENT)
+	expectRisk(t, check(order("EUR_USD", "300")), RiskCheck_MAX_UNITS)
+	// 1000 GBP_USD at 1.3 is within the default notional but not the exposure
+	expectRisk(t, check(order("GBP_USD", "1000")), RiskCheck_MAX_EXPOSURE)
+	expectRisk(t, check(order("GBP_USD", "1600")), RiskCheck_MAX_NOTIONAL)
+	expectRisk(t, check(order("GBP_USD", "100")), "")
+
+	gate.Kill()
+	expectRisk(t, check(order("GBP_USD", "100")), RiskCheck_KILL_SWITCH)
+	// Reducing the position is still allowed
+	expectRisk(t, check(order("EUR_USD", "-300")), "")
+	gate.Resume()
+
+	// The rate allows two orders within a second
+	expectRisk(t, check(order("EUR_USD", "-100")), RiskCheck_ORDER_RATE)
+	now = now.Add(time.Second)
+
+	// The accepted order is created and its fill opens the second trade
+	_ = gate.OnMessage(&model.MarketOrderTransaction{
+		Transaction: model.Transaction{Id: "11", AccountID: account},
+		Instrument:  "GBP_USD",
+		Units:       "100",
+	})
+	_ = gate.OnMessage(&model.OrderFillTransaction{
+		Transaction: model.Transaction{Id: "12", AccountID: account},
+		OrderID:     "11",
+		Instrument:  "GBP_USD",
+		Units:       "100",
+		Price:       "1.3",
+		TradeOpened: &model.TradeOpen{TradeID: "12"},
+	})
+	expectRisk(t, check(order("GBP_USD", "100")), RiskCheck_MAX_OPEN_TRADES)
+	// A stale Account does not undo the fill
+	gate.Update(&model.Account{Id: account, OpenTradeCount: 1, LastTransactionID: "10"})
+	expectRisk(t, check(order("GBP_USD", "100")), RiskCheck_MAX_OPEN_TRADES)
+	// Dependent orders only count towards the rate
+	expectRisk(t, gate.CheckTradeModify(account, "12", &model.TradeModifyRequest{}), "")
+
+	// Every order path of the Connection goes through the gate
+	conn := endpoint.NewConnection("token", false)
+	if err := conn.SetOrderGuard(gate); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetOrderGuard(gate); err != endpoint.ErrOrderGuardSet {
+		t.Fatal("expected ErrOrderGuardSet")
+	}
+	_, _, err := conn.OrderCreate(account, order("USD_JPY", "100"))
+	if _, ok := err.(endpoint.GuardError); !ok {
+		t.Fatalf("expected GuardError got %v", err)
+	}
+	expectRisk(t, err, RiskCheck_INSTRUMENT)
+	_, _, err = conn.OrderReplace(account, "1", order("USD_JPY", "100"))
+	expectRisk(t, err, RiskCheck_INSTRUMENT)
+}
+
+func TestRiskGatePending(t *testing.T) {
+	pricing := NewPricing()
+	pricing.Update(Quote{Instrument: "EUR_USD", Time: time.Now(), Bid: 1.0999, Ask: 1.1001})
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	gate := NewRiskGate(RiskLimits{
+		DefaultMaxUnits: 1000,
+		MaxOpenTrades:   2,
+	}, NewCurrencyConverter(pricing, "USD"))
+	gate.now = func() time.Time { return now }
+
+	const account = "101-001-1-001"
+	gate.Update(&model.Account{
+		Id:                account,
+		OpenTradeCount:    1,
+		LastTransactionID: "10",
+		Positions: []*model.Position{
+			{Instrument: "EUR_USD", Long: &model.PositionSide{Units: "800", AveragePrice: "1.1"}},
+		},
+	})
+	order := func(units model.DecimalNumber, fill model.OrderPositionFill) model.OrderRequest {
+		return &model.MarketOrderRequest{Instrument: "EUR_USD", Units: units, PositionFill: fill}
+	}
+	check := func(request model.OrderRequest) error {
+		return gate.CheckOrderCreate(account, request)
+	}
+
+	// Several reducing orders cannot bypass the kill switch together
+	gate.Kill()
+	expectRisk(t, check(order("-500", "")), "")
+	expectRisk(t, check(order("-500", "")), RiskCheck_KILL_SWITCH)
+	expectRisk(t, check(order("-5000", model.OrderPositionFill_REDUCE_ONLY)), RiskCheck_KILL_SWITCH)
+
+	// The accepted order is created as a pending order until cancelled
+	_ = gate.OnMessage(&model.LimitOrderTransaction{
+		Transaction: model.Transaction{Id: "11", AccountID: account},
+		Instrument:  "EUR_USD",
+		Units:       "-500",
+		Price:       "1.2",
+	})
+	expectRisk(t, check(order("-400", "")), RiskCheck_KILL_SWITCH)
+	_ = gate.OnMessage(&model.OrderCancelTransaction{
+		Transaction: model.Transaction{Id: "12", AccountID: account},
+		OrderID:     "11",
+	})
+	expectRisk(t, check(order("-400", "")), "")
+	gate.Resume()
+	_ = gate.OnMessage(&model.MarketOrderRejectTransaction{
+		Transaction: model.Transaction{Id: "13", AccountID: account},
+		Instrument:  "EUR_USD",
+		Units:       "-400",
+	})
+
+	// Pending orders count towards the units and open trades
+	gate.UpdateOrders(account, []*model.OrderParser{
+		{Id: "14", Type: "LIMIT", Instrument: "EUR_USD", Units: "150", Price: "1.05"},
+	})
+	expectRisk(t, check(order("100", "")), RiskCheck_MAX_UNITS)
+	expectRisk(t, check(order("40", "")), RiskCheck_MAX_OPEN_TRADES)
+	_ = gate.OnMessage(&model.OrderFillTransaction{
+		Transaction: model.Transaction{Id: "15", AccountID: account},
+		OrderID:     "14",
+		Instrument:  "EUR_USD",
+		Units:       "100",
+		Price:       "1.05",
+		TradeOpened: &model.TradeOpen{TradeID: "15"},
+	})
+	// 900 units with 50 pending
+	expectRisk(t, check(order("60", model.OrderPositionFill_REDUCE_ONLY)), RiskCheck_MAX_UNITS)
+
+	// A replacement is checked without the order it replaces
+	expectRisk(t, gate.CheckOrderReplace(account, "14", order("100", model.OrderPositionFill_REDUCE_ONLY)), "")
+	expectRisk(t, check(order("60", model.OrderPositionFill_REDUCE_ONLY)), RiskCheck_MAX_UNITS)
+
+	// Accepted orders that never show up expire
+	now = now.Add(riskAcceptedTimeout + time.Second)
+	expectRisk(t, check(order("50", model.OrderPositionFill_REDUCE_ONLY)), "")
+}
+
+func TestClientOrderGuard(t *testing.T) {
+	_, conn := newTestServer(t, 10000, oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1, Ask: 1.1002})
+	api := &countingAPI{API: conn}
+	client, err := NewClientWithAPI(api, NewRateLimiter(DefaultRateLimit, DefaultRateBurst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	gate := NewRiskGate(RiskLimits{Instruments: []model.InstrumentName{"GBP_USD"}}, nil)
+	if err = client.SetOrderGuard(gate); err != nil {
+		t.Fatal(err)
+	}
+	// The wrapped API cannot skip the guard
+	_, _, err = client.API().OrderCreate("101-001-1-001", &model.MarketOrderRequest{Instrument: "EUR_USD", Units: "100"})
+	expectRisk(t, err, RiskCheck_INSTRUMENT)
+	if api.creates != 0 {
+		t.Fatal("expected the order not to reach the API")
+	}
+}
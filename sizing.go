@@ -0,0 +1,165 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"strconv"
+)
+
+// SizingLimit identifies the constraint that determined the size of a position.
+type SizingLimit string
+
+const (
+	SizingLimit_RISK                SizingLimit = "RISK"
+	SizingLimit_MAXIMUM_ORDER_UNITS SizingLimit = "MAXIMUM_ORDER_UNITS"
+	SizingLimit_MARGIN_AVAILABLE    SizingLimit = "MARGIN_AVAILABLE"
+	SizingLimit_MINIMUM_TRADE_SIZE  SizingLimit = "MINIMUM_TRADE_SIZE"
+)
+
+var (
+	ErrSizingStop = errors.New("stop price or distance required")
+	ErrSizingRisk = errors.New("risk percent or amount required")
+)
+
+// SizingRequest describes the trade to size. Either Stop or StopDistance and either
+// RiskPercent or RiskAmount must be set. The direction is taken from the Stop
+// relative to the Entry, or from Short when only a distance is given.
+type SizingRequest struct {
+	Instrument model.InstrumentName
+	Entry      float64
+	// The stop loss price.
+	Stop float64
+	// The stop loss distance in price units.
+	StopDistance float64
+	Short        bool
+	// The fraction of NAV to risk, e.g. 0.01 for 1%.
+	RiskPercent float64
+	// The amount to risk in the home currency.
+	RiskAmount float64
+}
+
+// Sizing is the result of sizing a trade. Units are negative for short trades.
+type Sizing struct {
+	Units float64
+	// The constraint that determined Units.
+	Limit SizingLimit
+	// The amount lost in the home currency if the stop is hit.
+	Risk float64
+	// The units the risk alone would allow before any other limit.
+	RiskUnits float64
+	// The margin the trade requires in the home currency.
+	MarginRequired float64
+	precision      int
+}
+
+// DecimalUnits formats the units with the trade units precision of the instrument
+// for use in an order request.
+func (s *Sizing) DecimalUnits() model.DecimalNumber {
+	return model.DecimalNumber(strconv.FormatFloat(s.Units, 'f', s.precision, 64))
+}
+
+// PositionSizer sizes trades by the amount risked between entry and stop.
+type PositionSizer struct {
+	converter   *CurrencyConverter
+	instruments *InstrumentRegistry
+}
+
+func NewPositionSizer(converter *CurrencyConverter, instruments *InstrumentRegistry) *PositionSizer {
+	return &PositionSizer{
+		converter:   converter,
+		instruments: instruments,
+	}
+}
+
+// Size returns the number of units to trade so that hitting the stop loses the
+// requested risk. The units are rounded down to the instrument's trade units
+// precision and limited by its maximum order units and the Account's available
+// margin. Amounts in the quote currency are converted through the home currency
+// conversion rates.
+func (s *PositionSizer) Size(account *model.Account, request *SizingRequest) (*Sizing, error) {
+	if account == nil || request == nil {
+		return nil, endpoint.ErrNilRequest
+	}
+	instrument, err := s.instruments.Get(request.Instrument)
+	if err != nil {
+		return nil, err
+	}
+	_, quote, ok := SplitInstrument(request.Instrument)
+	if !ok {
+		return nil, ErrInstrumentNotFound
+	}
+
+	distance := request.StopDistance
+	short := request.Short
+	if request.Stop > 0 {
+		distance = math.Abs(request.Entry - request.Stop)
+		short = request.Stop > request.Entry
+	}
+	if distance <= 0 || request.Entry <= 0 {
+		return nil, ErrSizingStop
+	}
+
+	risk := request.RiskAmount
+	if request.RiskPercent > 0 {
+		risk = accountUnits(account.NAV) * request.RiskPercent
+	}
+	if risk <= 0 {
+		return nil, ErrSizingRisk
+	}
+
+	// The loss of a single unit when the stop is hit
+	lossPerUnit, err := s.converter.ToHome(-distance, quote)
+	if err != nil {
+		return nil, err
+	}
+	lossPerUnit = -lossPerUnit
+	valuePerUnit, err := s.converter.HomeValue(request.Entry, quote)
+	if err != nil {
+		return nil, err
+	}
+	rate := model.DecimalNumber(account.MarginRate).AsFloat64(0)
+	if r := instrument.MarginRate.AsFloat64(0); r > rate {
+		rate = r
+	}
+	marginPerUnit := valuePerUnit * rate
+
+	result := &Sizing{
+		Limit:     SizingLimit_RISK,
+		RiskUnits: risk / lossPerUnit,
+		precision: int(instrument.TradeUnitsPrecision),
+	}
+	units := result.RiskUnits
+	if max := instrument.MaximumOrderUnits.AsFloat64(0); max > 0 && units > max {
+		units = max
+		result.Limit = SizingLimit_MAXIMUM_ORDER_UNITS
+	}
+	if marginPerUnit > 0 {
+		available := accountUnits(account.MarginAvailable)
+		if max := available / marginPerUnit; units > max {
+			units = max
+			result.Limit = SizingLimit_MARGIN_AVAILABLE
+		}
+	}
+	units = roundUnitsDown(units, result.precision)
+	if units < instrument.MinimumTradeSize.AsFloat64(0) || units <= 0 {
+		units = 0
+		result.Limit = SizingLimit_MINIMUM_TRADE_SIZE
+	}
+
+	result.Risk = units * lossPerUnit
+	result.MarginRequired = units * marginPerUnit
+	if short {
+		units = -units
+	}
+	result.Units = units
+	return result, nil
+}
+
+// roundUnitsDown truncates units to the number of decimal places.
+func roundUnitsDown(units float64, precision int) float64 {
+	scale := math.Pow10(precision)
+	// Guard against representation error pushing an exact value below the boundary
+	return math.Floor(units*scale+1e-9) / scale
+}
@@ -0,0 +1,71 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPositionSizer(t *testing.T) {
+	pricing := NewPricing()
+	pricing.Update(Quote{Instrument: "EUR_USD", Time: time.Now(), Bid: 1.2, Ask: 1.2})
+	pricing.Update(Quote{Instrument: "USD_JPY", Time: time.Now(), Bid: 100, Ask: 100})
+	registry := NewInstrumentRegistryFrom([]*model.Instrument{
+		{Name: "EUR_USD", MarginRate: "0.02", MaximumOrderUnits: "100000000", MinimumTradeSize: "1"},
+		{Name: "USD_JPY", MarginRate: "0.04", MaximumOrderUnits: "5000", MinimumTradeSize: "1"},
+	})
+	sizer := NewPositionSizer(NewCurrencyConverter(pricing, "USD"), registry)
+	account := &model.Account{
+		Currency:        "USD",
+		NAV:             "10000",
+		MarginAvailable: "10000",
+		MarginRate:      "0.02",
+	}
+
+	// 1% of NAV with a 50 pip stop on EUR_USD
+	sizing, err := sizer.Size(account, &SizingRequest{
+		Instrument:  "EUR_USD",
+		Entry:       1.2,
+		Stop:        1.195,
+		RiskPercent: 0.01,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizing.Units != 20000 || sizing.Limit != SizingLimit_RISK || math.Abs(sizing.Risk-100) > 1e-6 {
+		t.Fatalf("unexpected sizing %+v", sizing)
+	}
+
+	// A short with a JPY quote: 50 pips at 100 JPY per USD is 0.005 USD per unit
+	sizing, err = sizer.Size(account, &SizingRequest{
+		Instrument:   "USD_JPY",
+		Entry:        100,
+		StopDistance: 0.5,
+		Short:        true,
+		RiskAmount:   10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizing.RiskUnits != 2000 || sizing.Units != -2000 || sizing.DecimalUnits() != "-2000" {
+		t.Fatalf("unexpected JPY sizing %+v", sizing)
+	}
+
+	// Maximum order units bind
+	sizing, _ = sizer.Size(account, &SizingRequest{Instrument: "USD_JPY", Entry: 100, Stop: 99.5, RiskAmount: 100})
+	if sizing.Units != 5000 || sizing.Limit != SizingLimit_MAXIMUM_ORDER_UNITS {
+		t.Fatalf("expected maximum order units to bind %+v", sizing)
+	}
+
+	// Margin available binds: 1000 USD at 2% margin allows 50000 USD of EUR_USD
+	account.MarginAvailable = "1000"
+	sizing, _ = sizer.Size(account, &SizingRequest{Instrument: "EUR_USD", Entry: 1.2, Stop: 1.199, RiskAmount: 1000})
+	if sizing.Limit != SizingLimit_MARGIN_AVAILABLE || sizing.Units != 41666 {
+		t.Fatalf("expected margin to bind %+v", sizing)
+	}
+
+	if _, err = sizer.Size(account, &SizingRequest{Instrument: "EUR_USD", Entry: 1.2, RiskAmount: 1}); err != ErrSizingStop {
+		t.Fatal("expected ErrSizingStop")
+	}
+}
@@ -0,0 +1,308 @@
+package oanda
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// The number of times an order whose outcome is unknown is submitted.
+	DefaultSubmitAttempts = 3
+	// The number of times the existence of an order is checked before giving up.
+	orderLookupAttempts = 3
+	orderLookupBackoff  = 250 * time.Millisecond
+)
+
+var (
+	// ErrOrderUnknown is returned when the outcome of an order request could not be
+	// determined. The order may exist and must not be resubmitted blindly.
+	ErrOrderUnknown = errors.New("order outcome unknown")
+
+	clientIDCounter uint64
+	clientIDPrefix  = newClientIDPrefix()
+)
+
+func newClientIDPrefix() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// NewClientID returns a client order ID that is unique across processes.
+func NewClientID() model.ClientID {
+	n := atomic.AddUint64(&clientIDCounter, 1)
+	return model.ClientID(clientIDPrefix + "-" +
+		strconv.FormatInt(time.Now().UnixNano(), 36) + "-" +
+		strconv.FormatUint(n, 36))
+}
+
+// EnsureClientID assigns a new client order ID to the request unless it already
+// has one and returns the ID.
+func EnsureClientID(request model.OrderRequest) model.ClientID {
+	ext := orderRequestExtensions(request)
+	if ext == nil {
+		return ""
+	}
+	if *ext == nil {
+		*ext = &model.ClientExtensions{}
+	}
+	if len((*ext).ID) == 0 {
+		(*ext).ID = NewClientID()
+	}
+	return (*ext).ID
+}
+
+// OrderSubmitter creates orders without ever creating one twice. Every order is
+// given a client order ID. If the result of a request is unknown, because of a
+// timeout, a reset connection or a server error, the order is looked up by its
+// client order ID and only resubmitted if OANDA does not know it. An order found
+// by the lookup is reported as if the original request had succeeded.
+//
+// A lookup that does not find the order is retried with a backoff. An order that
+// filled in the meantime is no longer pending and may not be found by its client
+// order ID, so before resubmitting, the transactions since the last one known
+// before the first attempt are searched for the order as well.
+type OrderSubmitter struct {
+	accountID model.AccountID
+	limiter   *RateLimiter
+	attempts  int
+	backoff   time.Duration
+	create    func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error)
+	lookup    func(specifier model.OrderSpecifier) (*model.OrderResponse, error)
+	since     func(id model.TransactionID) (*model.TransactionsResponse, error)
+	latest    func() (model.TransactionID, error)
+
+	mu       sync.Mutex
+	lastTxID uint64
+}
+
+func NewOrderSubmitter(conn endpoint.API, limiter *RateLimiter, accountID model.AccountID) *OrderSubmitter {
+	return &OrderSubmitter{
+		accountID: accountID,
+		limiter:   limiter,
+		attempts:  DefaultSubmitAttempts,
+		backoff:   orderLookupBackoff,
+		create: func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+			return conn.OrderCreate(accountID, request)
+		},
+		lookup: func(specifier model.OrderSpecifier) (*model.OrderResponse, error) {
+			return conn.OrdersBySpecifier(accountID, specifier)
+		},
+		since: func(id model.TransactionID) (*model.TransactionsResponse, error) {
+			return conn.TransactionsSinceID(accountID, model.NewTransactionsSinceIDRequest(id))
+		},
+		latest: func() (model.TransactionID, error) {
+			summary, err := conn.AccountSummary(accountID)
+			if err != nil {
+				return "", err
+			}
+			return summary.LastTransactionID, nil
+		},
+	}
+}
+
+// WithAttempts sets how many times an order whose outcome is unknown is submitted.
+func (s *OrderSubmitter) WithAttempts(attempts int) *OrderSubmitter {
+	if attempts < 1 {
+		attempts = 1
+	}
+	s.attempts = attempts
+	return s
+}
+
+func (s *OrderSubmitter) AccountID() model.AccountID {
+	return s.accountID
+}
+
+// Create submits the order like endpoint.Connection.OrderCreate. A client order ID
+// is assigned to the request if it has none. ErrOrderUnknown is returned if the
+// outcome stays unknown after all attempts.
+func (s *OrderSubmitter) Create(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+	if request == nil {
+		return nil, nil, endpoint.ErrNilRequest
+	}
+	clientID := EnsureClientID(request)
+	if len(clientID) == 0 {
+		// Unsupported request types are rejected by OrderCreate
+		return s.create(request)
+	}
+	since, err := s.lastKnown()
+	if err != nil {
+		return nil, nil, err
+	}
+	var lastErr error
+	for attempt := 0; attempt < s.attempts; attempt++ {
+		s.limiter.Wait()
+		resp, rejected, err := s.create(request)
+		if !orderOutcomeUnknown(err) {
+			if resp != nil {
+				s.observe(resp.LastTransactionID)
+			} else if rejected != nil {
+				s.observe(rejected.LastTransactionID)
+			}
+			if attempt == 0 || !clientIDExists(rejected) {
+				return resp, rejected, err
+			}
+			// An earlier attempt created the order after all
+		} else {
+			lastErr = err
+		}
+		resp, found, err := s.find(clientID, since)
+		if err != nil {
+			return nil, nil, ErrOrderUnknown
+		}
+		if found {
+			return resp, nil, nil
+		}
+	}
+	// None of the attempts reached OANDA
+	return nil, nil, lastErr
+}
+
+// lastKnown returns the ID of the last transaction the submitter has seen and asks
+// OANDA for it if there is none yet.
+func (s *OrderSubmitter) lastKnown() (model.TransactionID, error) {
+	s.mu.Lock()
+	id := s.lastTxID
+	s.mu.Unlock()
+	if id > 0 {
+		return formatTxID(id), nil
+	}
+	s.limiter.Wait()
+	latest, err := s.latest()
+	if err != nil {
+		return "", err
+	}
+	s.observe(latest)
+	return latest, nil
+}
+
+// observe records the ID of a transaction reported by OANDA.
+func (s *OrderSubmitter) observe(id model.TransactionID) {
+	n, err := parseTxID(id)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	if n > s.lastTxID {
+		s.lastTxID = n
+	}
+	s.mu.Unlock()
+}
+
+// find looks up the order with the client order ID and rebuilds the response of the
+// request that created it from the transaction history. If OANDA keeps answering
+// that the order does not exist, the transactions after since are searched for it.
+func (s *OrderSubmitter) find(clientID model.ClientID, since model.TransactionID) (*model.CreateOrderResponse, bool, error) {
+	var err error
+	for i := 0; i < orderLookupAttempts; i++ {
+		if i > 0 {
+			time.Sleep(s.backoff * time.Duration(i))
+		}
+		s.limiter.Wait()
+		var order *model.OrderResponse
+		order, err = s.lookup(model.OrderSpecifier("@" + clientID))
+		if err == nil && order.Order != nil {
+			return s.history(model.OrderID(order.Order.Id))
+		}
+	}
+	if e, ok := err.(endpoint.StatusCodeError); !ok || e.Code != 404 {
+		if err == nil {
+			err = ErrOrderUnknown
+		}
+		return nil, false, err
+	}
+	return s.scan(clientID, since)
+}
+
+// scan searches the transactions after since for the creation or the fill of the
+// order with the client order ID.
+func (s *OrderSubmitter) scan(clientID model.ClientID, since model.TransactionID) (*model.CreateOrderResponse, bool, error) {
+	s.limiter.Wait()
+	page, err := s.since(since)
+	if err != nil {
+		return nil, false, err
+	}
+	s.observe(page.LastTransactionID)
+	for _, tx := range page.Transactions {
+		if tx == nil {
+			continue
+		}
+		switch {
+		case tx.Type == string(model.TransactionType_ORDER_FILL) && tx.ClientOrderID == string(clientID):
+			return s.history(model.OrderID(tx.OrderID))
+		case strings.HasSuffix(tx.Type, "_ORDER") && tx.ClientExtensions != nil && tx.ClientExtensions.ID == clientID:
+			// Rejected orders have a _REJECT suffix and were never created
+			return s.history(model.OrderID(tx.Id))
+		}
+	}
+	return nil, false, nil
+}
+
+// history collects the transactions created in the same batch as the order.
+func (s *OrderSubmitter) history(orderID model.OrderID) (*model.CreateOrderResponse, bool, error) {
+	id, err := parseTxID(model.TransactionID(orderID))
+	if err != nil || id == 0 {
+		return nil, true, ErrInvalidTxID
+	}
+	s.limiter.Wait()
+	page, err := s.since(formatTxID(id - 1))
+	if err != nil {
+		return nil, true, err
+	}
+	resp := &model.CreateOrderResponse{LastTransactionID: page.LastTransactionID}
+	var batch string
+	for _, tx := range page.Transactions {
+		if tx == nil {
+			continue
+		}
+		switch {
+		case tx.Id == string(orderID):
+			resp.OrderCreateTransaction = tx
+			batch = tx.BatchID
+		case len(batch) == 0 || tx.BatchID != batch:
+			continue
+		case tx.OrderID != string(orderID):
+		case tx.Type == string(model.TransactionType_ORDER_FILL):
+			resp.OrderFillTransaction, _ = tx.Parse().(*model.OrderFillTransaction)
+		case tx.Type == string(model.TransactionType_ORDER_CANCEL):
+			resp.OrderCancelTransaction, _ = tx.Parse().(*model.OrderCancelTransaction)
+		}
+		if tx.BatchID == batch {
+			resp.RelatedTransactionIDs = append(resp.RelatedTransactionIDs, model.TransactionID(tx.Id))
+		}
+	}
+	if resp.OrderCreateTransaction == nil {
+		return nil, true, ErrTxNotFound
+	}
+	return resp, true, nil
+}
+
+// orderOutcomeUnknown reports whether an OrderCreate error leaves open whether the
+// order was created. Any response with a client error status is definite.
+func orderOutcomeUnknown(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch e := err.(type) {
+	case endpoint.StatusCodeError:
+		return e.Code >= 500
+	case endpoint.GuardError:
+		// Refused before it was sent
+		return false
+	}
+	return true
+}
+
+func clientIDExists(rejected *model.CreateOrderError) bool {
+	return rejected != nil && rejected.OrderRejectTransaction != nil &&
+		rejected.OrderRejectTransaction.RejectReason == string(model.TransactionRejectReason_CLIENT_ORDER_ID_ALREADY_EXISTS)
+}
@@ -0,0 +1,178 @@
+package oanda
+
+import (
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
+	"github.com/kamaiu/oanda-go/model"
+	"testing"
+)
+
+func TestEnsureClientID(t *testing.T) {
+	request := &model.MarketOrderRequest{Instrument: "EUR_USD", Units: "100"}
+	id := EnsureClientID(request)
+	if len(id) == 0 || request.ClientExtensions == nil || request.ClientExtensions.ID != id {
+		t.Fatal("client id not assigned")
+	}
+	if EnsureClientID(request) != id {
+		t.Fatal("client id replaced")
+	}
+	if NewClientID() == NewClientID() {
+		t.Fatal("client ids not unique")
+	}
+}
+
+func TestOrderSubmitter(t *testing.T) {
+	var (
+		creates  int
+		lookups  int
+		reset    = errors.New("connection reset")
+		notFound = endpoint.StatusCodeError{Code: 404}
+	)
+	submitter := &OrderSubmitter{attempts: DefaultSubmitAttempts}
+	submitter.latest = func() (model.TransactionID, error) {
+		return "40", nil
+	}
+	request := func() model.OrderRequest {
+		return &model.MarketOrderRequest{Instrument: "EUR_USD", Units: "100"}
+	}
+
+	// The first attempt never reached OANDA and is resubmitted
+	submitter.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		creates++
+		if creates == 1 {
+			return nil, nil, reset
+		}
+		return &model.CreateOrderResponse{LastTransactionID: "10"}, nil, nil
+	}
+	submitter.lookup = func(specifier model.OrderSpecifier) (*model.OrderResponse, error) {
+		lookups++
+		return nil, notFound
+	}
+	submitter.since = func(id model.TransactionID) (*model.TransactionsResponse, error) {
+		if id != "40" {
+			t.Errorf("unexpected sinceid %s", id)
+		}
+		return &model.TransactionsResponse{LastTransactionID: "40"}, nil
+	}
+	resp, _, err := submitter.Create(request())
+	if err != nil || resp == nil || creates != 2 || lookups != orderLookupAttempts {
+		t.Fatalf("expected resubmit %v %d %d", err, creates, lookups)
+	}
+
+	// The first attempt created the order and filled it
+	creates, lookups = 0, 0
+	var specifier model.OrderSpecifier
+	submitter.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		creates++
+		return nil, nil, reset
+	}
+	submitter.lookup = func(s model.OrderSpecifier) (*model.OrderResponse, error) {
+		lookups++
+		specifier = s
+		return &model.OrderResponse{Order: &model.OrderParser{Id: "50"}}, nil
+	}
+	submitter.since = func(id model.TransactionID) (*model.TransactionsResponse, error) {
+		if id != "49" {
+			t.Errorf("unexpected sinceid %s", id)
+		}
+		return &model.TransactionsResponse{
+			Transactions: []*model.TransactionParser{
+				{Id: "50", BatchID: "50", Type: "MARKET_ORDER"},
+				{Id: "51", BatchID: "50", Type: "ORDER_FILL", OrderID: "50"},
+				{Id: "52", BatchID: "52", Type: "ORDER_FILL", OrderID: "48"},
+			},
+			LastTransactionID: "52",
+		}, nil
+	}
+	r := request()
+	resp, _, err = submitter.Create(r)
+	if err != nil || creates != 1 || lookups != 1 {
+		t.Fatalf("expected lookup %v %d %d", err, creates, lookups)
+	}
+	if string(specifier) != "@"+string(r.(*model.MarketOrderRequest).ClientExtensions.ID) {
+		t.Fatalf("unexpected specifier %s", specifier)
+	}
+	if resp.OrderCreateTransaction.Id != "50" || resp.OrderFillTransaction == nil ||
+		resp.OrderFillTransaction.Id != "51" || len(resp.RelatedTransactionIDs) != 2 {
+		t.Fatalf("unexpected recovered response %+v", resp)
+	}
+
+	// The lookup fails as well so nothing is resubmitted
+	creates = 0
+	submitter.lookup = func(s model.OrderSpecifier) (*model.OrderResponse, error) {
+		return nil, reset
+	}
+	if _, _, err = submitter.Create(request()); err != ErrOrderUnknown || creates != 1 {
+		t.Fatalf("expected ErrOrderUnknown got %v after %d attempts", err, creates)
+	}
+
+	// A definite error is returned as is
+	creates = 0
+	submitter.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		creates++
+		return nil, &model.CreateOrderError{ErrorCode: "INVALID"}, endpoint.StatusCodeError{Code: 400}
+	}
+	if _, rejected, err := submitter.Create(request()); rejected == nil || err == nil || creates != 1 {
+		t.Fatal("expected rejection")
+	}
+}
+
+func TestOrderSubmitterFilledBeforeRetry(t *testing.T) {
+	var creates, lookups int
+	submitter := &OrderSubmitter{attempts: DefaultSubmitAttempts}
+	submitter.latest = func() (model.TransactionID, error) {
+		return "40", nil
+	}
+	request := &model.MarketOrderRequest{Instrument: "EUR_USD", Units: "100"}
+	clientID := EnsureClientID(request)
+
+	// The first attempt times out but the order is created and filled. It is no
+	// longer pending so the lookup by client order ID does not find it.
+	submitter.create = func(request model.OrderRequest) (*model.CreateOrderResponse, *model.CreateOrderError, error) {
+		creates++
+		return nil, nil, endpoint.StatusCodeError{Code: 504}
+	}
+	submitter.lookup = func(specifier model.OrderSpecifier) (*model.OrderResponse, error) {
+		lookups++
+		return nil, endpoint.StatusCodeError{Code: 404}
+	}
+	transactions := []*model.TransactionParser{
+		{Id: "41", BatchID: "41", Type: "MARKET_ORDER_REJECT", ClientExtensions: &model.ClientExtensions{ID: clientID}},
+		{Id: "42", BatchID: "42", Type: "MARKET_ORDER", ClientExtensions: &model.ClientExtensions{ID: clientID}},
+		{Id: "43", BatchID: "42", Type: "ORDER_FILL", OrderID: "42", ClientOrderID: string(clientID)},
+	}
+	var sinceIDs []model.TransactionID
+	submitter.since = func(id model.TransactionID) (*model.TransactionsResponse, error) {
+		sinceIDs = append(sinceIDs, id)
+		n, _ := parseTxID(id)
+		var page []*model.TransactionParser
+		for _, tx := range transactions {
+			if m, _ := parseTxID(model.TransactionID(tx.Id)); m > n {
+				page = append(page, tx)
+			}
+		}
+		return &model.TransactionsResponse{Transactions: page, LastTransactionID: "43"}, nil
+	}
+	resp, rejected, err := submitter.Create(request)
+	if err != nil || rejected != nil || creates != 1 || lookups != orderLookupAttempts {
+		t.Fatalf("expected the filled order %v %v %d %d", err, rejected, creates, lookups)
+	}
+	if len(sinceIDs) != 2 || sinceIDs[0] != "40" || sinceIDs[1] != "41" {
+		t.Fatalf("unexpected sinceids %v", sinceIDs)
+	}
+	if resp.OrderCreateTransaction.Id != "42" || resp.OrderFillTransaction == nil ||
+		resp.OrderFillTransaction.Id != "43" || resp.LastTransactionID != "43" {
+		t.Fatalf("unexpected recovered response %+v", resp)
+	}
+
+	// Only the fill is in the range searched
+	creates, lookups, sinceIDs = 0, 0, nil
+	submitter.lastTxID = 42
+	resp, _, err = submitter.Create(request)
+	if err != nil || creates != 1 || resp.OrderCreateTransaction.Id != "42" {
+		t.Fatalf("expected the order of the fill %v %d %+v", err, creates, resp)
+	}
+	if len(sinceIDs) != 2 || sinceIDs[0] != "42" || sinceIDs[1] != "41" {
+		t.Fatalf("unexpected sinceids %v", sinceIDs)
+	}
+}
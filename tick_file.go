@@ -0,0 +1,845 @@
+package oanda
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/kamaiu/oanda-go/model"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	tickFileMagic = "OTK1"
+	// Block header: size (4) + crc (4) + count (4) + first time (8) + last time (8)
+	tickBlockHeaderSize = 28
+	// Upper bound of a single block. Anything larger is treated as corruption.
+	tickMaxBlockSize = 1024 * 1024 * 16
+	// The maximum number of decimal places a stored price may have.
+	tickMaxDigits = 12
+
+	tickFlagTradeable   = 1
+	tickFlagCloseoutBid = 2
+	tickFlagCloseoutAsk = 4
+
+	// DefaultTickBlockSize is the encoded size after which a TickWriter starts a new block.
+	DefaultTickBlockSize = 64 * 1024
+)
+
+var (
+	ErrTickFileCorrupt  = errors.New("tick file corrupt")
+	ErrTickWriterClosed = errors.New("tick writer closed")
+	ErrTickPrice        = errors.New("invalid tick price")
+
+	tickPow10 = [tickMaxDigits + 1]float64{1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11, 1e12}
+)
+
+// A tick file stores prices in a compact binary form of about 20 bytes per price
+// with a single bid and ask, compared to about 400 bytes of JSON.
+//
+// The file starts with a magic number followed by blocks of prices. Every block is
+// framed with its size, a CRC32 checksum, the number of prices and the first and the
+// latest price time, so a file can be searched by time without decoding it and a
+// torn block at the tail is discarded. Blocks decode independently: each one has its
+// own instrument dictionary and encodes every price as the difference to the
+// previous price of the same instrument.
+//
+// Prices are stored as integers scaled by 10^digits, where digits is the largest
+// number of decimal places of the price, so they round trip exactly both as the
+// decimal strings of a ClientPrice and as the floats of a StreamClientPrice. Times
+// are stored in nanoseconds. Prices are expected in time order.
+
+type tickBucket struct {
+	price     int64
+	liquidity int64
+}
+
+// tick is the decoded form shared by the model types.
+type tick struct {
+	instrument  string
+	time        int64
+	flags       byte
+	digits      int
+	bids        []tickBucket
+	asks        []tickBucket
+	closeoutBid int64
+	closeoutAsk int64
+}
+
+// tickState is the previous price of an instrument within a block.
+type tickState struct {
+	digits int
+	bid    int64
+	ask    int64
+}
+
+// references returns the values the first bid and ask of t are encoded against and
+// moves the state on to t.
+func (s *tickState) references(t *tick) (bid int64, ask int64) {
+	if s.digits != t.digits {
+		*s = tickState{digits: t.digits}
+	}
+	bid, ask = s.bid, s.ask
+	if len(t.bids) > 0 {
+		s.bid = t.bids[0].price
+	}
+	if len(t.asks) > 0 {
+		s.ask = t.asks[0].price
+	}
+	return bid, ask
+}
+
+func (t *tick) fromStreamPrice(p *model.StreamClientPrice) error {
+	if p.Time.IsZero() {
+		return errors.New("price time required")
+	}
+	digits := 0
+	for _, v := range [...]float64{p.CloseoutBid, p.CloseoutAsk} {
+		if err := floatDigits(v, &digits); err != nil {
+			return err
+		}
+	}
+	for _, ladder := range [...][]model.StreamPriceBucket{p.Bids, p.Asks} {
+		for i := range ladder {
+			if err := floatDigits(ladder[i].Price, &digits); err != nil {
+				return err
+			}
+		}
+	}
+
+	t.instrument = string(p.Instrument)
+	t.time = p.Time.UnixNano()
+	t.digits = digits
+	t.flags = 0
+	if p.Tradeable {
+		t.flags |= tickFlagTradeable
+	}
+	if p.CloseoutBid != 0 {
+		t.flags |= tickFlagCloseoutBid
+		t.closeoutBid, _ = floatScaled(p.CloseoutBid, digits)
+	}
+	if p.CloseoutAsk != 0 {
+		t.flags |= tickFlagCloseoutAsk
+		t.closeoutAsk, _ = floatScaled(p.CloseoutAsk, digits)
+	}
+	t.bids = t.bids[:0]
+	for _, b := range p.Bids {
+		n, _ := floatScaled(b.Price, digits)
+		t.bids = append(t.bids, tickBucket{price: n, liquidity: b.Liquidity})
+	}
+	t.asks = t.asks[:0]
+	for _, a := range p.Asks {
+		n, _ := floatScaled(a.Price, digits)
+		t.asks = append(t.asks, tickBucket{price: n, liquidity: a.Liquidity})
+	}
+	return nil
+}
+
+func (t *tick) toStreamPrice(p *model.StreamClientPrice) {
+	scale := tickPow10[t.digits]
+	p.Instrument = append(p.Instrument[:0], t.instrument...)
+	p.Time = time.Unix(0, t.time).UTC()
+	p.Tradeable = t.flags&tickFlagTradeable != 0
+	p.IsHeartbeat = false
+	p.CloseoutBid, p.CloseoutAsk = 0, 0
+	if t.flags&tickFlagCloseoutBid != 0 {
+		p.CloseoutBid = float64(t.closeoutBid) / scale
+	}
+	if t.flags&tickFlagCloseoutAsk != 0 {
+		p.CloseoutAsk = float64(t.closeoutAsk) / scale
+	}
+	p.Bids = p.Bids[:0]
+	for _, b := range t.bids {
+		p.Bids = append(p.Bids, model.StreamPriceBucket{Price: float64(b.price) / scale, Liquidity: b.liquidity})
+	}
+	p.Asks = p.Asks[:0]
+	for _, a := range t.asks {
+		p.Asks = append(p.Asks, model.StreamPriceBucket{Price: float64(a.price) / scale, Liquidity: a.liquidity})
+	}
+}
+
+func (t *tick) fromClientPrice(p *model.ClientPrice) error {
+	at, err := p.Time.Parse()
+	if err != nil {
+		return err
+	}
+	if at.IsZero() {
+		return errors.New("price time required")
+	}
+	digits := 0
+	for _, v := range [...]model.PriceValue{p.CloseoutBid, p.CloseoutAsk} {
+		if n := priceDigits(string(v)); n > digits {
+			digits = n
+		}
+	}
+	for _, ladder := range [...][]model.PriceBucket{p.Bids, p.Asks} {
+		for i := range ladder {
+			if n := priceDigits(string(ladder[i].Price)); n > digits {
+				digits = n
+			}
+		}
+	}
+	if digits > tickMaxDigits {
+		return ErrTickPrice
+	}
+	scaled := func(v model.PriceValue) (int64, error) {
+		n, ok := parseScaled(string(v), digits)
+		if !ok {
+			return 0, ErrTickPrice
+		}
+		return n, nil
+	}
+
+	t.instrument = string(p.Instrument)
+	t.time = at.UnixNano()
+	t.digits = digits
+	t.flags = 0
+	if p.Tradeable {
+		t.flags |= tickFlagTradeable
+	}
+	if len(p.CloseoutBid) > 0 {
+		t.flags |= tickFlagCloseoutBid
+		if t.closeoutBid, err = scaled(p.CloseoutBid); err != nil {
+			return err
+		}
+	}
+	if len(p.CloseoutAsk) > 0 {
+		t.flags |= tickFlagCloseoutAsk
+		if t.closeoutAsk, err = scaled(p.CloseoutAsk); err != nil {
+			return err
+		}
+	}
+	t.bids = t.bids[:0]
+	for _, b := range p.Bids {
+		n, err := scaled(b.Price)
+		if err != nil {
+			return err
+		}
+		t.bids = append(t.bids, tickBucket{price: n, liquidity: b.Liquidity})
+	}
+	t.asks = t.asks[:0]
+	for _, a := range p.Asks {
+		n, err := scaled(a.Price)
+		if err != nil {
+			return err
+		}
+		t.asks = append(t.asks, tickBucket{price: n, liquidity: a.Liquidity})
+	}
+	return nil
+}
+
+func (t *tick) toClientPrice(p *model.ClientPrice) {
+	p.Type = "PRICE"
+	p.Instrument = model.InstrumentName(t.instrument)
+	p.Time = model.DateTime(time.Unix(0, t.time).UTC().Format(candleTimeLayout))
+	p.Tradeable = t.flags&tickFlagTradeable != 0
+	p.CloseoutBid, p.CloseoutAsk = "", ""
+	if t.flags&tickFlagCloseoutBid != 0 {
+		p.CloseoutBid = model.PriceValue(formatScaled(t.closeoutBid, t.digits))
+	}
+	if t.flags&tickFlagCloseoutAsk != 0 {
+		p.CloseoutAsk = model.PriceValue(formatScaled(t.closeoutAsk, t.digits))
+	}
+	p.Bids = make([]model.PriceBucket, len(t.bids))
+	for i, b := range t.bids {
+		p.Bids[i] = model.PriceBucket{Price: model.PriceValue(formatScaled(b.price, t.digits)), Liquidity: b.liquidity}
+	}
+	p.Asks = make([]model.PriceBucket, len(t.asks))
+	for i, a := range t.asks {
+		p.Asks[i] = model.PriceBucket{Price: model.PriceValue(formatScaled(a.price, t.digits)), Liquidity: a.liquidity}
+	}
+}
+
+// floatScaled scales a float by 10^digits and reports whether it converts back exactly.
+func floatScaled(v float64, digits int) (int64, bool) {
+	n := math.Round(v * tickPow10[digits])
+	if math.Abs(n) >= 1<<53 {
+		return 0, false
+	}
+	return int64(n), n/tickPow10[digits] == v
+}
+
+// floatDigits raises digits to the number of decimal places of v.
+func floatDigits(v float64, digits *int) error {
+	for d := *digits; d <= tickMaxDigits; d++ {
+		if _, ok := floatScaled(v, d); ok {
+			*digits = d
+			return nil
+		}
+	}
+	return ErrTickPrice
+}
+
+// tickEncoder encodes the prices of a block.
+type tickEncoder struct {
+	buf        []byte
+	count      int
+	first      int64
+	last       int64
+	previous   int64
+	dictionary map[string]int
+	states     []tickState
+}
+
+func (e *tickEncoder) reset() {
+	e.buf = e.buf[:0]
+	e.count = 0
+	e.dictionary = make(map[string]int)
+	e.states = e.states[:0]
+}
+
+func (e *tickEncoder) encode(t *tick) {
+	index, ok := e.dictionary[t.instrument]
+	if !ok {
+		index = len(e.states)
+		e.dictionary[t.instrument] = index
+		e.states = append(e.states, tickState{})
+	}
+	e.buf = appendUvarint(e.buf, uint64(index))
+	if !ok {
+		e.buf = appendUvarint(e.buf, uint64(len(t.instrument)))
+		e.buf = append(e.buf, t.instrument...)
+	}
+	if e.count == 0 {
+		e.first, e.last, e.previous = t.time, t.time, t.time
+	}
+	e.buf = appendVarint(e.buf, t.time-e.previous)
+	e.previous = t.time
+	if t.time > e.last {
+		e.last = t.time
+	}
+	e.buf = append(e.buf, t.flags, byte(t.digits))
+	e.buf = appendUvarint(e.buf, uint64(len(t.bids)))
+	e.buf = appendUvarint(e.buf, uint64(len(t.asks)))
+
+	bid, ask := e.states[index].references(t)
+	if len(t.bids) > 0 {
+		// Asks are expected to move with the bids
+		ask += t.bids[0].price - bid
+	}
+	e.buf = appendLadder(e.buf, t.bids, bid)
+	e.buf = appendLadder(e.buf, t.asks, ask)
+	if t.flags&tickFlagCloseoutBid != 0 {
+		e.buf = appendVarint(e.buf, t.closeoutBid-firstPrice(t.bids))
+	}
+	if t.flags&tickFlagCloseoutAsk != 0 {
+		e.buf = appendVarint(e.buf, t.closeoutAsk-firstPrice(t.asks))
+	}
+	e.count++
+}
+
+// appendLadder encodes the first price against reference and every further price
+// against the one before it.
+func appendLadder(b []byte, ladder []tickBucket, reference int64) []byte {
+	for _, bucket := range ladder {
+		b = appendVarint(b, bucket.price-reference)
+		b = appendVarint(b, bucket.liquidity)
+		reference = bucket.price
+	}
+	return b
+}
+
+func firstPrice(ladder []tickBucket) int64 {
+	if len(ladder) == 0 {
+		return 0
+	}
+	return ladder[0].price
+}
+
+// block returns the framed block.
+func (e *tickEncoder) block() []byte {
+	b := make([]byte, tickBlockHeaderSize, tickBlockHeaderSize+len(e.buf))
+	binary.LittleEndian.PutUint32(b, uint32(len(e.buf)))
+	binary.LittleEndian.PutUint32(b[4:], crc32.Checksum(e.buf, txLogCRCTable))
+	binary.LittleEndian.PutUint32(b[8:], uint32(e.count))
+	binary.LittleEndian.PutUint64(b[12:], uint64(e.first))
+	binary.LittleEndian.PutUint64(b[20:], uint64(e.last))
+	return append(b, e.buf...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+// tickDecoder decodes the prices of a block.
+type tickDecoder struct {
+	buf         []byte
+	remaining   int
+	previous    int64
+	instruments []string
+	states      []tickState
+	err         error
+}
+
+func (d *tickDecoder) reset(payload []byte, count int, first int64) {
+	d.buf = payload
+	d.remaining = count
+	d.previous = first
+	d.instruments = d.instruments[:0]
+	d.states = d.states[:0]
+	d.err = nil
+}
+
+func (d *tickDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrTickFileCorrupt
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *tickDecoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = ErrTickFileCorrupt
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *tickDecoder) bytes(n uint64) []byte {
+	if n > uint64(len(d.buf)) {
+		d.err = ErrTickFileCorrupt
+		return make([]byte, 2)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *tickDecoder) ladder(ladder []tickBucket, n uint64, reference int64) []tickBucket {
+	ladder = ladder[:0]
+	// Every bucket takes at least two bytes
+	if n > uint64(len(d.buf)) {
+		d.err = ErrTickFileCorrupt
+		return ladder
+	}
+	for i := uint64(0); i < n; i++ {
+		price := reference + d.varint()
+		ladder = append(ladder, tickBucket{price: price, liquidity: d.varint()})
+		reference = price
+	}
+	return ladder
+}
+
+// decode reads the next price of the block into t. The checksum of the block has
+// been verified, so malformed data is reported as corruption.
+func (d *tickDecoder) decode(t *tick) error {
+	index := d.uvarint()
+	if d.err == nil && index > uint64(len(d.instruments)) {
+		d.err = ErrTickFileCorrupt
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if index == uint64(len(d.instruments)) {
+		d.instruments = append(d.instruments, string(d.bytes(d.uvarint())))
+		d.states = append(d.states, tickState{})
+	}
+	t.instrument = d.instruments[index]
+	t.time = d.previous + d.varint()
+	d.previous = t.time
+	header := d.bytes(2)
+	t.flags, t.digits = header[0], int(header[1])
+	if t.digits > tickMaxDigits {
+		d.err = ErrTickFileCorrupt
+	}
+	bids, asks := d.uvarint(), d.uvarint()
+	if d.err != nil {
+		return d.err
+	}
+
+	state := &d.states[index]
+	if state.digits != t.digits {
+		*state = tickState{digits: t.digits}
+	}
+	bid, ask := state.bid, state.ask
+	t.bids = d.ladder(t.bids, bids, bid)
+	if len(t.bids) > 0 {
+		ask += t.bids[0].price - bid
+	}
+	t.asks = d.ladder(t.asks, asks, ask)
+	state.references(t)
+	if t.flags&tickFlagCloseoutBid != 0 {
+		t.closeoutBid = firstPrice(t.bids) + d.varint()
+	}
+	if t.flags&tickFlagCloseoutAsk != 0 {
+		t.closeoutAsk = firstPrice(t.asks) + d.varint()
+	}
+	d.remaining--
+	return d.err
+}
+
+// TickWriter writes prices in the tick file format. Prices are buffered until the
+// block is full, Flush is called or the writer is closed.
+type TickWriter struct {
+	w         io.Writer
+	f         *os.File
+	blockSize int
+	header    bool
+	encoder   tickEncoder
+	tick      tick
+	closed    bool
+}
+
+// NewTickWriter writes a new tick file to w.
+func NewTickWriter(w io.Writer) *TickWriter {
+	tw := &TickWriter{
+		w:         w,
+		blockSize: DefaultTickBlockSize,
+		header:    true,
+	}
+	tw.encoder.reset()
+	return tw
+}
+
+// OpenTickWriter creates the tick file at path or appends to an existing one. A torn
+// block at the tail of an existing file is truncated.
+func OpenTickWriter(path string) (*TickWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_, end, err := readTickIndex(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	tw := NewTickWriter(f)
+	tw.f = f
+	if end > 0 {
+		tw.header = false
+		if info, err := f.Stat(); err != nil || info.Size() != end {
+			// Torn write
+			if err == nil {
+				err = f.Truncate(end)
+			}
+			if err == nil {
+				err = f.Sync()
+			}
+			if err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+		}
+	}
+	if _, err = f.Seek(end, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return tw, nil
+}
+
+// WithBlockSize replaces the encoded size after which a new block is started.
+// Smaller blocks make searching by time faster and larger blocks compress better.
+// Defaults to DefaultTickBlockSize.
+func (w *TickWriter) WithBlockSize(size int) *TickWriter {
+	if size <= 0 {
+		size = DefaultTickBlockSize
+	}
+	w.blockSize = size
+	return w
+}
+
+// WriteStreamPrice writes a price of the pricing stream. Heartbeats are skipped.
+func (w *TickWriter) WriteStreamPrice(price *model.StreamClientPrice) error {
+	if w.closed {
+		return ErrTickWriterClosed
+	}
+	if price.IsHeartbeat {
+		return nil
+	}
+	if err := w.tick.fromStreamPrice(price); err != nil {
+		return err
+	}
+	return w.write()
+}
+
+// WriteClientPrice writes a price of the pricing endpoint. Prices are read back with
+// the largest number of decimal places within the price.
+func (w *TickWriter) WriteClientPrice(price *model.ClientPrice) error {
+	if w.closed {
+		return ErrTickWriterClosed
+	}
+	if err := w.tick.fromClientPrice(price); err != nil {
+		return err
+	}
+	return w.write()
+}
+
+func (w *TickWriter) write() error {
+	w.encoder.encode(&w.tick)
+	if len(w.encoder.buf) >= w.blockSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush writes the buffered prices as a block.
+func (w *TickWriter) Flush() error {
+	if w.closed {
+		return ErrTickWriterClosed
+	}
+	if w.encoder.count == 0 {
+		return nil
+	}
+	b := w.encoder.block()
+	if w.header {
+		b = append([]byte(tickFileMagic), b...)
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	w.header = false
+	w.encoder.reset()
+	return nil
+}
+
+// Close flushes the buffered prices. The file is closed if the writer was opened
+// with OpenTickWriter.
+func (w *TickWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	err := w.Flush()
+	w.closed = true
+	if w.f != nil {
+		if err == nil {
+			err = w.f.Sync()
+		}
+		if closeErr := w.f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// TickReader reads the prices of a tick file in order.
+type TickReader struct {
+	r       *bufio.Reader
+	header  bool
+	from    int64
+	payload []byte
+	decoder tickDecoder
+	tick    tick
+	err     error
+}
+
+// NewTickReader reads a tick file from r. A torn block at the end is ignored.
+func NewTickReader(r io.Reader) *TickReader {
+	return &TickReader{
+		r:      bufio.NewReaderSize(r, 64*1024),
+		header: true,
+		from:   math.MinInt64,
+	}
+}
+
+// ReadStreamPrice reads the next price into price, reusing its buffers. It returns
+// io.EOF after the last price.
+func (r *TickReader) ReadStreamPrice(price *model.StreamClientPrice) error {
+	if err := r.next(); err != nil {
+		return err
+	}
+	r.tick.toStreamPrice(price)
+	return nil
+}
+
+// ReadClientPrice reads the next price into price. It returns io.EOF after the last
+// price.
+func (r *TickReader) ReadClientPrice(price *model.ClientPrice) error {
+	if err := r.next(); err != nil {
+		return err
+	}
+	r.tick.toClientPrice(price)
+	return nil
+}
+
+func (r *TickReader) next() error {
+	for r.err == nil {
+		if r.decoder.remaining == 0 {
+			r.err = r.block()
+			continue
+		}
+		if r.err = r.decoder.decode(&r.tick); r.err == nil && r.tick.time >= r.from {
+			return nil
+		}
+	}
+	return r.err
+}
+
+func (r *TickReader) block() error {
+	if r.header {
+		magic := make([]byte, len(tickFileMagic))
+		if _, err := io.ReadFull(r.r, magic); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return ErrTickFileCorrupt
+			}
+			return err
+		}
+		if string(magic) != tickFileMagic {
+			return ErrTickFileCorrupt
+		}
+		r.header = false
+	}
+	var header [tickBlockHeaderSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			// Torn write
+			return io.EOF
+		}
+		return err
+	}
+	size := binary.LittleEndian.Uint32(header[:])
+	if size > tickMaxBlockSize {
+		return ErrTickFileCorrupt
+	}
+	if cap(r.payload) < int(size) {
+		r.payload = make([]byte, size)
+	}
+	r.payload = r.payload[:size]
+	if _, err := io.ReadFull(r.r, r.payload); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return io.EOF
+		}
+		return err
+	}
+	if crc32.Checksum(r.payload, txLogCRCTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return ErrTickFileCorrupt
+	}
+	r.decoder.reset(r.payload, int(binary.LittleEndian.Uint32(header[8:])), int64(binary.LittleEndian.Uint64(header[12:])))
+	return nil
+}
+
+type tickBlock struct {
+	offset int64
+	count  int
+	first  int64
+	last   int64
+}
+
+// readTickIndex reads the block headers of a tick file. It returns the end of the
+// last complete block, which is zero for an empty file.
+func readTickIndex(f *os.File) ([]tickBlock, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() == 0 {
+		return nil, 0, nil
+	}
+	magic := make([]byte, len(tickFileMagic))
+	if _, err = f.ReadAt(magic, 0); err != nil || string(magic) != tickFileMagic {
+		return nil, 0, ErrTickFileCorrupt
+	}
+	var (
+		blocks []tickBlock
+		header [tickBlockHeaderSize]byte
+		offset = int64(len(tickFileMagic))
+	)
+	for offset+tickBlockHeaderSize <= info.Size() {
+		if _, err = f.ReadAt(header[:], offset); err != nil {
+			return nil, 0, err
+		}
+		size := int64(binary.LittleEndian.Uint32(header[:]))
+		if size > tickMaxBlockSize {
+			return nil, 0, ErrTickFileCorrupt
+		}
+		end := offset + tickBlockHeaderSize + size
+		if end > info.Size() {
+			break
+		}
+		blocks = append(blocks, tickBlock{
+			offset: offset,
+			count:  int(binary.LittleEndian.Uint32(header[8:])),
+			first:  int64(binary.LittleEndian.Uint64(header[12:])),
+			last:   int64(binary.LittleEndian.Uint64(header[20:])),
+		})
+		offset = end
+	}
+	return blocks, offset, nil
+}
+
+// TickFile gives random access by time to a tick file.
+type TickFile struct {
+	f      *os.File
+	blocks []tickBlock
+	end    int64
+	count  int
+}
+
+// OpenTickFile opens the tick file at path for reading. Blocks written after the
+// file was opened are not visible.
+func OpenTickFile(path string) (*TickFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	blocks, end, err := readTickIndex(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	tf := &TickFile{f: f, blocks: blocks, end: end}
+	for _, b := range blocks {
+		tf.count += b.count
+	}
+	return tf, nil
+}
+
+// The number of stored prices.
+func (f *TickFile) Len() int {
+	return f.count
+}
+
+// The time of the first stored price or zero if the file is empty.
+func (f *TickFile) First() time.Time {
+	if len(f.blocks) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, f.blocks[0].first).UTC()
+}
+
+// The time of the latest stored price or zero if the file is empty.
+func (f *TickFile) Last() time.Time {
+	if len(f.blocks) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, f.blocks[len(f.blocks)-1].last).UTC()
+}
+
+// Reader returns a reader of the prices at or after from. Only the block containing
+// from is decoded to find the first price.
+func (f *TickFile) Reader(from time.Time) *TickReader {
+	ns := int64(math.MinInt64)
+	if !from.IsZero() {
+		ns = from.UnixNano()
+	}
+	i := sort.Search(len(f.blocks), func(i int) bool {
+		return f.blocks[i].last >= ns
+	})
+	offset := f.end
+	if i < len(f.blocks) {
+		offset = f.blocks[i].offset
+	}
+	r := NewTickReader(io.NewSectionReader(f.f, offset, f.end-offset))
+	r.header = false
+	r.from = ns
+	return r
+}
+
+func (f *TickFile) Close() error {
+	return f.f.Close()
+}
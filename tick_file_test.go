@@ -0,0 +1,188 @@
+package oanda
+
+import (
+	"bytes"
+	"github.com/kamaiu/oanda-go/model"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTickRoundTrip(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	prices := []*model.StreamClientPrice{
+		{
+			Instrument:  []byte("EUR_USD"),
+			Time:        start,
+			Bids:        []model.StreamPriceBucket{{Price: 1.20512, Liquidity: 1000000}, {Price: 1.20511, Liquidity: 2000000}},
+			Asks:        []model.StreamPriceBucket{{Price: 1.20524, Liquidity: 1000000}, {Price: 1.20526, Liquidity: 5000000}},
+			CloseoutBid: 1.20497,
+			CloseoutAsk: 1.20539,
+			Tradeable:   true,
+		},
+		{IsHeartbeat: true, Time: start},
+		{
+			Instrument: []byte("USD_JPY"),
+			Time:       start.Add(time.Millisecond),
+			Bids:       []model.StreamPriceBucket{{Price: 108.123, Liquidity: 250000}},
+			Asks:       []model.StreamPriceBucket{{Price: 108.131, Liquidity: 250000}},
+		},
+		newTestPrice("EUR_USD", start.Add(2*time.Millisecond), 1.2051, 1.20522),
+		// A price without asks
+		{
+			Instrument: []byte("EUR_USD"),
+			Time:       start.Add(3 * time.Millisecond),
+			Bids:       []model.StreamPriceBucket{{Price: 1.2049, Liquidity: 1000000}},
+		},
+	}
+	buf := &bytes.Buffer{}
+	w := NewTickWriter(buf)
+	for _, p := range prices {
+		if err := w.WriteStreamPrice(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteStreamPrice(prices[0]); err != ErrTickWriterClosed {
+		t.Fatalf("expected ErrTickWriterClosed got %v", err)
+	}
+
+	r := NewTickReader(bytes.NewReader(buf.Bytes()))
+	for _, p := range prices {
+		if p.IsHeartbeat {
+			continue
+		}
+		read := &model.StreamClientPrice{}
+		if err := r.ReadStreamPrice(read); err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Asks) == 0 {
+			// Empty and nil ladders are the same
+			read.Asks = nil
+		}
+		if !reflect.DeepEqual(read, p) {
+			t.Fatalf("expected %+v got %+v", p, read)
+		}
+	}
+	if err := r.ReadStreamPrice(&model.StreamClientPrice{}); err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+
+	// Prices that cannot be stored exactly are rejected
+	if err := w.WriteStreamPrice(newTestPrice("EUR_USD", start, 1.0/3, 1)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestTickClientPrice(t *testing.T) {
+	price := &model.ClientPrice{
+		Type:        "PRICE",
+		Instrument:  "EUR_USD",
+		Time:        "2021-03-01T12:00:00.123456789Z",
+		Tradeable:   true,
+		Bids:        []model.PriceBucket{{Price: "1.20510", Liquidity: 1000000}},
+		Asks:        []model.PriceBucket{{Price: "1.20524", Liquidity: 1000000}},
+		CloseoutBid: "1.20497",
+		CloseoutAsk: "1.20539",
+	}
+	buf := &bytes.Buffer{}
+	w := NewTickWriter(buf)
+	if err := w.WriteClientPrice(price); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteClientPrice(&model.ClientPrice{Instrument: "EUR_USD", Time: price.Time, Bids: []model.PriceBucket{{Price: "x"}}}); err != ErrTickPrice {
+		t.Fatalf("expected ErrTickPrice got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewTickReader(buf)
+	read := &model.ClientPrice{}
+	if err := r.ReadClientPrice(read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, price) {
+		t.Fatalf("expected %+v got %+v", price, read)
+	}
+}
+
+func TestTickFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "EUR_USD.ticks")
+	w, err := OpenTickWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WithBlockSize(256)
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	write := func(w *TickWriter, from, to int) {
+		for i := from; i < to; i++ {
+			bid := float64(120000+i%50) / 100000
+			if err := w.WriteStreamPrice(newTestPrice("EUR_USD", start.Add(time.Duration(i)*time.Second), bid, float64(120012+i%50)/100000)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	write(w, 0, 500)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append after a torn write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{1, 2, 3})
+	_ = f.Close()
+	if w, err = OpenTickWriter(path); err != nil {
+		t.Fatal(err)
+	}
+	write(w, 500, 1000)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tf, err := OpenTickFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+	if tf.Len() != 1000 || len(tf.blocks) < 10 {
+		t.Fatalf("expected 1000 prices in many blocks got %d in %d", tf.Len(), len(tf.blocks))
+	}
+	if !tf.First().Equal(start) || !tf.Last().Equal(start.Add(999*time.Second)) {
+		t.Fatalf("unexpected range %v %v", tf.First(), tf.Last())
+	}
+	info, _ := os.Stat(path)
+	if perPrice := info.Size() / 1000; perPrice > 24 {
+		t.Fatalf("expected a compact encoding got %d bytes per price", perPrice)
+	}
+
+	// Random access
+	r := tf.Reader(start.Add(750*time.Second + time.Millisecond))
+	price := &model.StreamClientPrice{}
+	count := 0
+	for ; ; count++ {
+		if err = r.ReadStreamPrice(price); err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count == 0 && !price.Time.Equal(start.Add(751*time.Second)) {
+			t.Fatalf("expected the price after 750s got %v", price.Time)
+		}
+	}
+	if count != 249 {
+		t.Fatalf("expected 249 prices got %d", count)
+	}
+	if err = tf.Reader(start.Add(time.Hour)).ReadStreamPrice(price); err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+}
@@ -1,17 +1,605 @@
 package oanda
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/kamaiu/oanda-go/endpoint"
 	"github.com/kamaiu/oanda-go/model"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 )
 
+const (
+	txLogExt = ".txlog"
+	// File header: magic (4) + crc (4) + the highest truncated id (8)
+	txLogFileHeaderSize = 16
+	txLogMagic          = "OTXL"
+	// Frame header: size (4) + crc (4) + id (8) + time (8)
+	txLogHeaderSize = 24
+	// Upper bound of a single record. Anything larger is treated as corruption.
+	txLogMaxRecordSize = 1024 * 1024 * 4
+	// The number of transactions requested per idrange page during Sync.
+	txLogSyncPageSize = 1000
+)
+
+var (
+	ErrTxNotFound     = errors.New("transaction not found")
+	ErrTxLogClosed    = errors.New("transaction log closed")
+	ErrInvalidTxID    = errors.New("invalid transaction id")
+	ErrTxWrongAccount = errors.New("transaction belongs to a different account")
+	ErrTxLogInvalid   = errors.New("invalid transaction log header")
+
+	txLogCRCTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type txLogEntry struct {
+	id     uint64
+	time   int64
+	offset int64
+	size   uint32
+}
+
+// TxLog is an append-only on-disk journal of the transactions of a single Account.
+//
+// Each record is framed with its size, a CRC32 checksum, the TransactionID and the
+// transaction time. A record is only considered written once the frame is complete
+// and the checksum matches, so a torn write caused by a crash is discarded the next
+// time the log is opened.
+//
+// The file starts with a header holding the highest TransactionID removed by
+// Truncate, so a log truncated down to nothing still knows where it left off.
 type TxLog struct {
 	accountID model.AccountID
 	first     model.TransactionID
 	last      model.TransactionID
+	floor     uint64
+	path      string
+	f         *os.File
+	size      int64
+	index     []txLogEntry
+	closed    bool
+	mu        sync.RWMutex
+}
+
+// OpenTxLog opens or creates the transaction log of an Account within dir.
+// Any incomplete record at the tail of the file is truncated.
+func OpenTxLog(dir string, accountID model.AccountID) (*TxLog, error) {
+	if len(accountID) == 0 {
+		return nil, errors.New("account id required")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, string(accountID)+txLogExt)
+	// A temp file left behind by an interrupted Truncate was never renamed
+	// into place, so the original log is still intact.
+	_ = os.Remove(path + ".tmp")
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	t := &TxLog{
+		accountID: accountID,
+		path:      path,
+		f:         f,
+	}
+	if err = t.recover(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// recover reads the file header, rebuilds the in-memory index and discards a torn
+// tail.
+func (t *TxLog) recover() error {
+	if err := t.readFileHeader(); err != nil {
+		return err
+	}
+	if _, err := t.f.Seek(txLogFileHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	var (
+		rd     = bufio.NewReaderSize(t.f, 1024*64)
+		header [txLogHeaderSize]byte
+		body   []byte
+		offset int64 = txLogFileHeaderSize
+	)
+	t.index = t.index[:0]
+	for {
+		if _, err := io.ReadFull(rd, header[:]); err != nil {
+			break
+		}
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > txLogMaxRecordSize {
+			break
+		}
+		if cap(body) < int(size) {
+			body = make([]byte, size)
+		}
+		body = body[:size]
+		if _, err := io.ReadFull(rd, body); err != nil {
+			break
+		}
+		crc := crc32.Update(0, txLogCRCTable, header[8:])
+		crc = crc32.Update(crc, txLogCRCTable, body)
+		if crc != binary.LittleEndian.Uint32(header[4:8]) {
+			break
+		}
+		id := binary.LittleEndian.Uint64(header[8:16])
+		if n := len(t.index); id <= t.floor || n > 0 && id <= t.index[n-1].id {
+			break
+		}
+		t.index = append(t.index, txLogEntry{
+			id:     id,
+			time:   int64(binary.LittleEndian.Uint64(header[16:24])),
+			offset: offset,
+			size:   size,
+		})
+		offset += txLogHeaderSize + int64(size)
+	}
+
+	stat, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() != offset {
+		if err = t.f.Truncate(offset); err != nil {
+			return err
+		}
+		if err = t.f.Sync(); err != nil {
+			return err
+		}
+	}
+	t.size = offset
+	t.updateBounds()
+	return nil
+}
+
+// readFileHeader reads the truncation floor. A file too short to hold the header
+// was torn while it was created and is given a new one.
+func (t *TxLog) readFileHeader() error {
+	var header [txLogFileHeaderSize]byte
+	if _, err := t.f.ReadAt(header[:], 0); err != nil {
+		if err != io.EOF {
+			return err
+		}
+		t.floor = 0
+		return writeTxLogHeader(t.f, 0)
+	}
+	if string(header[0:4]) != txLogMagic ||
+		crc32.Checksum(header[8:], txLogCRCTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return ErrTxLogInvalid
+	}
+	t.floor = binary.LittleEndian.Uint64(header[8:16])
+	return nil
+}
+
+// writeTxLogHeader writes the file header with the truncation floor to f and syncs
+// it. Any records in f are dropped.
+func writeTxLogHeader(f *os.File, floor uint64) error {
+	var header [txLogFileHeaderSize]byte
+	copy(header[0:4], txLogMagic)
+	binary.LittleEndian.PutUint64(header[8:16], floor)
+	binary.LittleEndian.PutUint32(header[4:8], crc32.Checksum(header[8:], txLogCRCTable))
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(header[:], 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (t *TxLog) updateBounds() {
+	if len(t.index) == 0 {
+		t.first = ""
+		t.last = ""
+		return
+	}
+	t.first = formatTxID(t.index[0].id)
+	t.last = formatTxID(t.index[len(t.index)-1].id)
+}
+
+func (t *TxLog) AccountID() model.AccountID {
+	return t.accountID
+}
+
+// The TransactionID of the oldest record in the log or empty if the log is empty.
+func (t *TxLog) First() model.TransactionID {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.first
+}
+
+// The TransactionID of the newest record in the log or empty if the log is empty.
+func (t *TxLog) Last() model.TransactionID {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.last
+}
+
+// lastID returns the ID of the newest record, or of the newest truncated record if
+// the log is empty.
+func (t *TxLog) lastID() uint64 {
+	if len(t.index) > 0 {
+		return t.index[len(t.index)-1].id
+	}
+	return t.floor
+}
+
+// The number of records in the log.
+func (t *TxLog) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.index)
+}
+
+// Append writes the transactions to the log and syncs the file before returning.
+// Transactions with an ID not greater than the last ID in the log, or the last
+// truncated one, are skipped, which makes appending an overlapping batch harmless.
+func (t *TxLog) Append(messages ...model.TransactionMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTxLogClosed
+	}
+
+	var (
+		last    = t.lastID()
+		buf     []byte
+		entries = make([]txLogEntry, 0, len(messages))
+		offset  = t.size
+	)
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		tx := msg.Get()
+		if len(tx.AccountID) > 0 && tx.AccountID != t.accountID {
+			return ErrTxWrongAccount
+		}
+		id, err := parseTxID(tx.Id)
+		if err != nil {
+			return err
+		}
+		if id <= last {
+			continue
+		}
+		tm, err := tx.Time.Parse()
+		if err != nil {
+			return err
+		}
+		body, err := msg.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if len(body) > txLogMaxRecordSize {
+			return errors.New("transaction record too big")
+		}
+
+		var header [txLogHeaderSize]byte
+		binary.LittleEndian.PutUint32(header[0:4], uint32(len(body)))
+		binary.LittleEndian.PutUint64(header[8:16], id)
+		binary.LittleEndian.PutUint64(header[16:24], uint64(tm.UnixNano()))
+		crc := crc32.Update(0, txLogCRCTable, header[8:])
+		crc = crc32.Update(crc, txLogCRCTable, body)
+		binary.LittleEndian.PutUint32(header[4:8], crc)
+
+		buf = append(buf, header[:]...)
+		buf = append(buf, body...)
+		entries = append(entries, txLogEntry{
+			id:     id,
+			time:   tm.UnixNano(),
+			offset: offset,
+			size:   uint32(len(body)),
+		})
+		offset += txLogHeaderSize + int64(len(body))
+		last = id
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if _, err := t.f.WriteAt(buf, t.size); err != nil {
+		// Roll back the partial write so the file stays consistent with the index.
+		_ = t.f.Truncate(t.size)
+		return err
+	}
+	if err := t.f.Sync(); err != nil {
+		_ = t.f.Truncate(t.size)
+		return err
+	}
+	t.size = offset
+	t.index = append(t.index, entries...)
+	t.updateBounds()
+	return nil
+}
+
+// Get the transaction with the supplied TransactionID.
+func (t *TxLog) Get(id model.TransactionID) (model.TransactionMessage, error) {
+	n, err := parseTxID(id)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return nil, ErrTxLogClosed
+	}
+	i := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].id >= n
+	})
+	if i == len(t.index) || t.index[i].id != n {
+		return nil, ErrTxNotFound
+	}
+	return t.read(t.index[i])
+}
+
+// Range returns the transactions with an ID between from and to (both inclusive).
+// An empty from starts at the first record and an empty to ends at the last record.
+func (t *TxLog) Range(from, to model.TransactionID) ([]model.TransactionMessage, error) {
+	var (
+		lo  uint64
+		hi  uint64 = 1<<64 - 1
+		err error
+	)
+	if len(from) > 0 {
+		if lo, err = parseTxID(from); err != nil {
+			return nil, err
+		}
+	}
+	if len(to) > 0 {
+		if hi, err = parseTxID(to); err != nil {
+			return nil, err
+		}
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return nil, ErrTxLogClosed
+	}
+	start := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].id >= lo
+	})
+	end := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].id > hi
+	})
+	return t.readAll(start, end)
+}
+
+// RangeTime returns the transactions created within [from, to). A zero from starts
+// at the first record and a zero to ends at the last record.
+func (t *TxLog) RangeTime(from, to time.Time) ([]model.TransactionMessage, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return nil, ErrTxLogClosed
+	}
+	start, end := 0, len(t.index)
+	if !from.IsZero() {
+		lo := from.UnixNano()
+		start = sort.Search(len(t.index), func(i int) bool {
+			return t.index[i].time >= lo
+		})
+	}
+	if !to.IsZero() {
+		hi := to.UnixNano()
+		end = sort.Search(len(t.index), func(i int) bool {
+			return t.index[i].time >= hi
+		})
+	}
+	return t.readAll(start, end)
+}
+
+func (t *TxLog) readAll(start, end int) ([]model.TransactionMessage, error) {
+	if start >= end {
+		return nil, nil
+	}
+	result := make([]model.TransactionMessage, 0, end-start)
+	for _, entry := range t.index[start:end] {
+		msg, err := t.read(entry)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+func (t *TxLog) read(entry txLogEntry) (model.TransactionMessage, error) {
+	body := make([]byte, entry.size)
+	if _, err := t.f.ReadAt(body, entry.offset+txLogHeaderSize); err != nil {
+		return nil, err
+	}
+	parser := &model.TransactionParser{}
+	if err := parser.UnmarshalJSON(body); err != nil {
+		return nil, err
+	}
+	return parser.Parse(), nil
 }
 
 // Truncate the log from the first record up to and including the record closest
 // to or inclusive of but not greater than the last TransactionID supplied.
-func (t *TxLog) Truncate(last model.TransactionID) {
+//
+// The remaining records are written to a temporary file which then atomically
+// replaces the log, so a crash during Truncate leaves either the old or the new
+// log in place. The ID of the last record removed is kept in the file header, so
+// Sync and Append continue after it even if no record is left.
+func (t *TxLog) Truncate(last model.TransactionID) error {
+	n, err := parseTxID(last)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTxLogClosed
+	}
+	k := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].id > n
+	})
+	if k == 0 {
+		return nil
+	}
+
+	var shift int64
+	if k < len(t.index) {
+		shift = t.index[k].offset
+	} else {
+		shift = t.size
+	}
+	floor := t.floor
+	if id := t.index[k-1].id; id > floor {
+		floor = id
+	}
+
+	tmpPath := t.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = writeTxLogHeader(tmp, floor); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if _, err = tmp.Seek(txLogFileHeaderSize, io.SeekStart); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if _, err = io.Copy(tmp, io.NewSectionReader(t.f, shift, t.size-shift)); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, t.path); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(t.path))
+
+	_ = t.f.Close()
+	t.f = tmp
+	remaining := make([]txLogEntry, len(t.index)-k)
+	copy(remaining, t.index[k:])
+	for i := range remaining {
+		remaining[i].offset += txLogFileHeaderSize - shift
+	}
+	t.index = remaining
+	t.size += txLogFileHeaderSize - shift
+	t.floor = floor
+	t.updateBounds()
+	return nil
+}
+
+// Sync pulls every transaction newer than the last record in the log, or the last
+// truncated one, and appends them. Progress is persisted page by page, so an
+// interrupted Sync resumes where it stopped. Returns the number of transactions
+// appended.
+func (t *TxLog) Sync(conn endpoint.TransactionsAPI) (int, error) {
+	count := 0
+	t.mu.RLock()
+	since := t.lastID()
+	t.mu.RUnlock()
+	resp, err := conn.TransactionsSinceID(t.accountID, model.NewTransactionsSinceIDRequest(formatTxID(since)))
+	if err != nil {
+		return count, err
+	}
+	n, err := t.appendParsed(resp.Transactions)
+	count += n
+	if err != nil {
+		return count, err
+	}
+
+	head, err := parseTxID(resp.LastTransactionID)
+	if err != nil {
+		return count, err
+	}
+	t.mu.RLock()
+	cursor := t.lastID()
+	t.mu.RUnlock()
+	// sinceid results are capped, page through whatever is left with idrange.
+	for cursor < head {
+		from := cursor + 1
+		to := from + txLogSyncPageSize - 1
+		if to > head {
+			to = head
+		}
+		page, err := conn.TransactionsIDRange(t.accountID, model.NewTransactionsIDRangeRequest(
+			formatTxID(from), formatTxID(to),
+		))
+		if err != nil {
+			return count, err
+		}
+		n, err = t.appendParsed(page.Transactions)
+		count += n
+		if err != nil {
+			return count, err
+		}
+		cursor = to
+	}
+	return count, nil
+}
+
+func (t *TxLog) appendParsed(transactions []*model.TransactionParser) (int, error) {
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+	before := t.Len()
+	messages := make([]model.TransactionMessage, 0, len(transactions))
+	for _, tx := range transactions {
+		if tx != nil {
+			messages = append(messages, tx.Parse())
+		}
+	}
+	err := t.Append(messages...)
+	return t.Len() - before, err
+}
+
+// Close the underlying file. Further calls return ErrTxLogClosed.
+func (t *TxLog) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	return t.f.Close()
+}
+
+func parseTxID(id model.TransactionID) (uint64, error) {
+	n, err := strconv.ParseUint(string(id), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidTxID
+	}
+	return n, nil
+}
+
+func formatTxID(id uint64) model.TransactionID {
+	return model.TransactionID(strconv.FormatUint(id, 10))
+}
 
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
 }
@@ -0,0 +1,181 @@
+package oanda
+
+import (
+	"github.com/kamaiu/oanda-go/model"
+	"github.com/kamaiu/oanda-go/oandatest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFill(id model.TransactionID, t time.Time) *model.OrderFillTransaction {
+	return &model.OrderFillTransaction{
+		Transaction: model.Transaction{
+			Id:        id,
+			Time:      model.DateTime(t.UTC().Format(time.RFC3339Nano)),
+			AccountID: "101-001-1-001",
+		},
+		Type:       "ORDER_FILL",
+		OrderID:    "1",
+		Instrument: "EUR_USD",
+		Units:      "100",
+		Pl:         "1.5",
+	}
+}
+
+func TestTxLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log, err := OpenTxLog(dir, "101-001-1-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 10; i++ {
+		err = log.Append(newTestFill(formatTxID(uint64(i)), start.Add(time.Duration(i)*time.Minute)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Overlapping records are skipped
+	if err = log.Append(newTestFill("5", start)); err != nil {
+		t.Fatal(err)
+	}
+	if log.Len() != 10 || log.First() != "1" || log.Last() != "10" {
+		t.Fatalf("unexpected bounds %s..%s (%d)", log.First(), log.Last(), log.Len())
+	}
+
+	msg, err := log.Get("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill, ok := msg.(*model.OrderFillTransaction)
+	if !ok {
+		t.Fatalf("expected *OrderFillTransaction got %T", msg)
+	}
+	if fill.Id != "7" || fill.Instrument != "EUR_USD" || fill.Pl != "1.5" {
+		t.Fatal("record did not round trip")
+	}
+	if _, err = log.Get("11"); err != ErrTxNotFound {
+		t.Fatal("expected ErrTxNotFound")
+	}
+
+	r, err := log.Range("3", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 3 || r[0].Get().Id != "3" || r[2].Get().Id != "5" {
+		t.Fatal("unexpected id range")
+	}
+	r, err = log.RangeTime(start.Add(2*time.Minute), start.Add(4*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[0].Get().Id != "2" || r[1].Get().Id != "3" {
+		t.Fatal("unexpected time range")
+	}
+
+	if err = log.Truncate("4"); err != nil {
+		t.Fatal(err)
+	}
+	if log.First() != "5" || log.Len() != 6 {
+		t.Fatalf("unexpected first after truncate %s", log.First())
+	}
+	if msg, err = log.Get("9"); err != nil || msg.Get().Id != "9" {
+		t.Fatal("record lost after truncate")
+	}
+	if err = log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a torn write at the tail
+	path := filepath.Join(dir, "101-001-1-001"+txLogExt)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{200, 0, 0, 0, 1, 2, 3})
+	_ = f.Close()
+
+	log, err = OpenTxLog(dir, "101-001-1-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if log.First() != "5" || log.Last() != "10" {
+		t.Fatalf("unexpected bounds after recovery %s..%s", log.First(), log.Last())
+	}
+	if err = log.Append(newTestFill("11", start.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = log.Get("11"); err != nil || msg.Get().Id != "11" {
+		t.Fatal("append after recovery failed")
+	}
+}
+
+func TestTxLogTruncateAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, conn := newTestServer(t, 10000, oandatest.Tick{Instrument: "EUR_USD", Bid: 1.1, Ask: 1.1002})
+	account := oandatest.TestAccount
+	order := func() {
+		t.Helper()
+		if _, _, err := conn.OrderCreate(account, &model.MarketOrderRequest{
+			Type:        model.OrderType_MARKET,
+			Instrument:  "EUR_USD",
+			Units:       "100",
+			TimeInForce: model.TimeInForce_FOK,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	order()
+	log, err := OpenTxLog(dir, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = log.Sync(conn); err != nil {
+		t.Fatal(err)
+	}
+	last := log.Last()
+	if err = log.Truncate(last); err != nil {
+		t.Fatal(err)
+	}
+	if log.Len() != 0 {
+		t.Fatalf("expected an empty log got %d", log.Len())
+	}
+	// Old transactions are neither appended nor synced again, also after reopening
+	if err = log.Append(newTestFill(last, time.Now())); err != nil || log.Len() != 0 {
+		t.Fatalf("truncated transaction appended %v", err)
+	}
+	if err = log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if log, err = OpenTxLog(dir, account); err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if n, err := log.Sync(conn); err != nil || n != 0 {
+		t.Fatalf("expected nothing to sync got %d %v", n, err)
+	}
+
+	order()
+	n, err := log.Sync(conn)
+	if err != nil || n == 0 {
+		t.Fatalf("expected new transactions got %d %v", n, err)
+	}
+	first, _ := parseTxID(log.First())
+	if truncated, _ := parseTxID(last); first != truncated+1 {
+		t.Fatalf("expected sync to resume after %s got %s", last, log.First())
+	}
+}